@@ -0,0 +1,60 @@
+// Команда fakespeller запускает локальный заменитель Яндекс.Спеллер API (см. пакет spellertest)
+// для разработки и тестов без доступа к интернету. Адрес заменителя передается приложению
+// через SPELLER_URL, например SPELLER_URL=http://localhost:8081.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/NickolaiP/notes_app/backend/internal/spellertest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "адрес, на котором принимаются запросы")
+	rulesFile := flag.String("rules", "", "файл правил: строки вида \"слово -> вариант1, вариант2 [код]\"")
+	dictFile := flag.String("dict", "", "словарь: по одному известному слову в строке; неизвестные слова считаются ошибками")
+	latency := flag.Duration("latency", 0, "задержка каждого ответа")
+	errorRate := flag.Float64("error-rate", 0, "доля запросов, на которые отвечается ошибкой (от 0 до 1)")
+	errorStatus := flag.Int("error-status", http.StatusServiceUnavailable, "код ответа для ошибок")
+	malformedRate := flag.Float64("malformed-rate", 0, "доля запросов, на которые отвечается некорректным JSON")
+	flag.Parse()
+
+	var rules []spellertest.Rule
+	if *rulesFile != "" {
+		f, err := os.Open(*rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules, err = spellertest.LoadRules(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *rulesFile, err)
+		}
+	}
+	var dictionary []string
+	if *dictFile != "" {
+		f, err := os.Open(*dictFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dictionary, err = spellertest.LoadDictionary(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *dictFile, err)
+		}
+	}
+
+	speller := spellertest.New(rules, dictionary)
+	speller.SetFaults(spellertest.Faults{
+		Latency:       *latency,
+		ErrorRate:     *errorRate,
+		ErrorStatus:   *errorStatus,
+		MalformedRate: *malformedRate,
+	})
+
+	log.Printf("Fake speller listening on %s (%d rules, %d dictionary words)", *addr, len(rules), len(dictionary))
+	log.Fatal(http.ListenAndServe(*addr, speller))
+}
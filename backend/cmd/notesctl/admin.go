@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/admin"
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/hand"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+)
+
+// adminCommand - подкоманда notesctl admin. setup регистрирует флаги команды и возвращает
+// функцию, которая выполняет ее после разбора аргументов.
+type adminCommand struct {
+	name    string
+	args    string
+	summary string
+	// user - команде нужно ровно одно имя пользователя после флагов.
+	user  bool
+	setup func(fs *flag.FlagSet) func(ctx context.Context, s *admin.Service, args []string) error
+}
+
+var adminCommands = []adminCommand{
+	{name: "list", args: "[-q text] [-disabled true|false] [-admins] [-limit n] [-offset n] [-json]",
+		summary: "список пользователей с числом заметок и занятым местом", setup: listUsers},
+	{name: "show", args: "[-json] <username>", summary: "сведения о пользователе", user: true, setup: showUser},
+	{name: "disable", args: "[-reason text] <username>", summary: "заблокировать учетную запись", user: true, setup: disableUser},
+	{name: "enable", args: "<username>", summary: "снять блокировку", user: true, setup: enableUser},
+	{name: "reset-password", args: "<username>", summary: "потребовать смену пароля и отправить письмо для сброса",
+		user: true, setup: resetPassword},
+	{name: "revoke-sessions", args: "[-api-tokens] <username>", summary: "завершить все сессии пользователя",
+		user: true, setup: revokeSessions},
+	{name: "grant", args: "<username>", summary: "назначить администратором", user: true, setup: setAdmin(true)},
+	{name: "revoke", args: "<username>", summary: "снять назначение администратором", user: true, setup: setAdmin(false)},
+	{name: "log", args: "[-user username] [-limit n] [-json]", summary: "журнал действий администраторов", setup: actionLog},
+}
+
+// runAdmin выполняет notesctl admin с аргументами args и возвращает код завершения.
+func runAdmin(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		adminUsage(os.Stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	var cmd *adminCommand
+	for i := range adminCommands {
+		if adminCommands[i].name == args[0] {
+			cmd = &adminCommands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "notesctl admin: unknown command %q\n", args[0])
+		adminUsage(os.Stderr)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("notesctl admin "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: notesctl admin %s %s\n", cmd.name, cmd.args)
+		fs.PrintDefaults()
+	}
+	run := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if (cmd.user && fs.NArg() != 1) || (!cmd.user && fs.NArg() != 0) {
+		fs.Usage()
+		return 2
+	}
+
+	cfg := config.LoadConfig()
+	db, err := database.NewPostgresDB(cfg.DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "notesctl: connect to database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	// Очередь не запускается: письма для сброса пароля только ставятся в нее и отправляются сервером.
+	queue := jobs.NewQueue(db, cfg.Jobs, logger.InitLogger(os.Stderr))
+	service := admin.New(db, func(ctx context.Context, email string) error {
+		return hand.EnqueuePasswordReset(ctx, queue, email)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := run(ctx, service, fs.Args()); err != nil {
+		if errors.Is(err, admin.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "notesctl: user %q not found\n", fs.Arg(0))
+		} else {
+			fmt.Fprintln(os.Stderr, "notesctl:", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func adminUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: notesctl admin <command> [flags] [username]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range adminCommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	tw.Flush()
+}
+
+func listUsers(fs *flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	query := fs.String("q", "", "часть имени пользователя или email")
+	disabled := fs.String("disabled", "", "true - только заблокированные, false - только активные")
+	admins := fs.Bool("admins", false, "только администраторы")
+	limit := fs.Int("limit", admin.DefaultLimit, "число пользователей (не больше "+strconv.Itoa(admin.MaxLimit)+")")
+	offset := fs.Int("offset", 0, "сколько пользователей пропустить")
+	asJSON := fs.Bool("json", false, "вывести в формате JSON")
+	return func(ctx context.Context, s *admin.Service, _ []string) error {
+		f := admin.Filter{Query: *query, Admins: *admins, Limit: *limit, Offset: *offset}
+		if *disabled != "" {
+			v, err := strconv.ParseBool(*disabled)
+			if err != nil {
+				return fmt.Errorf("invalid -disabled %q", *disabled)
+			}
+			f.Disabled = &v
+		}
+		users, err := s.Users(ctx, f)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(users)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tSTATUS\tNOTES\tTRASH\tSTORAGE\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", u.ID, u.Username, u.Email, status(u),
+				u.Notes, u.DeletedNotes, formatBytes(u.NotesBytes+u.AttachmentBytes), u.CreatedAt.Format("2006-01-02"))
+		}
+		return tw.Flush()
+	}
+}
+
+func showUser(fs *flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	asJSON := fs.Bool("json", false, "вывести в формате JSON")
+	return func(ctx context.Context, s *admin.Service, args []string) error {
+		u, err := s.User(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(u)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "ID:\t%d\n", u.ID)
+		fmt.Fprintf(tw, "Username:\t%s\n", u.Username)
+		fmt.Fprintf(tw, "Email:\t%s (verified: %t)\n", u.Email, u.EmailVerified)
+		fmt.Fprintf(tw, "Status:\t%s\n", status(u))
+		if u.DisabledAt != nil {
+			fmt.Fprintf(tw, "Disabled:\t%s %s\n", u.DisabledAt.Format(time.RFC3339), u.DisabledReason)
+		}
+		if u.SessionsRevokedAt != nil {
+			fmt.Fprintf(tw, "Sessions revoked:\t%s\n", u.SessionsRevokedAt.Format(time.RFC3339))
+		}
+		fmt.Fprintf(tw, "Two-factor:\t%t\n", u.TwoFactorEnabled)
+		fmt.Fprintf(tw, "Notes:\t%d (in trash: %d)\n", u.Notes, u.DeletedNotes)
+		fmt.Fprintf(tw, "Storage:\t%s notes, %s attachments\n", formatBytes(u.NotesBytes), formatBytes(u.AttachmentBytes))
+		fmt.Fprintf(tw, "API tokens:\t%d\n", u.APITokens)
+		fmt.Fprintf(tw, "Created:\t%s\n", u.CreatedAt.Format(time.RFC3339))
+		return tw.Flush()
+	}
+}
+
+func disableUser(fs *flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	reason := fs.String("reason", "", "причина блокировки")
+	return func(ctx context.Context, s *admin.Service, args []string) error {
+		if err := s.Disable(ctx, actor(), args[0], *reason); err != nil {
+			return err
+		}
+		fmt.Printf("User %s disabled\n", args[0])
+		return nil
+	}
+}
+
+func enableUser(*flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	return func(ctx context.Context, s *admin.Service, args []string) error {
+		if err := s.Enable(ctx, actor(), args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("User %s enabled\n", args[0])
+		return nil
+	}
+}
+
+func resetPassword(*flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	return func(ctx context.Context, s *admin.Service, args []string) error {
+		mailed, err := s.RequirePasswordReset(ctx, actor(), args[0])
+		if err != nil {
+			return err
+		}
+		if mailed {
+			fmt.Printf("Password reset required for %s, reset email queued\n", args[0])
+		} else {
+			fmt.Printf("Password reset required for %s; the user has no email, send a reset link another way\n", args[0])
+		}
+		return nil
+	}
+}
+
+func revokeSessions(fs *flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	apiTokens := fs.Bool("api-tokens", false, "также отозвать персональные токены доступа")
+	return func(ctx context.Context, s *admin.Service, args []string) error {
+		if err := s.RevokeSessions(ctx, actor(), args[0], *apiTokens); err != nil {
+			return err
+		}
+		fmt.Printf("Sessions of %s revoked\n", args[0])
+		return nil
+	}
+}
+
+func setAdmin(isAdmin bool) func(*flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	return func(*flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+		return func(ctx context.Context, s *admin.Service, args []string) error {
+			if err := s.SetAdmin(ctx, actor(), args[0], isAdmin); err != nil {
+				return err
+			}
+			if isAdmin {
+				fmt.Printf("User %s is now an admin\n", args[0])
+			} else {
+				fmt.Printf("User %s is no longer an admin\n", args[0])
+			}
+			return nil
+		}
+	}
+}
+
+func actionLog(fs *flag.FlagSet) func(context.Context, *admin.Service, []string) error {
+	username := fs.String("user", "", "только действия над этим пользователем")
+	limit := fs.Int("limit", admin.DefaultLimit, "число записей (не больше "+strconv.Itoa(admin.MaxLimit)+")")
+	asJSON := fs.Bool("json", false, "вывести в формате JSON")
+	return func(ctx context.Context, s *admin.Service, _ []string) error {
+		actions, err := s.Actions(ctx, *username, *limit)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(actions)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tACTOR\tUSERNAME\tACTION\tDETAILS")
+		for _, a := range actions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a.CreatedAt.Format(time.RFC3339), a.Actor, a.Username, a.Action, a.Details)
+		}
+		return tw.Flush()
+	}
+}
+
+// status кратко описывает состояние учетной записи.
+func status(u models.AdminUser) string {
+	var parts []string
+	if u.DisabledAt != nil {
+		parts = append(parts, "disabled")
+	}
+	if u.IsAdmin {
+		parts = append(parts, "admin")
+	}
+	if u.PasswordResetRequired {
+		parts = append(parts, "password-reset")
+	}
+	if len(parts) == 0 {
+		return "active"
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatBytes выводит размер в байтах в удобных единицах.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
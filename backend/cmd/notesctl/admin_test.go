@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+)
+
+func TestStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		user models.AdminUser
+		want string
+	}{
+		{models.AdminUser{}, "active"},
+		{models.AdminUser{IsAdmin: true}, "admin"},
+		{models.AdminUser{DisabledAt: &now}, "disabled"},
+		{models.AdminUser{PasswordResetRequired: true}, "password-reset"},
+		{models.AdminUser{DisabledAt: &now, IsAdmin: true, PasswordResetRequired: true}, "disabled,admin,password-reset"},
+	}
+	for _, tt := range tests {
+		if got := status(tt.user); got != tt.want {
+			t.Errorf("status(%+v) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		10 << 20:        "10.0 MiB",
+		5<<30 + 512<<20: "5.5 GiB",
+		3 << 40:         "3.0 TiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
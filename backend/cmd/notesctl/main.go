@@ -0,0 +1,49 @@
+// Команда notesctl выполняет служебные действия с базой данных приложения напрямую, без API.
+// Настройки подключения берутся из тех же переменных окружения, что и у сервера.
+//
+// Использование:
+//
+//	notesctl admin <команда> [флаги] [пользователь]
+//
+// Список команд выводит notesctl admin help.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "admin":
+		os.Exit(runAdmin(os.Args[2:]))
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "notesctl: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: notesctl admin <command> [flags] [username]")
+	fmt.Fprintln(os.Stderr, "run \"notesctl admin help\" for the list of commands")
+}
+
+// actor возвращает имя, под которым действия notesctl записываются в журнал admin_actions.
+func actor() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return "notesctl:" + name
+}
@@ -0,0 +1,97 @@
+package speller
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без обращения к сервису, пока он считается недоступным.
+// Вызывающий код сохраняет текст без исправлений.
+var ErrCircuitOpen = errors.New("speller: circuit open")
+
+// Состояния автомата защиты.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// breaker - автомат защиты (circuit breaker). После threshold неудачных запросов подряд он
+// размыкается и на cooldown отклоняет запросы, затем пропускает один пробный запрос:
+// его успех замыкает автомат, неудача снова размыкает.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: max(threshold, 1), cooldown: cooldown, state: circuitClosed}
+}
+
+// allow сообщает, можно ли выполнить запрос. Если запрос разрешен, его итог
+// должен быть передан в success или failure.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		// Пока пробный запрос не завершился, остальные отклоняются.
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// cancel освобождает разрешение на пробный запрос, итог которого неизвестен
+// (например, запрос отменил вызывающий код).
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// current возвращает текущее состояние автомата.
+func (b *breaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return circuitHalfOpen
+	}
+	return b.state
+}
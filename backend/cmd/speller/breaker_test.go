@@ -0,0 +1,64 @@
+package speller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := newBreaker(3, cooldown)
+	expect := func(step string, allow bool, state string) {
+		t.Helper()
+		if got := b.allow(); got != allow {
+			t.Fatalf("%s: allow = %v, want %v", step, got, allow)
+		}
+		if got := b.current(); got != state {
+			t.Fatalf("%s: state = %s, want %s", step, got, state)
+		}
+	}
+
+	// Успешный запрос сбрасывает счетчик неудач.
+	for i := 0; i < 2; i++ {
+		expect("failure before threshold", true, circuitClosed)
+		b.failure()
+	}
+	expect("success", true, circuitClosed)
+	b.success()
+	for i := 0; i < 3; i++ {
+		expect("failure", true, circuitClosed)
+		b.failure()
+	}
+	expect("open", false, circuitOpen)
+
+	// После паузы пропускается только один пробный запрос.
+	time.Sleep(cooldown)
+	if got := b.current(); got != circuitHalfOpen {
+		t.Fatalf("state after cooldown = %s, want %s", got, circuitHalfOpen)
+	}
+	expect("probe", true, circuitHalfOpen)
+	expect("concurrent request during probe", false, circuitHalfOpen)
+	// Неудачный пробный запрос снова размыкает автомат.
+	b.failure()
+	expect("failed probe", false, circuitOpen)
+
+	// Отмененный пробный запрос не меняет состояния, но освобождает место для следующего.
+	time.Sleep(cooldown)
+	expect("probe", true, circuitHalfOpen)
+	b.cancel()
+	expect("probe after cancel", true, circuitHalfOpen)
+	b.success()
+	expect("closed after successful probe", true, circuitClosed)
+	b.failure()
+	expect("single failure", true, circuitClosed)
+}
+
+func TestBreakerThreshold(t *testing.T) {
+	// Порог меньше единицы означает размыкание после первой неудачи.
+	b := newBreaker(0, time.Hour)
+	b.allow()
+	b.failure()
+	if b.allow() || b.current() != circuitOpen {
+		t.Errorf("breaker with zero threshold is %s after a failure", b.current())
+	}
+}
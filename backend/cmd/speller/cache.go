@@ -0,0 +1,72 @@
+package speller
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"strconv"
+	"sync"
+)
+
+// cacheKey - SHA-256 проверенного текста и настроек проверки.
+type cacheKey [sha256.Size]byte
+
+// cacheEntry - ошибки, найденные в тексте сервисом. Кэшируется ответ сервиса, а не исправленный
+// текст, чтобы изменения словаря пользователя применялись сразу.
+type cacheEntry struct {
+	key  cacheKey
+	errs []spellError
+}
+
+// lruCache хранит результаты последних проверок; при переполнении вытесняется запись,
+// которая дольше всего не использовалась. Нулевой размер отключает кэш.
+type lruCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	order   *list.List
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, entries: make(map[cacheKey]*list.Element), order: list.New()}
+}
+
+func textKey(opts Options, text string) cacheKey {
+	return sha256.Sum256([]byte(opts.Lang + "\x00" + strconv.Itoa(opts.flags()) + "\x00" + text))
+}
+
+// get возвращает ошибки из кэша. Возвращаемый срез нельзя изменять.
+func (c *lruCache) get(key cacheKey) ([]spellError, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).errs, true
+}
+
+func (c *lruCache) put(key cacheKey, errs []spellError) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, errs: errs})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,58 @@
+package speller
+
+import "testing"
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	a, b, d := textKey(Options{}, "a"), textKey(Options{}, "b"), textKey(Options{}, "d")
+	has := func(k cacheKey) bool {
+		_, ok := c.get(k)
+		return ok
+	}
+
+	c.put(a, []spellError{{Word: "a", S: []string{"A"}}})
+	c.put(b, nil)
+	if errs, ok := c.get(a); !ok || len(errs) != 1 || errs[0].Word != "a" {
+		t.Fatalf("get(a) = %v, %v", errs, ok)
+	}
+	// a использовалась последней, поэтому вытесняется b.
+	c.put(d, nil)
+	if !has(a) || has(b) || !has(d) || c.len() != 2 {
+		t.Errorf("after eviction: a %v, b %v, d %v, len %d; want a and d", has(a), has(b), has(d), c.len())
+	}
+	// Повторное добавление не дублирует запись.
+	c.put(d, nil)
+	if c.len() != 2 {
+		t.Errorf("len = %d after adding an existing key, want 2", c.len())
+	}
+}
+
+func TestLRUCacheDisabled(t *testing.T) {
+	c := newLRUCache(0)
+	c.put(textKey(Options{}, "a"), nil)
+	if _, ok := c.get(textKey(Options{}, "a")); ok || c.len() != 0 {
+		t.Error("disabled cache stored an entry")
+	}
+}
+
+func TestTextKey(t *testing.T) {
+	base := Options{Lang: "ru,en"}
+	keys := map[cacheKey]string{}
+	for name, k := range map[string]cacheKey{
+		"base":          textKey(base, "текст"),
+		"other text":    textKey(base, "текст2"),
+		"other lang":    textKey(Options{Lang: "ru"}, "текст"),
+		"ignore digits": textKey(Options{Lang: "ru,en", IgnoreDigits: true}, "текст"),
+		"ignore urls":   textKey(Options{Lang: "ru,en", IgnoreURLs: true}, "текст"),
+		// Разделитель не дает получить одинаковый ключ, перенеся часть текста в язык.
+		"shifted": textKey(Options{Lang: "ru,en\x000\x00т"}, "екст"),
+	} {
+		if other, ok := keys[k]; ok {
+			t.Errorf("%s and %s have the same key", name, other)
+		}
+		keys[k] = name
+	}
+	if textKey(base, "текст") != textKey(Options{Lang: "ru,en"}, "текст") {
+		t.Error("equal options have different keys")
+	}
+}
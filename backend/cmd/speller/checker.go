@@ -0,0 +1,141 @@
+package speller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+// Состояния проверки орфографии заметки.
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// spellcheckJob - параметры задания проверки орфографии версии заметки.
+type spellcheckJob struct {
+	NoteID  int `json:"note_id"`
+	Version int `json:"version"`
+}
+
+// spellcheckTask - задание проверки орфографии. Сервис проверки бывает недоступен подолгу,
+// поэтому попыток больше, чем у большинства заданий: с ростом задержки они покрывают несколько часов.
+var spellcheckTask = jobs.Task[spellcheckJob]{Kind: "notes.spellcheck", MaxAttempts: 12, Timeout: time.Minute}
+
+// CheckFunc проверяет орфографию текста с настройками opts и возвращает исправленный текст и внесенные исправления.
+type CheckFunc func(ctx context.Context, text string, opts Options) (string, []Correction, error)
+
+// Checker проверяет орфографию сохраненных заметок в фоновых заданиях. Заметка сохраняется
+// сразу с состоянием pending, а исправленный текст записывается, только если заметку с тех пор не меняли.
+type Checker struct {
+	db     database.Database
+	queue  *jobs.Queue
+	check  CheckFunc
+	logger *logger.Logger
+}
+
+// NewChecker создает новый экземпляр Checker и регистрирует обработчик его заданий в очереди.
+func NewChecker(db database.Database, queue *jobs.Queue, check CheckFunc, logger *logger.Logger) *Checker {
+	c := &Checker{db: db, queue: queue, check: check, logger: logger}
+	jobs.Handle(queue, spellcheckTask, c.run)
+	return c
+}
+
+// Enqueue ставит в очередь проверку версии version заметки noteID. Если поставить задание
+// не удалось, ошибка записывается в журнал, а заметка отмечается как не прошедшая проверку.
+func (c *Checker) Enqueue(ctx context.Context, noteID, version int) error {
+	_, err := spellcheckTask.Enqueue(ctx, c.queue, spellcheckJob{NoteID: noteID, Version: version})
+	if err != nil {
+		c.logger.Error("Failed to enqueue spell check", "note_id", noteID, "error", err)
+		c.markFailed(noteID, version)
+	}
+	return err
+}
+
+// CheckText проверяет орфографию текста с настройками пользователя userID и возвращает исправленный текст.
+func (c *Checker) CheckText(ctx context.Context, userID int, text string) (string, error) {
+	opts, err := LoadOptions(ctx, c.db, userID)
+	if err != nil {
+		return "", err
+	}
+	corrected, _, err := c.check(ctx, text, opts)
+	return corrected, err
+}
+
+// run проверяет орфографию заметки с настройками ее автора и сохраняет исправленный текст
+// вместе с исправлениями. Если заметку удалили или изменили после постановки задания, проверка не нужна.
+func (c *Checker) run(ctx context.Context, job spellcheckJob) error {
+	var text, status string
+	var userID int
+	err := c.db.QueryRow(ctx, `SELECT text, spellcheck_status, user_id FROM notes
+        WHERE id=$1 AND version=$2 AND deleted_at IS NULL`, job.NoteID, job.Version).Scan(&text, &status, &userID)
+	if err == sql.ErrNoRows || (err == nil && status != StatusPending) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	opts, err := LoadOptions(ctx, c.db, userID)
+	if err != nil {
+		return err
+	}
+
+	corrected, corrections, err := c.check(ctx, text, opts)
+	if err != nil {
+		// Проверка, прерванная остановкой сервера, будет повторена и попыткой не считается.
+		if attempt, maxAttempts := jobs.Attempt(ctx); attempt >= maxAttempts && !errors.Is(err, context.Canceled) {
+			c.markFailed(job.NoteID, job.Version)
+		}
+		return err
+	}
+
+	if len(corrections) == 0 {
+		return c.setStatus(ctx, job.NoteID, job.Version, StatusDone)
+	}
+	positions := make([]int64, len(corrections))
+	words := make([]string, len(corrections))
+	replacements := make([]string, len(corrections))
+	codes := make([]int64, len(corrections))
+	for i, corr := range corrections {
+		positions[i] = int64(corr.Pos)
+		words[i] = corr.Word
+		replacements[i] = corr.Replacement
+		codes[i] = int64(corr.Code)
+	}
+	// Текст обновляется только поверх проверенной версии, поэтому правки пользователя,
+	// сделанные во время проверки, не теряются.
+	_, err = c.db.Exec(ctx, `WITH updated AS (
+            UPDATE notes SET text=$3, spellcheck_status='done'
+            WHERE id=$1 AND version=$2 AND spellcheck_status='pending' AND deleted_at IS NULL
+            RETURNING id, version)
+        INSERT INTO note_corrections (note_id, version, position, word, replacement, code)
+        SELECT u.id, u.version, c.position, c.word, c.replacement, c.code
+        FROM updated u, unnest($4::int[], $5::text[], $6::text[], $7::int[]) AS c(position, word, replacement, code)`,
+		job.NoteID, job.Version, corrected, pq.Array(positions), pq.Array(words), pq.Array(replacements), pq.Array(codes))
+	return err
+}
+
+// setStatus сохраняет состояние проверки версии заметки, если заметку с тех пор не меняли.
+func (c *Checker) setStatus(ctx context.Context, noteID, version int, status string) error {
+	_, err := c.db.Exec(ctx, `UPDATE notes SET spellcheck_status=$3
+        WHERE id=$1 AND version=$2 AND spellcheck_status='pending'`, noteID, version, status)
+	return err
+}
+
+// markFailed отмечает, что проверить версию заметки не удалось. Использует собственный контекст,
+// так как вызывается и после истечения контекста задания.
+func (c *Checker) markFailed(noteID, version int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.setStatus(ctx, noteID, version, StatusFailed); err != nil {
+		c.logger.Error("Failed to save spell check status", "note_id", noteID, "error", err)
+	}
+}
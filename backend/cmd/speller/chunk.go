@@ -0,0 +1,89 @@
+package speller
+
+import "unicode"
+
+const (
+	// maxChunkLen - наибольшая длина фрагмента текста в символах, отправляемого на проверку.
+	maxChunkLen = 2000
+	// maxBatchLen - наибольшая суммарная длина фрагментов в одном запросе checkTexts.
+	// Яндекс.Спеллер не принимает запросы длиннее 10000 символов.
+	maxBatchLen = 10000
+)
+
+// chunk - фрагмент проверяемого текста. offset - позиция фрагмента в тексте в символах.
+type chunk struct {
+	offset int
+	text   []rune
+}
+
+// splitChunks делит текст на фрагменты не длиннее limit символов. Граница фрагмента выбирается
+// по убыванию предпочтения: между абзацами, в конце строки, после конца предложения, на пробеле;
+// слово длиннее limit разрезается. Фрагменты из одних пробелов (например, замаскированный код)
+// пропускаются: проверять в них нечего.
+func splitChunks(text []rune, limit int) []chunk {
+	var chunks []chunk
+	for start := 0; start < len(text); {
+		end := len(text)
+		if end-start > limit {
+			end = cutPoint(text, start, start+limit)
+		}
+		if !blank(text[start:end]) {
+			chunks = append(chunks, chunk{offset: start, text: text[start:end]})
+		}
+		start = end
+	}
+	return chunks
+}
+
+// cutPoint возвращает лучшую границу фрагмента text[start:end] - самую дальнюю границу
+// наиболее предпочтительного вида.
+func cutPoint(text []rune, start, end int) int {
+	line, sentence, space := -1, -1, -1
+	for i := end; i > start+1; i-- {
+		prev, before := text[i-1], text[i-2]
+		switch {
+		case prev == '\n' && before == '\n':
+			return i
+		case prev == '\n':
+			line = max(line, i)
+		case unicode.IsSpace(prev) && (before == '.' || before == '!' || before == '?' || before == '…'):
+			sentence = max(sentence, i)
+		case unicode.IsSpace(prev):
+			space = max(space, i)
+		}
+	}
+	for _, p := range []int{line, sentence, space} {
+		if p > 0 {
+			return p
+		}
+	}
+	return end
+}
+
+func blank(text []rune) bool {
+	for _, c := range text {
+		if !unicode.IsSpace(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// batches группирует фрагменты в запросы checkTexts, суммарная длина которых не больше limit.
+func batches(chunks []chunk, limit int) [][]chunk {
+	var out [][]chunk
+	var cur []chunk
+	size := 0
+	for _, c := range chunks {
+		if len(cur) > 0 && size+len(c.text) > limit {
+			out = append(out, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, c)
+		size += len(c.text)
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
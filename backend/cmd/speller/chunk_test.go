@@ -0,0 +1,88 @@
+package speller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short text", "один абзац", 20, []string{"один абзац"}},
+		{"empty", "", 20, nil},
+		{"paragraph break", "первый абзац\n\nвторой", 18, []string{"первый абзац\n\n", "второй"}},
+		{"paragraph before line", "ab\n\ncd\nef gh", 10, []string{"ab\n\n", "cd\nef gh"}},
+		{"line break", "строка один\nстрока два", 15, []string{"строка один\n", "строка два"}},
+		{"sentence end", "Раз два. Три четыре пять", 15, []string{"Раз два. ", "Три четыре пять"}},
+		{"space", "раз два три четыре", 10, []string{"раз два ", "три четыре"}},
+		{"long word", "абвгдеёжзийкл", 5, []string{"абвгд", "еёжзи", "йкл"}},
+		{"blank chunk skipped", "текст\n\n" + strings.Repeat(" ", 10) + "\n\nеще", 8, []string{"текст\n\n", "  \n\nеще"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := []rune(tt.text)
+			chunks := splitChunks(text, tt.limit)
+			var got []string
+			for _, c := range chunks {
+				if len(c.text) > tt.limit {
+					t.Errorf("chunk %q is longer than %d", string(c.text), tt.limit)
+				}
+				if string(text[c.offset:c.offset+len(c.text)]) != string(c.text) {
+					t.Errorf("chunk %q does not match text at offset %d", string(c.text), c.offset)
+				}
+				got = append(got, string(c.text))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitChunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	newChunk := func(n int) chunk { return chunk{text: []rune(strings.Repeat("a", n))} }
+	tests := []struct {
+		name  string
+		sizes []int
+		limit int
+		want  [][]int
+	}{
+		{"empty", nil, 10, nil},
+		{"single batch", []int{3, 3, 4}, 10, [][]int{{3, 3, 4}}},
+		{"split", []int{6, 5, 4, 2}, 10, [][]int{{6}, {5, 4}, {2}}},
+		{"oversized chunk", []int{12, 3}, 10, [][]int{{12}, {3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []chunk
+			for _, n := range tt.sizes {
+				chunks = append(chunks, newChunk(n))
+			}
+			var got [][]int
+			for _, b := range batches(chunks, tt.limit) {
+				var sizes []int
+				for _, c := range b {
+					sizes = append(sizes, len(c.text))
+				}
+				got = append(got, sizes)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("batches = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if len(got[i]) != len(tt.want[i]) {
+					t.Fatalf("batches = %v, want %v", got, tt.want)
+				}
+				for j := range got[i] {
+					if got[i][j] != tt.want[i][j] {
+						t.Fatalf("batches = %v, want %v", got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
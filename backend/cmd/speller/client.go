@@ -0,0 +1,280 @@
+package speller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+)
+
+const (
+	// maxResponseSize - наибольший размер ответа сервиса; ответ больше считается ошибкой сервиса.
+	maxResponseSize = 1 << 20
+	// retryBackoff - задержка перед первым повтором запроса, каждая следующая вдвое больше.
+	retryBackoff = 200 * time.Millisecond
+)
+
+// StatusError - ответ сервиса с неуспешным кодом состояния.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("speller: unexpected status %d", e.StatusCode)
+}
+
+// temporary сообщает, что запрос стоит повторить: сервис перегружен или неисправен.
+func (e *StatusError) temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Client - клиент Яндекс.Спеллер API. Запрос, завершившийся таймаутом, сетевой ошибкой или
+// ошибкой сервиса, повторяется ограниченное число раз. После нескольких неудачных запросов подряд
+// автомат защиты временно отключает обращения к сервису, и Check сразу возвращает ErrCircuitOpen:
+// вызывающий код сохраняет текст без исправлений, а не ждет недоступный сервис.
+// Результаты проверки кэшируются по хэшу текста.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	maxRetries int
+	breaker    *breaker
+	cache      *lruCache
+
+	requestsOK     atomic.Int64
+	requestsFailed atomic.Int64
+	rejected       atomic.Int64
+	retries        atomic.Int64
+	cacheHits      atomic.Int64
+	cacheMisses    atomic.Int64
+}
+
+// NewClient создает клиент сервиса проверки орфографии с параметрами из cfg.
+func NewClient(cfg config.SpellerConfig) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/"),
+		httpClient: &http.Client{},
+		timeout:    cfg.Timeout,
+		maxRetries: max(cfg.MaxRetries, 0),
+		breaker:    newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		cache:      newLRUCache(cfg.CacheSize),
+	}
+}
+
+// Check проверяет орфографию текста с использованием Яндекс.Спеллер API с настройками opts и возвращает
+// исправленный текст и внесенные исправления. Слова из словаря пользователя (opts.Dictionary) не исправляются.
+// Блоки кода, код в строке и адреса не проверяются: перед отправкой они заменяются пробелами,
+// а исправления применяются по позициям, поэтому остальной текст не смещается.
+// Длинный текст делится на фрагменты по границам абзацев и предложений (см. splitChunks),
+// которые отправляются методом checkTexts, а позиции ошибок пересчитываются в позиции текста.
+func (c *Client) Check(ctx context.Context, text string, opts Options) (string, []Correction, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil, nil
+	}
+	masked := maskProtected(text)
+	key := textKey(opts, text)
+	result, ok := c.cache.get(key)
+	if ok {
+		c.cacheHits.Add(1)
+	} else {
+		c.cacheMisses.Add(1)
+		for _, batch := range batches(splitChunks(masked, maxChunkLen), maxBatchLen) {
+			errs, err := c.checkTexts(ctx, batch, opts)
+			if err != nil {
+				return "", nil, err
+			}
+			result = append(result, errs...)
+		}
+		c.cache.put(key, result)
+	}
+
+	// Заменяем слова с ошибками на исправленные версии в тексте.
+	corrected, corrections := applyCorrections(text, masked, opts.filter(result))
+	return corrected, corrections, nil
+}
+
+// checkTexts проверяет фрагменты одним запросом к методу checkTexts и возвращает ошибки
+// с позициями в исходном тексте.
+func (c *Client) checkTexts(ctx context.Context, batch []chunk, opts Options) ([]spellError, error) {
+	form := url.Values{}
+	for _, ch := range batch {
+		form.Add("text", string(ch.text))
+	}
+	form.Set("lang", opts.Lang)
+	form.Set("options", strconv.Itoa(opts.flags()))
+
+	// Ответ - массив ошибок для каждого фрагмента в порядке их следования в запросе.
+	var result [][]spellError
+	if err := c.do(ctx, "checkTexts", form, &result); err != nil {
+		return nil, err
+	}
+	if len(result) != len(batch) {
+		return nil, fmt.Errorf("speller: got results for %d texts, want %d", len(result), len(batch))
+	}
+	var errs []spellError
+	for i, ch := range batch {
+		for _, e := range result[i] {
+			e.Pos += ch.offset
+			errs = append(errs, e)
+		}
+	}
+	return errs, nil
+}
+
+// do выполняет запрос к методу method с повторами и учетом автомата защиты и декодирует ответ в out.
+func (c *Client) do(ctx context.Context, method string, form url.Values, out any) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			c.retries.Add(1)
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+		}
+		if !c.breaker.allow() {
+			c.rejected.Add(1)
+			return ErrCircuitOpen
+		}
+
+		var retry bool
+		retry, err = c.attempt(ctx, method, form, out)
+		switch {
+		case err == nil:
+			c.breaker.success()
+			c.requestsOK.Add(1)
+			return nil
+		case ctx.Err() != nil:
+			// Запрос отменил вызывающий код: о состоянии сервиса это ничего не говорит.
+			c.breaker.cancel()
+			return ctx.Err()
+		case retry:
+			c.breaker.failure()
+		default:
+			// Сервис ответил, но отклонил запрос: повтор не поможет, а сервис исправен.
+			c.breaker.success()
+		}
+		c.requestsFailed.Add(1)
+		if !retry || attempt >= c.maxRetries {
+			return err
+		}
+	}
+}
+
+// attempt выполняет одну попытку запроса. retry сообщает, что ошибка временная.
+func (c *Client) attempt(ctx context.Context, method string, form url.Values, out any) (retry bool, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	// Создаем новый HTTP-запрос с привязанным контекстом.
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/"+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Выполняем запрос к API.
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+		se := &StatusError{StatusCode: resp.StatusCode}
+		return se.temporary(), se
+	}
+
+	// Читаем ответ с ограничением размера: лишний байт означает, что ответ слишком большой.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return true, err
+	}
+	if len(body) > maxResponseSize {
+		return true, errors.New("speller: response too large")
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return true, fmt.Errorf("speller: malformed response: %w", err)
+	}
+	return false, nil
+}
+
+// backoff возвращает задержку перед повтором attempt со случайным разбросом до 20%.
+func backoff(attempt int) time.Duration {
+	d := retryBackoff << (attempt - 1)
+	return d + time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+// sleep ждет d или отмены контекста.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Name возвращает имя компонента в проверке состояния и метриках.
+func (c *Client) Name() string {
+	return "speller"
+}
+
+// Health возвращает состояние клиента: degraded, пока автомат защиты не замкнут.
+func (c *Client) Health() (string, map[string]any) {
+	state := c.breaker.current()
+	status := "ok"
+	if state != circuitClosed {
+		status = "degraded"
+	}
+	return status, map[string]any{"circuit": state, "cache_entries": c.cache.len()}
+}
+
+// WriteMetrics записывает метрики клиента в текстовом формате Prometheus.
+func (c *Client) WriteMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP speller_requests_total Requests to the spell check service by result.")
+	fmt.Fprintln(w, "# TYPE speller_requests_total counter")
+	fmt.Fprintf(w, "speller_requests_total{result=\"ok\"} %d\n", c.requestsOK.Load())
+	fmt.Fprintf(w, "speller_requests_total{result=\"error\"} %d\n", c.requestsFailed.Load())
+	fmt.Fprintf(w, "speller_requests_total{result=\"rejected\"} %d\n", c.rejected.Load())
+	fmt.Fprintln(w, "# HELP speller_retries_total Retried requests to the spell check service.")
+	fmt.Fprintln(w, "# TYPE speller_retries_total counter")
+	fmt.Fprintf(w, "speller_retries_total %d\n", c.retries.Load())
+	fmt.Fprintln(w, "# HELP speller_cache_hits_total Spell check results served from cache.")
+	fmt.Fprintln(w, "# TYPE speller_cache_hits_total counter")
+	fmt.Fprintf(w, "speller_cache_hits_total %d\n", c.cacheHits.Load())
+	fmt.Fprintln(w, "# HELP speller_cache_misses_total Spell check results not found in cache.")
+	fmt.Fprintln(w, "# TYPE speller_cache_misses_total counter")
+	fmt.Fprintf(w, "speller_cache_misses_total %d\n", c.cacheMisses.Load())
+	fmt.Fprintln(w, "# HELP speller_cache_entries Spell check results in cache.")
+	fmt.Fprintln(w, "# TYPE speller_cache_entries gauge")
+	fmt.Fprintf(w, "speller_cache_entries %d\n", c.cache.len())
+	fmt.Fprintln(w, "# HELP speller_circuit_state Circuit breaker state: 0 closed, 1 half-open, 2 open.")
+	fmt.Fprintln(w, "# TYPE speller_circuit_state gauge")
+	fmt.Fprintf(w, "speller_circuit_state %d\n", circuitStateValue(c.breaker.current()))
+}
+
+func circuitStateValue(state string) int {
+	switch state {
+	case circuitHalfOpen:
+		return 1
+	case circuitOpen:
+		return 2
+	}
+	return 0
+}
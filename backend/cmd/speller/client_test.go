@@ -0,0 +1,223 @@
+package speller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/spellertest"
+)
+
+// newTestClient возвращает клиент, обращающийся к серверу, который отвечает handler.
+func newTestClient(t *testing.T, cfg config.SpellerConfig, handler http.HandlerFunc) (*Client, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	c := NewClient(cfg)
+	c.baseURL = srv.URL
+	return c, &requests
+}
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name string
+		// responses - коды ответов сервиса на последовательные запросы; после последнего повторяется он же.
+		responses []int
+		body      string
+		wantErr   bool
+		requests  int64
+	}{
+		{"ok", []int{200}, `[1, 2]`, false, 1},
+		{"retry after server error", []int{503, 200}, `[1, 2]`, false, 2},
+		{"retry after rate limit", []int{429, 200}, `[1, 2]`, false, 2},
+		{"retries exhausted", []int{500}, ``, true, 2},
+		{"bad request is not retried", []int{400}, ``, true, 1},
+		{"malformed response is retried", []int{200}, `{`, true, 2},
+		{"response too large", []int{200}, `[` + strings.Repeat(`1,`, maxResponseSize/2) + `1]`, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int64
+			c, requests := newTestClient(t, config.SpellerConfig{MaxRetries: 1, BreakerThreshold: 10},
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodPost || r.URL.Path != "/checkText" || r.FormValue("text") != "текст" {
+						t.Errorf("request %s %s, text %q", r.Method, r.URL.Path, r.FormValue("text"))
+					}
+					i := int(n.Add(1)) - 1
+					w.WriteHeader(tt.responses[min(i, len(tt.responses)-1)])
+					w.Write([]byte(tt.body))
+				})
+			var out []int
+			err := c.do(context.Background(), "checkText", url.Values{"text": {"текст"}}, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("do: err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(out) != 2 {
+				t.Errorf("out = %v", out)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("%d requests, want %d", got, tt.requests)
+			}
+			if c.retries.Load() != tt.requests-1 {
+				t.Errorf("%d retries counted, want %d", c.retries.Load(), tt.requests-1)
+			}
+		})
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	c, _ := newTestClient(t, config.SpellerConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	var se *StatusError
+	if err := c.do(context.Background(), "checkText", nil, &struct{}{}); !errors.As(err, &se) || se.StatusCode != http.StatusForbidden {
+		t.Errorf("do: err = %v, want StatusError 403", err)
+	}
+	// Сервис ответил, значит он исправен: отказ в запросе не размыкает автомат.
+	if state := c.breaker.current(); state != circuitClosed {
+		t.Errorf("circuit %s after a client error, want closed", state)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	c, requests := newTestClient(t, config.SpellerConfig{BreakerThreshold: 2, BreakerCooldown: 20 * time.Millisecond},
+		func(w http.ResponseWriter, r *http.Request) {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{}`))
+		})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := c.do(ctx, "checkText", nil, &struct{}{}); err == nil {
+			t.Fatal("do: want error")
+		}
+	}
+	// Разомкнутый автомат отклоняет запрос, не обращаясь к сервису.
+	if err := c.do(ctx, "checkText", nil, &struct{}{}); !errors.Is(err, ErrCircuitOpen) || requests.Load() != 2 {
+		t.Fatalf("do with open circuit: err = %v after %d requests", err, requests.Load())
+	}
+	if status, details := c.Health(); status != "degraded" || details["circuit"] != circuitOpen {
+		t.Errorf("Health = %s, %v", status, details)
+	}
+
+	healthy.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	if err := c.do(ctx, "checkText", nil, &struct{}{}); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if status, _ := c.Health(); status != "ok" {
+		t.Errorf("Health = %s after a successful probe", status)
+	}
+
+	var metrics strings.Builder
+	c.WriteMetrics(&metrics)
+	for _, line := range []string{
+		`speller_requests_total{result="ok"} 1`,
+		`speller_requests_total{result="error"} 2`,
+		`speller_requests_total{result="rejected"} 1`,
+		"speller_circuit_state 0",
+	} {
+		if !strings.Contains(metrics.String(), line+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", line, metrics.String())
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	c, requests := newTestClient(t, config.SpellerConfig{Timeout: 20 * time.Millisecond, MaxRetries: 1, BreakerThreshold: 10},
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		})
+	defer close(release)
+	// Попытка, не уложившаяся в таймаут, повторяется.
+	if err := c.do(context.Background(), "checkText", nil, &struct{}{}); err == nil || requests.Load() != 2 {
+		t.Errorf("do: err = %v after %d requests, want a timeout after 2", err, requests.Load())
+	}
+
+	// Отмена вызывающим кодом не повторяется и не считается неудачей сервиса.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	c.timeout = time.Hour
+	if err := c.do(ctx, "checkText", nil, &struct{}{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("do with canceled context: err = %v", err)
+	}
+	if c.breaker.failures != 2 {
+		t.Errorf("breaker counted %d failures, want 2", c.breaker.failures)
+	}
+}
+
+func TestClientCheck(t *testing.T) {
+	srv := spellertest.NewServer([]spellertest.Rule{
+		{Word: "превед", Suggestions: []string{"привет"}},
+		{Word: "москва", Suggestions: []string{"Москва"}, Code: spellertest.CodeCapitalization},
+	}, nil)
+	defer srv.Close()
+	c := NewClient(config.SpellerConfig{BaseURL: srv.URL + "/", CacheSize: 10})
+	ctx := context.Background()
+
+	// Длинный текст проверяется по фрагментам, а позиции ошибок пересчитываются в позиции текста.
+	filler := strings.Repeat("слово ", maxChunkLen/6)
+	text := "Превед из москва.\n\n" + filler + "\n\n`превед` превед"
+	corrected, corrections, err := c.Check(ctx, text, Options{Lang: "ru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Привет из Москва.\n\n" + filler + "\n\n`превед` привет"
+	if corrected != want {
+		t.Errorf("Check = %q, want %q", corrected, want)
+	}
+	if len(corrections) != 3 || corrections[2].Pos != utf8.RuneCountInString(want)-utf8.RuneCountInString("привет") {
+		t.Errorf("corrections = %+v", corrections)
+	}
+	if srv.Requests() != 1 {
+		t.Errorf("%d requests, want one checkTexts request", srv.Requests())
+	}
+
+	// Повторная проверка берется из кэша, а словарь пользователя применяется к результату из кэша.
+	corrected, _, err = c.Check(ctx, text, Options{Lang: "ru", Dictionary: map[string]bool{"превед": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(corrected, "Превед из Москва.") || srv.Requests() != 1 {
+		t.Errorf("Check with dictionary = %q after %d requests", corrected[:40], srv.Requests())
+	}
+	// Другие настройки проверки - другой результат, он в кэш не попадает.
+	corrected, _, err = c.Check(ctx, text, Options{Lang: "ru", IgnoreCapitalization: true})
+	if err != nil || !strings.HasPrefix(corrected, "Привет из москва.") || srv.Requests() != 2 {
+		t.Errorf("Check ignoring capitalization = %q, %v after %d requests", corrected[:40], err, srv.Requests())
+	}
+
+	srv.FailNext(1, http.StatusServiceUnavailable)
+	if _, _, err := c.Check(ctx, "превед, мир", Options{Lang: "ru"}); err == nil {
+		t.Error("Check with an unavailable service: want error")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: retryBackoff, 2: 2 * retryBackoff, 3: 4 * retryBackoff} {
+		for i := 0; i < 20; i++ {
+			if got := backoff(attempt); got < want || got > want+want/5 {
+				t.Fatalf("backoff(%d) = %v, want %v + up to 20%%", attempt, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package speller
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxDictionaryWords - наибольшее число слов в словаре пользователя.
+	maxDictionaryWords = 5000
+	// maxWordLen - наибольшая длина слова словаря в символах.
+	maxWordLen = 64
+	// maxWordListSize - наибольший размер импортируемого списка слов.
+	maxWordListSize = 1 << 20
+	// multipartOverhead - запас на заголовки частей multipart/form-data сверх размера списка.
+	multipartOverhead = 64 << 10
+)
+
+// loadDictionary возвращает слова словаря пользователя userID в нижнем регистре.
+func loadDictionary(ctx context.Context, db database.Database, userID int) (map[string]bool, error) {
+	rows, err := db.Query(ctx, "SELECT word FROM user_dictionary WHERE user_id=$1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dict := make(map[string]bool)
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return nil, err
+		}
+		dict[strings.ToLower(word)] = true
+	}
+	return dict, rows.Err()
+}
+
+// normalizeWord проверяет слово словаря: одно слово без пробелов, не длиннее maxWordLen символов
+// и хотя бы с одной буквой.
+func normalizeWord(word string) (string, bool) {
+	word = strings.TrimSpace(word)
+	if word == "" || utf8.RuneCountInString(word) > maxWordLen || strings.IndexFunc(word, unicode.IsSpace) >= 0 {
+		return "", false
+	}
+	return word, strings.IndexFunc(word, unicode.IsLetter) >= 0
+}
+
+// addWords добавляет в словарь пользователя слова, которых в нем еще нет (без учета регистра),
+// пока в словаре есть место, и возвращает число добавленных слов.
+func addWords(ctx context.Context, db database.Database, userID int, words []string) (int, error) {
+	res, err := db.Exec(ctx, `WITH existing AS (SELECT count(*) AS n FROM user_dictionary WHERE user_id=$1),
+        new AS (
+            SELECT t.word, row_number() OVER (ORDER BY t.i) AS i
+            FROM unnest($2::text[]) WITH ORDINALITY AS t(word, i)
+            WHERE NOT EXISTS (SELECT 1 FROM user_dictionary d WHERE d.user_id=$1 AND lower(d.word)=lower(t.word)))
+        INSERT INTO user_dictionary (user_id, word)
+        SELECT $1, new.word FROM new, existing WHERE new.i <= $3 - existing.n
+        ON CONFLICT (user_id, lower(word)) DO NOTHING`, userID, pq.Array(words), maxDictionaryWords)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// currentUserID возвращает ID текущего пользователя. Если пользователь не найден или запрос
+// не удался, ответ с ошибкой уже отправлен.
+func currentUserID(ctx context.Context, db database.Database, w http.ResponseWriter, r *http.Request) (int, bool) {
+	var userID int
+	err := db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, false
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	return userID, true
+}
+
+// GetDictionaryHandler возвращает обработчик, который отдает словарь текущего пользователя.
+func GetDictionaryHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `SELECT d.word, d.created_at
+            FROM user_dictionary d JOIN users u ON u.id = d.user_id
+            WHERE u.username=$1 ORDER BY lower(d.word)`, r.Header.Get("username"))
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		words := []models.DictionaryWord{}
+		for rows.Next() {
+			var word models.DictionaryWord
+			if err := rows.Scan(&word.Word, &word.CreatedAt); err != nil {
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			words = append(words, word)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(words)
+	}
+}
+
+// AddWordHandler возвращает обработчик, который добавляет слово word в словарь текущего пользователя.
+// Слова словаря сравниваются без учета регистра.
+func AddWordHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		word, ok := normalizeWord(r.FormValue("word"))
+		if !ok {
+			http.Error(w, "Invalid word", http.StatusBadRequest)
+			return
+		}
+		userID, ok := currentUserID(ctx, db, w, r)
+		if !ok {
+			return
+		}
+
+		added, err := addWords(ctx, db, userID, []string{word})
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if added == 0 {
+			// Слово не добавлено: либо оно уже есть в словаре, либо словарь заполнен.
+			var exists bool
+			err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_dictionary WHERE user_id=$1 AND lower(word)=lower($2))`,
+				userID, word).Scan(&exists)
+			if err != nil {
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				http.Error(w, "Dictionary is full", http.StatusConflict)
+				return
+			}
+			w.Write([]byte("Word already in dictionary"))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Word added"))
+	}
+}
+
+// UpdateWordHandler возвращает обработчик, который заменяет слово из пути запроса словом word,
+// например чтобы исправить опечатку в словаре.
+func UpdateWordHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		word, ok := normalizeWord(r.FormValue("word"))
+		if !ok {
+			http.Error(w, "Invalid word", http.StatusBadRequest)
+			return
+		}
+		userID, ok := currentUserID(ctx, db, w, r)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(ctx, `UPDATE user_dictionary SET word=$3 WHERE user_id=$1 AND lower(word)=lower($2)`,
+			userID, mux.Vars(r)["word"], word)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			http.Error(w, "Word already in dictionary", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Word not found", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Word updated"))
+	}
+}
+
+// DeleteWordHandler возвращает обработчик, который удаляет слово из словаря текущего пользователя.
+func DeleteWordHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		res, err := db.Exec(ctx, `DELETE FROM user_dictionary d USING users u
+            WHERE u.id = d.user_id AND u.username=$1 AND lower(d.word)=lower($2)`,
+			r.Header.Get("username"), mux.Vars(r)["word"])
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Word not found", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Word deleted"))
+	}
+}
+
+// ImportDictionaryHandler возвращает обработчик, который добавляет в словарь текущего пользователя
+// слова из списка: по одному слову в строке, пустые строки и строки, начинающиеся с #, пропускаются.
+// Список передается телом запроса (text/plain) или файлом file формы multipart/form-data.
+func ImportDictionaryHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxWordListSize+multipartOverhead)
+		var list io.Reader = r.Body
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "File is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			list = file
+		}
+
+		var words []string
+		var result models.DictionaryImport
+		seen := make(map[string]bool)
+		scanner := bufio.NewScanner(list)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			word, ok := normalizeWord(line)
+			if !ok || seen[strings.ToLower(word)] {
+				result.Skipped++
+				continue
+			}
+			seen[strings.ToLower(word)] = true
+			words = append(words, word)
+		}
+		if err := scanner.Err(); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, "Word list is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid word list", http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := currentUserID(ctx, db, w, r)
+		if !ok {
+			return
+		}
+		added, err := addWords(ctx, db, userID, words)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		result.Added = added
+		result.Skipped += len(words) - added
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,32 @@
+package speller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+		ok   bool
+	}{
+		{"Гошан", "Гошан", true},
+		{"  kubernetes\n", "kubernetes", true},
+		{"e-mail", "e-mail", true},
+		{"COVID-19", "COVID-19", true},
+		{strings.Repeat("я", maxWordLen), strings.Repeat("я", maxWordLen), true},
+		{"", "", false},
+		{"   ", "", false},
+		{"два слова", "", false},
+		{"таб\tуляция", "", false},
+		{"12345", "12345", false},
+		{"---", "---", false},
+		{strings.Repeat("я", maxWordLen+1), "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := normalizeWord(tt.word); got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeWord(%q) = %q, %v; want %q, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package speller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+)
+
+// Options - настройки проверки орфографии пользователя.
+type Options struct {
+	// Lang - языки проверки через запятую (ru, en, uk).
+	Lang string `json:"lang"`
+	// IgnoreDigits - пропускать слова с цифрами.
+	IgnoreDigits bool `json:"ignore_digits"`
+	// IgnoreURLs - пропускать адреса сайтов и файлов.
+	IgnoreURLs bool `json:"ignore_urls"`
+	// IgnoreCapitalization - не исправлять регистр букв, например «москва».
+	IgnoreCapitalization bool `json:"ignore_capitalization"`
+	// Dictionary - слова словаря пользователя в нижнем регистре, которые не исправляются (см. LoadOptions).
+	Dictionary map[string]bool `json:"-"`
+}
+
+// Флаги параметра options Яндекс.Спеллер API.
+const (
+	optionIgnoreDigits         = 2
+	optionIgnoreURLs           = 4
+	optionIgnoreCapitalization = 512
+)
+
+// languages - языки, которые поддерживает Яндекс.Спеллер.
+var languages = []string{"ru", "en", "uk"}
+
+// flags возвращает значение параметра options запроса к API.
+func (o Options) flags() int {
+	var f int
+	if o.IgnoreDigits {
+		f |= optionIgnoreDigits
+	}
+	if o.IgnoreURLs {
+		f |= optionIgnoreURLs
+	}
+	if o.IgnoreCapitalization {
+		f |= optionIgnoreCapitalization
+	}
+	return f
+}
+
+// filter исключает ошибки в словах из словаря пользователя.
+func (o Options) filter(errs []spellError) []spellError {
+	if len(o.Dictionary) == 0 {
+		return errs
+	}
+	out := make([]spellError, 0, len(errs))
+	for _, e := range errs {
+		if !o.Dictionary[strings.ToLower(e.Word)] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// normalizeLang приводит список языков к виду "ru,en": без пробелов, повторов и в нижнем регистре.
+// Возвращает false, если список пуст или содержит неподдерживаемый язык.
+func normalizeLang(lang string) (string, bool) {
+	var out []string
+	for _, l := range strings.Split(lang, ",") {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if !slices.Contains(languages, l) {
+			return "", false
+		}
+		if !slices.Contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, ","), true
+}
+
+// LoadOptions возвращает настройки проверки орфографии пользователя userID вместе с его словарем.
+func LoadOptions(ctx context.Context, db database.Database, userID int) (Options, error) {
+	var o Options
+	err := db.QueryRow(ctx, `SELECT speller_lang, speller_ignore_digits, speller_ignore_urls, speller_ignore_capitalization
+        FROM users WHERE id=$1`, userID).Scan(&o.Lang, &o.IgnoreDigits, &o.IgnoreURLs, &o.IgnoreCapitalization)
+	if err != nil {
+		return o, err
+	}
+	o.Dictionary, err = loadDictionary(ctx, db, userID)
+	return o, err
+}
+
+// GetSettingsHandler возвращает обработчик, который отдает настройки проверки орфографии текущего пользователя.
+func GetSettingsHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var o Options
+		err := db.QueryRow(ctx, `SELECT speller_lang, speller_ignore_digits, speller_ignore_urls, speller_ignore_capitalization
+            FROM users WHERE username=$1`, r.Header.Get("username")).
+			Scan(&o.Lang, &o.IgnoreDigits, &o.IgnoreURLs, &o.IgnoreCapitalization)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(o)
+	}
+}
+
+// UpdateSettingsHandler возвращает обработчик, который изменяет настройки проверки орфографии
+// текущего пользователя. Меняются только переданные параметры: lang, ignore_digits, ignore_urls
+// и ignore_capitalization. Настройки применяются к заметкам, проверяемым после изменения.
+func UpdateSettingsHandler(db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var lang *string
+		if v := r.FormValue("lang"); v != "" {
+			l, ok := normalizeLang(v)
+			if !ok {
+				http.Error(w, "Invalid lang", http.StatusBadRequest)
+				return
+			}
+			lang = &l
+		}
+		flags := make([]*bool, 3)
+		for i, name := range []string{"ignore_digits", "ignore_urls", "ignore_capitalization"} {
+			v := r.FormValue(name)
+			if v == "" {
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			flags[i] = &b
+		}
+
+		var o Options
+		err := db.QueryRow(ctx, `UPDATE users SET
+                speller_lang=COALESCE($2, speller_lang),
+                speller_ignore_digits=COALESCE($3, speller_ignore_digits),
+                speller_ignore_urls=COALESCE($4, speller_ignore_urls),
+                speller_ignore_capitalization=COALESCE($5, speller_ignore_capitalization)
+            WHERE username=$1
+            RETURNING speller_lang, speller_ignore_digits, speller_ignore_urls, speller_ignore_capitalization`,
+			r.Header.Get("username"), lang, flags[0], flags[1], flags[2]).
+			Scan(&o.Lang, &o.IgnoreDigits, &o.IgnoreURLs, &o.IgnoreCapitalization)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(o)
+	}
+}
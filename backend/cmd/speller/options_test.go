@@ -0,0 +1,70 @@
+package speller
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeLang(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+		ok   bool
+	}{
+		{"ru", "ru", true},
+		{"ru,en", "ru,en", true},
+		{" RU , en,ru ", "ru,en", true},
+		{"uk,en", "uk,en", true},
+		{"", "", false},
+		{"ru,", "", false},
+		{"de", "", false},
+		{"ru,de", "", false},
+		{"ru;en", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := normalizeLang(tt.lang); got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeLang(%q) = %q, %v; want %q, %v", tt.lang, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want int
+	}{
+		{Options{}, 0},
+		{Options{IgnoreDigits: true}, 2},
+		{Options{IgnoreURLs: true}, 4},
+		{Options{IgnoreCapitalization: true}, 512},
+		{Options{IgnoreDigits: true, IgnoreURLs: true, IgnoreCapitalization: true}, 518},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.flags(); got != tt.want {
+			t.Errorf("%+v.flags() = %d, want %d", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	errs := []spellError{{Word: "Гошан", Pos: 0}, {Word: "превет", Pos: 6}, {Word: "гошан", Pos: 13}}
+	tests := []struct {
+		name string
+		dict map[string]bool
+		want []int
+	}{
+		{"no dictionary", nil, []int{0, 6, 13}},
+		{"word in any case", map[string]bool{"гошан": true}, []int{6}},
+		{"unrelated words", map[string]bool{"привет": true}, []int{0, 6, 13}},
+	}
+	for _, tt := range tests {
+		got := Options{Dictionary: tt.dict}.filter(errs)
+		var pos []int
+		for _, e := range got {
+			pos = append(pos, e.Pos)
+		}
+		if fmt.Sprint(pos) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: filter kept errors at %v, want %v", tt.name, pos, tt.want)
+		}
+	}
+}
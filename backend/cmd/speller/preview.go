@@ -0,0 +1,70 @@
+package speller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+)
+
+// Action - действие, которое клиент может выполнить с исправлением: запрос method по адресу href.
+type Action struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Href   string `json:"href"`
+}
+
+// PreviewCorrection - исправление в ответе предварительной проверки вместе с доступными действиями.
+type PreviewCorrection struct {
+	Correction
+	Actions []Action `json:"actions"`
+}
+
+// Preview - результат предварительной проверки текста.
+type Preview struct {
+	Text        string              `json:"text"`
+	Corrections []PreviewCorrection `json:"corrections"`
+}
+
+// PreviewHandler возвращает обработчик, который проверяет орфографию текста text с настройками
+// и словарем текущего пользователя, ничего не сохраняя. Каждое исправление сопровождается действием
+// add_to_dictionary: если слово написано верно, его можно добавить в словарь, и больше оно не исправляется.
+func PreviewHandler(db database.Database, check CheckFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		userID, ok := currentUserID(ctx, db, w, r)
+		if !ok {
+			return
+		}
+		opts, err := LoadOptions(ctx, db, userID)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		corrected, corrections, err := check(ctx, r.FormValue("text"), opts)
+		if err != nil {
+			http.Error(w, "Spell check is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		preview := Preview{Text: corrected, Corrections: make([]PreviewCorrection, 0, len(corrections))}
+		for _, c := range corrections {
+			preview.Corrections = append(preview.Corrections, PreviewCorrection{
+				Correction: c,
+				Actions: []Action{{
+					Name:   "add_to_dictionary",
+					Method: http.MethodPost,
+					Href:   "/me/dictionary?" + url.Values{"word": {c.Word}}.Encode(),
+				}},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+	}
+}
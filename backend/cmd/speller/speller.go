@@ -3,19 +3,24 @@ package speller
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"io"
 	"net/http"
-	"net/url"
-	"strings"
+	"slices"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
 	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
 )
 
-// CreateNoteHandler возвращает обработчик HTTP-запросов для создания заметки
-// с проверкой орфографии текста и сохранением в базу данных.
-func CreateNoteHandler(db database.Database) http.HandlerFunc {
+// CreateNoteHandler возвращает обработчик HTTP-запросов для создания заметки.
+// Заметка сохраняется сразу с состоянием проверки орфографии pending, а проверка выполняется
+// в фоновом задании checker (см. Checker); параметр spellcheck=false отключает ее.
+// Если передан workspace_id, заметка создается в рабочем пространстве, где у пользователя
+// должна быть роль не ниже editor. Формат текста задается параметром format (plain по умолчанию или markdown).
+func CreateNoteHandler(db database.Database, checker *Checker) http.HandlerFunc {
+	az := authz.New(db)
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Создаем контекст с таймаутом для обработки запроса.
 		// Если выполнение операции затянется, контекст будет отменен.
@@ -25,18 +30,17 @@ func CreateNoteHandler(db database.Database) http.HandlerFunc {
 		// Извлекаем данные из запроса.
 		username := r.Header.Get("username")
 		text := r.FormValue("text")
-
-		// Проверяем орфографию текста с помощью Яндекс.Спеллер API.
-		correctedText, err := checkSpelling(ctx, text)
-		if err != nil {
-			// Если произошла ошибка при проверке орфографии, возвращаем ошибку 500.
-			http.Error(w, "Error checking spelling", http.StatusInternalServerError)
+		format := r.FormValue("format")
+		if format == "" {
+			format = markdown.FormatPlain
+		} else if !markdown.ValidFormat(format) {
+			http.Error(w, "Invalid format", http.StatusBadRequest)
 			return
 		}
 
 		// Находим ID пользователя по имени.
 		var userID int
-		err = db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", username).Scan(&userID)
+		err := db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", username).Scan(&userID)
 		if err == sql.ErrNoRows {
 			// Если пользователь не найден, возвращаем ошибку 404.
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -47,73 +51,151 @@ func CreateNoteHandler(db database.Database) http.HandlerFunc {
 			return
 		}
 
-		// Сохраняем заметку в базу данных.
-		_, err = db.Exec(ctx, "INSERT INTO notes (user_id, text) VALUES ($1, $2)", userID, correctedText)
+		// Проверяем право создавать заметки в рабочем пространстве.
+		var workspaceID *int
+		if v := r.FormValue("workspace_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid workspace_id", http.StatusBadRequest)
+				return
+			}
+			role, err := az.WorkspaceRole(ctx, userID, id)
+			if err == authz.ErrNotFound || (err == nil && role == "") {
+				http.Error(w, "Workspace not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "Server error", http.StatusInternalServerError)
+				return
+			}
+			if !authz.WorkspaceRoleAtLeast(role, authz.WorkspaceEditor) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			workspaceID = &id
+		}
+
+		// Сохраняем заметку сразу, а орфографию проверяем в фоне: недоступность сервиса
+		// проверки не должна мешать сохранению. Параметр spellcheck=false отключает проверку.
+		status := StatusPending
+		if r.FormValue("spellcheck") == "false" {
+			status = StatusSkipped
+		}
+		var noteID, version int
+		err = db.QueryRow(ctx, `INSERT INTO notes (user_id, workspace_id, text, format, spellcheck_status)
+            VALUES ($1, $2, $3, $4, $5) RETURNING id, version`,
+			userID, workspaceID, text, format, status).Scan(&noteID, &version)
 		if err != nil {
 			// Если произошла ошибка при сохранении заметки, возвращаем ошибку 500.
 			http.Error(w, "Error creating note", http.StatusInternalServerError)
 			return
 		}
+		if status == StatusPending {
+			// Заметка уже сохранена: если проверку не удалось поставить в очередь, она отмечается как failed.
+			checker.Enqueue(ctx, noteID, version)
+		}
+		w.Header().Set("Location", "/notes/"+strconv.Itoa(noteID))
 
 		// Отправляем успешный ответ.
 		w.Write([]byte("Note created successfully"))
 	}
 }
 
-// checkSpelling проверяет орфографию текста с использованием Яндекс.Спеллер API.
-// Возвращает исправленный текст и ошибку, если таковая имеется.
-func checkSpelling(ctx context.Context, text string) (string, error) {
-	// Подготовка запроса к Яндекс.Спеллер API.
-	apiURL := "https://speller.yandex.net/services/spellservice.json/checkText"
-	data := url.Values{}
-	data.Set("text", text)
+// spellError - ошибка, найденная Яндекс.Спеллер API. Pos и Len задаются в символах текста.
+type spellError struct {
+	Word string   `json:"word"`
+	S    []string `json:"s"`
+	Pos  int      `json:"pos"`
+	Row  int      `json:"row"`
+	Col  int      `json:"col"`
+	Len  int      `json:"len"`
+	Code int      `json:"code"`
+}
 
-	// Создаем новый HTTP-запрос с привязанным контекстом.
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		// Если произошла ошибка при создании запроса, возвращаем ошибку.
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+// Correction - исправление, внесенное в текст. Pos - позиция исправленного слова
+// в символах исправленного текста, Code - код ошибки Яндекс.Спеллер API
+// (1 - неизвестное слово, 2 - повтор слова, 3 - неверный регистр, 4 - слишком много ошибок).
+type Correction struct {
+	Pos         int    `json:"pos"`
+	Word        string `json:"word"`
+	Replacement string `json:"replacement"`
+	Code        int    `json:"code"`
+}
 
-	// Выполняем запрос к API.
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		// Если произошла ошибка при выполнении запроса, возвращаем ошибку.
-		return "", err
+// maskProtected заменяет пробелами символы фрагментов, которые не нужно проверять
+// (код и адреса, см. markdown.Protected). Переносы строк сохраняются, поэтому позиции
+// и номера строк в ответе API совпадают с исходным текстом.
+func maskProtected(text string) []rune {
+	var masked []rune
+	ranges := markdown.Protected(text)
+	for i, c := range text {
+		for len(ranges) > 0 && i >= ranges[0].End {
+			ranges = ranges[1:]
+		}
+		if len(ranges) > 0 && i >= ranges[0].Start && c != '\n' {
+			c = ' '
+		}
+		masked = append(masked, c)
 	}
-	defer resp.Body.Close()
+	return masked
+}
 
-	// Читаем и обрабатываем ответ от API.
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		// Если произошла ошибка при чтении ответа, возвращаем ошибку.
-		return "", err
+// applyCorrections заменяет слова с ошибками первым предложенным исправлением. Слово ищется
+// в проверенном тексте masked по позиции из ответа, а если она не совпала (например, API считает
+// позиции иначе для символов вне BMP) - ближайшим вхождением после нее; во фрагментах, замененных
+// пробелами, слово найтись не может. Исправления применяются с конца, чтобы позиции не сдвигались.
+// Возвращает исправленный текст и примененные исправления в порядке их следования в тексте.
+func applyCorrections(text string, masked []rune, errs []spellError) (string, []Correction) {
+	type replacement struct {
+		pos, len int
+		with     string
+		code     int
+	}
+	var reps []replacement
+	for _, e := range errs {
+		if len(e.S) == 0 {
+			continue
+		}
+		word := []rune(e.Word)
+		if pos := findWord(masked, word, e.Pos); pos >= 0 {
+			reps = append(reps, replacement{pos, len(word), e.S[0], e.Code})
+		}
 	}
+	sort.Slice(reps, func(i, j int) bool { return reps[i].pos > reps[j].pos })
 
-	// Парсим JSON-ответ от API.
-	var result []struct {
-		Word string   `json:"word"`
-		S    []string `json:"s"`
-		Pos  int      `json:"pos"`
-		Row  int      `json:"row"`
-		Col  int      `json:"col"`
-		Len  int      `json:"len"`
-		Code int      `json:"code"`
+	src := []rune(text)
+	out := append([]rune(nil), src...)
+	next := len(out) + 1
+	var applied []replacement
+	for _, r := range reps {
+		if r.pos+r.len > next {
+			// Пересекается с уже примененным исправлением.
+			continue
+		}
+		out = append(out[:r.pos], append([]rune(r.with), out[r.pos+r.len:]...)...)
+		next = r.pos
+		applied = append(applied, r)
 	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		// Если произошла ошибка при парсинге ответа, возвращаем ошибку.
-		return "", err
+
+	// Позиции в исправленном тексте сдвигаются на разницу длин предшествующих исправлений.
+	corrections := make([]Correction, 0, len(applied))
+	shift := 0
+	for i := len(applied) - 1; i >= 0; i-- {
+		r := applied[i]
+		corrections = append(corrections, Correction{Pos: r.pos + shift, Word: string(src[r.pos : r.pos+r.len]), Replacement: r.with, Code: r.code})
+		shift += len([]rune(r.with)) - r.len
 	}
+	return string(out), corrections
+}
 
-	// Заменяем слова с ошибками на исправленные версии в тексте.
-	for _, item := range result {
-		if len(item.S) > 0 {
-			// Заменяем слово с ошибкой на первое предложение исправления.
-			text = strings.Replace(text, item.Word, item.S[0], 1)
+// findWord возвращает позицию слова word в тексте, начиная с позиции pos, или -1.
+func findWord(text, word []rune, pos int) int {
+	if len(word) == 0 {
+		return -1
+	}
+	for p := max(pos, 0); p+len(word) <= len(text); p++ {
+		if slices.Equal(text[p:p+len(word)], word) {
+			return p
 		}
 	}
-
-	// Возвращаем исправленный текст.
-	return text, nil
+	return -1
 }
@@ -0,0 +1,133 @@
+package speller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindWord(t *testing.T) {
+	tests := []struct {
+		text, word string
+		pos        int
+		want       int
+	}{
+		{"кот и кот", "кот", 0, 0},
+		{"кот и кот", "кот", 6, 6},
+		{"кот и кот", "кот", 1, 6},
+		{"кот и кот", "кот", -3, 0},
+		{"кот", "пёс", 0, -1},
+		{"кот", "кот", 1, -1},
+		{"кот", "", 0, -1},
+		{"ко", "кот", 0, -1},
+	}
+	for _, tt := range tests {
+		if got := findWord([]rune(tt.text), []rune(tt.word), tt.pos); got != tt.want {
+			t.Errorf("findWord(%q, %q, %d) = %d, want %d", tt.text, tt.word, tt.pos, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCorrections(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		errs     []spellError
+		want     string
+		wantCorr []Correction
+	}{
+		{
+			name: "single",
+			text: "превед мир",
+			errs: []spellError{{Word: "превед", S: []string{"привет"}, Pos: 0, Code: 1}},
+			want: "привет мир",
+			wantCorr: []Correction{
+				{Pos: 0, Word: "превед", Replacement: "привет", Code: 1},
+			},
+		},
+		{
+			name: "positions shift",
+			text: "кродеться мышь ииии кот",
+			errs: []spellError{
+				{Word: "кродеться", S: []string{"крадется"}, Pos: 0, Code: 1},
+				{Word: "ииии", S: []string{"и"}, Pos: 15, Code: 1},
+			},
+			want: "крадется мышь и кот",
+			wantCorr: []Correction{
+				{Pos: 0, Word: "кродеться", Replacement: "крадется", Code: 1},
+				{Pos: 14, Word: "ииии", Replacement: "и", Code: 1},
+			},
+		},
+		{
+			name: "wrong position",
+			text: "😀 превед",
+			errs: []spellError{{Word: "превед", S: []string{"привет"}, Pos: 1, Code: 1}},
+			want: "😀 привет",
+			wantCorr: []Correction{
+				{Pos: 2, Word: "превед", Replacement: "привет", Code: 1},
+			},
+		},
+		{
+			name: "no suggestions",
+			text: "превед",
+			errs: []spellError{{Word: "превед", Pos: 0, Code: 4}},
+			want: "превед",
+		},
+		{
+			name: "overlapping",
+			text: "мама мыла",
+			errs: []spellError{
+				{Word: "мама мыла", S: []string{"мама мыла раму"}, Pos: 0, Code: 1},
+				{Word: "мыла", S: []string{"мыло"}, Pos: 5, Code: 1},
+			},
+			want: "мама мыло",
+			wantCorr: []Correction{
+				{Pos: 5, Word: "мыла", Replacement: "мыло", Code: 1},
+			},
+		},
+		{
+			name: "protected code",
+			text: "`превед` превед",
+			errs: []spellError{{Word: "превед", S: []string{"привет"}, Pos: 1, Code: 1}},
+			want: "`превед` привет",
+			wantCorr: []Correction{
+				{Pos: 9, Word: "превед", Replacement: "привет", Code: 1},
+			},
+		},
+		{
+			name: "only protected",
+			text: "https://example.com/превед",
+			errs: []spellError{{Word: "превед", S: []string{"привет"}, Pos: 20, Code: 1}},
+			want: "https://example.com/превед",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, corr := applyCorrections(tt.text, maskProtected(tt.text), tt.errs)
+			if got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if len(corr) == 0 && len(tt.wantCorr) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(corr, tt.wantCorr) {
+				t.Errorf("corrections = %+v, want %+v", corr, tt.wantCorr)
+			}
+			// Позиции исправлений указывают на замененные слова в исправленном тексте.
+			out := []rune(got)
+			for _, c := range corr {
+				r := []rune(c.Replacement)
+				if c.Pos+len(r) > len(out) || string(out[c.Pos:c.Pos+len(r)]) != c.Replacement {
+					t.Errorf("correction %+v does not point at %q", c, c.Replacement)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskProtected(t *testing.T) {
+	text := "код `x := 1`\n```\na\nb\n```\nтекст"
+	want := "код         \n   \n \n \n   \nтекст"
+	if got := string(maskProtected(text)); got != want {
+		t.Errorf("maskProtected(%q) = %q, want %q", text, got, want)
+	}
+}
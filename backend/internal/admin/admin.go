@@ -0,0 +1,243 @@
+// Package admin реализует модерацию учетных записей: поиск пользователей, блокировку,
+// принудительный сброс пароля и отзыв сессий. Его используют административный API
+// и команда notesctl admin, которая работает с базой данных напрямую.
+// Каждое изменение записывается в журнал admin_actions.
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+)
+
+// ErrNotFound возвращается, если пользователь не существует.
+var ErrNotFound = errors.New("admin: user not found")
+
+// Действия администраторов в журнале admin_actions.
+const (
+	ActionDisable        = "disable"
+	ActionEnable         = "enable"
+	ActionPasswordReset  = "password_reset"
+	ActionRevokeSessions = "revoke_sessions"
+	ActionImpersonate    = "impersonate"
+	ActionGrantAdmin     = "grant_admin"
+	ActionRevokeAdmin    = "revoke_admin"
+)
+
+const (
+	// DefaultLimit и MaxLimit - число записей в списке по умолчанию и наибольшее.
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ResetMailFunc отправляет пользователю с адресом email письмо со ссылкой для сброса пароля.
+type ResetMailFunc func(ctx context.Context, email string) error
+
+// Service выполняет действия администраторов над учетными записями.
+type Service struct {
+	db        database.Database
+	resetMail ResetMailFunc
+}
+
+// New создает новый экземпляр Service. resetMail вызывается при принудительном сбросе пароля.
+func New(db database.Database, resetMail ResetMailFunc) *Service {
+	return &Service{db: db, resetMail: resetMail}
+}
+
+// Filter - условия поиска пользователей.
+type Filter struct {
+	// Query - часть имени пользователя или адреса электронной почты, без учета регистра.
+	Query string
+	// Disabled, если задан, оставляет только заблокированных (true) или только активных (false) пользователей.
+	Disabled *bool
+	// Admins оставляет только администраторов.
+	Admins bool
+	Limit  int
+	Offset int
+}
+
+// userColumns - столбцы AdminUser в порядке scanUser. Запрос должен обозначать таблицу users как u.
+const userColumns = `u.id, u.username, COALESCE(u.email, ''), u.email_verified, u.is_admin, u.created_at,
+        u.disabled_at, COALESCE(u.disabled_reason, ''), u.sessions_revoked_at, u.password_reset_required, u.totp_enabled,
+        (SELECT count(*) FILTER (WHERE deleted_at IS NULL) FROM notes WHERE user_id = u.id),
+        (SELECT count(*) FILTER (WHERE deleted_at IS NOT NULL) FROM notes WHERE user_id = u.id),
+        (SELECT COALESCE(sum(octet_length(text)), 0) FROM notes WHERE user_id = u.id),
+        (SELECT COALESCE(sum(size), 0) FROM attachments WHERE user_id = u.id),
+        (SELECT count(*) FROM api_tokens WHERE user_id = u.id AND revoked_at IS NULL
+            AND (expires_at IS NULL OR expires_at > now()))`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (models.AdminUser, error) {
+	var u models.AdminUser
+	err := row.Scan(&u.ID, &u.Username, &u.Email, &u.EmailVerified, &u.IsAdmin, &u.CreatedAt,
+		&u.DisabledAt, &u.DisabledReason, &u.SessionsRevokedAt, &u.PasswordResetRequired, &u.TwoFactorEnabled,
+		&u.Notes, &u.DeletedNotes, &u.NotesBytes, &u.AttachmentBytes, &u.APITokens)
+	return u, err
+}
+
+// Users возвращает пользователей, удовлетворяющих условиям f, в порядке регистрации.
+func (s *Service) Users(ctx context.Context, f Filter) ([]models.AdminUser, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	rows, err := s.db.Query(ctx, `SELECT `+userColumns+` FROM users u
+        WHERE ($1 = '' OR u.username ILIKE $1 ESCAPE '\' OR u.email ILIKE $1 ESCAPE '\')
+            AND ($2::boolean IS NULL OR (u.disabled_at IS NOT NULL) = $2)
+            AND (NOT $3 OR u.is_admin)
+        ORDER BY u.id LIMIT $4 OFFSET $5`,
+		likePattern(f.Query), f.Disabled, f.Admins, limit, max(f.Offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// likePattern превращает строку поиска в шаблон ILIKE, который ищет ее как подстроку.
+func likePattern(query string) string {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return ""
+	}
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
+}
+
+// User возвращает пользователя по имени.
+func (s *Service) User(ctx context.Context, username string) (models.AdminUser, error) {
+	u, err := scanUser(s.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users u WHERE u.username=$1`, username))
+	if err == sql.ErrNoRows {
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+// Disable блокирует учетную запись. Повторная блокировка только меняет причину.
+func (s *Service) Disable(ctx context.Context, actor, username, reason string) error {
+	return s.update(ctx, actor, username, ActionDisable, reason,
+		"disabled_at=COALESCE(disabled_at, now()), disabled_reason=NULLIF($2, '')", reason)
+}
+
+// Enable снимает блокировку учетной записи. Сессии, выданные до блокировки, снова принимаются,
+// если они не были отозваны.
+func (s *Service) Enable(ctx context.Context, actor, username string) error {
+	return s.update(ctx, actor, username, ActionEnable, "", "disabled_at=NULL, disabled_reason=NULL")
+}
+
+// RevokeSessions отзывает все выданные пользователю сессии, а если apiTokens - true,
+// то и его персональные токены доступа.
+func (s *Service) RevokeSessions(ctx context.Context, actor, username string, apiTokens bool) error {
+	details := ""
+	if apiTokens {
+		details = "including API tokens"
+	}
+	if err := s.update(ctx, actor, username, ActionRevokeSessions, details, "sessions_revoked_at=now()"); err != nil {
+		return err
+	}
+	if !apiTokens {
+		return nil
+	}
+	_, err := s.db.Exec(ctx, `UPDATE api_tokens t SET revoked_at=now() FROM users u
+        WHERE u.id = t.user_id AND u.username=$1 AND t.revoked_at IS NULL`, username)
+	return err
+}
+
+// RequirePasswordReset запрещает пользователю входить по текущему паролю, отзывает его сессии
+// и отправляет письмо со ссылкой для сброса пароля. Возвращает false, если у пользователя нет
+// адреса электронной почты: тогда новый пароль нужно передать ему другим способом.
+func (s *Service) RequirePasswordReset(ctx context.Context, actor, username string) (mailed bool, err error) {
+	err = s.update(ctx, actor, username, ActionPasswordReset, "",
+		"password_reset_required=TRUE, sessions_revoked_at=now()")
+	if err != nil {
+		return false, err
+	}
+	var email string
+	if err := s.db.QueryRow(ctx, "SELECT COALESCE(email, '') FROM users WHERE username=$1", username).Scan(&email); err != nil {
+		return false, err
+	}
+	if email == "" {
+		return false, nil
+	}
+	if err := s.resetMail(ctx, email); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetAdmin назначает пользователя администратором или снимает это назначение.
+func (s *Service) SetAdmin(ctx context.Context, actor, username string, isAdmin bool) error {
+	action := ActionGrantAdmin
+	if !isAdmin {
+		action = ActionRevokeAdmin
+	}
+	return s.update(ctx, actor, username, action, "", "is_admin=$2", isAdmin)
+}
+
+// update изменяет пользователя username выражением set и записывает действие в журнал одним запросом.
+// Дополнительные параметры выражения set нумеруются с $2.
+func (s *Service) update(ctx context.Context, actor, username, action, details, set string, args ...interface{}) error {
+	n := len(args)
+	args = append([]interface{}{username}, args...)
+	args = append(args, actor, action, details)
+	var id int
+	err := s.db.QueryRow(ctx, `WITH target AS (UPDATE users SET `+set+` WHERE username=$1 RETURNING id)
+        INSERT INTO admin_actions (user_id, actor, action, details)
+        SELECT id, $`+strconv.Itoa(n+2)+`, $`+strconv.Itoa(n+3)+`, $`+strconv.Itoa(n+4)+` FROM target
+        RETURNING id`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Log записывает в журнал действие, которое не меняет учетную запись, например вход от имени пользователя.
+func (s *Service) Log(ctx context.Context, actor string, userID int, action, details string) error {
+	_, err := s.db.Exec(ctx, "INSERT INTO admin_actions (user_id, actor, action, details) VALUES ($1, $2, $3, $4)",
+		userID, actor, action, details)
+	return err
+}
+
+// Actions возвращает последние записи журнала, от новых к старым. Если username не пуст,
+// только действия над этим пользователем.
+func (s *Service) Actions(ctx context.Context, username string, limit int) ([]models.AdminAction, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	rows, err := s.db.Query(ctx, `SELECT a.id, a.actor, u.username, a.action, a.details, a.created_at
+        FROM admin_actions a JOIN users u ON u.id = a.user_id
+        WHERE $1 = '' OR u.username=$1
+        ORDER BY a.id DESC LIMIT $2`, username, min(limit, MaxLimit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []models.AdminAction{}
+	for rows.Next() {
+		var a models.AdminAction
+		if err := rows.Scan(&a.ID, &a.Actor, &a.Username, &a.Action, &a.Details, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,20 @@
+package admin
+
+import "testing"
+
+func TestLikePattern(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"   ":        "",
+		"alice":      "%alice%",
+		"  Алиса ":   "%Алиса%",
+		"100%":       `%100\%%`,
+		"user_1":     `%user\_1%`,
+		`domain\bob`: `%domain\\bob%`,
+	}
+	for query, want := range tests {
+		if got := likePattern(query); got != want {
+			t.Errorf("likePattern(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
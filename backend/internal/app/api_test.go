@@ -0,0 +1,677 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore/s3test"
+	"github.com/NickolaiP/notes_app/backend/internal/hand"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+	"github.com/NickolaiP/notes_app/backend/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	e := newTestEnv(t)
+
+	resp := e.do(http.MethodPost, "/register", url.Values{
+		"username": {"alice"},
+		"password": {"secret"},
+		"email":    {"Alice@Example.com"},
+	})
+	e.expect(resp, http.StatusOK)
+
+	var email string
+	if err := e.db.QueryRow(context.Background(), "SELECT email FROM users WHERE username='alice'").Scan(&email); err != nil {
+		t.Fatalf("registered user: %v", err)
+	}
+	if email != "alice@example.com" {
+		t.Errorf("email = %q, want it normalized", email)
+	}
+
+	// Имя пользователя уникально.
+	resp = e.do(http.MethodPost, "/register", url.Values{"username": {"alice"}, "password": {"other"}})
+	e.expect(resp, http.StatusInternalServerError)
+
+	resp = e.do(http.MethodPost, "/register", url.Values{"username": {"bob"}, "password": {"x"}, "email": {"not an email"}})
+	e.expect(resp, http.StatusBadRequest)
+
+	session := e.login(userFixture{Username: "alice", Password: "secret"})
+	e.expect(e.do(http.MethodGet, "/notes", nil, withSession(session)), http.StatusOK)
+
+	for name, form := range map[string]url.Values{
+		"wrong password": {"username": {"alice"}, "password": {"wrong"}},
+		"unknown user":   {"username": {"nobody"}, "password": {"secret"}},
+		"empty form":     {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := e.sub(t)
+			resp := e.do(http.MethodPost, "/login", form)
+			e.expect(resp, http.StatusUnauthorized)
+			if len(resp.Cookies()) != 0 {
+				t.Errorf("failed login set cookies %v", resp.Cookies())
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser("dave", withEmail("dave@example.com"))
+	session := e.login(user)
+
+	// Токен сброса создается напрямую, как его создает запрос письма: в базе хранится только хэш.
+	sum := sha256.Sum256([]byte("reset-token"))
+	_, err := e.db.Exec(context.Background(), `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+        VALUES ($1, 'password_reset', $2, now() + interval '1 hour')`, user.ID, hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("create reset token: %v", err)
+	}
+
+	form := url.Values{"token": {"reset-token"}, "password": {"new password"}}
+	e.expect(e.do(http.MethodPost, "/password/reset", form), http.StatusOK)
+	// Токен одноразовый.
+	e.expect(e.do(http.MethodPost, "/password/reset", form), http.StatusBadRequest)
+
+	// Сессии, выданные до сброса, больше не принимаются.
+	e.expect(e.do(http.MethodGet, "/notes", nil, withSession(session)), http.StatusUnauthorized)
+
+	resp := e.do(http.MethodPost, "/login", url.Values{"username": {user.Username}, "password": {user.Password}})
+	e.expect(resp, http.StatusUnauthorized)
+	resp = e.do(http.MethodPost, "/login", url.Values{"username": {user.Username}, "password": {"new password"}})
+	e.expect(resp, http.StatusOK)
+}
+
+func TestLoginTwoFactorChallenge(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser("carol", withTwoFactor())
+
+	resp := e.do(http.MethodPost, "/login", url.Values{"username": {user.Username}, "password": {user.Password}})
+	e.expect(resp, http.StatusOK)
+	if len(resp.Cookies()) != 0 {
+		t.Fatalf("login with 2FA set cookies %v before the second factor", resp.Cookies())
+	}
+	var challenge struct {
+		Required bool   `json:"two_factor_required"`
+		Token    string `json:"challenge_token"`
+	}
+	e.decode(resp, &challenge)
+	if !challenge.Required || challenge.Token == "" {
+		t.Fatalf("login response %q, want a challenge", resp.Body)
+	}
+
+	// Challenge-токен не является сессией.
+	e.expect(e.do(http.MethodGet, "/notes", nil, withBearer(challenge.Token)), http.StatusUnauthorized)
+	e.expect(e.do(http.MethodGet, "/notes", nil, withSession(challenge.Token)), http.StatusUnauthorized)
+
+	// После пяти неверных кодов challenge-токен больше не принимается.
+	form := url.Values{"challenge_token": {challenge.Token}, "recovery_code": {"wrong"}}
+	for i := 0; i < 5; i++ {
+		resp := e.do(http.MethodPost, "/login/2fa", form)
+		e.expect(resp, http.StatusUnauthorized)
+		if !strings.Contains(resp.Body, "Invalid code") {
+			t.Fatalf("attempt %d: response %q, want invalid code", i+1, resp.Body)
+		}
+	}
+	resp = e.do(http.MethodPost, "/login/2fa", form)
+	e.expect(resp, http.StatusUnauthorized)
+	if !strings.Contains(resp.Body, "Invalid or expired challenge") {
+		t.Fatalf("attempt after the limit: response %q, want the challenge rejected", resp.Body)
+	}
+}
+
+func TestLoginTwoFactorDisabledAccount(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser("carol", withTwoFactor())
+	sum := sha256.Sum256([]byte("abcd1234"))
+	_, err := e.db.Exec(context.Background(), "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+		user.ID, hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("create recovery code: %v", err)
+	}
+
+	resp := e.do(http.MethodPost, "/login", url.Values{"username": {user.Username}, "password": {user.Password}})
+	e.expect(resp, http.StatusOK)
+	var challenge struct {
+		Token string `json:"challenge_token"`
+	}
+	e.decode(resp, &challenge)
+
+	// Учетную запись заблокировали, пока пользователь вводил второй фактор.
+	if _, err := e.db.Exec(context.Background(), "UPDATE users SET disabled_at=now() WHERE id=$1", user.ID); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+	resp = e.do(http.MethodPost, "/login/2fa", url.Values{"challenge_token": {challenge.Token}, "recovery_code": {"ABCD-1234"}})
+	e.expect(resp, http.StatusForbidden)
+	if !strings.Contains(resp.Body, "Account is disabled") {
+		t.Errorf("response %q, want account disabled", resp.Body)
+	}
+	if len(resp.Cookies()) != 0 {
+		t.Errorf("second factor for a disabled account set cookies %v", resp.Cookies())
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.NewServer("notes", "secret")
+	t.Cleanup(idp.Close)
+	e := newTestEnv(t, withOIDC("corp", idp, true), withOIDC("strict", idp, false))
+
+	callback := func(state *http.Cookie, q url.Values) response {
+		t.Helper()
+		return e.do(http.MethodGet, "/auth/oidc/callback", q, withCookie(state))
+	}
+	sessionOf := func(resp response) string {
+		t.Helper()
+		for _, c := range resp.Cookies() {
+			if c.Name == "token" && c.Value != "" {
+				return c.Value
+			}
+		}
+		t.Fatalf("callback response has no session cookie")
+		return ""
+	}
+
+	// Первый вход создает пользователя и привязывает к нему учетную запись провайдера.
+	idp.SetUser(oidctest.User{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"})
+	resp := callback(e.startOIDCLogin("corp"))
+	e.expect(resp, http.StatusOK)
+	var result struct {
+		Username string `json:"username"`
+	}
+	e.decode(resp, &result)
+	if result.Username != "alice" {
+		t.Fatalf("provisioned username = %q, want alice", result.Username)
+	}
+	e.expect(e.do(http.MethodGet, "/notes", nil, withSession(sessionOf(resp))), http.StatusOK)
+
+	// Повторный вход находит того же пользователя по привязке.
+	resp = callback(e.startOIDCLogin("corp"))
+	e.expect(resp, http.StatusOK)
+	e.decode(resp, &result)
+	if result.Username != "alice" {
+		t.Errorf("second login username = %q, want alice", result.Username)
+	}
+
+	t.Run("state mismatch", func(t *testing.T) {
+		e := e.sub(t)
+		state, q := e.startOIDCLogin("corp")
+		q.Set("state", "forged")
+		e.expect(e.do(http.MethodGet, "/auth/oidc/callback", q, withCookie(state)), http.StatusBadRequest)
+	})
+	t.Run("no state cookie", func(t *testing.T) {
+		e := e.sub(t)
+		_, q := e.startOIDCLogin("corp")
+		e.expect(e.do(http.MethodGet, "/auth/oidc/callback", q), http.StatusBadRequest)
+	})
+	t.Run("code reused", func(t *testing.T) {
+		e := e.sub(t)
+		state, q := e.startOIDCLogin("corp")
+		e.expect(e.do(http.MethodGet, "/auth/oidc/callback", q, withCookie(state)), http.StatusOK)
+		e.expect(e.do(http.MethodGet, "/auth/oidc/callback", q, withCookie(state)), http.StatusUnauthorized)
+	})
+	t.Run("unknown provider", func(t *testing.T) {
+		e := e.sub(t)
+		e.expect(e.do(http.MethodGet, "/auth/oidc/login", url.Values{"provider": {"other"}}), http.StatusNotFound)
+	})
+
+	// Без автоматического создания пользователей непривязанная учетная запись не входит,
+	// пока пользователь не привяжет ее, войдя по паролю.
+	bob := e.createUser("bob")
+	idp.SetUser(oidctest.User{Subject: "sub-bob", PreferredUsername: "bobby"})
+	e.expect(callback(e.startOIDCLogin("strict")), http.StatusForbidden)
+
+	e.expect(callback(e.startOIDCLogin("strict", withSession(e.login(bob)))), http.StatusOK)
+	resp = callback(e.startOIDCLogin("strict"))
+	e.expect(resp, http.StatusOK)
+	e.decode(resp, &result)
+	if result.Username != "bob" {
+		t.Errorf("linked login username = %q, want bob", result.Username)
+	}
+
+	// Учетную запись, привязанную к bob, нельзя привязать к другому пользователю.
+	carol := e.createUser("carol")
+	e.expect(callback(e.startOIDCLogin("strict", withSession(e.login(carol)))), http.StatusConflict)
+
+	// Вход через провайдер не обходит запреты, установленные администратором.
+	for _, tc := range []struct{ column, body string }{
+		{"disabled_at=now()", "Account is disabled"},
+		{"password_reset_required=TRUE", "Password reset required"},
+	} {
+		t.Run(tc.body, func(t *testing.T) {
+			e := e.sub(t)
+			if _, err := e.db.Exec(context.Background(), "UPDATE users SET "+tc.column+" WHERE id=$1", bob.ID); err != nil {
+				t.Fatalf("update bob: %v", err)
+			}
+			t.Cleanup(func() {
+				e.db.Exec(context.Background(), "UPDATE users SET disabled_at=NULL, password_reset_required=FALSE WHERE id=$1", bob.ID)
+			})
+			resp := callback(e.startOIDCLogin("strict"))
+			e.expect(resp, http.StatusForbidden)
+			if !strings.Contains(resp.Body, tc.body) {
+				t.Errorf("response %q, want %q", resp.Body, tc.body)
+			}
+		})
+	}
+}
+
+func TestNotes(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.createUser("alice")
+	session := e.login(alice)
+
+	resp := e.do(http.MethodPost, "/notes", url.Values{"text": {"первая заметка"}, "spellcheck": {"false"}}, withSession(session))
+	e.expect(resp, http.StatusOK)
+	location := resp.Header.Get("Location")
+	path, ok := strings.CutPrefix(location, "/notes/")
+	id, err := strconv.Atoi(path)
+	if !ok || err != nil {
+		t.Fatalf("Location = %q", location)
+	}
+	second := e.createNote(alice, "вторая заметка")
+
+	resp = e.do(http.MethodGet, "/notes", nil, withSession(session))
+	e.expect(resp, http.StatusOK)
+	var notes []models.Note
+	e.decode(resp, &notes)
+	if len(notes) != 2 || notes[0].ID != id || notes[1].ID != second.ID {
+		t.Fatalf("notes = %+v, want %d and %d", notes, id, second.ID)
+	}
+	if notes[0].Text != "первая заметка" || notes[0].SpellcheckStatus != "skipped" || notes[0].Format != "plain" {
+		t.Errorf("created note = %+v", notes[0])
+	}
+
+	resp = e.do(http.MethodPost, "/notes", url.Values{"text": {"x"}, "format": {"html"}}, withSession(session))
+	e.expect(resp, http.StatusBadRequest)
+
+	resp = e.do(http.MethodDelete, "/notes", url.Values{"id": {strconv.Itoa(id)}}, withSession(session))
+	e.expect(resp, http.StatusOK)
+	if !e.noteDeleted(id) {
+		t.Errorf("note %d is not deleted", id)
+	}
+
+	resp = e.do(http.MethodGet, "/notes", nil, withSession(session))
+	e.expect(resp, http.StatusOK)
+	notes = nil
+	e.decode(resp, &notes)
+	if len(notes) != 1 || notes[0].ID != second.ID {
+		t.Fatalf("notes after delete = %+v, want only %d", notes, second.ID)
+	}
+
+	// Удаленную заметку нельзя удалить повторно.
+	resp = e.do(http.MethodDelete, "/notes", url.Values{"id": {strconv.Itoa(id)}}, withSession(session))
+	e.expect(resp, http.StatusNotFound)
+	e.expect(e.do(http.MethodDelete, "/notes", url.Values{"id": {"abc"}}, withSession(session)), http.StatusBadRequest)
+}
+
+func TestNotesOfAnotherUser(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.createUser("alice")
+	bob := e.createUser("bob")
+	note := e.createNote(alice, "заметка alice")
+	session := e.login(bob)
+
+	resp := e.do(http.MethodGet, "/notes", nil, withSession(session))
+	e.expect(resp, http.StatusOK)
+	var notes []models.Note
+	e.decode(resp, &notes)
+	if len(notes) != 0 {
+		t.Errorf("bob sees notes %+v", notes)
+	}
+
+	// Чужая заметка для пользователя не существует.
+	e.expect(e.do(http.MethodDelete, "/notes", url.Values{"id": {strconv.Itoa(note.ID)}}, withSession(session)), http.StatusNotFound)
+	e.expect(e.do(http.MethodGet, "/notes/"+strconv.Itoa(note.ID), nil, withSession(session)), http.StatusNotFound)
+	if e.noteDeleted(note.ID) {
+		t.Errorf("bob deleted alice's note")
+	}
+}
+
+func TestSyncAccessChanges(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.createUser("alice")
+	bob := e.createUser("bob")
+	note := e.createNote(alice, "заметка alice")
+	aliceSession, bobSession := e.login(alice), e.login(bob)
+	notePath := "/notes/" + strconv.Itoa(note.ID)
+
+	type syncResponse struct {
+		Changes []models.SyncChange `json:"changes"`
+		Token   string              `json:"token"`
+	}
+	sync := func(since string) syncResponse {
+		t.Helper()
+		resp := e.do(http.MethodGet, "/sync", url.Values{"since": {since}}, withSession(bobSession))
+		e.expect(resp, http.StatusOK)
+		var s syncResponse
+		e.decode(resp, &s)
+		return s
+	}
+	s := sync("")
+	if len(s.Changes) != 0 {
+		t.Fatalf("initial sync = %+v, want no notes", s.Changes)
+	}
+
+	// Доступ к заметке не меняет ее, но лента должна отдать ее получателю.
+	e.expect(e.do(http.MethodPost, notePath+"/shares", url.Values{"username": {"bob"}, "role": {"viewer"}}, withSession(aliceSession)), http.StatusCreated)
+	s = sync(s.Token)
+	if len(s.Changes) != 1 || s.Changes[0].ID != note.ID || s.Changes[0].Deleted || s.Changes[0].Text != note.Text {
+		t.Fatalf("sync after share = %+v, want the shared note", s.Changes)
+	}
+
+	// После отзыва доступа заметка приходит как удаленная и без текста.
+	e.expect(e.do(http.MethodDelete, notePath+"/shares/bob", nil, withSession(aliceSession)), http.StatusOK)
+	s = sync(s.Token)
+	if len(s.Changes) != 1 || s.Changes[0].ID != note.ID || !s.Changes[0].Deleted || s.Changes[0].Text != "" {
+		t.Fatalf("sync after revoke = %+v, want a tombstone", s.Changes)
+	}
+}
+
+func TestAttachmentsS3(t *testing.T) {
+	s3 := s3test.NewServer("access", "secret", "attachments")
+	t.Cleanup(s3.Close)
+	e := newTestEnv(t, withS3(s3, "attachments"))
+	alice := e.createUser("alice")
+	note := e.createNote(alice, "заметка с вложением")
+	session := e.login(alice)
+	attachmentsPath := "/notes/" + strconv.Itoa(note.ID) + "/attachments"
+
+	resp := e.upload(attachmentsPath, "список.txt", "молоко\nхлеб\n", withSession(session))
+	e.expect(resp, http.StatusCreated)
+	var a models.Attachment
+	e.decode(resp, &a)
+	if a.Filename != "список.txt" || a.Size != int64(len("молоко\nхлеб\n")) || !strings.HasPrefix(a.ContentType, "text/plain") {
+		t.Errorf("attachment = %+v", a)
+	}
+	if s3.Len("attachments") != 1 {
+		t.Fatalf("bucket has %d objects, want 1", s3.Len("attachments"))
+	}
+	var orphaned int
+	if err := e.db.QueryRow(context.Background(), "SELECT count(*) FROM orphaned_blobs").Scan(&orphaned); err != nil {
+		t.Fatal(err)
+	}
+	if orphaned != 0 {
+		t.Errorf("orphaned_blobs has %d keys after a successful upload", orphaned)
+	}
+
+	attachmentPath := attachmentsPath + "/" + strconv.Itoa(a.ID)
+	resp = e.do(http.MethodGet, attachmentPath, nil, withSession(session))
+	e.expect(resp, http.StatusOK)
+	if resp.Body != "молоко\nхлеб\n" {
+		t.Errorf("downloaded %q", resp.Body)
+	}
+
+	e.expect(e.do(http.MethodDelete, attachmentPath, nil, withSession(session)), http.StatusOK)
+	if s3.Len("attachments") != 0 {
+		t.Errorf("bucket has %d objects after delete, want 0", s3.Len("attachments"))
+	}
+	e.expect(e.do(http.MethodGet, attachmentPath, nil, withSession(session)), http.StatusNotFound)
+}
+
+func TestAttachmentsS3Unavailable(t *testing.T) {
+	// Бакета нет: хранилище отклоняет загрузку.
+	s3 := s3test.NewServer("access", "secret")
+	t.Cleanup(s3.Close)
+	e := newTestEnv(t, withS3(s3, "attachments"))
+	alice := e.createUser("alice")
+	note := e.createNote(alice, "заметка")
+	session := e.login(alice)
+	attachmentsPath := "/notes/" + strconv.Itoa(note.ID) + "/attachments"
+
+	e.expect(e.upload(attachmentsPath, "a.txt", "a", withSession(session)), http.StatusInternalServerError)
+
+	// Ключ остается в orphaned_blobs, чтобы Sweeper удалил объект, если он все же был записан.
+	var orphaned int
+	if err := e.db.QueryRow(context.Background(), "SELECT count(*) FROM orphaned_blobs").Scan(&orphaned); err != nil {
+		t.Fatal(err)
+	}
+	if orphaned != 1 {
+		t.Errorf("orphaned_blobs has %d keys, want 1", orphaned)
+	}
+	resp := e.do(http.MethodGet, attachmentsPath, nil, withSession(session))
+	e.expect(resp, http.StatusOK)
+	var list []models.Attachment
+	e.decode(resp, &list)
+	if len(list) != 0 {
+		t.Errorf("attachments = %+v, want none", list)
+	}
+}
+
+func TestAttachmentsQuotaConcurrent(t *testing.T) {
+	e := newTestEnv(t, withQuota(10))
+	alice := e.createUser("alice")
+	note := e.createNote(alice, "заметка")
+	session := e.login(alice)
+	attachmentsPath := "/notes/" + strconv.Itoa(note.ID) + "/attachments"
+
+	// Каждая загрузка по отдельности помещается в квоту, но вместе поместятся только две.
+	const uploads = 8
+	statuses := make(chan int, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- e.upload(attachmentsPath, "a.txt", "1234", withSession(session)).StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusInsufficientStorage:
+		default:
+			t.Errorf("upload status %d", status)
+		}
+	}
+	if created != 2 {
+		t.Errorf("%d uploads accepted, want 2", created)
+	}
+	var used int64
+	if err := e.db.QueryRow(context.Background(), "SELECT COALESCE(SUM(size), 0) FROM attachments").Scan(&used); err != nil {
+		t.Fatal(err)
+	}
+	if used > 10 {
+		t.Errorf("stored %d bytes, quota is 10", used)
+	}
+}
+
+func TestViewLinkHTML(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.createUser("alice")
+	note := e.createNote(alice, "заметка")
+	session := e.login(alice)
+	if _, err := e.db.Exec(context.Background(), "UPDATE notes SET format='markdown', text=$2 WHERE id=$1",
+		note.ID, "# Заголовок\n\n<script>alert(1)</script>"); err != nil {
+		t.Fatal(err)
+	}
+
+	createLink := func(form url.Values) string {
+		t.Helper()
+		resp := e.do(http.MethodPost, "/notes/"+strconv.Itoa(note.ID)+"/links", form, withSession(session))
+		e.expect(resp, http.StatusCreated)
+		var link struct {
+			URL string `json:"url"`
+		}
+		e.decode(resp, &link)
+		path, ok := strings.CutPrefix(link.URL, testIssuer)
+		if !ok {
+			t.Fatalf("link URL = %q", link.URL)
+		}
+		return path
+	}
+	const csp = "default-src 'none'; img-src http: https:; style-src 'unsafe-inline'"
+
+	// HTML-страница заметки получает ту же политику, что и GET /notes/{id}?render=html.
+	resp := e.do(http.MethodGet, createLink(nil), url.Values{"format": {"html"}})
+	e.expect(resp, http.StatusOK)
+	if got := resp.Header.Get("Content-Security-Policy"); got != csp {
+		t.Errorf("Content-Security-Policy = %q, want %q", got, csp)
+	}
+	if strings.Contains(resp.Body, "<script>") || !strings.Contains(resp.Body, "<h1") {
+		t.Errorf("page body = %q", resp.Body)
+	}
+
+	// Форма пароля тоже отдается с политикой.
+	resp = e.do(http.MethodGet, createLink(url.Values{"password": {"secret"}}), url.Values{"format": {"html"}})
+	e.expect(resp, http.StatusUnauthorized)
+	if got := resp.Header.Get("Content-Security-Policy"); got != csp {
+		t.Errorf("password page Content-Security-Policy = %q, want %q", got, csp)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	e := newTestEnv(t)
+	alice := e.createUser("alice")
+	session := e.login(alice)
+	readToken := e.createAPIToken(session, hand.ScopeNotesRead)
+	writeToken := e.createAPIToken(session, hand.ScopeNotesRead, hand.ScopeNotesWrite)
+
+	expired := signToken(t, &hand.Claims{
+		Username: alice.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+	}, testJWTKey)
+	foreignKey := signToken(t, &hand.Claims{Username: alice.Username}, "another-key")
+	foreignAudience := signToken(t, &hand.Claims{
+		Username:         alice.Username,
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"other_app"}},
+	}, testJWTKey)
+	valid := signToken(t, &hand.Claims{Username: alice.Username}, testJWTKey)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		form   url.Values
+		auth   []auth
+		status int
+	}{
+		{"no credentials", http.MethodGet, "/notes", nil, nil, http.StatusUnauthorized},
+		{"session cookie", http.MethodGet, "/notes", nil, []auth{withSession(session)}, http.StatusOK},
+		{"session bearer", http.MethodGet, "/notes", nil, []auth{withBearer(session)}, http.StatusOK},
+		{"malformed cookie", http.MethodGet, "/notes", nil, []auth{withSession("garbage")}, http.StatusUnauthorized},
+		{"malformed bearer", http.MethodGet, "/notes", nil, []auth{withBearer("garbage")}, http.StatusUnauthorized},
+		{"expired token", http.MethodGet, "/notes", nil, []auth{withSession(expired)}, http.StatusUnauthorized},
+		{"foreign key", http.MethodGet, "/notes", nil, []auth{withSession(foreignKey)}, http.StatusUnauthorized},
+		{"foreign audience", http.MethodGet, "/notes", nil, []auth{withSession(foreignAudience)}, http.StatusUnauthorized},
+		{"signed token", http.MethodGet, "/notes", nil, []auth{withSession(valid)}, http.StatusOK},
+		// Заголовок Authorization важнее cookie.
+		{"bearer over cookie", http.MethodGet, "/notes", nil, []auth{withSession(session), withBearer("garbage")}, http.StatusUnauthorized},
+
+		{"API token", http.MethodGet, "/notes", nil, []auth{withBearer(readToken)}, http.StatusOK},
+		{"API token without scope", http.MethodPost, "/notes", url.Values{"text": {"x"}, "spellcheck": {"false"}}, []auth{withBearer(readToken)}, http.StatusForbidden},
+		{"API token with scope", http.MethodPost, "/notes", url.Values{"text": {"x"}, "spellcheck": {"false"}}, []auth{withBearer(writeToken)}, http.StatusOK},
+		{"API token without all scopes", http.MethodPost, "/sync", nil, []auth{withBearer(writeToken)}, http.StatusForbidden},
+		{"API token on account route", http.MethodGet, "/me/tokens", nil, []auth{withBearer(writeToken)}, http.StatusForbidden},
+		{"unknown API token", http.MethodGet, "/notes", nil, []auth{withBearer(readToken + "x")}, http.StatusUnauthorized},
+		{"API token in cookie", http.MethodGet, "/notes", nil, []auth{withSession(readToken)}, http.StatusUnauthorized},
+		{"session on account route", http.MethodGet, "/me/tokens", nil, []auth{withSession(session)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := e.sub(t)
+			e.expect(e.do(tt.method, tt.path, tt.form, tt.auth...), tt.status)
+		})
+	}
+
+	// Отозванный токен больше не принимается.
+	var tokenID int
+	err := e.db.QueryRow(context.Background(), "SELECT id FROM api_tokens WHERE user_id=$1 ORDER BY id LIMIT 1", alice.ID).Scan(&tokenID)
+	if err != nil {
+		t.Fatalf("API token: %v", err)
+	}
+	e.expect(e.do(http.MethodDelete, "/me/tokens/"+strconv.Itoa(tokenID), nil, withSession(session)), http.StatusOK)
+	e.expect(e.do(http.MethodGet, "/notes", nil, withBearer(readToken)), http.StatusUnauthorized)
+}
+
+func TestAdmin(t *testing.T) {
+	e := newTestEnv(t)
+	root := e.createUser("root", withAdmin())
+	alice := e.createUser("alice")
+	e.createNote(alice, "заметка alice")
+	adminSession := e.login(root)
+	aliceSession := e.login(alice)
+
+	// Обычному пользователю административный API недоступен.
+	e.expect(e.do(http.MethodGet, "/admin/users", nil, withSession(aliceSession)), http.StatusForbidden)
+
+	resp := e.do(http.MethodGet, "/admin/users", url.Values{"q": {"ALI"}}, withSession(adminSession))
+	e.expect(resp, http.StatusOK)
+	var users []models.AdminUser
+	e.decode(resp, &users)
+	if len(users) != 1 || users[0].Username != "alice" || users[0].Notes != 1 {
+		t.Fatalf("users = %+v, want alice with 1 note", users)
+	}
+
+	t.Run("disable", func(t *testing.T) {
+		e := e.sub(t)
+		e.expect(e.do(http.MethodPost, "/admin/users/root/disable", nil, withSession(adminSession)), http.StatusBadRequest)
+		e.expect(e.do(http.MethodPost, "/admin/users/nobody/disable", nil, withSession(adminSession)), http.StatusNotFound)
+
+		e.expect(e.do(http.MethodPost, "/admin/users/alice/disable", url.Values{"reason": {"spam"}}, withSession(adminSession)), http.StatusOK)
+		e.expect(e.do(http.MethodGet, "/notes", nil, withSession(aliceSession)), http.StatusForbidden)
+		e.expect(e.do(http.MethodPost, "/login", url.Values{"username": {"alice"}, "password": {alice.Password}}), http.StatusForbidden)
+
+		// После снятия блокировки прежняя сессия снова принимается.
+		e.expect(e.do(http.MethodPost, "/admin/users/alice/enable", nil, withSession(adminSession)), http.StatusOK)
+		e.expect(e.do(http.MethodGet, "/notes", nil, withSession(aliceSession)), http.StatusOK)
+	})
+
+	t.Run("impersonate", func(t *testing.T) {
+		e := e.sub(t)
+		resp := e.do(http.MethodPost, "/admin/users/alice/impersonate", nil, withSession(adminSession))
+		e.expect(resp, http.StatusOK)
+		var session struct {
+			Token string `json:"token"`
+		}
+		e.decode(resp, &session)
+
+		resp = e.do(http.MethodGet, "/notes", nil, withBearer(session.Token))
+		e.expect(resp, http.StatusOK)
+		var notes []models.Note
+		e.decode(resp, &notes)
+		if len(notes) != 1 {
+			t.Errorf("impersonated notes = %+v, want alice's note", notes)
+		}
+		// Сессия от имени пользователя дает только чтение.
+		e.expect(e.do(http.MethodPost, "/notes", url.Values{"text": {"новая"}}, withBearer(session.Token)), http.StatusForbidden)
+		e.expect(e.do(http.MethodGet, "/admin/users", nil, withBearer(session.Token)), http.StatusForbidden)
+	})
+
+	t.Run("revoke sessions", func(t *testing.T) {
+		e := e.sub(t)
+		e.expect(e.do(http.MethodPost, "/admin/users/alice/sessions/revoke", nil, withSession(adminSession)), http.StatusOK)
+		e.expect(e.do(http.MethodGet, "/notes", nil, withSession(aliceSession)), http.StatusUnauthorized)
+	})
+
+	resp = e.do(http.MethodGet, "/admin/actions", url.Values{"username": {"alice"}}, withSession(adminSession))
+	e.expect(resp, http.StatusOK)
+	var actions []models.AdminAction
+	e.decode(resp, &actions)
+	var got []string
+	for _, a := range actions {
+		if a.Actor != "root" {
+			t.Errorf("action %s by %q, want root", a.Action, a.Actor)
+		}
+		got = append(got, a.Action)
+	}
+	want := []string{"revoke_sessions", "impersonate", "enable", "disable"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("actions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,336 @@
+// Package app собирает сервис заметок из конфигурации: подключается к базе данных, создает
+// компоненты и маршрутизатор HTTP-запросов, запускает HTTP-сервер и фоновые обработчики
+// и останавливает их. Его используют cmd/api и интеграционные тесты.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/cmd/speller"
+	"github.com/NickolaiP/notes_app/backend/internal/admin"
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/collab"
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/events"
+	"github.com/NickolaiP/notes_app/backend/internal/hand"
+	"github.com/NickolaiP/notes_app/backend/internal/importer"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/jwtkeys"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/mailer"
+	"github.com/NickolaiP/notes_app/backend/internal/oidc"
+	"github.com/NickolaiP/notes_app/backend/internal/trash"
+)
+
+// startTimeout ограничивает запуск фоновых обработчиков в Run.
+const startTimeout = 10 * time.Second
+
+// Hook - фоновый компонент, который запускается вместе с сервером и останавливается после него.
+// Start вызывается до того, как сервер начнет принимать запросы; ctx ограничивает только запуск.
+// Stop вызывается после остановки сервера в порядке, обратном запуску; ctx ограничивает ожидание.
+// Любую из функций можно не задавать.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// App - сервис заметок: база данных, HTTP-сервер и фоновые обработчики.
+type App struct {
+	cfg    *config.Config
+	db     database.Database
+	logger *logger.Logger
+
+	hub    *events.Hub
+	queue  *jobs.Queue
+	router http.Handler
+	server *http.Server
+
+	mu       sync.Mutex
+	hooks    []Hook
+	started  int
+	shutdown sync.Once
+	stopErr  error
+}
+
+// New подключается к базе данных, применяет миграции и создает компоненты сервиса.
+// Фоновые обработчики и HTTP-сервер запускаются вызовом Run (или Start, если запросы
+// обслуживает другой сервер, например httptest.Server в тестах).
+func New(cfg *config.Config, logger *logger.Logger) (*App, error) {
+	if (cfg.Server.TLSCertFile == "") != (cfg.Server.TLSKeyFile == "") {
+		return nil, errors.New("both TLS_CERT_FILE and TLS_KEY_FILE must be set to enable TLS")
+	}
+
+	// Инициализация подключения к базе данных
+	db, err := database.NewPostgresDB(cfg.DB)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	a := &App{cfg: cfg, db: db, logger: logger}
+	if err := a.init(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *App) init() error {
+	cfg, db, logger := a.cfg, a.db, a.logger
+
+	// Применение миграций базы данных перед запуском сервера
+	if pg, ok := db.(*database.PostgresDB); ok {
+		database.RunMigrations(pg.DB)
+	}
+
+	// Инициализация сервиса отправки писем
+	mail, err := mailer.New(cfg.Mailer, logger)
+	if err != nil {
+		return fmt.Errorf("initialize mailer: %w", err)
+	}
+
+	// Загрузка ключей подписи JWT токенов
+	keys, err := jwtkeys.Load(cfg.JWT)
+	if err != nil {
+		return fmt.Errorf("load JWT signing keys: %w", err)
+	}
+	auth := hand.NewAuth(db, keys, cfg.JWT)
+
+	// Рассылка событий изменений заметок через LISTEN/NOTIFY
+	a.hub = events.NewHub(db, database.ConnString(cfg.DB), logger)
+	a.addHubHook()
+
+	// Очередь фоновых заданий: обработчики регистрируются компонентами ниже, а запускается она
+	// после инициализации всех компонентов
+	a.queue = jobs.NewQueue(db, cfg.Jobs, logger)
+	a.AddHook(Hook{
+		Name:  "jobs",
+		Start: a.queue.Start,
+		Stop: func(ctx context.Context) error {
+			// Ждем завершения выполняемых заданий не дольше JOB_SHUTDOWN_TIMEOUT; не успевшие
+			// завершиться прерываются и будут выполнены повторно после запуска.
+			ctx, cancel := context.WithTimeout(ctx, cfg.Jobs.ShutdownTimeout)
+			defer cancel()
+			return a.queue.Shutdown(ctx)
+		},
+	})
+
+	// Инициализация хранилища вложений и периодическое удаление ненужных файлов из него
+	store, err := blobstore.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("initialize blob storage: %w", err)
+	}
+	if err := blobstore.NewSweeper(db, store, logger).Schedule(a.queue); err != nil {
+		return fmt.Errorf("schedule blob sweeper: %w", err)
+	}
+
+	// Периодическое окончательное удаление заметок из корзины
+	if err := trash.NewPurger(db, cfg.Jobs.TrashRetention, logger).Schedule(a.queue); err != nil {
+		return fmt.Errorf("schedule trash purge: %w", err)
+	}
+
+	// Клиент сервиса проверки орфографии с повторами, автоматом защиты и кэшем
+	spellClient := speller.NewClient(cfg.Speller)
+
+	// Фоновая проверка орфографии созданных заметок
+	spellChecker := speller.NewChecker(db, a.queue, spellClient.Check, logger)
+
+	// Фоновый импорт заметок в очереди заданий
+	notesImporter := importer.NewImporter(db, store, a.queue, spellChecker.CheckText, logger)
+
+	// Сеансы совместного редактирования заметок; при фиксации текст проверяется на орфографию.
+	// Соединения WebSocket не отслеживаются сервером, поэтому при остановке участники отключаются,
+	// а документы сохраняются.
+	collabManager := collab.NewManager(db, spellChecker.Enqueue, logger)
+	a.AddHook(Hook{
+		Name: "collab",
+		Stop: func(context.Context) error {
+			collabManager.Close()
+			return nil
+		},
+	})
+
+	// Инициализация обработчиков запросов и маршрутизатора
+	a.router = newRouter(&components{
+		db:           db,
+		auth:         auth,
+		spellClient:  spellClient,
+		spellChecker: spellChecker,
+		users:        hand.NewUserHandler(db, auth, mail, a.queue, cfg.BaseURL, logger),
+		notes:        hand.NewNoteHandler(db, cfg.BaseURL, logger),
+		workspaces:   hand.NewWorkspaceHandler(db, logger),
+		events:       hand.NewEventHandler(db, a.hub, logger),
+		attachments:  hand.NewAttachmentHandler(db, store, cfg.Storage, logger),
+		export:       hand.NewExportHandler(db, store, logger),
+		imports:      hand.NewImportHandler(db, store, notesImporter, logger),
+		collab:       hand.NewCollabHandler(db, collabManager, cfg.BaseURL, logger),
+		oidc:         hand.NewOIDCHandler(db, auth, oidc.NewProviders(cfg.OIDC), logger),
+		health:       hand.NewHealthHandler(db, logger, spellClient),
+		admin:        hand.NewAdminHandler(auth, admin.New(db, a.enqueuePasswordReset), logger),
+	})
+
+	// Создание и настройка HTTP-сервера
+	a.server = &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           a.router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Открытые потоки событий не завершаются сами, поэтому при остановке сервера закрываем их подписки.
+	a.server.RegisterOnShutdown(a.hub.Close)
+	return nil
+}
+
+// enqueuePasswordReset ставит в очередь письмо для сброса пароля, назначенного администратором.
+func (a *App) enqueuePasswordReset(ctx context.Context, email string) error {
+	return hand.EnqueuePasswordReset(ctx, a.queue, email)
+}
+
+// addHubHook регистрирует рассылку событий: она работает, пока не будет остановлена.
+func (a *App) addHubHook() {
+	var stop context.CancelFunc
+	done := make(chan struct{})
+	a.AddHook(Hook{
+		Name: "events",
+		Start: func(context.Context) error {
+			var ctx context.Context
+			ctx, stop = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				if err := a.hub.Run(ctx); err != nil && ctx.Err() == nil {
+					a.logger.Error("Event hub stopped", "error", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stop()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
+
+// AddHook регистрирует фоновый компонент. Компоненты запускаются в порядке регистрации;
+// регистрировать их нужно до вызова Run или Start.
+func (a *App) AddHook(h Hook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks = append(a.hooks, h)
+}
+
+// Router возвращает обработчик всех HTTP-запросов сервиса.
+func (a *App) Router() http.Handler {
+	return a.router
+}
+
+// Start запускает фоновые компоненты. Если один из них не запустился, уже запущенные
+// останавливаются и возвращается ошибка.
+func (a *App) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.started < len(a.hooks) {
+		h := a.hooks[a.started]
+		if h.Start != nil {
+			if err := h.Start(ctx); err != nil {
+				a.stopHooks(ctx)
+				return fmt.Errorf("start %s: %w", h.Name, err)
+			}
+		}
+		a.started++
+	}
+	return nil
+}
+
+// Run запускает фоновые компоненты и HTTP-сервер и работает, пока не будет отменен ctx,
+// после чего останавливает сервис, ожидая запросы и фоновые задания до SERVER_SHUTDOWN_TIMEOUT.
+// Возвращает ошибку, если сервис не удалось запустить или сервер остановился сам.
+func (a *App) Run(ctx context.Context) error {
+	startCtx, cancel := context.WithTimeout(ctx, startTimeout)
+	err := a.Start(startCtx)
+	cancel()
+	if err != nil {
+		a.Shutdown(context.Background())
+		return err
+	}
+
+	tls := a.cfg.Server.TLSCertFile != ""
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if tls {
+			err = a.server.ListenAndServeTLS(a.cfg.Server.TLSCertFile, a.cfg.Server.TLSKeyFile)
+		} else {
+			err = a.server.ListenAndServe()
+		}
+		serveErr <- err
+	}()
+	a.logger.Info("Server started", "addr", a.server.Addr, "tls", tls)
+
+	select {
+	case err = <-serveErr:
+		// Логирование ошибки, если сервер не смог запуститься
+		a.logger.Error("Could not listen on "+a.server.Addr, "error", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if stopErr := a.Shutdown(shutdownCtx); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// Shutdown останавливает HTTP-сервер, дожидаясь обработки начатых запросов, затем фоновые
+// компоненты в обратном порядке и закрывает подключение к базе данных. ctx ограничивает
+// ожидание; по его истечении оставшиеся запросы и задания прерываются. Повторные вызовы
+// возвращают результат первого.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.shutdown.Do(func() {
+		if err := a.server.Shutdown(ctx); err != nil {
+			// Логирование ошибки, если сервер не смог корректно завершить работу
+			a.logger.Error("Server forced to shutdown", "error", err)
+			a.stopErr = err
+		}
+
+		a.mu.Lock()
+		if err := a.stopHooks(ctx); err != nil && a.stopErr == nil {
+			a.stopErr = err
+		}
+		a.mu.Unlock()
+
+		a.db.Close()
+	})
+	return a.stopErr
+}
+
+// stopHooks останавливает запущенные компоненты в обратном порядке и возвращает первую ошибку.
+// Вызывается под a.mu.
+func (a *App) stopHooks(ctx context.Context) error {
+	var first error
+	for ; a.started > 0; a.started-- {
+		h := a.hooks[a.started-1]
+		if h.Stop == nil {
+			continue
+		}
+		if err := h.Stop(ctx); err != nil {
+			a.logger.Error("Background component did not stop cleanly", "component", h.Name, "error", err)
+			if first == nil {
+				first = fmt.Errorf("stop %s: %w", h.Name, err)
+			}
+		}
+	}
+	return first
+}
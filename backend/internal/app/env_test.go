@@ -0,0 +1,479 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore/s3test"
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/hand"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/oidc/oidctest"
+	"github.com/NickolaiP/notes_app/backend/internal/pgtest"
+	"github.com/NickolaiP/notes_app/backend/internal/spellertest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Настройки JWT тестового сервера; ими же подписываются токены, собранные в тестах вручную.
+const (
+	testIssuer   = "http://notes.test"
+	testAudience = "notes_app"
+	testJWTKey   = "integration-test-key"
+	testKeyID    = "hs256"
+)
+
+// pg - временный сервер PostgreSQL, общий для всех тестов пакета; каждый тест получает свою базу.
+var (
+	pg    *pgtest.Server
+	pgErr error
+)
+
+func TestMain(m *testing.M) {
+	pg, pgErr = pgtest.Start()
+	code := m.Run()
+	if pg != nil {
+		pg.Stop()
+	}
+	os.Exit(code)
+}
+
+// testEnv - сервис, собранный так же, как в cmd/api, поверх отдельной базы данных
+// и локального заменителя сервиса проверки орфографии.
+type testEnv struct {
+	t       *testing.T
+	db      database.Database
+	server  *httptest.Server
+	speller *spellertest.Server
+}
+
+// envOption меняет конфигурацию сервиса перед запуском.
+type envOption func(*config.Config)
+
+// newTestEnv создает базу данных, применяет миграции и запускает сервис. Если PostgreSQL
+// недоступен, тест пропускается.
+func newTestEnv(t *testing.T, opts ...envOption) *testEnv {
+	t.Helper()
+	if errors.Is(pgErr, pgtest.ErrUnavailable) {
+		t.Skipf("integration tests need PostgreSQL: %v", pgErr)
+	} else if pgErr != nil {
+		t.Fatalf("start PostgreSQL: %v", pgErr)
+	}
+
+	speller := spellertest.NewServer(nil, nil)
+	t.Cleanup(speller.Close)
+
+	cfg := &config.Config{
+		DB:     pg.NewDatabase(t),
+		Mailer: config.MailerConfig{Driver: "log", From: "notes@localhost"},
+		JWT:    config.JWTConfig{Issuer: testIssuer, Audience: testAudience, HMACKey: testJWTKey},
+		Storage: config.StorageConfig{
+			Driver:      "fs",
+			Dir:         t.TempDir(),
+			MaxFileSize: 1 << 20,
+			UserQuota:   10 << 20,
+		},
+		Jobs: config.JobsConfig{
+			Workers:         1,
+			PollInterval:    50 * time.Millisecond,
+			ShutdownTimeout: 5 * time.Second,
+			TrashRetention:  24 * time.Hour,
+		},
+		Speller: config.SpellerConfig{
+			BaseURL:          speller.URL,
+			Timeout:          time.Second,
+			CacheSize:        100,
+			BreakerThreshold: 5,
+			BreakerCooldown:  time.Second,
+		},
+		BaseURL: testIssuer,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	a, err := New(cfg, logger.InitLogger(io.Discard))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.Start(ctx); err != nil {
+		a.Shutdown(context.Background())
+		t.Fatalf("Start: %v", err)
+	}
+
+	server := httptest.NewServer(a.Router())
+	// Сначала останавливаем HTTP-сервер, затем фоновые обработчики, как при остановке сервиса.
+	t.Cleanup(func() {
+		server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Jobs.ShutdownTimeout)
+		defer cancel()
+		if err := a.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	})
+
+	return &testEnv{t: t, db: a.db, server: server, speller: speller}
+}
+
+// withOIDC подключает провайдер OpenID Connect с именем name.
+func withOIDC(name string, idp *oidctest.Server, autoProvision bool) envOption {
+	return func(cfg *config.Config) {
+		cfg.OIDC = append(cfg.OIDC, config.OIDCProviderConfig{
+			Name:          name,
+			Issuer:        idp.Issuer(),
+			ClientID:      idp.ClientID,
+			ClientSecret:  idp.ClientSecret,
+			RedirectURL:   testIssuer + "/auth/oidc/callback",
+			Scopes:        []string{"openid", "email", "profile"},
+			AutoProvision: autoProvision,
+		})
+	}
+}
+
+// withS3 хранит вложения в бакете bucket локального хранилища S3.
+func withS3(srv *s3test.Server, bucket string) envOption {
+	return func(cfg *config.Config) {
+		cfg.Storage.Driver = "s3"
+		cfg.Storage.S3Endpoint = srv.URL
+		cfg.Storage.S3Region = srv.Region
+		cfg.Storage.S3Bucket = bucket
+		cfg.Storage.S3AccessKey = srv.AccessKey
+		cfg.Storage.S3SecretKey = srv.SecretKey
+		cfg.Storage.S3PathStyle = true
+	}
+}
+
+// withQuota ограничивает суммарный размер вложений пользователя.
+func withQuota(quota int64) envOption {
+	return func(cfg *config.Config) {
+		cfg.Storage.UserQuota = quota
+	}
+}
+
+// sub возвращает окружение для подтеста t: проверки ответов завершают подтест, а не весь тест.
+func (e *testEnv) sub(t *testing.T) *testEnv {
+	c := *e
+	c.t = t
+	return &c
+}
+
+// auth добавляет к запросу учетные данные.
+type auth func(r *http.Request)
+
+// withSession передает сессионный токен в cookie, как браузер.
+func withSession(token string) auth {
+	return func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	}
+}
+
+// withBearer передает токен в заголовке Authorization.
+func withBearer(token string) auth {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// response - ответ сервиса с прочитанным телом.
+type response struct {
+	*http.Response
+	Body string
+}
+
+// do выполняет запрос к сервису. Параметры form передаются в теле запроса для POST и PUT
+// и в строке запроса для остальных методов.
+func (e *testEnv) do(method, path string, form url.Values, auths ...auth) response {
+	e.t.Helper()
+	target := e.server.URL + path
+	var body io.Reader
+	if method == http.MethodPost || method == http.MethodPut {
+		body = strings.NewReader(form.Encode())
+	} else if len(form) > 0 {
+		target += "?" + form.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		e.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, a := range auths {
+		a(req)
+	}
+
+	resp, err := e.server.Client().Do(req)
+	if err != nil {
+		e.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatalf("%s %s: read body: %v", method, path, err)
+	}
+	return response{Response: resp, Body: string(data)}
+}
+
+// upload загружает файл запросом multipart/form-data в поле file.
+func (e *testEnv) upload(path, filename, content string, auths ...auth) response {
+	e.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	io.WriteString(fw, content)
+	if err := mw.Close(); err != nil {
+		e.t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.server.URL+path, &body)
+	if err != nil {
+		e.t.Fatalf("POST %s: %v", path, err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, a := range auths {
+		a(req)
+	}
+	resp, err := e.server.Client().Do(req)
+	if err != nil {
+		e.t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatalf("POST %s: read body: %v", path, err)
+	}
+	return response{Response: resp, Body: string(data)}
+}
+
+// expect проверяет код ответа.
+func (e *testEnv) expect(resp response, status int) {
+	e.t.Helper()
+	if resp.StatusCode != status {
+		e.t.Fatalf("%s %s: status %d, want %d; body: %q",
+			resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, resp.Body)
+	}
+}
+
+// decode разбирает JSON-тело ответа в v.
+func (e *testEnv) decode(resp response, v any) {
+	e.t.Helper()
+	if err := json.Unmarshal([]byte(resp.Body), v); err != nil {
+		e.t.Fatalf("%s %s: decode %q: %v", resp.Request.Method, resp.Request.URL.Path, resp.Body, err)
+	}
+}
+
+// userFixture - пользователь, созданный напрямую в базе данных.
+type userFixture struct {
+	ID       int
+	Username string
+	Password string
+	// Email - подтвержденный адрес электронной почты, если задан.
+	Email string
+	// TwoFactor - включена ли двухфакторная аутентификация.
+	TwoFactor bool
+	// Admin - является ли пользователь администратором.
+	Admin bool
+}
+
+// userOption меняет пользователя перед сохранением.
+type userOption func(*userFixture)
+
+// withEmail задает подтвержденный адрес электронной почты.
+func withEmail(email string) userOption {
+	return func(u *userFixture) { u.Email = email }
+}
+
+// withTwoFactor включает пользователю двухфакторную аутентификацию.
+func withTwoFactor() userOption {
+	return func(u *userFixture) { u.TwoFactor = true }
+}
+
+// withAdmin назначает пользователя администратором.
+func withAdmin() userOption {
+	return func(u *userFixture) { u.Admin = true }
+}
+
+// createUser создает пользователя с паролем "password" и возвращает его.
+func (e *testEnv) createUser(username string, opts ...userOption) userFixture {
+	e.t.Helper()
+	u := userFixture{Username: username, Password: "password"}
+	for _, opt := range opts {
+		opt(&u)
+	}
+	// Для тестов хватает минимальной стоимости хэширования.
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+	if err != nil {
+		e.t.Fatalf("hash password: %v", err)
+	}
+	err = e.db.QueryRow(context.Background(), `INSERT INTO users (username, password, email, email_verified, totp_enabled, is_admin)
+        VALUES ($1, $2, NULLIF($3, ''), $3 <> '', $4, $5) RETURNING id`,
+		u.Username, string(hash), u.Email, u.TwoFactor, u.Admin).Scan(&u.ID)
+	if err != nil {
+		e.t.Fatalf("create user %s: %v", username, err)
+	}
+	return u
+}
+
+// noteFixture - заметка, созданная напрямую в базе данных.
+type noteFixture struct {
+	ID     int
+	UserID int
+	Text   string
+}
+
+// createNote создает личную заметку пользователя без проверки орфографии.
+func (e *testEnv) createNote(user userFixture, text string) noteFixture {
+	e.t.Helper()
+	n := noteFixture{UserID: user.ID, Text: text}
+	err := e.db.QueryRow(context.Background(), "INSERT INTO notes (user_id, text) VALUES ($1, $2) RETURNING id",
+		user.ID, text).Scan(&n.ID)
+	if err != nil {
+		e.t.Fatalf("create note: %v", err)
+	}
+	return n
+}
+
+// noteDeleted сообщает, удалена ли заметка.
+func (e *testEnv) noteDeleted(id int) bool {
+	e.t.Helper()
+	var deleted bool
+	err := e.db.QueryRow(context.Background(), "SELECT deleted_at IS NOT NULL FROM notes WHERE id=$1", id).Scan(&deleted)
+	if err != nil {
+		e.t.Fatalf("note %d: %v", id, err)
+	}
+	return deleted
+}
+
+// login входит под пользователем и возвращает сессионный токен из cookie.
+func (e *testEnv) login(user userFixture) string {
+	e.t.Helper()
+	resp := e.do(http.MethodPost, "/login", url.Values{"username": {user.Username}, "password": {user.Password}})
+	e.expect(resp, http.StatusOK)
+	for _, c := range resp.Cookies() {
+		if c.Name == "token" {
+			return c.Value
+		}
+	}
+	e.t.Fatalf("login %s: no token cookie", user.Username)
+	return ""
+}
+
+// startOIDCLogin начинает вход через провайдер и проходит его страницу входа, не следуя перенаправлениям.
+// Возвращает cookie с параметрами входа и параметры, с которыми провайдер вернул пользователя в сервис.
+func (e *testEnv) startOIDCLogin(provider string, auths ...auth) (*http.Cookie, url.Values) {
+	e.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, err := http.NewRequest(http.MethodGet, e.server.URL+"/auth/oidc/login?"+url.Values{"provider": {provider}}.Encode(), nil)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	for _, a := range auths {
+		a(req)
+	}
+	if len(auths) > 0 {
+		req.URL.RawQuery += "&link=1"
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		e.t.Fatalf("OIDC login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		e.t.Fatalf("OIDC login: status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	var state *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "oidc_state" {
+			state = c
+		}
+	}
+	if state == nil {
+		e.t.Fatal("OIDC login: no oidc_state cookie")
+	}
+
+	resp, err = client.Get(resp.Header.Get("Location"))
+	if err != nil {
+		e.t.Fatalf("OIDC authorize: %v", err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		e.t.Fatalf("OIDC authorize: status %d, no redirect: %v", resp.StatusCode, err)
+	}
+	if location.Path != "/auth/oidc/callback" {
+		e.t.Fatalf("OIDC authorize redirected to %s", location)
+	}
+	return state, location.Query()
+}
+
+// withCookie передает cookie.
+func withCookie(c *http.Cookie) auth {
+	return func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+}
+
+// createAPIToken выпускает пользователю персональный токен доступа с разрешениями scopes.
+func (e *testEnv) createAPIToken(session string, scopes ...string) string {
+	e.t.Helper()
+	resp := e.do(http.MethodPost, "/me/tokens", url.Values{
+		"name":   {"test"},
+		"scopes": {strings.Join(scopes, ",")},
+	}, withSession(session))
+	e.expect(resp, http.StatusCreated)
+	var token struct {
+		Token string `json:"token"`
+	}
+	e.decode(resp, &token)
+	return token.Token
+}
+
+// signToken подписывает утверждения ключом key так же, как сервис подписывает сессии.
+func signToken(t *testing.T, claims *hand.Claims, key string) string {
+	t.Helper()
+	now := time.Now()
+	if claims.Issuer == "" {
+		claims.Issuer = testIssuer
+	}
+	if claims.Audience == nil {
+		claims.Audience = jwt.ClaimStrings{testAudience}
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if claims.NotBefore == nil {
+		claims.NotBefore = claims.IssuedAt
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour))
+	}
+	claims.ID = fmt.Sprintf("test-%d", now.UnixNano())
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString([]byte(key))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
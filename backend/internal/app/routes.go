@@ -0,0 +1,125 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/NickolaiP/notes_app/backend/cmd/speller"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/hand"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// components - обработчики запросов и компоненты, из которых собирается маршрутизатор.
+type components struct {
+	db           database.Database
+	auth         *hand.Auth
+	spellClient  *speller.Client
+	spellChecker *speller.Checker
+
+	users       *hand.UserHandler
+	notes       *hand.NoteHandler
+	workspaces  *hand.WorkspaceHandler
+	events      *hand.EventHandler
+	attachments *hand.AttachmentHandler
+	export      *hand.ExportHandler
+	imports     *hand.ImportHandler
+	collab      *hand.CollabHandler
+	oidc        *hand.OIDCHandler
+	health      *hand.HealthHandler
+	admin       *hand.AdminHandler
+}
+
+// newRouter настраивает маршруты сервиса и разрешает запросы к ним из браузера с других доменов (CORS).
+func newRouter(h *components) http.Handler {
+	r := mux.NewRouter()
+
+	// Настройка маршрутов для регистрации, входа, получения, создания и удаления заметок
+	r.HandleFunc("/healthz", h.health.Health).Methods("GET")
+	r.HandleFunc("/metrics", h.health.Metrics).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", h.auth.JWKS).Methods("GET")
+	r.HandleFunc("/register", h.users.Register).Methods("POST")
+	r.HandleFunc("/login", h.users.Login).Methods("POST")
+	r.HandleFunc("/login/2fa", h.users.LoginTwoFactor).Methods("POST")
+	r.HandleFunc("/2fa/enroll", h.auth.AuthMiddleware(h.users.EnrollTwoFactor)).Methods("POST")
+	r.HandleFunc("/2fa/confirm", h.auth.AuthMiddleware(h.users.ConfirmTwoFactor)).Methods("POST")
+	r.HandleFunc("/2fa/disable", h.auth.AuthMiddleware(h.users.DisableTwoFactor)).Methods("POST")
+	r.HandleFunc("/2fa/recovery-codes", h.auth.AuthMiddleware(h.users.RegenerateRecoveryCodes)).Methods("POST")
+	r.HandleFunc("/auth/oidc/login", h.oidc.Login).Methods("GET")
+	r.HandleFunc("/auth/oidc/callback", h.oidc.Callback).Methods("GET")
+	r.HandleFunc("/me/identities", h.auth.AuthMiddleware(h.oidc.GetIdentities)).Methods("GET")
+	r.HandleFunc("/me/identities/{provider}", h.auth.AuthMiddleware(h.oidc.DeleteIdentity)).Methods("DELETE")
+	r.HandleFunc("/password/forgot", h.users.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", h.users.ResetPassword).Methods("POST")
+	r.HandleFunc("/email/verify", h.users.VerifyEmail).Methods("GET", "POST")
+	r.HandleFunc("/email/verify/resend", h.auth.AuthMiddleware(h.users.ResendVerification)).Methods("POST")
+	r.HandleFunc("/me/email", h.auth.AuthMiddleware(h.users.SetEmail)).Methods("PUT")
+	r.HandleFunc("/me/speller", h.auth.AuthMiddleware(speller.GetSettingsHandler(h.db))).Methods("GET")
+	r.HandleFunc("/me/speller", h.auth.AuthMiddleware(speller.UpdateSettingsHandler(h.db))).Methods("PUT")
+	r.HandleFunc("/me/dictionary", h.auth.AuthMiddleware(speller.GetDictionaryHandler(h.db))).Methods("GET")
+	r.HandleFunc("/me/dictionary", h.auth.AuthMiddleware(speller.AddWordHandler(h.db))).Methods("POST")
+	r.HandleFunc("/me/dictionary/import", h.auth.AuthMiddleware(speller.ImportDictionaryHandler(h.db))).Methods("POST")
+	r.HandleFunc("/me/dictionary/{word}", h.auth.AuthMiddleware(speller.UpdateWordHandler(h.db))).Methods("PUT")
+	r.HandleFunc("/me/dictionary/{word}", h.auth.AuthMiddleware(speller.DeleteWordHandler(h.db))).Methods("DELETE")
+	r.HandleFunc("/spellcheck/preview", h.auth.AuthMiddleware(speller.PreviewHandler(h.db, h.spellClient.Check), hand.ScopeNotesRead)).Methods("POST")
+	r.HandleFunc("/me/tokens", h.auth.AuthMiddleware(h.users.CreateAPIToken)).Methods("POST")
+	r.HandleFunc("/me/tokens", h.auth.AuthMiddleware(h.users.GetAPITokens)).Methods("GET")
+	r.HandleFunc("/me/tokens/{id:[0-9]+}", h.auth.AuthMiddleware(h.users.RevokeAPIToken)).Methods("DELETE")
+	r.HandleFunc("/notes", h.auth.AuthMiddleware(h.notes.GetNotes, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes", h.auth.AuthMiddleware(speller.CreateNoteHandler(h.db, h.spellChecker), hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/notes", h.auth.AuthMiddleware(h.notes.DeleteNote, hand.ScopeNotesDelete)).Methods("DELETE")
+	r.HandleFunc("/events", h.auth.AuthMiddleware(h.events.Events, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/export", h.auth.AuthMiddleware(h.export.Export, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/import", h.auth.AuthMiddleware(h.imports.Import, hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/import/{id:[0-9]+}", h.auth.AuthMiddleware(h.imports.GetImportJob, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/sync", h.auth.AuthMiddleware(h.notes.GetSync, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/sync", h.auth.AuthMiddleware(h.notes.PostSync, hand.ScopeNotesWrite, hand.ScopeNotesDelete)).Methods("POST")
+	r.HandleFunc("/notes/{id:[0-9]+}", h.auth.AuthMiddleware(h.notes.GetNote, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}", h.auth.AuthMiddleware(h.notes.UpdateNote, hand.ScopeNotesWrite)).Methods("PUT")
+	r.HandleFunc("/notes/{id:[0-9]+}/corrections", h.auth.AuthMiddleware(h.notes.GetCorrections, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/corrections/{correctionID:[0-9]+}/revert", h.auth.AuthMiddleware(h.notes.RevertCorrection, hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/me/corrections/stats", h.auth.AuthMiddleware(h.notes.GetCorrectionStats, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/collab", h.auth.AuthMiddleware(h.collab.Collab, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/attachments", h.auth.AuthMiddleware(h.attachments.UploadAttachment, hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/notes/{id:[0-9]+}/attachments", h.auth.AuthMiddleware(h.attachments.GetAttachments, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/attachments/{attachmentID:[0-9]+}", h.auth.AuthMiddleware(h.attachments.DownloadAttachment, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/attachments/{attachmentID:[0-9]+}", h.auth.AuthMiddleware(h.attachments.DeleteAttachment, hand.ScopeNotesWrite)).Methods("DELETE")
+	r.HandleFunc("/me/storage", h.auth.AuthMiddleware(h.attachments.GetStorageUsage, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/shares", h.auth.AuthMiddleware(h.notes.GetShares, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/shares", h.auth.AuthMiddleware(h.notes.GrantShare, hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/notes/{id:[0-9]+}/shares/{username}", h.auth.AuthMiddleware(h.notes.UpdateShare, hand.ScopeNotesWrite)).Methods("PUT")
+	r.HandleFunc("/notes/{id:[0-9]+}/shares/{username}", h.auth.AuthMiddleware(h.notes.RevokeShare, hand.ScopeNotesWrite)).Methods("DELETE")
+	r.HandleFunc("/notes/{id:[0-9]+}/links", h.auth.AuthMiddleware(h.notes.CreateLink, hand.ScopeNotesWrite)).Methods("POST")
+	r.HandleFunc("/notes/{id:[0-9]+}/links", h.auth.AuthMiddleware(h.notes.GetLinks, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/notes/{id:[0-9]+}/links/{linkID:[0-9]+}", h.auth.AuthMiddleware(h.notes.RevokeLink, hand.ScopeNotesWrite)).Methods("DELETE")
+	r.HandleFunc("/s/{token}", h.notes.ViewLink).Methods("GET", "POST")
+	r.HandleFunc("/workspaces", h.auth.AuthMiddleware(h.workspaces.CreateWorkspace)).Methods("POST")
+	r.HandleFunc("/workspaces", h.auth.AuthMiddleware(h.workspaces.GetWorkspaces, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/workspaces/{id:[0-9]+}", h.auth.AuthMiddleware(h.workspaces.UpdateWorkspace)).Methods("PUT")
+	r.HandleFunc("/workspaces/{id:[0-9]+}", h.auth.AuthMiddleware(h.workspaces.DeleteWorkspace)).Methods("DELETE")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/members", h.auth.AuthMiddleware(h.workspaces.GetMembers, hand.ScopeNotesRead)).Methods("GET")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/members/{username}", h.auth.AuthMiddleware(h.workspaces.UpdateMember)).Methods("PUT")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/members/{username}", h.auth.AuthMiddleware(h.workspaces.RemoveMember)).Methods("DELETE")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/invitations", h.auth.AuthMiddleware(h.workspaces.CreateInvitation)).Methods("POST")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/invitations", h.auth.AuthMiddleware(h.workspaces.GetInvitations)).Methods("GET")
+	r.HandleFunc("/workspaces/{id:[0-9]+}/invitations/{invitationID:[0-9]+}", h.auth.AuthMiddleware(h.workspaces.CancelInvitation)).Methods("DELETE")
+	r.HandleFunc("/me/invitations", h.auth.AuthMiddleware(h.workspaces.GetMyInvitations)).Methods("GET")
+	r.HandleFunc("/me/invitations/{invitationID:[0-9]+}/accept", h.auth.AuthMiddleware(h.workspaces.AcceptInvitation)).Methods("POST")
+	r.HandleFunc("/me/invitations/{invitationID:[0-9]+}/decline", h.auth.AuthMiddleware(h.workspaces.DeclineInvitation)).Methods("POST")
+
+	// Административный API доступен только сессиям администраторов
+	r.HandleFunc("/admin/users", h.auth.AdminMiddleware(h.admin.GetUsers)).Methods("GET")
+	r.HandleFunc("/admin/users/{username}", h.auth.AdminMiddleware(h.admin.GetUser)).Methods("GET")
+	r.HandleFunc("/admin/users/{username}/disable", h.auth.AdminMiddleware(h.admin.DisableUser)).Methods("POST")
+	r.HandleFunc("/admin/users/{username}/enable", h.auth.AdminMiddleware(h.admin.EnableUser)).Methods("POST")
+	r.HandleFunc("/admin/users/{username}/password-reset", h.auth.AdminMiddleware(h.admin.ResetPassword)).Methods("POST")
+	r.HandleFunc("/admin/users/{username}/sessions/revoke", h.auth.AdminMiddleware(h.admin.RevokeSessions)).Methods("POST")
+	r.HandleFunc("/admin/users/{username}/impersonate", h.auth.AdminMiddleware(h.admin.Impersonate)).Methods("POST")
+	r.HandleFunc("/admin/actions", h.auth.AdminMiddleware(h.admin.GetActions)).Methods("GET")
+
+	return handlers.CORS(
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Authorization", "Content-Type", "X-Share-Password", "Last-Event-ID"}),
+	)(r)
+}
@@ -0,0 +1,167 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+)
+
+// ErrNotFound возвращается, если заметка не существует.
+var ErrNotFound = errors.New("authz: not found")
+
+// Access - уровень доступа пользователя к заметке. Уровни упорядочены: каждый следующий включает предыдущие.
+type Access int
+
+const (
+	// AccessNone - доступа нет.
+	AccessNone Access = iota
+	// AccessViewer - чтение заметки.
+	AccessViewer
+	// AccessEditor - чтение и изменение текста заметки.
+	AccessEditor
+	// AccessOwner - полный доступ: удаление заметки и управление доступом к ней.
+	AccessOwner
+)
+
+// Роли пользователей, которым предоставлен доступ к заметке.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// String возвращает название уровня доступа для ответов API.
+func (a Access) String() string {
+	switch a {
+	case AccessViewer:
+		return RoleViewer
+	case AccessEditor:
+		return RoleEditor
+	case AccessOwner:
+		return "owner"
+	default:
+		return "none"
+	}
+}
+
+// CanRead сообщает, можно ли читать заметку.
+func (a Access) CanRead() bool { return a >= AccessViewer }
+
+// CanWrite сообщает, можно ли изменять текст заметки.
+func (a Access) CanWrite() bool { return a >= AccessEditor }
+
+// CanManage сообщает, можно ли удалять заметку и управлять доступом к ней.
+func (a Access) CanManage() bool { return a >= AccessOwner }
+
+// Роли участников рабочего пространства. Роли упорядочены: каждая следующая включает права предыдущих.
+// - viewer: чтение заметок пространства.
+// - editor: создание и изменение заметок.
+// - admin: удаление заметок, управление доступом к ним и участниками пространства.
+// - owner: переименование и удаление пространства, назначение администраторов и владельцев.
+const (
+	WorkspaceViewer = "viewer"
+	WorkspaceEditor = "editor"
+	WorkspaceAdmin  = "admin"
+	WorkspaceOwner  = "owner"
+)
+
+// workspaceRanks задает порядок ролей участников рабочего пространства.
+var workspaceRanks = map[string]int{
+	WorkspaceViewer: 1,
+	WorkspaceEditor: 2,
+	WorkspaceAdmin:  3,
+	WorkspaceOwner:  4,
+}
+
+// ValidWorkspaceRole сообщает, является ли роль допустимой ролью участника рабочего пространства.
+func ValidWorkspaceRole(role string) bool {
+	_, ok := workspaceRanks[role]
+	return ok
+}
+
+// WorkspaceRoleAtLeast сообщает, включает ли роль участника права роли min.
+// Пустая роль (пользователь не участник) не включает никаких прав.
+func WorkspaceRoleAtLeast(role, min string) bool {
+	return role != "" && workspaceRanks[role] >= workspaceRanks[min]
+}
+
+// ValidShareRole сообщает, является ли роль допустимой для предоставления доступа к заметке.
+func ValidShareRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
+
+// Authorizer определяет права пользователей на заметки.
+// Обработчики заметок обращаются к нему вместо фильтрации по user_id.
+type Authorizer struct {
+	db database.Database
+}
+
+// New создает новый экземпляр Authorizer.
+func New(db database.Database) *Authorizer {
+	return &Authorizer{db: db}
+}
+
+// NoteAccess возвращает уровень доступа пользователя к заметке с учетом владения,
+// роли в рабочем пространстве заметки и доступа, предоставленного через note_shares.
+// Если заметки нет или она удалена, возвращается ErrNotFound.
+func (a *Authorizer) NoteAccess(ctx context.Context, userID, noteID int) (Access, error) {
+	var authorID int
+	var workspaceID sql.NullInt64
+	var shareRole, memberRole sql.NullString
+	err := a.db.QueryRow(ctx, `SELECT n.user_id, n.workspace_id, s.role, m.role FROM notes n
+        LEFT JOIN note_shares s ON s.note_id = n.id AND s.user_id = $1
+        LEFT JOIN workspace_members m ON m.workspace_id = n.workspace_id AND m.user_id = $1
+        WHERE n.id = $2 AND n.deleted_at IS NULL`, userID, noteID).Scan(&authorID, &workspaceID, &shareRole, &memberRole)
+	if err == sql.ErrNoRows {
+		return AccessNone, ErrNotFound
+	} else if err != nil {
+		return AccessNone, err
+	}
+	return ResolveNoteAccess(userID, authorID, workspaceID.Valid, shareRole.String, memberRole.String), nil
+}
+
+// ResolveNoteAccess вычисляет уровень доступа пользователя к заметке по уже загруженным данным:
+// автору заметки, ее принадлежности рабочему пространству, роли из note_shares и роли участника пространства.
+// Личной заметкой владеет ее автор, заметкой рабочего пространства - пространство: права на нее
+// определяются ролью участника, а автор, покинувший пространство, теряет к ней доступ.
+// Используется, когда права нужны для списка заметок, чтобы не обращаться к базе данных для каждой.
+func ResolveNoteAccess(userID, authorID int, inWorkspace bool, shareRole, memberRole string) Access {
+	access := AccessNone
+	if inWorkspace {
+		switch {
+		case WorkspaceRoleAtLeast(memberRole, WorkspaceAdmin):
+			access = AccessOwner
+		case WorkspaceRoleAtLeast(memberRole, WorkspaceEditor):
+			access = AccessEditor
+		case WorkspaceRoleAtLeast(memberRole, WorkspaceViewer):
+			access = AccessViewer
+		}
+	} else if authorID == userID {
+		return AccessOwner
+	}
+
+	// Доступ, предоставленный к отдельной заметке, может быть шире роли в пространстве.
+	switch {
+	case shareRole == RoleEditor && access < AccessEditor:
+		access = AccessEditor
+	case shareRole == RoleViewer && access < AccessViewer:
+		access = AccessViewer
+	}
+	return access
+}
+
+// WorkspaceRole возвращает роль пользователя в рабочем пространстве или пустую строку,
+// если он не является участником. Если пространства нет, возвращается ErrNotFound.
+func (a *Authorizer) WorkspaceRole(ctx context.Context, userID, workspaceID int) (string, error) {
+	var role sql.NullString
+	err := a.db.QueryRow(ctx, `SELECT m.role FROM workspaces w
+        LEFT JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1
+        WHERE w.id = $2`, userID, workspaceID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return role.String, nil
+}
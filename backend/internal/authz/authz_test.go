@@ -0,0 +1,101 @@
+package authz
+
+import "testing"
+
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		access                     Access
+		name                       string
+		canRead, canWrite, canMgmt bool
+	}{
+		{AccessNone, "none", false, false, false},
+		{AccessViewer, "viewer", true, false, false},
+		{AccessEditor, "editor", true, true, false},
+		{AccessOwner, "owner", true, true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.access.String(); got != tt.name {
+			t.Errorf("Access(%d).String() = %q, want %q", tt.access, got, tt.name)
+		}
+		if tt.access.CanRead() != tt.canRead || tt.access.CanWrite() != tt.canWrite || tt.access.CanManage() != tt.canMgmt {
+			t.Errorf("%s: CanRead, CanWrite, CanManage = %v, %v, %v; want %v, %v, %v", tt.name,
+				tt.access.CanRead(), tt.access.CanWrite(), tt.access.CanManage(), tt.canRead, tt.canWrite, tt.canMgmt)
+		}
+	}
+}
+
+func TestValidShareRole(t *testing.T) {
+	tests := map[string]bool{
+		RoleViewer: true,
+		RoleEditor: true,
+		"owner":    false,
+		"admin":    false,
+		"":         false,
+		"Editor":   false,
+	}
+	for role, want := range tests {
+		if got := ValidShareRole(role); got != want {
+			t.Errorf("ValidShareRole(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
+
+func TestWorkspaceRoles(t *testing.T) {
+	roles := []string{WorkspaceViewer, WorkspaceEditor, WorkspaceAdmin, WorkspaceOwner}
+	for i, role := range roles {
+		if !ValidWorkspaceRole(role) {
+			t.Errorf("ValidWorkspaceRole(%q) = false", role)
+		}
+		for j, min := range roles {
+			if got := WorkspaceRoleAtLeast(role, min); got != (i >= j) {
+				t.Errorf("WorkspaceRoleAtLeast(%q, %q) = %v, want %v", role, min, got, i >= j)
+			}
+		}
+		// Пользователь, не участвующий в пространстве, не имеет никаких прав.
+		if WorkspaceRoleAtLeast("", role) {
+			t.Errorf("WorkspaceRoleAtLeast(\"\", %q) = true", role)
+		}
+	}
+	for _, role := range []string{"", "member", "Owner"} {
+		if ValidWorkspaceRole(role) {
+			t.Errorf("ValidWorkspaceRole(%q) = true", role)
+		}
+		if WorkspaceRoleAtLeast(role, WorkspaceViewer) {
+			t.Errorf("WorkspaceRoleAtLeast(%q, viewer) = true", role)
+		}
+	}
+}
+
+func TestResolveNoteAccess(t *testing.T) {
+	const user, other = 1, 2
+	tests := []struct {
+		name        string
+		authorID    int
+		inWorkspace bool
+		shareRole   string
+		memberRole  string
+		want        Access
+	}{
+		{"own personal note", user, false, "", "", AccessOwner},
+		{"foreign personal note", other, false, "", "", AccessNone},
+		{"shared for viewing", other, false, RoleViewer, "", AccessViewer},
+		{"shared for editing", other, false, RoleEditor, "", AccessEditor},
+		{"own note shared to self", user, false, RoleViewer, "", AccessOwner},
+		{"workspace viewer", other, true, "", WorkspaceViewer, AccessViewer},
+		{"workspace editor", other, true, "", WorkspaceEditor, AccessEditor},
+		{"workspace admin", other, true, "", WorkspaceAdmin, AccessOwner},
+		{"workspace owner", other, true, "", WorkspaceOwner, AccessOwner},
+		{"author left the workspace", user, true, "", "", AccessNone},
+		{"author is a workspace viewer", user, true, "", WorkspaceViewer, AccessViewer},
+		{"not a member", other, true, "", "", AccessNone},
+		{"share wider than workspace role", other, true, RoleEditor, WorkspaceViewer, AccessEditor},
+		{"share narrower than workspace role", other, true, RoleViewer, WorkspaceAdmin, AccessOwner},
+		{"share for a non-member", other, true, RoleViewer, "", AccessViewer},
+		{"unknown share role", other, false, "owner", "", AccessNone},
+	}
+	for _, tt := range tests {
+		if got := ResolveNoteAccess(user, tt.authorID, tt.inWorkspace, tt.shareRole, tt.memberRole); got != tt.want {
+			t.Errorf("%s: ResolveNoteAccess = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
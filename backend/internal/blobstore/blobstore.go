@@ -0,0 +1,62 @@
+// Package blobstore хранит содержимое файлов (вложений заметок) вне базы данных.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+)
+
+// ErrNotFound возвращается, если объекта с указанным ключом нет в хранилище.
+var ErrNotFound = errors.New("blobstore: object not found")
+
+// BlobStore определяет интерфейс хранилища объектов.
+// Реализации: FSStore хранит объекты в каталоге файловой системы, S3Store - в S3-совместимом хранилище.
+// Ключи объектов формирует сервис: они состоят из латинских букв, цифр, "-" и "/".
+type BlobStore interface {
+	// Put сохраняет объект размером size байт. Существующий объект с тем же ключом заменяется.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект для чтения. Вызывающий должен закрыть его.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет объект. Удаление отсутствующего объекта не считается ошибкой.
+	Delete(ctx context.Context, key string) error
+}
+
+// New создает BlobStore в соответствии с драйвером, указанным в конфигурации.
+func New(cfg config.StorageConfig) (BlobStore, error) {
+	switch cfg.Driver {
+	case "fs", "":
+		return NewFSStore(cfg.Dir)
+	case "s3":
+		return NewS3Store(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// validKey проверяет, что ключ объекта не выходит за пределы хранилища.
+func validKey(key string) error {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return fmt.Errorf("blobstore: invalid key %q", key)
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+		case c == '/' && key[i-1] != '/':
+		default:
+			return fmt.Errorf("blobstore: invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+)
+
+func newTestFSStore(t *testing.T) (*FSStore, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func readObject(t *testing.T, store BlobStore, key string) string {
+	t.Helper()
+	rc, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFSStore(t *testing.T) {
+	store, dir := newTestFSStore(t)
+	ctx := context.Background()
+	const key = "attachments/ab/abcdef"
+
+	if err := store.Put(ctx, key, strings.NewReader("первая версия"), int64(len("первая версия")), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := readObject(t, store, key); got != "первая версия" {
+		t.Errorf("Get = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attachments", "ab", "abcdef")); err != nil {
+		t.Errorf("object file: %v", err)
+	}
+
+	// Существующий объект заменяется целиком.
+	if err := store.Put(ctx, key, strings.NewReader("v2"), 2, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := readObject(t, store, key); got != "v2" {
+		t.Errorf("Get after replace = %q", got)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestFSStoreFailedPut(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		body io.Reader
+		size int64
+	}{
+		{"short body", context.Background(), strings.NewReader("abc"), 10},
+		{"long body", context.Background(), strings.NewReader("abcdef"), 3},
+		{"read error", context.Background(), io.MultiReader(strings.NewReader("abc"), errReader{}), 10},
+		{"canceled", canceled, strings.NewReader("abc"), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, dir := newTestFSStore(t)
+			if err := store.Put(context.Background(), "a/b", strings.NewReader("old"), 3, ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(tt.ctx, "a/b", tt.body, tt.size, ""); err == nil {
+				t.Fatal("Put: want error")
+			}
+			// Неудачная запись не затрагивает прежнюю версию и не оставляет временных файлов.
+			if got := readObject(t, store, "a/b"); got != "old" {
+				t.Errorf("object = %q after a failed Put, want the previous version", got)
+			}
+			entries, err := os.ReadDir(filepath.Join(dir, "a"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%d files in the object directory, want 1", len(entries))
+			}
+		})
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestFSStoreKeys(t *testing.T) {
+	store, _ := newTestFSStore(t)
+	ctx := context.Background()
+	for _, key := range []string{"", "/etc/passwd", "a/", "a//b", "../a", "a/../../b", "a/./b", `a\b`, "a b"} {
+		if err := store.Put(ctx, key, strings.NewReader("a"), 1, ""); err == nil {
+			t.Errorf("Put(%q): want error", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): err = %v, want an invalid key error", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q): want error", key)
+		}
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	tests := map[string]bool{
+		"a":                     true,
+		"attachments/ab/abcdef": true,
+		"imports/1/Note-2":      true,
+		"":                      false,
+		"/a":                    false,
+		"a/":                    false,
+		"a//b":                  false,
+		"..":                    false,
+		"a/../b":                false,
+		"a.txt":                 false,
+		"a_b":                   false,
+		"заметка":               false,
+	}
+	for key, ok := range tests {
+		if err := validKey(key); (err == nil) != ok {
+			t.Errorf("validKey(%q) = %v, want ok = %v", key, err, ok)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	for _, driver := range []string{"", "fs"} {
+		store, err := New(config.StorageConfig{Driver: driver, Dir: dir})
+		if _, ok := store.(*FSStore); err != nil || !ok {
+			t.Errorf("New(%q) = %T, %v; want *FSStore", driver, store, err)
+		}
+	}
+	if _, err := New(config.StorageConfig{Driver: "gcs"}); err == nil {
+		t.Error("New with an unknown driver: want error")
+	}
+}
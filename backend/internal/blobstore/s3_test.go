@@ -0,0 +1,200 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore/s3test"
+)
+
+// newTestS3Store запускает локальное хранилище S3 с бакетом notes и возвращает его вместе с S3Store.
+func newTestS3Store(t *testing.T) (*s3test.Server, *S3Store) {
+	t.Helper()
+	srv := s3test.NewServer("access", "secret", "notes")
+	t.Cleanup(srv.Close)
+	store, err := NewS3Store(S3Options{
+		Endpoint:  srv.URL,
+		Region:    srv.Region,
+		Bucket:    "notes",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, store
+}
+
+func TestS3Store(t *testing.T) {
+	srv, store := newTestS3Store(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		key         string
+		data        string
+		contentType string
+	}{
+		{"text", "attachments/ab/cd-1", "содержимое файла", "text/plain; charset=utf-8"},
+		{"binary", "attachments/ef/01", "\x00\x01\x02\xff", "application/octet-stream"},
+		{"empty", "attachments/empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(ctx, tt.key, strings.NewReader(tt.data), int64(len(tt.data)), tt.contentType); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			obj, ok := srv.Object("notes", tt.key)
+			if !ok || string(obj.Data) != tt.data || obj.ContentType != tt.contentType {
+				t.Fatalf("stored object = %q (%q), %v; want %q (%q)", obj.Data, obj.ContentType, ok, tt.data, tt.contentType)
+			}
+
+			rc, err := store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(data) != tt.data {
+				t.Errorf("Get = %q, %v; want %q", data, err, tt.data)
+			}
+
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get(ctx, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	// Удаление отсутствующего объекта не считается ошибкой.
+	if err := store.Delete(ctx, "attachments/missing"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+
+	// Существующий объект заменяется.
+	for _, data := range []string{"old", "new"} {
+		if err := store.Put(ctx, "attachments/replaced", strings.NewReader(data), int64(len(data)), ""); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	if obj, _ := srv.Object("notes", "attachments/replaced"); string(obj.Data) != "new" {
+		t.Errorf("replaced object = %q, want new", obj.Data)
+	}
+
+	// Передается ровно size байт, даже если источник длиннее.
+	if err := store.Put(ctx, "attachments/limited", strings.NewReader("abcdef"), 3, ""); err != nil {
+		t.Fatalf("Put with a longer reader: %v", err)
+	}
+	if obj, _ := srv.Object("notes", "attachments/limited"); string(obj.Data) != "abc" {
+		t.Errorf("limited object = %q, want abc", obj.Data)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	srv, _ := newTestS3Store(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts S3Options
+		// want - фрагмент текста ошибки.
+		want string
+	}{
+		{"wrong secret", S3Options{Bucket: "notes", AccessKey: "access", SecretKey: "wrong"}, "SignatureDoesNotMatch"},
+		{"unknown access key", S3Options{Bucket: "notes", AccessKey: "other", SecretKey: "secret"}, "SignatureDoesNotMatch"},
+		{"wrong region", S3Options{Region: "eu-central-1", Bucket: "notes", AccessKey: "access", SecretKey: "secret"}, "SignatureDoesNotMatch"},
+		{"missing bucket", S3Options{Bucket: "other", AccessKey: "access", SecretKey: "secret"}, "NoSuchBucket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Endpoint = srv.URL
+			tt.opts.PathStyle = true
+			store, err := NewS3Store(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.Put(ctx, "attachments/a", strings.NewReader("a"), 1, "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Put: err = %v, want %s", err, tt.want)
+			}
+			if _, err := store.Get(ctx, "attachments/a"); err == nil {
+				t.Error("Get: want error")
+			}
+		})
+	}
+	if srv.Len("notes") != 0 {
+		t.Errorf("rejected requests stored %d objects", srv.Len("notes"))
+	}
+}
+
+func TestS3StoreKeys(t *testing.T) {
+	_, store := newTestS3Store(t)
+	ctx := context.Background()
+	for _, key := range []string{"", "/a", "a/", "a//b", "../a", "a/./b", "a b", "a?b"} {
+		if err := store.Put(ctx, key, strings.NewReader("a"), 1, ""); err == nil {
+			t.Errorf("Put(%q): want error", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil {
+			t.Errorf("Get(%q): want error", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q): want error", key)
+		}
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	valid := S3Options{Endpoint: "https://s3.example.com", Bucket: "notes", AccessKey: "a", SecretKey: "s"}
+	tests := []struct {
+		name   string
+		modify func(*S3Options)
+		ok     bool
+	}{
+		{"valid", func(*S3Options) {}, true},
+		{"no endpoint", func(o *S3Options) { o.Endpoint = "" }, false},
+		{"no bucket", func(o *S3Options) { o.Bucket = "" }, false},
+		{"no credentials", func(o *S3Options) { o.SecretKey = "" }, false},
+		{"endpoint without scheme", func(o *S3Options) { o.Endpoint = "s3.example.com" }, false},
+		{"ftp endpoint", func(o *S3Options) { o.Endpoint = "ftp://s3.example.com" }, false},
+	}
+	for _, tt := range tests {
+		opts := valid
+		tt.modify(&opts)
+		if _, err := NewS3Store(opts); (err == nil) != tt.ok {
+			t.Errorf("%s: NewS3Store err = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestS3RequestURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{"path style", "http://localhost:9000", true, "http://localhost:9000/notes/attachments/ab/cd"},
+		{"path style with base path", "https://storage.example.com/s3/", true, "https://storage.example.com/s3/notes/attachments/ab/cd"},
+		{"virtual host", "https://s3.eu-central-1.amazonaws.com", false, "https://notes.s3.eu-central-1.amazonaws.com/attachments/ab/cd"},
+	}
+	for _, tt := range tests {
+		store, err := NewS3Store(S3Options{Endpoint: tt.endpoint, Bucket: "notes", AccessKey: "a", SecretKey: "s", PathStyle: tt.pathStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := store.newRequest(context.Background(), http.MethodGet, "attachments/ab/cd", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.URL.String(); got != tt.want {
+			t.Errorf("%s: URL = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
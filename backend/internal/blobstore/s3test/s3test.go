@@ -0,0 +1,195 @@
+// Package s3test предоставляет локальное S3-совместимое хранилище для тестов и разработки.
+// Хранилище держит объекты в памяти, поддерживает адреса вида endpoint/bucket/key
+// и проверяет подпись AWS Signature Version 4 каждого запроса.
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Object - сохраненный объект.
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Server - S3-совместимое хранилище поверх httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]Object
+}
+
+// NewServer запускает хранилище с заданными учетными данными и пустыми бакетами.
+// Сервер нужно остановить вызовом Close.
+func NewServer(accessKey, secretKey string, buckets ...string) *Server {
+	s := &Server{
+		Region:    "us-east-1",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		buckets:   make(map[string]map[string]Object),
+	}
+	for _, b := range buckets {
+		s.buckets[b] = make(map[string]Object)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Object возвращает сохраненный объект.
+func (s *Server) Object(bucket, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.buckets[bucket][key]
+	return obj, ok
+}
+
+// Len возвращает количество объектов в бакете.
+func (s *Server) Len(bucket string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets[bucket])
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if err := s.verify(r); err != nil {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "Object key is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", "Body does not match Content-Length")
+			return
+		}
+		s.mu.Lock()
+		objects[key] = Object{Data: data, ContentType: r.Header.Get("Content-Type")}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		s.mu.Lock()
+		obj, ok := objects[key]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		if obj.ContentType != "" {
+			w.Header().Set("Content-Type", obj.ContentType)
+		}
+		w.Write(obj.Data)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Method not allowed")
+	}
+}
+
+// verify заново вычисляет подпись запроса по заголовкам, перечисленным в Authorization,
+// и сравнивает ее с переданной.
+func (s *Server) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	rest, ok := strings.CutPrefix(auth, "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return fmt.Errorf("unsupported authorization scheme")
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(rest, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[k] = v
+	}
+	accessKey, scope, _ := strings.Cut(params["Credential"], "/")
+	if accessKey != s.AccessKey {
+		return fmt.Errorf("unknown access key")
+	}
+	scopeParts := strings.Split(scope, "/")
+	if len(scopeParts) != 4 || scopeParts[1] != s.Region || scopeParts[2] != "s3" || scopeParts[3] != "aws4_request" {
+		return fmt.Errorf("invalid credential scope")
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, scopeParts[0]) {
+		return fmt.Errorf("date does not match credential scope")
+	}
+
+	signed := strings.Split(params["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) || !slices.Contains(signed, "host") || !slices.Contains(signed, "x-amz-content-sha256") {
+		return fmt.Errorf("invalid signed headers")
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		headers.String(),
+		params["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range scopeParts {
+		key = mac(key, part)
+	}
+	expected := hex.EncodeToString(mac(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(params["Signature"])) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,99 @@
+package blobstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+const (
+	// SweepSchedule - расписание удаления ненужных объектов из хранилища.
+	SweepSchedule = "@every 10m"
+	// OrphanGracePeriod - время, после которого объект из orphaned_blobs можно удалять.
+	// Ключ загружаемого файла попадает в orphaned_blobs до начала загрузки, поэтому
+	// период должен быть больше времени самой долгой загрузки.
+	OrphanGracePeriod = time.Hour
+	// sweepBatch - число объектов, удаляемых за один проход.
+	sweepBatch = 100
+)
+
+// Sweeper удаляет из хранилища объекты, ключи которых перечислены в таблице orphaned_blobs:
+// файлы удаленных вложений и заметок, а также файлы незавершенных загрузок.
+type Sweeper struct {
+	db     database.Database
+	store  BlobStore
+	logger *logger.Logger
+}
+
+// NewSweeper создает новый экземпляр Sweeper.
+func NewSweeper(db database.Database, store BlobStore, logger *logger.Logger) *Sweeper {
+	return &Sweeper{db: db, store: store, logger: logger}
+}
+
+// sweepTask - задание удаления ненужных объектов.
+var sweepTask = jobs.Task[struct{}]{Kind: "blobs.sweep", MaxAttempts: 3}
+
+// Schedule регистрирует удаление ненужных объектов как периодическое задание очереди q.
+func (s *Sweeper) Schedule(q *jobs.Queue) error {
+	jobs.Handle(q, sweepTask, func(ctx context.Context, _ struct{}) error {
+		n, err := s.Sweep(ctx)
+		if n > 0 {
+			s.logger.Info("Deleted orphaned blobs", "count", n)
+		}
+		return err
+	})
+	return jobs.Schedule(q, "sweep-blobs", SweepSchedule, sweepTask, struct{}{})
+}
+
+// Sweep удаляет ненужные объекты старше OrphanGracePeriod и возвращает их число.
+// Запись в orphaned_blobs удаляется только после удаления объекта, поэтому при ошибке
+// хранилища объект будет удален при следующем проходе.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		keys, err := s.batch(ctx)
+		if err != nil {
+			return deleted, err
+		}
+		for _, key := range keys {
+			if err := s.store.Delete(ctx, key); err != nil {
+				return deleted, err
+			}
+			if _, err := s.db.Exec(ctx, "DELETE FROM orphaned_blobs WHERE storage_key=$1", key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(keys) < sweepBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// batch возвращает очередную порцию ключей для удаления. Ключи, которые снова используются
+// вложениями, из orphaned_blobs просто убираются.
+func (s *Sweeper) batch(ctx context.Context) ([]string, error) {
+	if _, err := s.db.Exec(ctx, `DELETE FROM orphaned_blobs o
+        WHERE EXISTS (SELECT 1 FROM attachments a WHERE a.storage_key = o.storage_key)`); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, `SELECT storage_key FROM orphaned_blobs
+        WHERE created_at < now() - make_interval(secs => $1) ORDER BY created_at LIMIT $2`,
+		OrphanGracePeriod.Seconds(), sweepBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,273 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrInvalidOperation возвращается, если операция не применима к документу или другой операции.
+var ErrInvalidOperation = errors.New("collab: invalid operation")
+
+// Component - шаг операции над текстом: пропуск (Retain), вставка (Insert) или удаление (Delete)
+// символов. Длины измеряются в символах Unicode, а не в байтах. Заполнено ровно одно поле.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation - операция над текстом, которая проходит документ от начала до конца.
+// В JSON операция передается массивом, как в ot.js: положительное число - пропуск символов,
+// строка - вставка, отрицательное число - удаление. Например, [5, "abc", -2, 10].
+type Operation []Component
+
+// MarshalJSON кодирует операцию в компактный формат.
+func (op Operation) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, 0, len(op))
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			out = append(out, c.Retain)
+		case c.Insert != "":
+			out = append(out, c.Insert)
+		case c.Delete > 0:
+			out = append(out, -c.Delete)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON разбирает операцию из компактного формата.
+func (op *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var b builder
+	for _, item := range raw {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			b.insert(s)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil || n == 0 {
+			return fmt.Errorf("%w: component must be a non-zero integer or a string", ErrInvalidOperation)
+		}
+		if n > 0 {
+			b.retain(n)
+		} else {
+			b.delete(-n)
+		}
+	}
+	*op = b.op
+	return nil
+}
+
+// BaseLen возвращает длину документа, к которому применима операция.
+func (op Operation) BaseLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen возвращает длину документа после применения операции.
+func (op Operation) TargetLen() int {
+	n := 0
+	for _, c := range op {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+	return n
+}
+
+// IsNoop сообщает, что операция не меняет документ.
+func (op Operation) IsNoop() bool {
+	for _, c := range op {
+		if c.Insert != "" || c.Delete > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply применяет операцию к документу.
+func (op Operation) Apply(doc []rune) ([]rune, error) {
+	if op.BaseLen() != len(doc) {
+		return nil, fmt.Errorf("%w: operation length %d does not match document length %d", ErrInvalidOperation, op.BaseLen(), len(doc))
+	}
+	out := make([]rune, 0, op.TargetLen())
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			out = append(out, doc[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		case c.Delete > 0:
+			pos += c.Delete
+		}
+	}
+	return out, nil
+}
+
+// Transform преобразует две операции, примененные к одному и тому же документу, так что
+// a1 применяется после b, b1 - после a, и результат в обоих порядках совпадает.
+// При вставке в одну и ту же позицию текст из a оказывается раньше текста из b.
+func Transform(a, b Operation) (a1, b1 Operation, err error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, fmt.Errorf("%w: concurrent operations have different base lengths", ErrInvalidOperation)
+	}
+
+	var ab, bb builder
+	i, j := 0, 0
+	var ca, cb *Component
+	for {
+		if ca == nil && i < len(a) {
+			c := a[i]
+			ca = &c
+			i++
+		}
+		if cb == nil && j < len(b) {
+			c := b[j]
+			cb = &c
+			j++
+		}
+		if ca == nil && cb == nil {
+			break
+		}
+
+		if ca != nil && ca.Insert != "" {
+			ab.insert(ca.Insert)
+			bb.retain(utf8.RuneCountInString(ca.Insert))
+			ca = nil
+			continue
+		}
+		if cb != nil && cb.Insert != "" {
+			ab.retain(utf8.RuneCountInString(cb.Insert))
+			bb.insert(cb.Insert)
+			cb = nil
+			continue
+		}
+		if ca == nil || cb == nil {
+			return nil, nil, fmt.Errorf("%w: operation is too short", ErrInvalidOperation)
+		}
+
+		n := min(ca.Retain+ca.Delete, cb.Retain+cb.Delete)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			ab.retain(n)
+			bb.retain(n)
+		case ca.Delete > 0 && cb.Delete > 0:
+			// Оба удалили одни и те же символы.
+		case ca.Delete > 0:
+			ab.delete(n)
+		default:
+			bb.delete(n)
+		}
+		ca = consume(ca, n)
+		cb = consume(cb, n)
+	}
+	return ab.op, bb.op, nil
+}
+
+// TransformIndex переносит позицию в документе (например, курсор) через операцию.
+func TransformIndex(op Operation, index int) int {
+	newIndex := index
+	remaining := index
+	for _, c := range op {
+		switch {
+		case c.Retain > 0:
+			remaining -= c.Retain
+		case c.Insert != "":
+			newIndex += utf8.RuneCountInString(c.Insert)
+		case c.Delete > 0:
+			newIndex -= min(remaining, c.Delete)
+			remaining -= c.Delete
+		}
+		if remaining < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// Diff строит операцию, переводящую текст from в текст to: общие начало и конец пропускаются,
+// а различающаяся середина заменяется целиком. Используется для изменений, пришедших не через
+// операции, например правок орфографии или изменений заметки через REST API.
+func Diff(from, to []rune) Operation {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	var b builder
+	b.retain(prefix)
+	b.delete(len(from) - prefix - suffix)
+	b.insert(string(to[prefix : len(to)-suffix]))
+	b.retain(suffix)
+	return b.op
+}
+
+// consume уменьшает пропуск или удаление на n символов и возвращает nil, если от шага ничего не осталось.
+func consume(c *Component, n int) *Component {
+	if c.Retain > 0 {
+		c.Retain -= n
+		if c.Retain == 0 {
+			return nil
+		}
+	} else {
+		c.Delete -= n
+		if c.Delete == 0 {
+			return nil
+		}
+	}
+	return c
+}
+
+// builder собирает операцию, объединяя соседние шаги одного вида и пропуская пустые.
+type builder struct {
+	op Operation
+}
+
+func (b *builder) retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Retain > 0 {
+		b.op[last].Retain += n
+		return
+	}
+	b.op = append(b.op, Component{Retain: n})
+}
+
+func (b *builder) insert(s string) {
+	if s == "" {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Insert != "" {
+		b.op[last].Insert += s
+		return
+	}
+	b.op = append(b.op, Component{Insert: s})
+}
+
+func (b *builder) delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Delete > 0 {
+		b.op[last].Delete += n
+		return
+	}
+	b.op = append(b.op, Component{Delete: n})
+}
@@ -0,0 +1,235 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// op разбирает операцию из компактного формата JSON.
+func op(t *testing.T, s string) Operation {
+	t.Helper()
+	var o Operation
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		t.Fatalf("unmarshal %s: %v", s, err)
+	}
+	return o
+}
+
+func TestOperationJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`[5, "abc", -2, 10]`, `[5,"abc",-2,10]`},
+		// Соседние шаги одного вида объединяются, пустые вставки отбрасываются.
+		{`[1, 2, "a", "", "b", -1, -1]`, `[3,"ab",-2]`},
+		{`[]`, `[]`},
+		{`["привет"]`, `["привет"]`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(op(t, tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("round trip %s = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`[0]`, `[1.5]`, `[true]`, `{"a":1}`, `"abc"`} {
+		var o Operation
+		if err := json.Unmarshal([]byte(in), &o); err == nil {
+			t.Errorf("unmarshal %s: want error, got %v", in, o)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		op     string
+		want   string
+		noop   bool
+		hasErr bool
+	}{
+		{"insert", "hello", `[5, " world"]`, "hello world", false, false},
+		{"delete", "hello world", `[5, -6]`, "hello", false, false},
+		{"replace", "кот", `[-1, "К", 2]`, "Кот", false, false},
+		{"retain only", "abc", `[3]`, "abc", true, false},
+		{"empty document", "", `["a"]`, "a", false, false},
+		{"multibyte lengths", "ёжик", `[1, -1, "Ж", 2]`, "ёЖик", false, false},
+		{"too short", "abc", `[2]`, "", true, true},
+		{"too long", "abc", `[2, -2]`, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := op(t, tt.op)
+			if o.IsNoop() != tt.noop {
+				t.Errorf("IsNoop() = %v, want %v", o.IsNoop(), tt.noop)
+			}
+			got, err := o.Apply([]rune(tt.doc))
+			if tt.hasErr {
+				if !errors.Is(err, ErrInvalidOperation) {
+					t.Errorf("Apply: err = %v, want ErrInvalidOperation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply = %q, want %q", string(got), tt.want)
+			}
+			if o.TargetLen() != len(got) {
+				t.Errorf("TargetLen() = %d, want %d", o.TargetLen(), len(got))
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"inserts at different positions", "abc", `["x", 3]`, `[3, "y"]`, "xabcy"},
+		{"inserts at the same position", "abc", `[1, "x", 2]`, `[1, "y", 2]`, "axybc"},
+		{"insert and delete", "abcdef", `[3, "X", 3]`, `[1, -4, 1]`, "aXf"},
+		{"same deletion", "abcdef", `[1, -2, 3]`, `[1, -2, 3]`, "adef"},
+		{"overlapping deletions", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"insert inside deleted range", "abcdef", `[-6]`, `[3, "X", 3]`, "X"},
+		{"noop", "abc", `[3]`, `[-1, 2]`, "bc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := op(t, tt.a), op(t, tt.b)
+			a1, b1, err := Transform(a, b)
+			if err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+			doc := []rune(tt.doc)
+			ab := mustApply(t, mustApply(t, doc, a), b1)
+			ba := mustApply(t, mustApply(t, doc, b), a1)
+			if string(ab) != tt.want || string(ba) != tt.want {
+				t.Errorf("a then b1 = %q, b then a1 = %q, want %q", string(ab), string(ba), tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Transform(op(t, `[3]`), op(t, `[4]`)); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Transform with different base lengths: err = %v, want ErrInvalidOperation", err)
+	}
+}
+
+// TestTransformRandom проверяет сходимость преобразования на случайных парах операций.
+func TestTransformRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		doc := randomText(rng, rng.Intn(20))
+		a, b := randomOperation(rng, doc), randomOperation(rng, doc)
+		a1, b1, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Transform(%v, %v): %v", a, b, err)
+		}
+		ab := mustApply(t, mustApply(t, doc, a), b1)
+		ba := mustApply(t, mustApply(t, doc, b), a1)
+		if string(ab) != string(ba) {
+			t.Fatalf("doc %q, a %v, b %v: a then b1 = %q, b then a1 = %q", string(doc), a, b, string(ab), string(ba))
+		}
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    string
+		index int
+		want  int
+	}{
+		{"insert before", `["ab", 5]`, 2, 4},
+		{"insert at cursor", `[2, "ab", 3]`, 2, 4},
+		{"insert after", `[3, "ab", 2]`, 2, 2},
+		{"delete before", `[-2, 3]`, 3, 1},
+		{"delete around", `[1, -3, 1]`, 2, 1},
+		{"delete after", `[3, -2]`, 2, 2},
+		{"multibyte insert", `["ёж", 5]`, 0, 2},
+	}
+	for _, tt := range tests {
+		if got := TransformIndex(op(t, tt.op), tt.index); got != tt.want {
+			t.Errorf("%s: TransformIndex(%s, %d) = %d, want %d", tt.name, tt.op, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"", "", `[]`},
+		{"abc", "abc", `[3]`},
+		{"", "abc", `["abc"]`},
+		{"abc", "", `[-3]`},
+		{"hello world", "hello, world", `[5,",",6]`},
+		{"кот и пёс", "кит и пёс", `[1,-1,"и",7]`},
+		{"aaa", "aa", `[2,-1]`},
+	}
+	for _, tt := range tests {
+		d := Diff([]rune(tt.from), []rune(tt.to))
+		got, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Diff(%q, %q) = %s, want %s", tt.from, tt.to, got, tt.want)
+		}
+		if out := mustApply(t, []rune(tt.from), d); string(out) != tt.to {
+			t.Errorf("Diff(%q, %q) applies to %q", tt.from, tt.to, string(out))
+		}
+	}
+}
+
+func mustApply(t *testing.T, doc []rune, o Operation) []rune {
+	t.Helper()
+	out, err := o.Apply(doc)
+	if err != nil {
+		t.Fatalf("Apply(%q, %v): %v", string(doc), o, err)
+	}
+	return out
+}
+
+func randomText(rng *rand.Rand, n int) []rune {
+	alphabet := []rune("abcЖё ")
+	out := make([]rune, n)
+	for i := range out {
+		out[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	return out
+}
+
+// randomOperation строит случайную операцию, применимую к документу doc.
+func randomOperation(rng *rand.Rand, doc []rune) Operation {
+	var b builder
+	for pos := 0; pos < len(doc); {
+		n := 1 + rng.Intn(len(doc)-pos)
+		switch rng.Intn(3) {
+		case 0:
+			b.retain(n)
+			pos += n
+		case 1:
+			b.delete(n)
+			pos += n
+		default:
+			b.insert(string(randomText(rng, 1+rng.Intn(3))))
+		}
+	}
+	if rng.Intn(2) == 0 {
+		b.insert(string(randomText(rng, 1+rng.Intn(3))))
+	}
+	return b.op
+}
@@ -0,0 +1,652 @@
+package collab
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// ErrNotFound возвращается, если заметка не существует или удалена.
+var ErrNotFound = errors.New("collab: note not found")
+
+// ErrAccessDenied возвращается AccessFunc, если участник потерял доступ к заметке.
+var ErrAccessDenied = errors.New("collab: access denied")
+
+const (
+	// PersistInterval - период сохранения снимка документа в notes.text.
+	PersistInterval = 5 * time.Second
+	// MaxDocumentLen - максимальная длина документа в символах.
+	MaxDocumentLen = 1 << 20
+
+	// maxHistory - число последних операций, которые хранятся для преобразования операций
+	// отставших клиентов. Клиент, отставший сильнее, получает ошибку и переподключается.
+	maxHistory = 1000
+	// clientBuffer - размер очереди сообщений одного клиента. Клиент, не успевающий
+	// их читать, отключается и при переподключении получает текущий документ.
+	clientBuffer = 256
+	// persistAttempts - число попыток сохранить документ при параллельных изменениях заметки.
+	persistAttempts = 3
+	// dbTimeout - таймаут запросов к базе данных при загрузке и сохранении документа.
+	dbTimeout = 10 * time.Second
+)
+
+// Типы сообщений протокола.
+const (
+	// Клиент -> сервер: операция над ревизией revision и положение курсора.
+	TypeOp     = "op"
+	TypeCursor = "cursor"
+
+	// Сервер -> клиент.
+	TypeInit   = "init"
+	TypeAck    = "ack"
+	TypeJoin   = "join"
+	TypeLeave  = "leave"
+	TypeAccess = "access"
+	TypeError  = "error"
+)
+
+// serverClientID - идентификатор автора операций, сделанных сервером: слияния с изменениями
+// через REST API и исправлений орфографии.
+const serverClientID = "server"
+
+// AccessFunc повторно проверяет доступ участника к заметке и возвращает, может ли он ее редактировать.
+// Если доступ потерян, возвращает ErrAccessDenied; другие ошибки считаются временными.
+type AccessFunc func(ctx context.Context) (canEdit bool, err error)
+
+// SpellFunc ставит в очередь фоновую проверку орфографии версии version заметки noteID.
+type SpellFunc func(ctx context.Context, noteID, version int) error
+
+// Cursor - выделение участника: Anchor - начало, Head - положение курсора (в символах).
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Participant - участник совместного редактирования.
+type Participant struct {
+	ClientID string  `json:"client_id"`
+	Username string  `json:"username"`
+	CanEdit  bool    `json:"can_edit"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+// Message - сообщение протокола совместного редактирования.
+type Message struct {
+	Type         string        `json:"type"`
+	Revision     int           `json:"revision"`
+	Op           Operation     `json:"op,omitempty"`
+	Text         *string       `json:"text,omitempty"`
+	ClientID     string        `json:"client_id,omitempty"`
+	Cursor       *Cursor       `json:"cursor,omitempty"`
+	Participant  *Participant  `json:"participant,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Manager хранит сеансы совместного редактирования заметок этого экземпляра сервиса.
+// Сеанс создается при подключении первого участника и закрывается после ухода последнего.
+type Manager struct {
+	db     database.Database
+	spell  SpellFunc
+	logger *logger.Logger
+
+	mu       sync.Mutex
+	sessions map[int]*Session
+	closed   bool
+}
+
+// NewManager создает новый экземпляр Manager. spell вызывается при фиксации документа,
+// когда его покидает последний участник: документ сохраняется с состоянием проверки pending,
+// и орфография проверяется в фоне, как при создании заметки. Если spell равен nil, проверка не выполняется.
+func NewManager(db database.Database, spell SpellFunc, logger *logger.Logger) *Manager {
+	return &Manager{
+		db:       db,
+		spell:    spell,
+		logger:   logger,
+		sessions: make(map[int]*Session),
+	}
+}
+
+// Join подключает пользователя к сеансу заметки. Участник без права редактирования
+// получает изменения и курсоры других, но не может менять документ. Перед каждым сохранением
+// документа доступ участника проверяется заново функцией access: участник, потерявший доступ,
+// отключается, а право редактирования меняется без переподключения.
+func (m *Manager) Join(ctx context.Context, noteID int, username string, canEdit bool, access AccessFunc) (*Client, error) {
+	id, err := newClientID()
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		send:   make(chan []byte, clientBuffer),
+		done:   make(chan struct{}),
+		access: access,
+		info:   Participant{ClientID: id, Username: username, CanEdit: canEdit},
+	}
+
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, errors.New("collab: manager closed")
+		}
+		s := m.sessions[noteID]
+		if s == nil {
+			s, err = m.load(ctx, noteID)
+			if err != nil {
+				m.mu.Unlock()
+				return nil, err
+			}
+			m.sessions[noteID] = s
+			go s.run()
+		}
+		if s.add(c) {
+			m.mu.Unlock()
+			return c, nil
+		}
+		m.mu.Unlock()
+
+		// Сеанс закрывается: дожидаемся сохранения документа, чтобы новый сеанс загрузил его из базы.
+		select {
+		case <-s.finished:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close отключает всех участников и сохраняет документы, например при остановке сервера.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+
+	for _, s := range sessions {
+		s.shutdown()
+		<-s.finished
+	}
+}
+
+// load читает заметку и создает для нее сеанс. Вызывается под блокировкой m.mu.
+func (m *Manager) load(ctx context.Context, noteID int) (*Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var text string
+	var version int
+	err := m.db.QueryRow(ctx, "SELECT text, version FROM notes WHERE id=$1 AND deleted_at IS NULL",
+		noteID).Scan(&text, &version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	doc := []rune(text)
+	return &Session{
+		manager:   m,
+		noteID:    noteID,
+		text:      doc,
+		persisted: doc,
+		version:   version,
+		clients:   make(map[string]*Client),
+		stop:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}, nil
+}
+
+// remove удаляет закрытый сеанс из списка.
+func (m *Manager) remove(s *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[s.noteID] == s {
+		delete(m.sessions, s.noteID)
+	}
+}
+
+// Client - подключение участника к сеансу. Сообщения для отправки клиенту читаются из Send,
+// полученные от него передаются в Handle. Done закрывается, когда участник отключен сервером.
+type Client struct {
+	session *Session
+	send    chan []byte
+	done    chan struct{}
+	access  AccessFunc
+
+	// info изменяется под блокировкой сеанса.
+	info Participant
+}
+
+// Send возвращает очередь сообщений для отправки клиенту.
+func (c *Client) Send() <-chan []byte {
+	return c.send
+}
+
+// Done закрывается, когда сервер отключил участника: сеанс закрыт, заметка удалена, доступ к ней
+// потерян или клиент не успевает.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Handle обрабатывает сообщение клиента.
+func (c *Client) Handle(data []byte) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.session.reply(c, Message{Type: TypeError, Error: "invalid message"})
+		return
+	}
+	switch msg.Type {
+	case TypeOp:
+		c.session.receiveOp(c, msg.Revision, msg.Op)
+	case TypeCursor:
+		c.session.moveCursor(c, msg.Revision, msg.Cursor)
+	default:
+		c.session.reply(c, Message{Type: TypeError, Error: "unknown message type"})
+	}
+}
+
+// Leave отключает участника от сеанса.
+func (c *Client) Leave() {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(c)
+}
+
+// Session - документ заметки, который редактируют несколько участников. Операции участников
+// упорядочиваются сервером: каждая принятая операция увеличивает ревизию, а операция, сделанная
+// над более старой ревизией, преобразуется относительно принятых после нее.
+type Session struct {
+	manager *Manager
+	noteID  int
+
+	mu           sync.Mutex
+	text         []rune
+	revision     int
+	history      []Operation
+	historyStart int
+	clients      map[string]*Client
+	// persisted и version - текст и версия заметки в базе данных на момент последнего сохранения.
+	persisted []rune
+	version   int
+	// unchecked - сохраненный текст не отправлялся на проверку орфографии.
+	unchecked bool
+	closed    bool
+
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// add добавляет участника и отправляет ему текущее состояние документа.
+// Возвращает false, если сеанс уже закрывается.
+func (s *Session) add(c *Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	participants := make([]Participant, 0, len(s.clients))
+	for _, other := range s.clients {
+		participants = append(participants, other.info)
+	}
+	c.session = s
+	s.clients[c.info.ClientID] = c
+
+	text := string(s.text)
+	info := c.info
+	s.sendLocked(c, Message{Type: TypeInit, Revision: s.revision, Text: &text, ClientID: c.info.ClientID,
+		Participant: &info, Participants: participants})
+	s.broadcastLocked(c, Message{Type: TypeJoin, Revision: s.revision, ClientID: c.info.ClientID, Participant: &info})
+	return true
+}
+
+// receiveOp принимает операцию участника, сделанную над ревизией revision.
+func (s *Session) receiveOp(c *Client, revision int, op Operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c.info.ClientID]; !ok {
+		return
+	}
+	if !c.info.CanEdit {
+		s.sendLocked(c, Message{Type: TypeError, Error: "read-only access"})
+		return
+	}
+	if revision < s.historyStart || revision > s.revision {
+		// Операций, относительно которых нужно преобразовать изменение, уже нет:
+		// клиент переподключится и получит документ заново.
+		s.sendLocked(c, Message{Type: TypeError, Error: "revision is too old"})
+		s.removeLocked(c)
+		return
+	}
+
+	var err error
+	for _, h := range s.history[revision-s.historyStart:] {
+		if op, _, err = Transform(op, h); err != nil {
+			break
+		}
+	}
+	var text []rune
+	if err == nil {
+		text, err = op.Apply(s.text)
+	}
+	if err != nil {
+		s.sendLocked(c, Message{Type: TypeError, Error: "invalid operation"})
+		return
+	}
+	if len(text) > MaxDocumentLen {
+		s.sendLocked(c, Message{Type: TypeError, Error: "document is too large"})
+		return
+	}
+
+	s.applyLocked(op, text, c.info.ClientID)
+	s.sendLocked(c, Message{Type: TypeAck, Revision: s.revision})
+}
+
+// moveCursor обновляет курсор участника, заданный в ревизии revision, и рассылает его остальным.
+func (s *Session) moveCursor(c *Client, revision int, cursor *Cursor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c.info.ClientID]; !ok || cursor == nil {
+		return
+	}
+	if revision < s.historyStart || revision > s.revision {
+		return
+	}
+	cur := *cursor
+	for _, h := range s.history[revision-s.historyStart:] {
+		cur = transformCursor(h, cur)
+	}
+	cur.Anchor = clamp(cur.Anchor, len(s.text))
+	cur.Head = clamp(cur.Head, len(s.text))
+	c.info.Cursor = &cur
+	s.broadcastLocked(c, Message{Type: TypeCursor, Revision: s.revision, ClientID: c.info.ClientID, Cursor: &cur})
+}
+
+// applyLocked применяет операцию author к документу, переносит курсоры участников
+// и рассылает операцию всем, кроме автора.
+func (s *Session) applyLocked(op Operation, text []rune, author string) {
+	s.text = text
+	s.revision++
+	s.history = append(s.history, op)
+	if len(s.history) > maxHistory {
+		drop := len(s.history) - maxHistory
+		s.history = append([]Operation(nil), s.history[drop:]...)
+		s.historyStart += drop
+	}
+
+	for _, other := range s.clients {
+		if other.info.Cursor != nil {
+			cur := transformCursor(op, *other.info.Cursor)
+			other.info.Cursor = &cur
+		}
+	}
+	for id, other := range s.clients {
+		if id != author {
+			s.sendLocked(other, Message{Type: TypeOp, Revision: s.revision, Op: op, ClientID: author})
+		}
+	}
+}
+
+// rebaseLocked вносит в документ изменения, которые кто-то сделал над текстом base, получив text
+// (например, правку через REST API или исправления орфографии). Изменения участников,
+// сделанные после base, сохраняются.
+func (s *Session) rebaseLocked(base, text []rune) error {
+	theirs := Diff(base, text)
+	if theirs.IsNoop() {
+		return nil
+	}
+	_, op, err := Transform(Diff(base, s.text), theirs)
+	if err != nil {
+		return err
+	}
+	if op.IsNoop() {
+		return nil
+	}
+	doc, err := op.Apply(s.text)
+	if err != nil {
+		return err
+	}
+	s.applyLocked(op, doc, serverClientID)
+	return nil
+}
+
+// reply отправляет сообщение одному участнику.
+func (s *Session) reply(c *Client, msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c.info.ClientID]; ok {
+		s.sendLocked(c, msg)
+	}
+}
+
+// broadcastLocked отправляет сообщение всем участникам, кроме except.
+func (s *Session) broadcastLocked(except *Client, msg Message) {
+	for _, c := range s.clients {
+		if c != except {
+			s.sendLocked(c, msg)
+		}
+	}
+}
+
+// sendLocked ставит сообщение в очередь участника. Участник, очередь которого заполнена, отключается.
+func (s *Session) sendLocked(c *Client, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.manager.logger.Error("Failed to encode collab message", "error", err)
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		s.removeLocked(c)
+	}
+}
+
+// removeLocked отключает участника и сообщает об этом остальным. После ухода последнего
+// участника сеанс закрывается: документ проверяется на орфографию и сохраняется.
+func (s *Session) removeLocked(c *Client) {
+	if _, ok := s.clients[c.info.ClientID]; !ok {
+		return
+	}
+	delete(s.clients, c.info.ClientID)
+	close(c.done)
+	s.broadcastLocked(nil, Message{Type: TypeLeave, Revision: s.revision, ClientID: c.info.ClientID})
+
+	if len(s.clients) == 0 && !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+// shutdown закрывает сеанс, отключая всех участников.
+func (s *Session) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for id, c := range s.clients {
+		delete(s.clients, id)
+		close(c.done)
+	}
+	close(s.stop)
+}
+
+// run периодически проверяет доступ участников и сохраняет документ, а после закрытия сеанса фиксирует его.
+func (s *Session) run() {
+	ticker := time.NewTicker(PersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkAccess()
+			s.persist(false)
+		case <-s.stop:
+			s.persist(s.manager.spell != nil)
+			s.manager.remove(s)
+			close(s.finished)
+			return
+		}
+	}
+}
+
+// checkAccess заново проверяет доступ участников к заметке. Участник, потерявший доступ, получает
+// ошибку и отключается, а об изменении права редактирования сообщается всем участникам сообщением access.
+// Если проверить доступ не удалось, участник остается с прежними правами до следующей проверки.
+func (s *Session) checkAccess() {
+	s.mu.Lock()
+	clients := make([]*Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+		canEdit, err := c.access(ctx)
+		cancel()
+		if err != nil && err != ErrAccessDenied {
+			s.manager.logger.Error("Failed to check collaborative access", "note_id", s.noteID, "error", err)
+			continue
+		}
+
+		s.mu.Lock()
+		if _, ok := s.clients[c.info.ClientID]; !ok {
+			s.mu.Unlock()
+			continue
+		}
+		if err == ErrAccessDenied {
+			s.sendLocked(c, Message{Type: TypeError, Revision: s.revision, Error: "access revoked"})
+			s.removeLocked(c)
+		} else if canEdit != c.info.CanEdit {
+			c.info.CanEdit = canEdit
+			info := c.info
+			s.broadcastLocked(nil, Message{Type: TypeAccess, Revision: s.revision, ClientID: c.info.ClientID, Participant: &info})
+		}
+		s.mu.Unlock()
+	}
+}
+
+// persist сохраняет документ в notes.text, если он изменился. Обновление выполняется только
+// поверх известной версии заметки, поэтому изменения, сделанные в обход сеанса (через REST API
+// или синхронизацию), не теряются: они вносятся в документ и рассылаются участникам, после чего
+// сохранение повторяется. Сохранение проходит через обычные триггеры версий и событий.
+// Если check равен true, документ фиксируется: он сохраняется с состоянием проверки pending,
+// даже если текст уже сохранен без проверки, и его проверка ставится в очередь. Исправления
+// записываются заданием проверки, если заметку с тех пор не меняли, как и для других способов изменения.
+func (s *Session) persist(check bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	for attempt := 0; attempt < persistAttempts; attempt++ {
+		s.mu.Lock()
+		if string(s.text) == string(s.persisted) && !(check && s.unchecked) {
+			s.mu.Unlock()
+			return
+		}
+		text := append([]rune(nil), s.text...)
+		version := s.version
+		s.mu.Unlock()
+
+		// Без фиксации состояние проверки не меняется, и триггер отмечает новый текст как непроверенный.
+		var newVersion int
+		err := s.manager.db.QueryRow(ctx, `UPDATE notes SET text=$1,
+                spellcheck_status=CASE WHEN $4 THEN 'pending' ELSE spellcheck_status END
+            WHERE id=$2 AND version=$3 AND deleted_at IS NULL RETURNING version`,
+			string(text), s.noteID, version, check).Scan(&newVersion)
+		if err == nil {
+			s.mu.Lock()
+			if string(s.persisted) != string(text) || check {
+				s.unchecked = !check && s.manager.spell != nil
+			}
+			s.persisted = text
+			s.version = newVersion
+			s.mu.Unlock()
+			if check {
+				// Если задание не удалось поставить, проверка отмечает заметку как failed и пишет ошибку в журнал.
+				s.manager.spell(ctx, s.noteID, newVersion)
+			}
+			return
+		}
+		if err != sql.ErrNoRows {
+			s.manager.logger.Error("Failed to save collaborative note", "note_id", s.noteID, "error", err)
+			return
+		}
+
+		// Заметка изменилась в обход сеанса или удалена.
+		var current string
+		var deleted bool
+		err = s.manager.db.QueryRow(ctx, "SELECT text, version, deleted_at IS NOT NULL FROM notes WHERE id=$1",
+			s.noteID).Scan(&current, &newVersion, &deleted)
+		if err == sql.ErrNoRows || (err == nil && deleted) {
+			s.terminate("note was deleted")
+			return
+		} else if err != nil {
+			s.manager.logger.Error("Failed to load collaborative note", "note_id", s.noteID, "error", err)
+			return
+		}
+
+		s.mu.Lock()
+		err = s.rebaseLocked(s.persisted, []rune(current))
+		if err == nil {
+			s.persisted = []rune(current)
+			s.version = newVersion
+		}
+		s.mu.Unlock()
+		if err != nil {
+			s.manager.logger.Error("Failed to merge collaborative note", "note_id", s.noteID, "error", err)
+			return
+		}
+	}
+}
+
+// terminate отключает всех участников с сообщением об ошибке, например после удаления заметки.
+func (s *Session) terminate(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persisted = s.text
+	s.unchecked = false
+	for _, c := range s.clients {
+		s.sendLocked(c, Message{Type: TypeError, Revision: s.revision, Error: reason})
+	}
+	for _, c := range s.clients {
+		s.removeLocked(c)
+	}
+}
+
+// transformCursor переносит выделение через операцию.
+func transformCursor(op Operation, c Cursor) Cursor {
+	return Cursor{Anchor: TransformIndex(op, c.Anchor), Head: TransformIndex(op, c.Head)}
+}
+
+// clamp ограничивает позицию длиной документа.
+func clamp(pos, length int) int {
+	if pos < 0 {
+		return 0
+	}
+	if pos > length {
+		return length
+	}
+	return pos
+}
+
+// newClientID создает случайный идентификатор подключения.
+func newClientID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
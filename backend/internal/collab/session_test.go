@@ -0,0 +1,155 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// newTestSession создает сеанс без базы данных с документом text.
+func newTestSession(text string) *Session {
+	m := &Manager{logger: logger.InitLogger(io.Discard), sessions: make(map[int]*Session)}
+	return &Session{
+		manager:  m,
+		noteID:   1,
+		text:     []rune(text),
+		clients:  make(map[string]*Client),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+// join добавляет в сеанс участника с правом редактирования canEdit и проверкой доступа access.
+func join(t *testing.T, s *Session, id string, canEdit bool, access AccessFunc) *Client {
+	t.Helper()
+	c := &Client{
+		send:   make(chan []byte, clientBuffer),
+		done:   make(chan struct{}),
+		access: access,
+		info:   Participant{ClientID: id, Username: id, CanEdit: canEdit},
+	}
+	if !s.add(c) {
+		t.Fatalf("add %s: session closed", id)
+	}
+	return c
+}
+
+// drain возвращает сообщения, накопившиеся в очереди участника.
+func drain(t *testing.T, c *Client) []Message {
+	t.Helper()
+	var msgs []Message
+	for {
+		select {
+		case data := <-c.send:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("unmarshal %s: %v", data, err)
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// allow возвращает проверку доступа с фиксированным результатом.
+func allow(canEdit bool, err error) AccessFunc {
+	return func(ctx context.Context) (bool, error) { return canEdit, err }
+}
+
+func TestCheckAccess(t *testing.T) {
+	s := newTestSession("текст")
+	kept := join(t, s, "kept", true, allow(true, nil))
+	downgraded := join(t, s, "downgraded", true, allow(false, nil))
+	revoked := join(t, s, "revoked", true, allow(false, ErrAccessDenied))
+	failed := join(t, s, "failed", true, allow(false, errors.New("connection refused")))
+	for _, c := range []*Client{kept, downgraded, revoked, failed} {
+		drain(t, c)
+	}
+
+	s.checkAccess()
+
+	select {
+	case <-revoked.Done():
+	default:
+		t.Fatal("client without access is still connected")
+	}
+	// Последним отключенный участник получает причину отключения.
+	msgs := drain(t, revoked)
+	if len(msgs) == 0 || msgs[len(msgs)-1].Type != TypeError || msgs[len(msgs)-1].Error != "access revoked" {
+		t.Errorf("revoked client got %+v, want access revoked error", msgs)
+	}
+	if _, ok := s.clients["revoked"]; ok {
+		t.Error("revoked client is still in the session")
+	}
+
+	if downgraded.info.CanEdit {
+		t.Error("client that lost write access can still edit")
+	}
+	if !kept.info.CanEdit || !failed.info.CanEdit {
+		t.Error("rights changed for a client whose access did not change or could not be checked")
+	}
+
+	// Остальные участники узнают об изменении прав и об отключении.
+	for _, c := range []*Client{kept, downgraded, failed} {
+		var access, leave bool
+		for _, msg := range drain(t, c) {
+			switch {
+			case msg.Type == TypeAccess && msg.ClientID == "downgraded" && msg.Participant != nil && !msg.Participant.CanEdit:
+				access = true
+			case msg.Type == TypeLeave && msg.ClientID == "revoked":
+				leave = true
+			}
+		}
+		if !access || !leave {
+			t.Errorf("%s: access message %v, leave message %v; want both", c.info.ClientID, access, leave)
+		}
+	}
+
+	// Участник, потерявший право редактирования, больше не может менять документ.
+	downgraded.Handle([]byte(`{"type": "op", "revision": 0, "op": ["новый "]}`))
+	msgs = drain(t, downgraded)
+	if len(msgs) != 1 || msgs[0].Error != "read-only access" {
+		t.Errorf("op from downgraded client: got %+v, want read-only error", msgs)
+	}
+	if string(s.text) != "текст" {
+		t.Errorf("document = %q, want it unchanged", string(s.text))
+	}
+}
+
+func TestCheckAccessUpgrade(t *testing.T) {
+	s := newTestSession("")
+	c := join(t, s, "viewer", false, allow(true, nil))
+	drain(t, c)
+
+	s.checkAccess()
+	if !c.info.CanEdit {
+		t.Fatal("client that gained write access still cannot edit")
+	}
+	msgs := drain(t, c)
+	if len(msgs) != 1 || msgs[0].Type != TypeAccess || !msgs[0].Participant.CanEdit {
+		t.Errorf("got %+v, want access message with can_edit", msgs)
+	}
+
+	// Повторная проверка без изменений ничего не отправляет.
+	s.checkAccess()
+	if msgs := drain(t, c); len(msgs) != 0 {
+		t.Errorf("unchanged access: got %+v, want no messages", msgs)
+	}
+}
+
+func TestCheckAccessLastClient(t *testing.T) {
+	s := newTestSession("")
+	join(t, s, "only", true, allow(false, ErrAccessDenied))
+
+	s.checkAccess()
+	select {
+	case <-s.stop:
+	default:
+		t.Error("session is not closed after its last client lost access")
+	}
+}
@@ -2,10 +2,47 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DB DatabaseConfig
+	// Server - HTTP-сервер сервиса.
+	Server ServerConfig
+	DB     DatabaseConfig
+	Mailer MailerConfig
+	OIDC   []OIDCProviderConfig
+	JWT    JWTConfig
+	// Storage - хранилище вложений заметок.
+	Storage StorageConfig
+	// Jobs - выполнение фоновых заданий.
+	Jobs JobsConfig
+	// Speller - обращения к сервису проверки орфографии.
+	Speller SpellerConfig
+
+	// BaseURL - публичный адрес сервиса, используется для формирования ссылок в письмах.
+	BaseURL string
+}
+
+// ServerConfig описывает HTTP-сервер. Если заданы TLSCertFile и TLSKeyFile, сервер принимает HTTPS.
+type ServerConfig struct {
+	// Addr - адрес, на котором сервер принимает подключения, например ":8000".
+	Addr string
+	// ReadHeaderTimeout и ReadTimeout ограничивают чтение заголовков и всего запроса вместе с телом.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	// WriteTimeout ограничивает время ответа на запрос. Потоки событий, выгрузка заметок
+	// и соединения WebSocket снимают это ограничение сами, а загрузка и скачивание вложений
+	// и импорт заметок заменяют ReadTimeout и WriteTimeout собственным сроком передачи файла.
+	WriteTimeout time.Duration
+	// IdleTimeout - сколько держать открытым соединение keep-alive между запросами.
+	IdleTimeout time.Duration
+	// ShutdownTimeout - сколько при остановке ждать завершения запросов и фоновых обработчиков.
+	ShutdownTimeout time.Duration
+	// TLSCertFile и TLSKeyFile - сертификат и закрытый ключ в формате PEM.
+	TLSCertFile string
+	TLSKeyFile  string
 }
 
 type DatabaseConfig struct {
@@ -17,8 +54,108 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// MailerConfig описывает способ отправки писем пользователям.
+// Driver принимает значения "smtp", "log" или "file".
+type MailerConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	// Dir - каталог, в который драйвер "file" складывает письма в формате .eml.
+	Dir string
+}
+
+// OIDCProviderConfig описывает внешний провайдер учетных записей OpenID Connect.
+// Настройки провайдера с именем corp читаются из переменных OIDC_CORP_*.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AutoProvision разрешает создавать локального пользователя при первом входе через провайдер.
+	AutoProvision bool
+	// LinkByEmail разрешает привязывать вход к существующему пользователю с тем же подтвержденным email.
+	LinkByEmail bool
+}
+
+// JWTConfig описывает выпуск и проверку JWT токенов сервиса.
+type JWTConfig struct {
+	// Issuer и Audience записываются в утверждения iss и aud и проверяются при разборе токена.
+	Issuer   string
+	Audience string
+	// KeysDir - каталог с ключами подписи в формате PEM, имя файла без расширения служит идентификатором ключа (kid).
+	KeysDir string
+	// ActiveKeyID - идентификатор ключа, которым подписываются новые токены. Остальные ключи только проверяют подпись.
+	ActiveKeyID string
+	// HMACKey - симметричный ключ HS256, используется, если KeysDir не задан.
+	HMACKey string
+}
+
+// StorageConfig описывает хранилище файлов вложений. Driver принимает значения "fs" или "s3".
+type StorageConfig struct {
+	Driver string
+	// Dir - каталог, в котором драйвер "fs" хранит файлы.
+	Dir string
+	// Настройки S3-совместимого хранилища (AWS S3, MinIO и т.п.).
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// S3PathStyle включает адреса вида endpoint/bucket/key вместо bucket.endpoint/key, как требует MinIO.
+	S3PathStyle bool
+	// MaxFileSize - максимальный размер одного вложения в байтах.
+	MaxFileSize int64
+	// UserQuota - максимальный суммарный размер вложений, загруженных одним пользователем, в байтах.
+	UserQuota int64
+}
+
+// JobsConfig описывает обработчики фоновых заданий этого экземпляра сервиса.
+type JobsConfig struct {
+	// Workers - число заданий, выполняемых одновременно.
+	Workers int
+	// PollInterval - как часто простаивающий обработчик проверяет очередь.
+	PollInterval time.Duration
+	// ShutdownTimeout - сколько при остановке сервера ждать завершения выполняемых заданий.
+	ShutdownTimeout time.Duration
+	// TrashRetention - сколько удаленные заметки хранятся в корзине до окончательного удаления.
+	TrashRetention time.Duration
+}
+
+// SpellerConfig описывает клиент сервиса проверки орфографии (Яндекс.Спеллер).
+type SpellerConfig struct {
+	// BaseURL - адрес JSON-интерфейса сервиса, например локального заменителя cmd/fakespeller.
+	BaseURL string
+	// Timeout - время на одну попытку запроса.
+	Timeout time.Duration
+	// MaxRetries - число повторов запроса после ошибки сервера или таймаута.
+	MaxRetries int
+	// CacheSize - число результатов проверки, которые хранятся в памяти.
+	CacheSize int
+	// BreakerThreshold - число неудачных запросов подряд, после которого запросы временно не выполняются.
+	BreakerThreshold int
+	// BreakerCooldown - сколько запросы не выполняются, прежде чем сервис будет проверен снова.
+	BreakerCooldown time.Duration
+}
+
 func LoadConfig() *Config {
+	baseURL := getEnv("APP_BASE_URL", "http://localhost:8000")
+
 	return &Config{
+		Server: ServerConfig{
+			Addr:              getEnv("SERVER_ADDR", ":8000"),
+			ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+			ReadTimeout:       getEnvDuration("SERVER_READ_TIMEOUT", 5*time.Minute),
+			WriteTimeout:      getEnvDuration("SERVER_WRITE_TIMEOUT", time.Minute),
+			IdleTimeout:       getEnvDuration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+			ShutdownTimeout:   getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 40*time.Second),
+			TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+			TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+		},
 		DB: DatabaseConfig{
 			Host:     os.Getenv("DB_HOST"),
 			Port:     os.Getenv("DB_PORT"),
@@ -27,5 +164,98 @@ func LoadConfig() *Config {
 			DBName:   os.Getenv("DB_NAME"),
 			SSLMode:  os.Getenv("DB_SSLMODE"),
 		},
+		Mailer: MailerConfig{
+			Driver:       getEnv("MAILER_DRIVER", "log"),
+			From:         getEnv("MAILER_FROM", "notes@localhost"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUser:     os.Getenv("SMTP_USER"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			Dir:          getEnv("MAILER_DIR", "mail"),
+		},
+		OIDC: loadOIDCProviders(baseURL),
+		JWT: JWTConfig{
+			Issuer:      getEnv("JWT_ISSUER", baseURL),
+			Audience:    getEnv("JWT_AUDIENCE", "notes_app"),
+			KeysDir:     os.Getenv("JWT_KEYS_DIR"),
+			ActiveKeyID: os.Getenv("JWT_ACTIVE_KEY_ID"),
+			HMACKey:     os.Getenv("JWT_KEY"),
+		},
+		Storage: StorageConfig{
+			Driver:      getEnv("STORAGE_DRIVER", "fs"),
+			Dir:         getEnv("STORAGE_DIR", "attachments"),
+			S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    os.Getenv("S3_BUCKET"),
+			S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+			S3PathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+			MaxFileSize: getEnvInt64("ATTACHMENT_MAX_SIZE", 25<<20),
+			UserQuota:   getEnvInt64("ATTACHMENT_USER_QUOTA", 1<<30),
+		},
+		Jobs: JobsConfig{
+			Workers:         int(getEnvInt64("JOB_WORKERS", 4)),
+			PollInterval:    getEnvDuration("JOB_POLL_INTERVAL", time.Second),
+			ShutdownTimeout: getEnvDuration("JOB_SHUTDOWN_TIMEOUT", 30*time.Second),
+			TrashRetention:  getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		},
+		Speller: SpellerConfig{
+			BaseURL:          getEnv("SPELLER_URL", "https://speller.yandex.net/services/spellservice.json"),
+			Timeout:          getEnvDuration("SPELLER_TIMEOUT", 5*time.Second),
+			MaxRetries:       int(getEnvInt64("SPELLER_RETRIES", 2)),
+			CacheSize:        int(getEnvInt64("SPELLER_CACHE_SIZE", 1000)),
+			BreakerThreshold: int(getEnvInt64("SPELLER_BREAKER_THRESHOLD", 5)),
+			BreakerCooldown:  getEnvDuration("SPELLER_BREAKER_COOLDOWN", 30*time.Second),
+		},
+		BaseURL: baseURL,
+	}
+}
+
+// loadOIDCProviders читает настройки провайдеров, перечисленных через запятую в OIDC_PROVIDERS.
+func loadOIDCProviders(baseURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:          name,
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientID:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:   getEnv(prefix+"REDIRECT_URL", baseURL+"/auth/oidc/callback"),
+			Scopes:        strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			AutoProvision: getEnv(prefix+"AUTO_PROVISION", "false") == "true",
+			LinkByEmail:   getEnv(prefix+"LINK_BY_EMAIL", "false") == "true",
+		})
+	}
+	return providers
+}
+
+// getEnv возвращает значение переменной окружения или значение по умолчанию, если переменная не задана.
+func getEnv(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt64 возвращает числовое значение переменной окружения или значение по умолчанию,
+// если переменная не задана или не является числом.
+func getEnvInt64(key string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// getEnvDuration возвращает длительность из переменной окружения (например, "30s" или "720h")
+// или значение по умолчанию, если переменная не задана или не является длительностью.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
 	}
+	return def
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetEnv(t *testing.T) {
+	t.Setenv("NOTES_TEST_SET", "value")
+	t.Setenv("NOTES_TEST_EMPTY", "")
+	tests := map[string]string{
+		"NOTES_TEST_SET":   "value",
+		"NOTES_TEST_EMPTY": "default",
+		"NOTES_TEST_UNSET": "default",
+	}
+	for key, want := range tests {
+		if got := getEnv(key, "default"); got != want {
+			t.Errorf("getEnv(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", " corp, ,google")
+	t.Setenv("OIDC_CORP_ISSUER", "https://sso.example.com")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "notes")
+	t.Setenv("OIDC_CORP_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_CORP_SCOPES", "openid  email groups")
+	t.Setenv("OIDC_CORP_AUTO_PROVISION", "true")
+	t.Setenv("OIDC_CORP_LINK_BY_EMAIL", "true")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_REDIRECT_URL", "https://notes.example.com/google/callback")
+	t.Setenv("OIDC_GOOGLE_AUTO_PROVISION", "yes")
+
+	got := loadOIDCProviders("https://notes.example.com")
+	want := []OIDCProviderConfig{
+		{
+			Name: "corp", Issuer: "https://sso.example.com", ClientID: "notes", ClientSecret: "secret",
+			RedirectURL: "https://notes.example.com/auth/oidc/callback", Scopes: []string{"openid", "email", "groups"},
+			AutoProvision: true, LinkByEmail: true,
+		},
+		{
+			Name: "google", Issuer: "https://accounts.google.com",
+			RedirectURL: "https://notes.example.com/google/callback", Scopes: []string{"openid", "email", "profile"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadOIDCProviders =\n%+v\nwant\n%+v", got, want)
+	}
+
+	t.Setenv("OIDC_PROVIDERS", "")
+	if got := loadOIDCProviders("https://notes.example.com"); len(got) != 0 {
+		t.Errorf("loadOIDCProviders without providers = %+v", got)
+	}
+}
+
+func TestGetEnvInt64(t *testing.T) {
+	t.Setenv("NOTES_TEST_SIZE", "1048576")
+	t.Setenv("NOTES_TEST_INVALID", "25MB")
+	tests := map[string]int64{
+		"NOTES_TEST_SIZE":    1 << 20,
+		"NOTES_TEST_INVALID": 42,
+		"NOTES_TEST_UNSET":   42,
+	}
+	for key, want := range tests {
+		if got := getEnvInt64(key, 42); got != want {
+			t.Errorf("getEnvInt64(%s) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	t.Setenv("NOTES_TEST_TIMEOUT", "1m30s")
+	t.Setenv("NOTES_TEST_SECONDS", "30")
+	tests := map[string]time.Duration{
+		"NOTES_TEST_TIMEOUT": 90 * time.Second,
+		// Число без единицы измерения не принимается, чтобы не гадать, секунды это или миллисекунды.
+		"NOTES_TEST_SECONDS": time.Minute,
+		"NOTES_TEST_UNSET":   time.Minute,
+	}
+	for key, want := range tests {
+		if got := getEnvDuration(key, time.Minute); got != want {
+			t.Errorf("getEnvDuration(%s) = %v, want %v", key, got, want)
+		}
+	}
+}
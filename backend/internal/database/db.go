@@ -62,16 +62,19 @@ func (db *PostgresDB) Close() error {
 	return db.DB.Close()
 }
 
+// ConnString формирует строку подключения к базе данных PostgreSQL.
+// Она нужна и для отдельных соединений, которые не проходят через пул, например для LISTEN.
+func ConnString(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode)
+}
+
 // NewPostgresDB создает и возвращает новый экземпляр PostgresDB, используя настройки из конфигурации.
 // Выполняется проверка подключения к базе данных для обеспечения его корректной работы.
 // При успешной проверке возвращается объект PostgresDB и nil, иначе возвращается ошибка.
 func NewPostgresDB(cfg config.DatabaseConfig) (Database, error) {
-	// Формирование строки подключения к базе данных PostgreSQL.
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode)
-
 	// Открытие соединения с базой данных.
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", ConnString(cfg))
 	if err != nil {
 		return nil, err
 	}
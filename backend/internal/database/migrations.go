@@ -1,13 +1,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 )
 
 // RunMigrations выполняет миграции базы данных, создавая необходимые таблицы,
 // если они еще не существуют. Это необходимо для обеспечения структуры
 // базы данных перед запуском приложения.
+//
+// Номер каждой примененной миграции записывается в таблицу schema_migrations, и при следующих
+// запусках она не выполняется. Поэтому новые миграции добавляются только в конец списка,
+// а уже добавленные не меняются.
 func RunMigrations(db *sql.DB) {
 	// SQL-запрос для создания таблицы пользователей.
 	// Таблица содержит следующие столбцы:
@@ -35,17 +41,688 @@ func RunMigrations(db *sql.DB) {
         FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
     );`
 
-	// Выполнение SQL-запроса для создания таблицы пользователей.
-	// В случае возникновения ошибки во время выполнения запроса, приложение завершится с ошибкой.
-	_, err := db.Exec(userTable)
-	if err != nil {
+	// SQL-запрос для добавления адреса электронной почты пользователям.
+	// - email: необязательный адрес, уникальный без учета регистра.
+	// - email_verified: признак того, что пользователь подтвердил владение адресом.
+	userEmail := `ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS email VARCHAR(255),
+        ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+    CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email));`
+
+	// SQL-запрос для создания таблицы одноразовых токенов пользователей
+	// (сброс пароля, подтверждение email).
+	// - token_hash: SHA-256 хэш токена, сам токен в базе данных не хранится.
+	// - purpose: назначение токена, токен одного назначения нельзя использовать для другого.
+	// - expires_at: момент, после которого токен недействителен.
+	// - used_at: момент использования, токен можно использовать только один раз.
+	userTokensTable := `CREATE TABLE IF NOT EXISTS user_tokens (
+        id SERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        purpose VARCHAR(32) NOT NULL,
+        token_hash CHAR(64) UNIQUE NOT NULL,
+        expires_at TIMESTAMPTZ NOT NULL,
+        used_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );`
+
+	// SQL-запрос для добавления пользователям двухфакторной аутентификации (TOTP).
+	// - totp_secret: активный секрет в кодировке base32.
+	// - totp_pending_secret: новый секрет, ожидающий подтверждения первым кодом.
+	// - totp_enabled: признак включенной двухфакторной аутентификации.
+	// - totp_last_step: последний использованный временной шаг, защищает от повторного использования кода.
+	userTOTP := `ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64),
+        ADD COLUMN IF NOT EXISTS totp_pending_secret VARCHAR(64),
+        ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;`
+
+	// SQL-запрос для создания таблицы одноразовых кодов восстановления двухфакторной аутентификации.
+	// - code_hash: SHA-256 хэш кода, сам код в базе данных не хранится.
+	// - used_at: момент использования кода, каждый код можно использовать один раз.
+	recoveryCodesTable := `CREATE TABLE IF NOT EXISTS recovery_codes (
+        id SERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        code_hash CHAR(64) NOT NULL,
+        used_at TIMESTAMPTZ,
+        UNIQUE (user_id, code_hash)
+    );`
+
+	// SQL-запрос для создания таблицы challenge-токенов второго шага входа.
+	// - jti: идентификатор токена; по токену можно войти только один раз (used_at).
+	// - attempts: число введенных по токену кодов; после пяти неверных токен не принимается.
+	// Неверные коды пользователя за последние 15 минут считаются по этой таблице: после 20 неудач
+	// новые токены не выдаются до конца окна.
+	twoFactorChallenges := `CREATE TABLE IF NOT EXISTS two_factor_challenges (
+        jti VARCHAR(64) PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        attempts INT NOT NULL DEFAULT 0,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        used_at TIMESTAMPTZ
+    );
+    CREATE INDEX IF NOT EXISTS two_factor_challenges_user_id_idx ON two_factor_challenges (user_id, created_at);`
+
+	// SQL-запрос для создания таблицы привязок пользователей к учетным записям внешних провайдеров (OIDC).
+	// - provider: имя провайдера из конфигурации.
+	// - subject: неизменяемый идентификатор пользователя у провайдера (утверждение sub).
+	// - email: адрес, сообщенный провайдером при привязке, хранится для справки.
+	userIdentitiesTable := `CREATE TABLE IF NOT EXISTS user_identities (
+        id SERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        provider VARCHAR(50) NOT NULL,
+        subject VARCHAR(255) NOT NULL,
+        email VARCHAR(255),
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        UNIQUE (provider, subject),
+        UNIQUE (user_id, provider)
+    );`
+
+	// SQL-запрос для создания таблицы персональных токенов доступа (API keys).
+	// - prefix: открытая часть токена, по которой пользователь узнает его в списке.
+	// - token_hash: SHA-256 хэш полного токена, сам токен в базе данных не хранится.
+	// - scopes: разрешения токена (notes:read, notes:write, notes:delete).
+	// - expires_at: необязательный срок действия.
+	// - last_used_at: момент последнего использования.
+	// - revoked_at: момент отзыва, отозванный токен больше не принимается.
+	apiTokensTable := `CREATE TABLE IF NOT EXISTS api_tokens (
+        id SERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        name VARCHAR(100) NOT NULL,
+        prefix VARCHAR(16) UNIQUE NOT NULL,
+        token_hash CHAR(64) UNIQUE NOT NULL,
+        scopes TEXT[] NOT NULL,
+        expires_at TIMESTAMPTZ,
+        last_used_at TIMESTAMPTZ,
+        revoked_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );`
+
+	// SQL-запрос для создания таблицы доступа к заметкам других пользователей.
+	// - role: viewer (только чтение) или editor (чтение и изменение текста).
+	// Удалять заметку и управлять доступом к ней может только владелец.
+	noteSharesTable := `CREATE TABLE IF NOT EXISTS note_shares (
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR(16) NOT NULL CHECK (role IN ('viewer', 'editor')),
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (note_id, user_id)
+    );
+    CREATE INDEX IF NOT EXISTS note_shares_user_id_idx ON note_shares (user_id);`
+
+	// SQL-запрос для создания таблицы публичных ссылок на заметки (доступ без учетной записи, только чтение).
+	// - token_hash: SHA-256 хэш токена из ссылки, сам токен в базе данных не хранится.
+	// - password_hash: необязательный пароль ссылки, хэшированный bcrypt.
+	// - expires_at: необязательный срок действия.
+	// - view_count: число успешных просмотров.
+	// - revoked_at: момент отзыва, отозванная ссылка больше не открывается.
+	noteLinksTable := `CREATE TABLE IF NOT EXISTS note_links (
+        id SERIAL PRIMARY KEY,
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        token_hash CHAR(64) UNIQUE NOT NULL,
+        password_hash VARCHAR(100),
+        expires_at TIMESTAMPTZ,
+        view_count INT NOT NULL DEFAULT 0,
+        revoked_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS note_links_note_id_idx ON note_links (note_id);`
+
+	// SQL-запрос для создания таблиц рабочих пространств (команд), их участников и приглашений.
+	// - workspace_members.role: owner, admin, editor или viewer.
+	// - workspace_invitations: приглашение пользователя с заданной ролью, которое он может принять или отклонить.
+	workspacesTable := `CREATE TABLE IF NOT EXISTS workspaces (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        created_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE TABLE IF NOT EXISTS workspace_members (
+        workspace_id INT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (workspace_id, user_id)
+    );
+    CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+    CREATE TABLE IF NOT EXISTS workspace_invitations (
+        id SERIAL PRIMARY KEY,
+        workspace_id INT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+        invited_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        UNIQUE (workspace_id, user_id)
+    );`
+
+	// SQL-запрос для привязки заметок к рабочему пространству.
+	// - workspace_id: пространство, которому принадлежит заметка; NULL для личных заметок.
+	// Для заметок пространства user_id хранит автора заметки.
+	notesWorkspace := `ALTER TABLE notes
+        ADD COLUMN IF NOT EXISTS workspace_id INT REFERENCES workspaces(id) ON DELETE CASCADE;
+    CREATE INDEX IF NOT EXISTS notes_workspace_id_idx ON notes (workspace_id);`
+
+	// SQL-запрос для создания журнала изменений заметок, из которого отдаются события в реальном времени.
+	// - type: created, updated или deleted.
+	// - user_ids: пользователи, которым видна заметка на момент изменения (автор личной заметки,
+	//   участники ее рабочего пространства и пользователи, которым предоставлен доступ).
+	// События записываются триггерами notesTriggers, поэтому их порождает любое изменение заметок,
+	// и рассылаются по каналу note_events через NOTIFY. Идентификаторы событий выдаются в порядке,
+	// согласованном с фиксацией транзакций (см. noteEventsOrder).
+	noteEventsTable := `CREATE TABLE IF NOT EXISTS note_events (
+        id BIGSERIAL PRIMARY KEY,
+        note_id INT NOT NULL,
+        workspace_id INT,
+        type VARCHAR(16) NOT NULL,
+        user_ids INT[] NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS note_events_user_ids_idx ON note_events USING GIN (user_ids);
+    CREATE INDEX IF NOT EXISTS note_events_created_at_idx ON note_events (created_at);`
+
+	// SQL-запрос для поддержки синхронизации заметок с офлайн-клиентами.
+	// - version: версия заметки, увеличивается при каждом изменении; клиент передает ее как базовую,
+	//   чтобы изменение, сделанное поверх устаревшей версии, было отклонено как конфликт.
+	// - change_seq: номер последнего изменения из последовательности notes_change_seq, по нему строится лента изменений.
+	// - client_ref: идентификатор, присвоенный заметке клиентом при создании, делает повторную отправку безопасной.
+	// - deleted_at: момент удаления. Удаленная заметка остается в таблице (tombstone), чтобы клиенты узнали об удалении.
+	// Номера изменений выдаются триггером notes_track_change (см. notesTriggers) под разделяемой
+	// advisory-блокировкой, которую функция notes_sync_token берет монопольно: так токен синхронизации
+	// не может обогнать еще не зафиксированные изменения.
+	notesSync := `CREATE SEQUENCE IF NOT EXISTS notes_change_seq;
+    ALTER TABLE notes
+        ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1,
+        ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT nextval('notes_change_seq'),
+        ADD COLUMN IF NOT EXISTS client_ref VARCHAR(64),
+        ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+    ALTER TABLE notes ALTER COLUMN change_seq DROP DEFAULT;
+    CREATE INDEX IF NOT EXISTS notes_change_seq_idx ON notes (change_seq);
+    CREATE UNIQUE INDEX IF NOT EXISTS notes_client_ref_key ON notes (user_id, client_ref);
+
+    CREATE OR REPLACE FUNCTION notes_sync_token() RETURNS BIGINT AS $$
+    DECLARE
+        token BIGINT;
+    BEGIN
+        PERFORM pg_advisory_xact_lock(hashtext('notes_change_seq'));
+        SELECT CASE WHEN is_called THEN last_value ELSE 0 END INTO token FROM notes_change_seq;
+        RETURN token;
+    END;
+    $$ LANGUAGE plpgsql;`
+
+	// SQL-запрос для учета изменений доступа к заметкам в ленте синхронизации и журнале событий.
+	// Предоставление доступа к заметке или участие в рабочем пространстве не меняют саму заметку,
+	// поэтому триггеры note_shares и workspace_members записывают в note_access_changes номер изменения
+	// для пользователя, чей доступ изменился: лента отдает ему заметку, если она ему видна, и удаление
+	// (tombstone), если доступ потерян. Тем же пользователям рассылаются события created и deleted.
+	// Записи удаляются вместе с пользователем или заметкой, поэтому каскадное удаление их не создает.
+	noteAccessChanges := `CREATE TABLE IF NOT EXISTS note_access_changes (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        change_seq BIGINT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS note_access_changes_user_seq_idx ON note_access_changes (user_id, change_seq);
+    CREATE INDEX IF NOT EXISTS note_access_changes_note_id_idx ON note_access_changes (note_id);
+
+    CREATE OR REPLACE FUNCTION note_access_changed(uid INT, note_ids INT[], granted BOOLEAN) RETURNS void AS $$
+    DECLARE
+        n notes%ROWTYPE;
+        event_id BIGINT;
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM users WHERE id = uid) THEN
+            RETURN;
+        END IF;
+        PERFORM pg_advisory_xact_lock_shared(hashtext('notes_change_seq'));
+        FOR n IN SELECT * FROM notes WHERE id = ANY(note_ids) ORDER BY id LOOP
+            INSERT INTO note_access_changes (user_id, note_id, change_seq)
+            VALUES (uid, n.id, nextval('notes_change_seq'));
+
+            -- Об удаленной заметке и о заметке, которая осталась видна другим путем, событие не нужно.
+            CONTINUE WHEN n.deleted_at IS NOT NULL;
+            CONTINUE WHEN NOT granted AND (
+                (n.workspace_id IS NULL AND n.user_id = uid)
+                OR EXISTS (SELECT 1 FROM note_shares s WHERE s.note_id = n.id AND s.user_id = uid)
+                OR EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = n.workspace_id AND m.user_id = uid));
+
+            INSERT INTO note_events (note_id, workspace_id, type, user_ids)
+            VALUES (n.id, n.workspace_id, CASE WHEN granted THEN 'created' ELSE 'deleted' END, ARRAY[uid])
+            RETURNING id INTO event_id;
+            PERFORM pg_notify('note_events', event_id::text);
+        END LOOP;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    CREATE OR REPLACE FUNCTION note_shares_access() RETURNS trigger AS $$
+    BEGIN
+        IF TG_OP = 'INSERT' THEN
+            PERFORM note_access_changed(NEW.user_id, ARRAY[NEW.note_id], TRUE);
+        ELSE
+            PERFORM note_access_changed(OLD.user_id, ARRAY[OLD.note_id], FALSE);
+        END IF;
+        RETURN NULL;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    DROP TRIGGER IF EXISTS note_shares_access ON note_shares;
+    CREATE TRIGGER note_shares_access AFTER INSERT OR DELETE ON note_shares
+        FOR EACH ROW EXECUTE FUNCTION note_shares_access();
+
+    CREATE OR REPLACE FUNCTION workspace_members_access() RETURNS trigger AS $$
+    BEGIN
+        IF TG_OP = 'INSERT' THEN
+            PERFORM note_access_changed(NEW.user_id,
+                ARRAY(SELECT id FROM notes WHERE workspace_id = NEW.workspace_id), TRUE);
+        ELSE
+            PERFORM note_access_changed(OLD.user_id,
+                ARRAY(SELECT id FROM notes WHERE workspace_id = OLD.workspace_id), FALSE);
+        END IF;
+        RETURN NULL;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    DROP TRIGGER IF EXISTS workspace_members_access ON workspace_members;
+    CREATE TRIGGER workspace_members_access AFTER INSERT OR DELETE ON workspace_members
+        FOR EACH ROW EXECUTE FUNCTION workspace_members_access();`
+
+	// SQL-запрос для добавления формата текста заметки: plain (обычный текст) или markdown.
+	notesFormat := `ALTER TABLE notes ADD COLUMN IF NOT EXISTS format VARCHAR(16) NOT NULL DEFAULT 'plain'
+        CHECK (format IN ('plain', 'markdown'));`
+
+	// SQL-запрос для создания таблицы вложений заметок. Содержимое файлов хранится в BlobStore
+	// под ключом storage_key. Ключи объектов, которые больше не нужны (вложение или заметка удалены,
+	// загрузка не завершилась), попадают в orphaned_blobs и удаляются из хранилища в фоне.
+	attachmentsTable := `CREATE TABLE IF NOT EXISTS attachments (
+        id SERIAL PRIMARY KEY,
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        filename VARCHAR(255) NOT NULL,
+        content_type VARCHAR(255) NOT NULL,
+        size BIGINT NOT NULL,
+        sha256 CHAR(64) NOT NULL,
+        storage_key VARCHAR(255) NOT NULL UNIQUE,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS attachments_note_id_idx ON attachments (note_id);
+    CREATE INDEX IF NOT EXISTS attachments_user_id_idx ON attachments (user_id);
+
+    CREATE TABLE IF NOT EXISTS orphaned_blobs (
+        storage_key VARCHAR(255) PRIMARY KEY,
+        created_at TIMESTAMP NOT NULL DEFAULT now()
+    );
+
+    CREATE OR REPLACE FUNCTION attachments_orphan_blob() RETURNS trigger AS $$
+    BEGIN
+        INSERT INTO orphaned_blobs (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+        RETURN OLD;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    DROP TRIGGER IF EXISTS attachments_orphan_blob ON attachments;
+    CREATE TRIGGER attachments_orphan_blob AFTER DELETE ON attachments
+        FOR EACH ROW EXECUTE FUNCTION attachments_orphan_blob();`
+
+	// SQL-запрос для добавления меток заметок, например папок и ярлыков импортированных заметок.
+	notesTags := `ALTER TABLE notes ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+    CREATE INDEX IF NOT EXISTS notes_tags_idx ON notes USING GIN (tags);`
+
+	// SQL-запрос для создания таблицы заданий импорта заметок.
+	// - source_key: ключ загруженного файла в BlobStore, удаляется после завершения задания.
+	// - status: queued (ожидает), running (выполняется), done (завершено) или failed (ошибка).
+	// - total, processed: число найденных и обработанных элементов для отображения прогресса.
+	// - report: итог импорта - импортированные и пропущенные элементы с причинами.
+	importJobsTable := `CREATE TABLE IF NOT EXISTS import_jobs (
+        id SERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        format VARCHAR(32) NOT NULL,
+        spellcheck BOOLEAN NOT NULL DEFAULT FALSE,
+        source_key VARCHAR(255),
+        status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+        total INT NOT NULL DEFAULT 0,
+        processed INT NOT NULL DEFAULT 0,
+        imported INT NOT NULL DEFAULT 0,
+        skipped INT NOT NULL DEFAULT 0,
+        report JSONB,
+        error TEXT,
+        created_at TIMESTAMP NOT NULL DEFAULT now(),
+        started_at TIMESTAMP,
+        finished_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs (user_id);`
+
+	// SQL-запрос для создания очереди фоновых заданий.
+	// - kind, payload: тип задания и его параметры в JSON.
+	// - status: queued (ожидает), running (выполняется), done (выполнено) или dead (попытки исчерпаны).
+	// - run_at: момент, не раньше которого задание можно выполнять; при повторе сдвигается.
+	// - locked_by, locked_until: экземпляр сервиса, выполняющий задание, и срок его закрепления.
+	// - unique_key: ключ, не допускающий двух одинаковых заданий в очереди одновременно.
+	// Таблица job_schedules хранит момент последнего запуска периодических заданий.
+	jobsTable := `CREATE TABLE IF NOT EXISTS jobs (
+        id BIGSERIAL PRIMARY KEY,
+        kind VARCHAR(64) NOT NULL,
+        payload JSONB NOT NULL DEFAULT '{}',
+        status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'dead')),
+        attempts INT NOT NULL DEFAULT 0,
+        max_attempts INT NOT NULL DEFAULT 10,
+        unique_key VARCHAR(255),
+        run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        locked_by VARCHAR(128),
+        locked_until TIMESTAMPTZ,
+        last_error TEXT,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        finished_at TIMESTAMPTZ
+    );
+    CREATE INDEX IF NOT EXISTS jobs_queued_idx ON jobs (run_at) WHERE status = 'queued';
+    CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs (locked_until) WHERE status = 'running';
+    CREATE INDEX IF NOT EXISTS jobs_finished_idx ON jobs (finished_at) WHERE status IN ('done', 'dead');
+    CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key ON jobs (kind, unique_key) WHERE status IN ('queued', 'running');
+
+    CREATE TABLE IF NOT EXISTS job_schedules (
+        name VARCHAR(64) PRIMARY KEY,
+        spec VARCHAR(128) NOT NULL,
+        last_run_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );`
+
+	// SQL-запрос для окончательного удаления заметок из корзины. Клиент, токен синхронизации
+	// которого меньше sync_horizon.change_seq, не узнает об удалении удаленных окончательно заметок,
+	// поэтому такой токен считается устаревшим.
+	notesTrashPurge := `CREATE INDEX IF NOT EXISTS notes_deleted_at_idx ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
+
+    CREATE TABLE IF NOT EXISTS sync_horizon (
+        id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+        change_seq BIGINT NOT NULL DEFAULT 0
+    );
+    INSERT INTO sync_horizon (id) VALUES (TRUE) ON CONFLICT DO NOTHING;`
+
+	// SQL-запрос для фоновой проверки орфографии заметок.
+	// - spellcheck_status: pending (ожидает проверки), done (проверена), failed (проверить не удалось)
+	//   или skipped (не проверялась). Изменение текста без установки состояния означает, что новый текст
+	//   не проверялся, поэтому состояние становится skipped.
+	// Изменение только состояния проверки не меняет версию заметки и не порождает событий (см. notesTriggers).
+	// Таблица note_corrections хранит исправления, внесенные проверкой:
+	// - version: версия заметки, созданная исправлением.
+	// - position: позиция исправленного слова в символах текста этой версии.
+	notesSpellcheck := `ALTER TABLE notes ADD COLUMN IF NOT EXISTS spellcheck_status VARCHAR(16) NOT NULL DEFAULT 'skipped'
+        CHECK (spellcheck_status IN ('pending', 'done', 'failed', 'skipped'));
+
+    CREATE TABLE IF NOT EXISTS note_corrections (
+        id BIGSERIAL PRIMARY KEY,
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        version INT NOT NULL,
+        position INT NOT NULL,
+        word TEXT NOT NULL,
+        replacement TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS note_corrections_note_id_idx ON note_corrections (note_id);`
+
+	// SQL-запрос для создания триггеров заметок. Каждый триггер определяется только здесь.
+	// - notes_track_change и notes_track_update выдают номер изменения для ленты синхронизации,
+	//   увеличивают версию и обновляют updated_at; новый текст без установки состояния проверки
+	//   орфографии отмечается как непроверенный (skipped). Изменение только состояния проверки
+	//   версию не меняет.
+	// - notes_events_* записывают события в note_events: удаление и восстановление заметки приходят
+	//   как deleted и created, изменения удаленной заметки и ее окончательное удаление событий
+	//   не порождают. Для удаления триггер срабатывает до каскадного удаления записей note_shares,
+	//   чтобы их получатели тоже узнали об удалении.
+	notesTriggers := `CREATE OR REPLACE FUNCTION notes_track_change() RETURNS trigger AS $$
+    BEGIN
+        PERFORM pg_advisory_xact_lock_shared(hashtext('notes_change_seq'));
+        NEW.change_seq := nextval('notes_change_seq');
+        IF TG_OP = 'UPDATE' THEN
+            NEW.version := OLD.version + 1;
+            NEW.updated_at := now();
+            IF NEW.text IS DISTINCT FROM OLD.text AND NEW.spellcheck_status = OLD.spellcheck_status THEN
+                NEW.spellcheck_status := 'skipped';
+            END IF;
+        END IF;
+        RETURN NEW;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    CREATE OR REPLACE FUNCTION note_events_record() RETURNS trigger AS $$
+    DECLARE
+        n notes%ROWTYPE;
+        kind TEXT;
+        recipients INT[];
+        event_id BIGINT;
+    BEGIN
+        IF TG_OP = 'DELETE' THEN
+            IF OLD.deleted_at IS NOT NULL THEN
+                RETURN OLD;
+            END IF;
+            n := OLD;
+            kind := 'deleted';
+        ELSIF TG_OP = 'INSERT' THEN
+            n := NEW;
+            kind := 'created';
+        ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            n := NEW;
+            kind := 'deleted';
+        ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+            n := NEW;
+            kind := 'created';
+        ELSIF NEW.deleted_at IS NOT NULL THEN
+            RETURN NULL;
+        ELSE
+            n := NEW;
+            kind := 'updated';
+        END IF;
+
+        SELECT array_agg(DISTINCT r.uid) INTO recipients FROM (
+            SELECT n.user_id AS uid WHERE n.workspace_id IS NULL
+            UNION SELECT s.user_id FROM note_shares s WHERE s.note_id = n.id
+            UNION SELECT m.user_id FROM workspace_members m WHERE m.workspace_id = n.workspace_id
+        ) r;
+
+        INSERT INTO note_events (note_id, workspace_id, type, user_ids)
+        VALUES (n.id, n.workspace_id, kind, COALESCE(recipients, '{}'))
+        RETURNING id INTO event_id;
+        PERFORM pg_notify('note_events', event_id::text);
+
+        IF TG_OP = 'DELETE' THEN
+            RETURN OLD;
+        END IF;
+        RETURN NULL;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    DROP TRIGGER IF EXISTS notes_track_change ON notes;
+    CREATE TRIGGER notes_track_change BEFORE INSERT ON notes
+        FOR EACH ROW EXECUTE FUNCTION notes_track_change();
+    DROP TRIGGER IF EXISTS notes_track_update ON notes;
+    CREATE TRIGGER notes_track_update BEFORE UPDATE ON notes
+        FOR EACH ROW WHEN (NEW.text IS DISTINCT FROM OLD.text OR NEW.spellcheck_status IS NOT DISTINCT FROM OLD.spellcheck_status)
+        EXECUTE FUNCTION notes_track_change();
+    DROP TRIGGER IF EXISTS notes_events_insert ON notes;
+    CREATE TRIGGER notes_events_insert AFTER INSERT ON notes
+        FOR EACH ROW EXECUTE FUNCTION note_events_record();
+    DROP TRIGGER IF EXISTS notes_events_update ON notes;
+    CREATE TRIGGER notes_events_update AFTER UPDATE ON notes
+        FOR EACH ROW WHEN (OLD.* IS DISTINCT FROM NEW.*
+            AND (NEW.text IS DISTINCT FROM OLD.text OR NEW.spellcheck_status IS NOT DISTINCT FROM OLD.spellcheck_status))
+        EXECUTE FUNCTION note_events_record();
+    DROP TRIGGER IF EXISTS notes_events_delete ON notes;
+    CREATE TRIGGER notes_events_delete BEFORE DELETE ON notes
+        FOR EACH ROW EXECUTE FUNCTION note_events_record();`
+
+	// SQL-запрос для добавления настроек проверки орфографии пользователя.
+	// - speller_lang: языки проверки через запятую.
+	// - speller_ignore_*: пропускать слова с цифрами, адреса, не исправлять регистр букв.
+	userSpeller := `ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS speller_lang VARCHAR(16) NOT NULL DEFAULT 'ru,en',
+        ADD COLUMN IF NOT EXISTS speller_ignore_digits BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS speller_ignore_urls BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS speller_ignore_capitalization BOOLEAN NOT NULL DEFAULT FALSE;`
+
+	// SQL-запрос для создания таблицы словарей пользователей: слова, которые проверка орфографии
+	// не исправляет. Слова сравниваются без учета регистра.
+	userDictionaryTable := `CREATE TABLE IF NOT EXISTS user_dictionary (
+        id BIGSERIAL PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        word VARCHAR(255) NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS user_dictionary_word_key ON user_dictionary (user_id, lower(word));`
+
+	// SQL-запрос для дополнения журнала исправлений орфографии.
+	// - code: код ошибки Яндекс.Спеллер API.
+	// - reverted_at и reverted_version: момент отмены исправления пользователем и созданная отменой версия заметки.
+	noteCorrectionsAudit := `ALTER TABLE note_corrections
+        ADD COLUMN IF NOT EXISTS code INT NOT NULL DEFAULT 0,
+        ADD COLUMN IF NOT EXISTS reverted_at TIMESTAMPTZ,
+        ADD COLUMN IF NOT EXISTS reverted_version INT;`
+
+	// SQL-запрос для добавления администраторов и модерации учетных записей.
+	// - is_admin: пользователь может пользоваться административным API.
+	// - disabled_at, disabled_reason: время и причина блокировки; заблокированный пользователь не может
+	//   войти, а выданные ему сессии и персональные токены доступа не принимаются.
+	// - sessions_revoked_at: сессии, выданные раньше этого времени, не принимаются.
+	// - password_reset_required: вход запрещен (в том числе через провайдер учетных записей), пока пользователь
+	//   не сбросит пароль по ссылке из письма.
+	// - created_at: время регистрации; у пользователей, созданных до миграции, - время ее выполнения.
+	// Таблица admin_actions - журнал действий администраторов над учетными записями.
+	// - actor: администратор или, для действий из notesctl, пользователь операционной системы.
+	userAdmin := `ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ,
+        ADD COLUMN IF NOT EXISTS disabled_reason TEXT,
+        ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMPTZ,
+        ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+        ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+    CREATE TABLE IF NOT EXISTS admin_actions (
+        id SERIAL PRIMARY KEY,
+        actor VARCHAR(100) NOT NULL,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        action VARCHAR(32) NOT NULL,
+        details TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+    CREATE INDEX IF NOT EXISTS admin_actions_user_id_idx ON admin_actions (user_id, id);`
+
+	// SQL-запрос для создания функции, сохраняющей метаданные загруженного вложения с учетом квоты.
+	// Загрузки одного пользователя сериализуются advisory-блокировкой по его id, поэтому параллельные
+	// загрузки не могут вместе превысить квоту: каждая следующая видит размер уже сохраненных.
+	// Ключ объекта убирается из orphaned_blobs, только если вложение помещается в квоту; иначе функция
+	// не возвращает строк, и загруженный объект удаляется в фоне как ненужный.
+	attachmentsQuota := `CREATE OR REPLACE FUNCTION attachments_claim(p_note_id INT, p_user_id INT, p_filename TEXT,
+        p_content_type TEXT, p_size BIGINT, p_sha256 TEXT, p_storage_key TEXT, p_quota BIGINT)
+    RETURNS TABLE (attachment_id INT, attachment_created_at TIMESTAMP) AS $$
+    BEGIN
+        PERFORM pg_advisory_xact_lock(hashtext('attachments_quota'), p_user_id);
+        IF (SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = p_user_id) + p_size > p_quota THEN
+            RETURN;
+        END IF;
+        DELETE FROM orphaned_blobs WHERE storage_key = p_storage_key;
+        IF NOT FOUND THEN
+            RETURN;
+        END IF;
+        RETURN QUERY INSERT INTO attachments (note_id, user_id, filename, content_type, size, sha256, storage_key)
+            VALUES (p_note_id, p_user_id, p_filename, p_content_type, p_size, p_sha256, p_storage_key)
+            RETURNING id, created_at;
+    END;
+    $$ LANGUAGE plpgsql;`
+
+	// SQL-запрос для упорядочивания журнала событий по фиксации транзакций.
+	// Идентификатор события выдается триггером под той же разделяемой advisory-блокировкой, что и номера
+	// изменений заметок, а функция note_events_token берет ее монопольно, дожидаясь незафиксированных
+	// транзакций. Поэтому все события с идентификатором не больше возвращенного ею уже видны,
+	// и журнал можно читать до этой границы, не пропуская события, зафиксированные позже следующих.
+	noteEventsOrder := `ALTER TABLE note_events ALTER COLUMN id DROP DEFAULT;
+
+    CREATE OR REPLACE FUNCTION note_events_assign_id() RETURNS trigger AS $$
+    BEGIN
+        PERFORM pg_advisory_xact_lock_shared(hashtext('notes_change_seq'));
+        NEW.id := nextval('note_events_id_seq');
+        RETURN NEW;
+    END;
+    $$ LANGUAGE plpgsql;
+
+    CREATE TRIGGER note_events_assign_id BEFORE INSERT ON note_events
+        FOR EACH ROW EXECUTE FUNCTION note_events_assign_id();
+
+    CREATE OR REPLACE FUNCTION note_events_token() RETURNS BIGINT AS $$
+    DECLARE
+        token BIGINT;
+    BEGIN
+        PERFORM pg_advisory_xact_lock(hashtext('notes_change_seq'));
+        SELECT CASE WHEN is_called THEN last_value ELSE 0 END INTO token FROM note_events_id_seq;
+        RETURN token;
+    END;
+    $$ LANGUAGE plpgsql;`
+
+	// Миграции выполняются по порядку. В случае возникновения ошибки во время
+	// выполнения запроса, приложение завершится с ошибкой. Номер миграции - ее позиция в списке, начиная с 1.
+	migrations := []string{
+		userTable,
+		notesTable,
+		userEmail,
+		userTokensTable,
+		userTOTP,
+		recoveryCodesTable,
+		twoFactorChallenges,
+		userIdentitiesTable,
+		apiTokensTable,
+		noteSharesTable,
+		noteLinksTable,
+		workspacesTable,
+		notesWorkspace,
+		noteEventsTable,
+		notesSync,
+		noteAccessChanges,
+		notesFormat,
+		attachmentsTable,
+		notesTags,
+		importJobsTable,
+		jobsTable,
+		notesTrashPurge,
+		notesSpellcheck,
+		notesTriggers,
+		userSpeller,
+		userDictionaryTable,
+		noteCorrectionsAudit,
+		userAdmin,
+		attachmentsQuota,
+		noteEventsOrder,
+	}
+	if err := migrate(context.Background(), db, migrations); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// Выполнение SQL-запроса для создания таблицы заметок.
-	// В случае возникновения ошибки во время выполнения запроса, приложение завершится с ошибкой.
-	_, err = db.Exec(notesTable)
+// migrate применяет миграции, которые еще не записаны в schema_migrations. Все они выполняются
+// в одной транзакции под advisory-блокировкой: экземпляры сервиса, запущенные одновременно,
+// применяют миграции по очереди, а прерванный запуск не оставляет схему измененной наполовину.
+func migrate(ctx context.Context, db *sql.DB, migrations []string) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))"); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INT PRIMARY KEY,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    )`)
+	if err != nil {
+		return err
+	}
+	var applied int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&applied); err != nil {
+		return err
+	}
+
+	for i := applied; i < len(migrations); i++ {
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/pgtest"
+)
+
+// pg - временный сервер PostgreSQL, общий для всех тестов пакета; каждый тест получает свою базу.
+var (
+	pg    *pgtest.Server
+	pgErr error
+)
+
+func TestMain(m *testing.M) {
+	pg, pgErr = pgtest.Start()
+	code := m.Run()
+	if pg != nil {
+		pg.Stop()
+	}
+	os.Exit(code)
+}
+
+// newTestDB создает пустую базу данных для теста. Если PostgreSQL недоступен, тест пропускается.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if errors.Is(pgErr, pgtest.ErrUnavailable) {
+		t.Skipf("integration tests need PostgreSQL: %v", pgErr)
+	} else if pgErr != nil {
+		t.Fatalf("start PostgreSQL: %v", pgErr)
+	}
+	db, err := sql.Open("postgres", ConnString(pg.NewDatabase(t)))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// count возвращает результат запроса, выбирающего одно число.
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+	migrations := []string{
+		`CREATE TABLE items (id SERIAL PRIMARY KEY)`,
+		`INSERT INTO items DEFAULT VALUES`,
+	}
+
+	// Одновременный запуск нескольких экземпляров применяет каждую миграцию один раз.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = migrate(context.Background(), db, migrations)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("migrate #%d: %v", i, err)
+		}
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM items"); n != 1 {
+		t.Errorf("items = %d, want 1", n)
+	}
+
+	// Новая миграция в конце списка применяется только она.
+	migrations = append(migrations, `INSERT INTO items DEFAULT VALUES`)
+	if err := migrate(context.Background(), db, migrations); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM items"); n != 2 {
+		t.Errorf("items = %d, want 2", n)
+	}
+	if n := count(t, db, "SELECT MAX(version) FROM schema_migrations"); n != 3 {
+		t.Errorf("schema version = %d, want 3", n)
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	db := newTestDB(t)
+	migrations := []string{
+		`CREATE TABLE items (id SERIAL PRIMARY KEY)`,
+		`INSERT INTO items DEFAULT VALUES`,
+		`SELECT missing FROM items`,
+	}
+
+	// Ошибка в любой миграции откатывает все миграции этого запуска.
+	if err := migrate(context.Background(), db, migrations); err == nil {
+		t.Fatal("migrate succeeded with a broken migration")
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM pg_tables WHERE tablename IN ('items', 'schema_migrations')"); n != 0 {
+		t.Errorf("%d tables left after a failed migration, want 0", n)
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	db := newTestDB(t)
+	RunMigrations(db)
+	RunMigrations(db)
+
+	// Каждый триггер заметок объявлен один раз и срабатывает один раз.
+	var triggers []string
+	rows, err := db.Query(`SELECT tgname FROM pg_trigger
+        WHERE tgrelid = 'notes'::regclass AND NOT tgisinternal ORDER BY tgname`)
+	if err != nil {
+		t.Fatalf("list triggers: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan trigger: %v", err)
+		}
+		triggers = append(triggers, name)
+	}
+	rows.Close()
+	want := []string{"notes_events_delete", "notes_events_insert", "notes_events_update", "notes_track_change", "notes_track_update"}
+	if len(triggers) != len(want) {
+		t.Fatalf("triggers = %v, want %v", triggers, want)
+	}
+	for i := range want {
+		if triggers[i] != want[i] {
+			t.Fatalf("triggers = %v, want %v", triggers, want)
+		}
+	}
+
+	if _, err := db.Exec("INSERT INTO users (username, password) VALUES ('user', 'hash')"); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO notes (user_id, text) VALUES (1, 'text')"); err != nil {
+		t.Fatalf("insert note: %v", err)
+	}
+	if n := count(t, db, "SELECT COUNT(*) FROM note_events"); n != 1 {
+		t.Errorf("note events = %d, want 1", n)
+	}
+}
+
+func TestNoteEventsToken(t *testing.T) {
+	db := newTestDB(t)
+	RunMigrations(db)
+	if _, err := db.Exec("INSERT INTO users (username, password) VALUES ('user', 'hash')"); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	// Событие незафиксированной транзакции получает меньший идентификатор, чем событие,
+	// зафиксированное раньше нее.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT INTO notes (user_id, text) VALUES (1, 'late')"); err != nil {
+		t.Fatalf("insert note: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO notes (user_id, text) VALUES (1, 'early')"); err != nil {
+		t.Fatalf("insert note: %v", err)
+	}
+
+	// Граница журнала не выдается, пока транзакция с меньшим идентификатором не зафиксирована.
+	token := make(chan int, 1)
+	go func() {
+		var n int
+		if err := db.QueryRow("SELECT note_events_token()").Scan(&n); err != nil {
+			t.Errorf("note_events_token: %v", err)
+		}
+		token <- n
+	}()
+	select {
+	case n := <-token:
+		t.Fatalf("note_events_token() = %d before the open transaction committed", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	n := <-token
+	if visible := count(t, db, "SELECT COUNT(*) FROM note_events WHERE id <= "+strconv.Itoa(n)); visible != 2 {
+		t.Errorf("%d events up to token %d, want 2", visible, n)
+	}
+}
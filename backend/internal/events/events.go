@@ -0,0 +1,282 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+// Channel - канал PostgreSQL, в который триггер таблицы notes отправляет идентификаторы новых событий.
+const Channel = "note_events"
+
+// Типы событий.
+const (
+	TypeCreated = "created"
+	TypeUpdated = "updated"
+	TypeDeleted = "deleted"
+)
+
+const (
+	// Retention - время хранения событий. Клиент, отставший сильнее, получает событие reset
+	// и должен заново запросить список заметок.
+	Retention = 7 * 24 * time.Hour
+	// ReplayLimit - максимальное число событий, которое отдается клиенту при возобновлении.
+	ReplayLimit = 1000
+
+	// subscriberBuffer - размер очереди событий одного подписчика. Подписчик, не успевающий
+	// их читать, отключается и при переподключении получает пропущенное из журнала.
+	subscriberBuffer = 64
+	// pingInterval - период проверки соединения LISTEN.
+	pingInterval = 90 * time.Second
+	// pruneInterval - период удаления устаревших событий.
+	pruneInterval = time.Hour
+)
+
+// Event описывает изменение заметки. Текст заметки в событие не входит: клиент запрашивает его отдельно.
+type Event struct {
+	ID          int64     `json:"id"`
+	Type        string    `json:"type"`
+	NoteID      int       `json:"note_id"`
+	WorkspaceID *int      `json:"workspace_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// userIDs - пользователи, которым видна заметка.
+	userIDs []int64
+}
+
+// Subscription - подписка пользователя на события. Канал C закрывается, когда подписка
+// отменена, подписчик не успевает читать события или хаб остановлен.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	userID int
+	hub    *Hub
+}
+
+// Close отменяет подписку.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// Hub получает события изменений заметок из PostgreSQL через LISTEN/NOTIFY и рассылает
+// их подписчикам этого экземпляра сервиса. Каждая реплика слушает канал самостоятельно,
+// поэтому отдельный брокер сообщений не нужен.
+type Hub struct {
+	db      database.Database
+	connStr string
+	logger  *logger.Logger
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	lastID int64
+	closed bool
+}
+
+// NewHub создает новый экземпляр Hub. connStr используется для отдельного соединения LISTEN.
+func NewHub(db database.Database, connStr string, logger *logger.Logger) *Hub {
+	return &Hub{
+		db:      db,
+		connStr: connStr,
+		logger:  logger,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Run слушает канал событий до отмены контекста. Уведомление служит только сигналом:
+// события читаются из журнала, начиная с последнего разосланного, поэтому после
+// переподключения к базе данных пропущенные за это время события тоже будут разосланы.
+func (h *Hub) Run(ctx context.Context) error {
+	latest, err := h.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	h.lastID = latest
+
+	listener := pq.NewListener(h.connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			h.logger.Error("Event listener connection problem", "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.Close()
+			return nil
+		case <-listener.Notify:
+			// После переподключения приходит nil: дочитываем журнал так же, как при уведомлении.
+			h.dispatch(ctx)
+		case <-ping.C:
+			go listener.Ping()
+			h.dispatch(ctx)
+		case <-prune.C:
+			if _, err := h.db.Exec(ctx, "DELETE FROM note_events WHERE created_at < now() - $1 * interval '1 second'",
+				Retention.Seconds()); err != nil {
+				h.logger.Error("Failed to prune note events", "error", err)
+			}
+		}
+	}
+}
+
+// dispatch читает из журнала события после последнего разосланного до границы Latest и отправляет
+// их подписчикам. События за границей еще могут соседствовать с незафиксированными, поэтому
+// рассылаются при следующем вызове.
+func (h *Hub) dispatch(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	latest, err := h.Latest(ctx)
+	if err != nil {
+		h.logger.Error("Failed to read note events", "error", err)
+		return
+	}
+	evs, err := h.query(ctx, "id > $1 AND id <= $2 ORDER BY id", h.lastID, latest)
+	if err != nil {
+		h.logger.Error("Failed to read note events", "error", err)
+		return
+	}
+	h.publish(evs, latest)
+}
+
+// publish отправляет события подписчикам, которым видны их заметки, и запоминает границу latest,
+// до которой журнал разослан.
+func (h *Hub) publish(evs []Event, latest int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID = latest
+	for _, ev := range evs {
+		for sub := range h.subs {
+			if !ev.visibleTo(sub.userID) {
+				continue
+			}
+			select {
+			case sub.c <- ev:
+			default:
+				// Подписчик не успевает: отключаем его, он догонит по Last-Event-ID.
+				delete(h.subs, sub)
+				close(sub.c)
+			}
+		}
+	}
+}
+
+// Subscribe подписывает пользователя на события его заметок.
+func (h *Hub) Subscribe(userID int) *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe удаляет подписку и закрывает ее канал, если это еще не сделано.
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Close закрывает все подписки, чтобы открытые потоки событий завершились, например при остановке сервера.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Since возвращает события пользователя с идентификатором больше lastID и не больше latest -
+// границы, полученной от Latest.
+// Если часть событий после lastID уже удалена из журнала или их больше ReplayLimit, reset равен true:
+// клиенту нужно заново загрузить заметки, а продолжить можно с latest.
+func (h *Hub) Since(ctx context.Context, userID int, lastID, latest int64) (evs []Event, reset bool, err error) {
+	var oldest sql.NullInt64
+	if err := h.db.QueryRow(ctx, "SELECT min(id) FROM note_events").Scan(&oldest); err != nil {
+		return nil, false, err
+	}
+	if oldest.Valid && lastID < oldest.Int64-1 {
+		return nil, true, nil
+	}
+
+	evs, err = h.query(ctx, "id > $1 AND id <= $2 AND $3 = ANY(user_ids) ORDER BY id LIMIT "+strconv.Itoa(ReplayLimit+1),
+		lastID, latest, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(evs) > ReplayLimit {
+		return nil, true, nil
+	}
+	return evs, false, nil
+}
+
+// Latest возвращает границу журнала: все события с идентификатором не больше нее уже зафиксированы,
+// а события, которые будут записаны позже, получат большие идентификаторы. Граница может быть больше
+// идентификатора последнего события, например после отката транзакции.
+func (h *Hub) Latest(ctx context.Context) (int64, error) {
+	var id int64
+	err := h.db.QueryRow(ctx, "SELECT note_events_token()").Scan(&id)
+	return id, err
+}
+
+// query читает события журнала по условию filter.
+func (h *Hub) query(ctx context.Context, filter string, args ...interface{}) ([]Event, error) {
+	rows, err := h.db.Query(ctx, `SELECT id, type, note_id, workspace_id, user_ids, created_at
+        FROM note_events WHERE `+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evs []Event
+	for rows.Next() {
+		var ev Event
+		var workspaceID sql.NullInt64
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.NoteID, &workspaceID, pq.Array(&ev.userIDs), &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if workspaceID.Valid {
+			id := int(workspaceID.Int64)
+			ev.WorkspaceID = &id
+		}
+		evs = append(evs, ev)
+	}
+	return evs, rows.Err()
+}
+
+// visibleTo сообщает, видна ли заметка события пользователю.
+func (ev Event) visibleTo(userID int) bool {
+	for _, id := range ev.userIDs {
+		if id == int64(userID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"io"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+func newTestHub() *Hub {
+	return NewHub(nil, "", logger.InitLogger(io.Discard))
+}
+
+// received возвращает события, уже доставленные подписчику, и сообщает, закрыт ли его канал.
+func received(sub *Subscription) (ids []int64, closed bool) {
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, ev.ID)
+		default:
+			return ids, false
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	h := newTestHub()
+	alice, bob, carol := h.Subscribe(1), h.Subscribe(2), h.Subscribe(3)
+	alice2 := h.Subscribe(1)
+
+	h.publish([]Event{
+		{ID: 10, Type: TypeCreated, NoteID: 1, userIDs: []int64{1}},
+		{ID: 11, Type: TypeUpdated, NoteID: 2, userIDs: []int64{1, 2}},
+		{ID: 12, Type: TypeDeleted, NoteID: 3, userIDs: []int64{2}},
+		{ID: 13, Type: TypeUpdated, NoteID: 4},
+	}, 13)
+
+	tests := []struct {
+		name string
+		sub  *Subscription
+		want []int64
+	}{
+		{"alice", alice, []int64{10, 11}},
+		{"alice in another tab", alice2, []int64{10, 11}},
+		{"bob", bob, []int64{11, 12}},
+		{"carol", carol, nil},
+	}
+	for _, tt := range tests {
+		got, closed := received(tt.sub)
+		if closed || len(got) != len(tt.want) {
+			t.Errorf("%s received %v (closed %v), want %v", tt.name, got, closed, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s received %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+	if h.lastID != 13 {
+		t.Errorf("lastID = %d, want 13", h.lastID)
+	}
+
+	// Граница журнала сдвигается и без событий, например после отката транзакций.
+	h.publish(nil, 20)
+	if h.lastID != 20 {
+		t.Errorf("lastID = %d after an empty batch, want 20", h.lastID)
+	}
+}
+
+func TestPublishSlowSubscriber(t *testing.T) {
+	h := newTestHub()
+	slow, fast := h.Subscribe(1), h.Subscribe(2)
+
+	evs := make([]Event, subscriberBuffer+1)
+	for i := range evs {
+		evs[i] = Event{ID: int64(i + 1), userIDs: []int64{1}}
+	}
+	h.publish(evs, int64(len(evs)))
+
+	// Переполненная очередь не блокирует рассылку: подписчик отключается и догонит по Last-Event-ID.
+	got, closed := received(slow)
+	if len(got) != subscriberBuffer || !closed {
+		t.Errorf("slow subscriber received %d events (closed %v), want %d and closed", len(got), closed, subscriberBuffer)
+	}
+	h.publish([]Event{{ID: 100, userIDs: []int64{1, 2}}}, 100)
+	if got, closed := received(fast); len(got) != 1 || closed {
+		t.Errorf("other subscriber received %v (closed %v), want [100]", got, closed)
+	}
+	// Отмена уже отключенной подписки ничего не делает.
+	slow.Close()
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	h := newTestHub()
+	a, b := h.Subscribe(1), h.Subscribe(1)
+	a.Close()
+	a.Close()
+	if _, closed := received(a); !closed {
+		t.Error("closed subscription channel is open")
+	}
+	h.publish([]Event{{ID: 1, userIDs: []int64{1}}}, 1)
+	if got, closed := received(b); len(got) != 1 || closed {
+		t.Errorf("remaining subscriber received %v (closed %v), want [1]", got, closed)
+	}
+
+	h.Close()
+	if _, closed := received(b); !closed {
+		t.Error("subscription is open after Hub.Close")
+	}
+	if _, closed := received(h.Subscribe(1)); !closed {
+		t.Error("subscription to a closed hub is open")
+	}
+	b.Close()
+}
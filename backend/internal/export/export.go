@@ -0,0 +1,188 @@
+// Package export выгружает заметки пользователя в переносимые форматы: JSON, архив файлов
+// Markdown и архив HTML-страниц. Заметки читаются из базы данных курсором и сразу записываются
+// в выходной поток, поэтому память не зависит от числа заметок.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+// Форматы выгрузки.
+const (
+	FormatJSON        = "json"
+	FormatMarkdownZip = "markdown-zip"
+	FormatHTML        = "html"
+)
+
+// ErrUnknownFormat возвращается для неподдерживаемого формата выгрузки.
+var ErrUnknownFormat = errors.New("export: unknown format")
+
+// Note - заметка в выгрузке.
+type Note struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Format - формат текста: plain или markdown.
+	Format string   `json:"format"`
+	Tags   []string `json:"tags"`
+	// Version - номер ревизии заметки; история ревизий не хранится.
+	Version     int          `json:"version"`
+	WorkspaceID *int         `json:"workspace_id,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// Attachment - вложение заметки в выгрузке. В архивах Path - путь к файлу вложения внутри архива.
+type Attachment struct {
+	ID          int       `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+	Path        string    `json:"path,omitempty"`
+
+	key string
+}
+
+// Writer записывает заметки в выходной поток в одном из форматов.
+type Writer interface {
+	// WriteNote записывает заметку вместе с вложениями.
+	WriteNote(ctx context.Context, n *Note) error
+	// Close завершает выгрузку. Если выгрузка прервана ошибкой, Close вызывать не нужно:
+	// незавершенный файл остается некорректным, и клиент не примет его за полный.
+	Close() error
+}
+
+// NewWriter создает Writer для формата format. Содержимое вложений читается из store.
+func NewWriter(format string, w io.Writer, store blobstore.BlobStore, logger *logger.Logger) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	case FormatMarkdownZip:
+		return newZipWriter(w, store, markdownPage, logger), nil
+	case FormatHTML:
+		return newZipWriter(w, store, htmlPage, logger), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType возвращает тип содержимого и расширение файла выгрузки в формате format.
+func ContentType(format string) (contentType, ext string) {
+	if format == FormatJSON {
+		return "application/json", ".json"
+	}
+	return "application/zip", ".zip"
+}
+
+// Export выгружает все заметки пользователя userID, кроме удаленных, в порядке создания.
+func Export(ctx context.Context, db database.Database, userID int, w Writer) error {
+	rows, err := db.Query(ctx, `SELECT n.id, n.text, n.format, n.tags, n.version, n.workspace_id, n.created_at, n.updated_at,
+            COALESCE((SELECT json_agg(json_build_object(
+                'id', a.id, 'filename', a.filename, 'content_type', a.content_type, 'size', a.size,
+                'sha256', a.sha256, 'created_at', a.created_at, 'storage_key', a.storage_key) ORDER BY a.id)
+            FROM attachments a WHERE a.note_id = n.id), '[]')
+        FROM notes n WHERE n.user_id=$1 AND n.deleted_at IS NULL ORDER BY n.id`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Note
+		var attachments []byte
+		if err := rows.Scan(&n.ID, &n.Text, &n.Format, pq.Array(&n.Tags), &n.Version, &n.WorkspaceID, &n.CreatedAt, &n.UpdatedAt, &attachments); err != nil {
+			return err
+		}
+		if n.Attachments, err = decodeAttachments(attachments); err != nil {
+			return err
+		}
+		n.Title = Title(n.Text)
+		if err := w.WriteNote(ctx, &n); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// decodeAttachments разбирает вложения, собранные запросом в массив JSON.
+func decodeAttachments(data []byte) ([]Attachment, error) {
+	var raw []struct {
+		Attachment
+		CreatedAt  string `json:"created_at"`
+		StorageKey string `json:"storage_key"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("export: decode attachments: %w", err)
+	}
+	attachments := make([]Attachment, len(raw))
+	for i, r := range raw {
+		a := r.Attachment
+		// json_build_object выводит timestamp без часового пояса; время в базе хранится в UTC.
+		a.CreatedAt, _ = time.Parse("2006-01-02T15:04:05.999999", r.CreatedAt)
+		a.key = r.StorageKey
+		attachments[i] = a
+	}
+	return attachments, nil
+}
+
+// maxTitleLen - максимальная длина заголовка заметки в символах.
+const maxTitleLen = 80
+
+// Title возвращает заголовок заметки - ее первую непустую строку без разметки заголовка Markdown.
+func Title(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxTitleLen {
+			line = string([]rune(line)[:maxTitleLen]) + "…"
+		}
+		return line
+	}
+	return "Untitled"
+}
+
+// maxSlugLen - максимальная длина части имени файла, полученной из заголовка.
+const maxSlugLen = 50
+
+// slug преобразует заголовок в часть имени файла: буквы и цифры сохраняются,
+// остальные символы заменяются дефисом.
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+	n := 0
+	for _, r := range strings.ToLower(title) {
+		if n >= maxSlugLen {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		} else {
+			continue
+		}
+		n++
+	}
+	return strings.Trim(b.String(), "-")
+}
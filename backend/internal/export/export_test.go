@@ -0,0 +1,96 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitle(t *testing.T) {
+	tests := map[string]string{
+		"Список покупок\nмолоко":         "Список покупок",
+		"\n\n   \n  Первая строка  \n":   "Первая строка",
+		"# Заголовок\nтекст":             "Заголовок",
+		"### Раздел ###":                 "Раздел ###",
+		"#\n##\nтекст":                   "текст",
+		"":                               "Untitled",
+		"  \n\t\n":                       "Untitled",
+		strings.Repeat("я", 100):         strings.Repeat("я", maxTitleLen) + "…",
+		strings.Repeat("я", maxTitleLen): strings.Repeat("я", maxTitleLen),
+	}
+	for text, want := range tests {
+		if got := Title(text); got != want {
+			t.Errorf("Title(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Список покупок":              "список-покупок",
+		"Hello, World!":               "hello-world",
+		"  --Заметка №2 (черновик)--": "заметка-2-черновик",
+		"C++ & Go":                "c-go",
+		"...":                     "",
+		"":                        "",
+		"../../etc/passwd":        "etc-passwd",
+		strings.Repeat("ab ", 30): strings.TrimSuffix(strings.Repeat("ab-", 17), "-"),
+	}
+	for title, want := range tests {
+		if got := slug(title); got != want {
+			t.Errorf("slug(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestDecodeAttachments(t *testing.T) {
+	got, err := decodeAttachments([]byte(`[
+		{"id": 1, "filename": "фото.png", "content_type": "image/png", "size": 1024, "sha256": "abc",
+		 "created_at": "2024-03-15T10:30:00.123456", "storage_key": "attachments/ab/abcdef"},
+		{"id": 2, "filename": "a.txt", "content_type": "text/plain", "size": 0, "sha256": "def",
+		 "created_at": "2024-03-15T10:31:00", "storage_key": "attachments/cd/cdef01"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Attachment{
+		{ID: 1, Filename: "фото.png", ContentType: "image/png", Size: 1024, SHA256: "abc",
+			CreatedAt: time.Date(2024, 3, 15, 10, 30, 0, 123456000, time.UTC), key: "attachments/ab/abcdef"},
+		{ID: 2, Filename: "a.txt", ContentType: "text/plain", SHA256: "def",
+			CreatedAt: time.Date(2024, 3, 15, 10, 31, 0, 0, time.UTC), key: "attachments/cd/cdef01"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decodeAttachments = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+			t.Errorf("attachment %d created at %v, want %v", i, got[i].CreatedAt, want[i].CreatedAt)
+		}
+		got[i].CreatedAt = want[i].CreatedAt
+		if got[i] != want[i] {
+			t.Errorf("attachment %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got, err := decodeAttachments([]byte(`[]`)); err != nil || len(got) != 0 {
+		t.Errorf("decodeAttachments([]) = %v, %v", got, err)
+	}
+	if _, err := decodeAttachments([]byte(`{`)); err == nil {
+		t.Error("decodeAttachments with invalid JSON: want error")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		format, contentType, ext string
+	}{
+		{FormatJSON, "application/json", ".json"},
+		{FormatMarkdownZip, "application/zip", ".zip"},
+		{FormatHTML, "application/zip", ".zip"},
+	}
+	for _, tt := range tests {
+		if contentType, ext := ContentType(tt.format); contentType != tt.contentType || ext != tt.ext {
+			t.Errorf("ContentType(%q) = %q, %q; want %q, %q", tt.format, contentType, ext, tt.contentType, tt.ext)
+		}
+	}
+}
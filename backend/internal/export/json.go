@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonWriter выгружает заметки одним документом JSON {"exported_at": ..., "notes": [...]}.
+// Содержимое вложений в документ не входит, только их описание.
+type jsonWriter struct {
+	w     *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	bw := bufio.NewWriter(w)
+	return &jsonWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (j *jsonWriter) WriteNote(ctx context.Context, n *Note) error {
+	if j.count == 0 {
+		if err := j.header(); err != nil {
+			return err
+		}
+	} else if _, err := j.w.WriteString(","); err != nil {
+		return err
+	}
+	j.count++
+	return j.enc.Encode(n)
+}
+
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		if err := j.header(); err != nil {
+			return err
+		}
+	}
+	if _, err := j.w.WriteString("]}\n"); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// header записывает начало документа до массива заметок.
+func (j *jsonWriter) header() error {
+	exportedAt, _ := json.Marshal(time.Now().UTC())
+	_, err := j.w.WriteString(`{"exported_at":` + string(exportedAt) + `,"notes":[` + "\n")
+	return err
+}
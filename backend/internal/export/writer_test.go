@@ -0,0 +1,244 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+var (
+	created = time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	updated = time.Date(2024, 3, 16, 8, 0, 0, 0, time.UTC)
+)
+
+// testNotes возвращает заметки для выгрузки: с вложениями, одно из которых отсутствует в store,
+// и без них.
+func testNotes(t *testing.T) ([]*Note, blobstore.BlobStore) {
+	t.Helper()
+	store, err := blobstore.NewFSStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "attachments/ab/photo", strings.NewReader("PNG"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	workspaceID := 4
+	notes := []*Note{
+		{ID: 1, Title: "Список покупок", Text: "# Список покупок\n\n- молоко <b>", Format: "markdown", Tags: []string{"еда", `"дом"`}, Version: 3,
+			CreatedAt: created, UpdatedAt: updated, Attachments: []Attachment{
+				{ID: 10, Filename: "../фото.png", ContentType: "image/png", Size: 3, SHA256: "abc", CreatedAt: created, key: "attachments/ab/photo"},
+				{ID: 11, Filename: "lost.txt", ContentType: "text/plain", Size: 5, SHA256: "def", CreatedAt: created, key: "attachments/cd/lost"},
+			}},
+		{ID: 2, Title: "Untitled", Text: "", Format: "plain", Version: 1, WorkspaceID: &workspaceID,
+			CreatedAt: created, UpdatedAt: updated, Attachments: []Attachment{}},
+	}
+	return notes, store
+}
+
+func export(t *testing.T, format string) []byte {
+	t.Helper()
+	notes, store := testNotes(t)
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, store, logger.InitLogger(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range notes {
+		if err := w.WriteNote(context.Background(), n); err != nil {
+			t.Fatalf("WriteNote: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// readZip возвращает содержимое файлов архива по именам в порядке записи.
+func readZip(t *testing.T, data []byte) ([]string, map[string]string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	var names []string
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, f.Name)
+		files[f.Name] = string(content)
+	}
+	return names, files
+}
+
+func TestJSONWriter(t *testing.T) {
+	var doc struct {
+		ExportedAt time.Time `json:"exported_at"`
+		Notes      []Note    `json:"notes"`
+	}
+	if err := json.Unmarshal(export(t, FormatJSON), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if time.Since(doc.ExportedAt) > time.Minute || len(doc.Notes) != 2 {
+		t.Fatalf("exported at %v, %d notes", doc.ExportedAt, len(doc.Notes))
+	}
+	n := doc.Notes[0]
+	if n.ID != 1 || n.Title != "Список покупок" || n.Text != "# Список покупок\n\n- молоко <b>" || n.Version != 3 ||
+		!n.UpdatedAt.Equal(updated) || len(n.Attachments) != 2 || n.Attachments[0].Path != "" {
+		t.Errorf("first note = %+v", n)
+	}
+	if n := doc.Notes[1]; n.WorkspaceID == nil || *n.WorkspaceID != 4 || len(n.Attachments) != 0 {
+		t.Errorf("second note = %+v", n)
+	}
+
+	// Выгрузка без заметок - тоже корректный документ.
+	var buf bytes.Buffer
+	w := newJSONWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil || len(doc.Notes) != 0 {
+		t.Errorf("empty export %q: %v", buf.String(), err)
+	}
+}
+
+func TestMarkdownZip(t *testing.T) {
+	names, files := readZip(t, export(t, FormatMarkdownZip))
+	want := []string{
+		"attachments/1/10-фото.png",
+		"notes/1-список-покупок.md",
+		"notes/2-untitled.md",
+	}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("archive files %q, want %q", names, want)
+	}
+	if got := files["attachments/1/10-фото.png"]; got != "PNG" {
+		t.Errorf("attachment content = %q", got)
+	}
+
+	note := files["notes/1-список-покупок.md"]
+	for _, line := range []string{
+		`title: "Список покупок"`,
+		`tags: ["еда", "\"дом\""]`,
+		`  - filename: "../фото.png"`,
+		`    path: "../attachments/1/10-фото.png"`,
+		`  - filename: "lost.txt"`,
+		"---\n\n# Список покупок\n\n- молоко <b>\n",
+	} {
+		if !strings.Contains(note, line) {
+			t.Errorf("note file does not contain %q:\n%s", line, note)
+		}
+	}
+	// Отсутствующее вложение описывается без ссылки на файл.
+	if strings.Count(note, "path:") != 1 {
+		t.Errorf("note file links a missing attachment:\n%s", note)
+	}
+	if note := files["notes/2-untitled.md"]; !strings.Contains(note, "workspace_id: 4\n") || strings.Contains(note, "attachments:") ||
+		strings.Contains(note, "tags:") {
+		t.Errorf("second note file:\n%s", note)
+	}
+}
+
+func TestHTMLZip(t *testing.T) {
+	names, files := readZip(t, export(t, FormatHTML))
+	want := []string{
+		"attachments/1/10-фото.png",
+		"notes/1-список-покупок.html",
+		"notes/2-untitled.html",
+		"index.html",
+	}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("archive files %q, want %q", names, want)
+	}
+
+	note := files["notes/1-список-покупок.html"]
+	for _, s := range []string{
+		"<title>Список покупок</title>",
+		`<a href="../attachments/1/10-%d1%84%d0%be%d1%82%d0%be.png">../фото.png</a>`,
+		"lost.txt (missing)",
+		"Tags: еда, &#34;дом&#34;",
+		"version 3",
+	} {
+		if !strings.Contains(note, s) {
+			t.Errorf("note page does not contain %q:\n%s", s, note)
+		}
+	}
+	// Текст заметки выводится через markdown, поэтому HTML из текста экранируется.
+	if strings.Contains(note, "<b>") {
+		t.Errorf("note page contains raw HTML from the note text:\n%s", note)
+	}
+
+	index := files["index.html"]
+	for _, s := range []string{
+		`<a href="notes/1-%d1%81%d0%bf%d0%b8%d1%81%d0%be%d0%ba-%d0%bf%d0%be%d0%ba%d1%83%d0%bf%d0%be%d0%ba.html">Список покупок</a>`,
+		`<a href="notes/2-untitled.html">Untitled</a>`,
+	} {
+		if !strings.Contains(index, s) {
+			t.Errorf("index does not contain %q:\n%s", s, index)
+		}
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("pdf", io.Discard, nil, nil); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("NewWriter(pdf): err = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"photo.png":        "photo.png",
+		"../../etc/passwd": "passwd",
+		`C:\tmp\a.txt`:     "a.txt",
+		"..":               "file",
+		".":                "file",
+		"/":                "file",
+		"":                 "file",
+	}
+	for name, want := range tests {
+		if got := fileName(name); got != want {
+			t.Errorf("fileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	n := &Note{ID: 7, Title: `Цитата "в кавычках"`, Text: "текст без перевода строки", Format: "plain", Version: 2,
+		CreatedAt: created, UpdatedAt: updated.In(time.FixedZone("MSK", 3*60*60))}
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+id: 7
+title: "Цитата \"в кавычках\""
+format: plain
+version: 2
+created_at: 2024-03-15T10:30:00Z
+updated_at: 2024-03-16T08:00:00Z
+---
+
+текст без перевода строки
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeMarkdown:\n%s\nwant:\n%s", got, want)
+	}
+}
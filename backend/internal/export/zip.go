@@ -0,0 +1,215 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+// page описывает формат файлов заметок в архиве.
+type page struct {
+	// ext - расширение файла заметки.
+	ext string
+	// write записывает файл заметки; ссылки на вложения задаются относительно каталога notes.
+	write func(w io.Writer, n *Note) error
+	// index записывает оглавление архива, если формат его предусматривает.
+	index func(w io.Writer, entries []indexEntry) error
+}
+
+// indexEntry - заметка в оглавлении архива.
+type indexEntry struct {
+	Title string
+	Path  string
+}
+
+// zipWriter выгружает заметки ZIP-архивом: файлы заметок в каталоге notes, файлы вложений
+// в каталоге attachments/<id заметки>. Архив пишется в поток без промежуточных файлов.
+type zipWriter struct {
+	zw      *zip.Writer
+	store   blobstore.BlobStore
+	page    page
+	entries []indexEntry
+	logger  *logger.Logger
+}
+
+func newZipWriter(w io.Writer, store blobstore.BlobStore, p page, logger *logger.Logger) *zipWriter {
+	return &zipWriter{zw: zip.NewWriter(w), store: store, page: p, logger: logger}
+}
+
+func (z *zipWriter) WriteNote(ctx context.Context, n *Note) error {
+	for i := range n.Attachments {
+		a := &n.Attachments[i]
+		a.Path = "attachments/" + strconv.Itoa(n.ID) + "/" + strconv.Itoa(a.ID) + "-" + fileName(a.Filename)
+		if err := z.attachment(ctx, a); err != nil {
+			return err
+		}
+	}
+
+	name := "notes/" + strconv.Itoa(n.ID)
+	if s := slug(n.Title); s != "" {
+		name += "-" + s
+	}
+	name += z.page.ext
+	fw, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: n.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	if err := z.page.write(fw, n); err != nil {
+		return err
+	}
+	if z.page.index != nil {
+		z.entries = append(z.entries, indexEntry{Title: n.Title, Path: name})
+	}
+	return nil
+}
+
+// attachment копирует содержимое вложения из хранилища в архив. Вложения, содержимое которых
+// отсутствует в хранилище, пропускаются: их описание остается в файле заметки.
+func (z *zipWriter) attachment(ctx context.Context, a *Attachment) error {
+	body, err := z.store.Get(ctx, a.key)
+	if err == blobstore.ErrNotFound {
+		z.logger.Error("Attachment content is missing, skipping in export", "attachment_id", a.ID)
+		a.Path = ""
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Изображения и архивы уже сжаты, поэтому вложения сохраняются без сжатия.
+	fw, err := z.zw.CreateHeader(&zip.FileHeader{Name: a.Path, Method: zip.Store, Modified: a.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, body)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	if z.page.index != nil {
+		fw, err := z.zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if err := z.page.index(fw, z.entries); err != nil {
+			return err
+		}
+	}
+	return z.zw.Close()
+}
+
+// markdownPage - файлы Markdown с описанием заметки во front matter YAML.
+var markdownPage = page{ext: ".md", write: writeMarkdown}
+
+// writeMarkdown записывает заметку в формате Markdown. Строки во front matter записываются
+// в кавычках JSON, которые являются допустимыми строками YAML.
+func writeMarkdown(w io.Writer, n *Note) error {
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.WriteString("id: " + strconv.Itoa(n.ID) + "\n")
+	b.WriteString("title: " + quote(n.Title) + "\n")
+	b.WriteString("format: " + n.Format + "\n")
+	if len(n.Tags) > 0 {
+		tags := make([]string, len(n.Tags))
+		for i, t := range n.Tags {
+			tags[i] = quote(t)
+		}
+		b.WriteString("tags: [" + strings.Join(tags, ", ") + "]\n")
+	}
+	b.WriteString("version: " + strconv.Itoa(n.Version) + "\n")
+	if n.WorkspaceID != nil {
+		b.WriteString("workspace_id: " + strconv.Itoa(*n.WorkspaceID) + "\n")
+	}
+	b.WriteString("created_at: " + n.CreatedAt.UTC().Format(time.RFC3339) + "\n")
+	b.WriteString("updated_at: " + n.UpdatedAt.UTC().Format(time.RFC3339) + "\n")
+	if len(n.Attachments) > 0 {
+		b.WriteString("attachments:\n")
+		for _, a := range n.Attachments {
+			b.WriteString("  - filename: " + quote(a.Filename) + "\n")
+			b.WriteString("    content_type: " + quote(a.ContentType) + "\n")
+			b.WriteString("    size: " + strconv.FormatInt(a.Size, 10) + "\n")
+			b.WriteString("    sha256: " + a.SHA256 + "\n")
+			if a.Path != "" {
+				b.WriteString("    path: " + quote("../"+a.Path) + "\n")
+			}
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(n.Text)
+	if !strings.HasSuffix(n.Text, "\n") {
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// htmlPage - HTML-страницы заметок с оглавлением архива в index.html.
+var htmlPage = page{ext: ".html", write: writeHTML, index: writeIndex}
+
+var notePage = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<p><a href="../index.html">All notes</a></p>
+<article>
+{{.HTML}}
+</article>
+{{if .Attachments}}<h2>Attachments</h2>
+<ul>
+{{range .Attachments}}<li>{{if .Path}}<a href="../{{.Path}}">{{.Filename}}</a>{{else}}{{.Filename}} (missing){{end}} ({{.Size}} bytes)</li>
+{{end}}</ul>{{end}}
+{{if .Tags}}<p>Tags: {{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</p>{{end}}
+<footer><p>Created {{.CreatedAt.UTC.Format "2006-01-02 15:04"}} UTC, updated {{.UpdatedAt.UTC.Format "2006-01-02 15:04"}} UTC, version {{.Version}}</p></footer>
+</body>
+</html>
+`))
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Notes</title></head>
+<body>
+<h1>Notes</h1>
+<ul>
+{{range .}}<li><a href="{{.Path}}">{{.Title}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// writeHTML записывает заметку HTML-страницей. Текст преобразуется так же, как для render=html.
+func writeHTML(w io.Writer, n *Note) error {
+	doc := markdown.RenderFormat(n.Format, n.Text)
+	return notePage.Execute(w, struct {
+		*Note
+		HTML template.HTML
+	}{n, template.HTML(doc.TOC() + doc.HTML)})
+}
+
+func writeIndex(w io.Writer, entries []indexEntry) error {
+	return indexPage.Execute(w, entries)
+}
+
+// fileName возвращает имя файла вложения для архива. Имена очищаются при загрузке, но в архив
+// попадает только последний компонент пути, чтобы архив нельзя было распаковать за пределы каталога.
+func fileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "file"
+	}
+	return name
+}
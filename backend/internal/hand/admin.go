@@ -0,0 +1,228 @@
+package hand
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/admin"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// impersonationTTL - время жизни сессии входа от имени пользователя.
+const impersonationTTL = time.Hour
+
+// AdminHandler обрабатывает запросы административного API: поиск пользователей и модерацию
+// учетных записей. Маршруты защищаются Auth.AdminMiddleware.
+type AdminHandler struct {
+	auth   *Auth
+	admin  *admin.Service
+	logger *logger.Logger
+}
+
+// NewAdminHandler создает новый экземпляр AdminHandler.
+func NewAdminHandler(auth *Auth, service *admin.Service, logger *logger.Logger) *AdminHandler {
+	return &AdminHandler{
+		auth:   auth,
+		admin:  service,
+		logger: logger,
+	}
+}
+
+// GetUsers возвращает пользователей вместе с числом их заметок и занятым местом.
+// Параметры: q - часть имени или email, disabled=true|false, admin=true, limit (по умолчанию 50,
+// не больше 200) и offset.
+func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	query := r.URL.Query()
+	f := admin.Filter{Query: query.Get("q"), Admins: query.Get("admin") == "true"}
+	if v := query.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid disabled", http.StatusBadRequest)
+			return
+		}
+		f.Disabled = &disabled
+	}
+	for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+
+	users, err := h.admin.Users(ctx, f)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// GetUser возвращает пользователя по имени.
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.admin.User(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// DisableUser блокирует учетную запись с необязательной причиной reason. Заблокированный
+// пользователь не может войти, а его сессии и персональные токены доступа не принимаются.
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := mux.Vars(r)["username"]
+	actor := r.Header.Get("username")
+	if username == actor {
+		http.Error(w, "Cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+	if err := h.admin.Disable(ctx, actor, username, r.FormValue("reason")); err != nil {
+		adminError(w, err)
+		return
+	}
+	h.logger.Info("User disabled", "username", username, "admin", actor)
+	w.Write([]byte("User disabled"))
+}
+
+// EnableUser снимает блокировку учетной записи.
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username, actor := mux.Vars(r)["username"], r.Header.Get("username")
+	if err := h.admin.Enable(ctx, actor, username); err != nil {
+		adminError(w, err)
+		return
+	}
+	h.logger.Info("User enabled", "username", username, "admin", actor)
+	w.Write([]byte("User enabled"))
+}
+
+// ResetPassword запрещает пользователю вход по текущему паролю, отзывает его сессии
+// и отправляет ему письмо для сброса пароля, если у него есть email.
+func (h *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username, actor := mux.Vars(r)["username"], r.Header.Get("username")
+	mailed, err := h.admin.RequirePasswordReset(ctx, actor, username)
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	h.logger.Info("Password reset required", "username", username, "admin", actor, "mailed", mailed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"email_sent": mailed})
+}
+
+// RevokeSessions завершает все сессии пользователя. С параметром api_tokens=true
+// также отзываются его персональные токены доступа.
+func (h *AdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username, actor := mux.Vars(r)["username"], r.Header.Get("username")
+	if err := h.admin.RevokeSessions(ctx, actor, username, r.FormValue("api_tokens") == "true"); err != nil {
+		adminError(w, err)
+		return
+	}
+	h.logger.Info("User sessions revoked", "username", username, "admin", actor)
+	w.Write([]byte("Sessions revoked"))
+}
+
+// Impersonate выпускает сессию от имени пользователя для поддержки. Сессия действует час,
+// дает только чтение заметок (маршруты с разрешением notes:read) и передается в заголовке
+// Authorization: Bearer, не заменяя cookie администратора. Выдача записывается в журнал.
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	actor := r.Header.Get("username")
+	user, err := h.admin.User(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	// Сначала записываем выдачу в журнал: сессия без записи в журнале не выдается.
+	if err := h.admin.Log(ctx, actor, user.ID, admin.ActionImpersonate, ""); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(impersonationTTL)
+	token, err := h.auth.signToken(&Claims{
+		Username:     user.Username,
+		Impersonator: actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Username,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("Impersonation session issued", "username", user.Username, "admin", actor)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"username":   user.Username,
+		"expires_at": expiresAt.UTC(),
+	})
+}
+
+// GetActions возвращает журнал действий администраторов, от новых записей к старым.
+// Параметр username оставляет только действия над этим пользователем, limit - число записей.
+func (h *AdminHandler) GetActions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	actions, err := h.admin.Actions(ctx, r.URL.Query().Get("username"), limit)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
+
+// adminError отправляет ответ с ошибкой действия администратора.
+func adminError(w http.ResponseWriter, err error) {
+	if err == admin.ErrNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Server error", http.StatusInternalServerError)
+}
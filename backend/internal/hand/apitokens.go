@@ -0,0 +1,195 @@
+package hand
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Разрешения персональных токенов доступа.
+const (
+	ScopeNotesRead   = "notes:read"
+	ScopeNotesWrite  = "notes:write"
+	ScopeNotesDelete = "notes:delete"
+)
+
+// allScopes - все разрешения, которые можно выдать персональному токену.
+var allScopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeNotesDelete}
+
+const (
+	// apiTokenPrefix отличает персональные токены доступа от JWT и облегчает их поиск в утечках.
+	apiTokenPrefix = "nat_"
+	// apiTokenLastUsedPrecision - точность отметки последнего использования, чтобы не писать в базу на каждый запрос.
+	apiTokenLastUsedPrecision = time.Minute
+)
+
+// apiTokenPrincipal - владелец и разрешения проверенного персонального токена.
+type apiTokenPrincipal struct {
+	id       int
+	username string
+	scopes   []string
+	// disabled - учетная запись владельца токена заблокирована.
+	disabled bool
+}
+
+// CreateAPIToken создает персональный токен доступа для текущего пользователя.
+// Принимает название (name), разрешения через запятую или пробел (scopes) и необязательный
+// срок действия в днях (expires_in_days). Токен возвращается в ответе один раз.
+func (h *UserHandler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := r.Header.Get("username")
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		http.Error(w, "Name is required (up to 100 characters)", http.StatusBadRequest)
+		return
+	}
+
+	scopes := strings.FieldsFunc(r.FormValue("scopes"), func(c rune) bool { return c == ',' || c == ' ' })
+	if len(scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range scopes {
+		if !hasScope(allScopes, scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if v := r.FormValue("expires_in_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 || days > 3650 {
+			http.Error(w, "Invalid expires_in_days", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	// Токен состоит из открытого префикса, по которому его видно в списке, и секретной части.
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	prefix := apiTokenPrefix + hex.EncodeToString(idBytes)
+	token := prefix + "_" + secret
+
+	t := models.APIToken{Name: name, Prefix: prefix, Scopes: scopes, ExpiresAt: expiresAt}
+	err = h.db.QueryRow(ctx, `INSERT INTO api_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+        SELECT id, $2, $3, $4, $5, $6 FROM users WHERE username=$1
+        RETURNING id, created_at`,
+		username, name, prefix, hashToken(token), pq.Array(scopes), expiresAt).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.APIToken
+		Token string `json:"token"`
+	}{t, token})
+}
+
+// GetAPITokens возвращает действующие персональные токены текущего пользователя без их секретной части.
+func (h *UserHandler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `SELECT t.id, t.name, t.prefix, t.scopes, t.expires_at, t.last_used_at, t.created_at
+        FROM api_tokens t JOIN users u ON u.id = t.user_id
+        WHERE u.username=$1 AND t.revoked_at IS NULL
+        ORDER BY t.created_at`, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		var t models.APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RevokeAPIToken отзывает персональный токен текущего пользователя.
+func (h *UserHandler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.db.Exec(ctx, `UPDATE api_tokens SET revoked_at=now()
+        WHERE id=$1 AND revoked_at IS NULL AND user_id=(SELECT id FROM users WHERE username=$2)`,
+		mux.Vars(r)["id"], r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Token revoked successfully"))
+}
+
+// lookupAPIToken проверяет персональный токен и возвращает его владельца и разрешения.
+// Заодно обновляет отметку последнего использования токена.
+func (a *Auth) lookupAPIToken(ctx context.Context, token string) (*apiTokenPrincipal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	p := &apiTokenPrincipal{}
+	err := a.db.QueryRow(ctx, `SELECT t.id, u.username, t.scopes, u.disabled_at IS NOT NULL
+        FROM api_tokens t JOIN users u ON u.id = t.user_id
+        WHERE t.token_hash=$1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > now())`,
+		hashToken(token)).Scan(&p.id, &p.username, pq.Array(&p.scopes), &p.disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = a.db.Exec(ctx, `UPDATE api_tokens SET last_used_at=now()
+        WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < now() - $2 * interval '1 second')`,
+		p.id, apiTokenLastUsedPrecision.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// hasScope сообщает, содержится ли разрешение в списке.
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package hand
+
+import "testing"
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{ScopeNotesRead}, ScopeNotesRead, true},
+		{[]string{ScopeNotesRead, ScopeNotesWrite}, ScopeNotesWrite, true},
+		{[]string{ScopeNotesRead}, ScopeNotesWrite, false},
+		{[]string{ScopeNotesWrite}, ScopeNotesDelete, false},
+		{nil, ScopeNotesRead, false},
+		{[]string{"notes:*"}, ScopeNotesRead, false},
+	}
+	for _, tt := range tests {
+		if got := hasScope(tt.scopes, tt.scope); got != tt.want {
+			t.Errorf("hasScope(%q, %q) = %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package hand
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// attachmentTransferTimeout - время на передачу содержимого вложения в хранилище и из него.
+	attachmentTransferTimeout = 10 * time.Minute
+	// multipartOverhead - запас на заголовки и границы частей multipart сверх размера файла.
+	multipartOverhead = 64 << 10
+	// maxFilenameLen - максимальная длина имени файла вложения в символах.
+	maxFilenameLen = 255
+)
+
+// inlineContentTypes - типы вложений, которые браузер может показать на странице.
+// Остальные вложения отдаются только для скачивания.
+var inlineContentTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"text/plain; charset=utf-8": true,
+}
+
+// AttachmentHandler обрабатывает запросы, связанные с вложениями заметок: загрузку, скачивание,
+// получение списка и удаление. Содержимое файлов хранится в BlobStore, метаданные - в таблице attachments.
+type AttachmentHandler struct {
+	db      database.Database
+	authz   *authz.Authorizer
+	store   blobstore.BlobStore
+	maxSize int64
+	quota   int64
+	logger  *logger.Logger
+}
+
+// NewAttachmentHandler создает новый экземпляр AttachmentHandler. Ограничения размера
+// вложения и квоты пользователя берутся из конфигурации хранилища.
+func NewAttachmentHandler(db database.Database, store blobstore.BlobStore, cfg config.StorageConfig, logger *logger.Logger) *AttachmentHandler {
+	return &AttachmentHandler{
+		db:      db,
+		authz:   authz.New(db),
+		store:   store,
+		maxSize: cfg.MaxFileSize,
+		quota:   cfg.UserQuota,
+		logger:  logger,
+	}
+}
+
+// UploadAttachment обрабатывает загрузку вложения в заметку запросом multipart/form-data
+// с файлом в поле file. Загружать вложения могут пользователи с правом изменения заметки.
+// Тип содержимого определяется по самому файлу, а не по заголовкам клиента.
+// Размер вложения учитывается в квоте загрузившего его пользователя.
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := noteRequest(ctx, h.db, w, r)
+	if !ok {
+		return
+	}
+	if _, ok := noteAccess(ctx, h.authz, w, userID, noteID, authz.Access.CanWrite); !ok {
+		return
+	}
+	// Чтение файла может занять больше таймаута запросов к базе данных: для следующих запросов
+	// контекст создается после того, как файл получен целиком.
+	cancel()
+
+	// Получение большого файла от медленного клиента дольше таймаутов сервера.
+	extendTransferDeadlines(w)
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxSize+multipartOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected multipart/form-data request", http.StatusBadRequest)
+		return
+	}
+	var part io.Reader
+	var filename string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if tooLarge(err) {
+				http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(w, "Missing file field", http.StatusBadRequest)
+			}
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, cleanFilename(p.FileName())
+			break
+		}
+	}
+
+	// Файл сохраняется во временный файл: размер и хэш нужны до передачи в хранилище.
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		h.logger.Error("Failed to create temporary file", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, h.maxSize+1))
+	if err != nil {
+		if tooLarge(err) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Error reading file", http.StatusBadRequest)
+		}
+		return
+	}
+	if size > h.maxSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Проверка квоты до загрузки в хранилище; окончательно она проверяется при сохранении метаданных.
+	var used int64
+	err = h.db.QueryRow(ctx, "SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id=$1", userID).Scan(&used)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if used+size > h.quota {
+		http.Error(w, "Storage quota exceeded", http.StatusInsufficientStorage)
+		return
+	}
+
+	key, err := newStorageKey("attachments")
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	// Ключ регистрируется как ненужный до загрузки: если запрос прервется, объект удалит Sweeper.
+	if _, err := h.db.Exec(ctx, "INSERT INTO orphaned_blobs (storage_key) VALUES ($1)", key); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	cancel()
+
+	putCtx, cancelPut := context.WithTimeout(r.Context(), attachmentTransferTimeout)
+	defer cancelPut()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.Put(putCtx, key, tmp, size, contentType); err != nil {
+		h.logger.Error("Failed to store attachment", "error", err)
+		http.Error(w, "Error storing file", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	a := models.Attachment{
+		NoteID:      noteID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		UploadedBy:  r.Header.Get("username"),
+	}
+	// Ключ убирается из orphaned_blobs в той же транзакции, что и сохраняются метаданные, и только если
+	// вложение помещается в квоту; иначе загруженный объект остается ненужным и будет удален.
+	// Функция attachments_claim сериализует загрузки пользователя, поэтому квота соблюдается
+	// и при параллельных загрузках.
+	err = h.db.QueryRow(ctx, "SELECT attachment_id, attachment_created_at FROM attachments_claim($1, $2, $3, $4, $5, $6, $7, $8)",
+		noteID, userID, a.Filename, a.ContentType, a.Size, a.SHA256, key, h.quota).Scan(&a.ID, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Storage quota exceeded", http.StatusInsufficientStorage)
+		return
+	} else if err != nil {
+		h.logger.Error("Failed to save attachment", "error", err)
+		http.Error(w, "Error saving attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// GetAttachments возвращает список вложений заметки. Доступен всем, кто может читать заметку.
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := noteRequest(ctx, h.db, w, r)
+	if !ok {
+		return
+	}
+	if _, ok := noteAccess(ctx, h.authz, w, userID, noteID, authz.Access.CanRead); !ok {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT a.id, a.note_id, a.filename, a.content_type, a.size, a.sha256, u.username, a.created_at
+        FROM attachments a JOIN users u ON u.id = a.user_id
+        WHERE a.note_id=$1 ORDER BY a.id`, noteID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.NoteID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.UploadedBy, &a.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment отдает содержимое вложения. Изображения и обычный текст показываются
+// в браузере, остальные файлы отдаются для скачивания. Содержимое вложений не может выполнять
+// сценарии в контексте сервиса: браузеру запрещено угадывать тип, а страница изолирована политикой sandbox.
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := noteRequest(ctx, h.db, w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachmentID"])
+	if err != nil {
+		http.Error(w, "Invalid attachment id", http.StatusBadRequest)
+		return
+	}
+	if _, ok := noteAccess(ctx, h.authz, w, userID, noteID, authz.Access.CanRead); !ok {
+		return
+	}
+
+	var a models.Attachment
+	var key string
+	err = h.db.QueryRow(ctx, `SELECT filename, content_type, size, sha256, storage_key
+        FROM attachments WHERE id=$1 AND note_id=$2`, attachmentID, noteID).
+		Scan(&a.Filename, &a.ContentType, &a.Size, &a.SHA256, &key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	cancel()
+
+	etag := `"` + a.SHA256 + `"`
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	getCtx, cancelGet := context.WithTimeout(r.Context(), attachmentTransferTimeout)
+	defer cancelGet()
+	body, err := h.store.Get(getCtx, key)
+	if err == blobstore.ErrNotFound {
+		h.logger.Error("Attachment content is missing", "attachment_id", attachmentID)
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.logger.Error("Failed to read attachment", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if inlineContentTypes[a.ContentType] {
+		disposition = "inline"
+	}
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}); v != "" {
+		disposition = v
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	// Передача большого файла медленному клиенту дольше таймаута записи сервера: ее ограничивает
+	// собственный срок, как и чтение из хранилища.
+	extendTransferDeadlines(w)
+	if _, err := io.Copy(w, body); err != nil {
+		h.logger.Error("Failed to send attachment", "error", err)
+	}
+}
+
+// DeleteAttachment удаляет вложение заметки. Удалять вложения могут пользователи с правом
+// изменения заметки. Содержимое удаляется из хранилища сразу, а при ошибке - фоновой очисткой.
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := noteRequest(ctx, h.db, w, r)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachmentID"])
+	if err != nil {
+		http.Error(w, "Invalid attachment id", http.StatusBadRequest)
+		return
+	}
+	if _, ok := noteAccess(ctx, h.authz, w, userID, noteID, authz.Access.CanWrite); !ok {
+		return
+	}
+
+	// Триггер таблицы attachments добавляет ключ объекта в orphaned_blobs.
+	var key string
+	err = h.db.QueryRow(ctx, "DELETE FROM attachments WHERE id=$1 AND note_id=$2 RETURNING storage_key",
+		attachmentID, noteID).Scan(&key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error deleting attachment", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.Delete(ctx, key); err != nil {
+		h.logger.Error("Failed to delete attachment content", "error", err)
+	} else if _, err := h.db.Exec(ctx, "DELETE FROM orphaned_blobs WHERE storage_key=$1", key); err != nil {
+		h.logger.Error("Failed to clear orphaned blob", "error", err)
+	}
+
+	w.Write([]byte("Attachment deleted successfully"))
+}
+
+// GetStorageUsage возвращает суммарный размер вложений, загруженных текущим пользователем,
+// его квоту и максимальный размер одного вложения.
+func (h *AttachmentHandler) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var used int64
+	err := h.db.QueryRow(ctx, `SELECT COALESCE(SUM(a.size), 0) FROM users u
+        LEFT JOIN attachments a ON a.user_id = u.id WHERE u.username=$1 GROUP BY u.id`,
+		r.Header.Get("username")).Scan(&used)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		"used":          used,
+		"quota":         h.quota,
+		"max_file_size": h.maxSize,
+	})
+}
+
+// newStorageKey создает случайный ключ объекта в каталоге prefix. Ключи распределяются по подкаталогам
+// по первым символам, чтобы в одном каталоге файлового хранилища не копились все файлы.
+func newStorageKey(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	return prefix + "/" + id[:2] + "/" + id, nil
+}
+
+// cleanFilename оставляет от имени файла клиента только последний компонент пути
+// без управляющих символов и ограничивает его длину.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+	if utf8.RuneCountInString(name) > maxFilenameLen {
+		name = string([]rune(name)[:maxFilenameLen])
+	}
+	return name
+}
+
+// tooLarge сообщает, что тело запроса превысило ограничение http.MaxBytesReader.
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// extendTransferDeadlines заменяет таймауты чтения запроса и записи ответа сервера сроком
+// attachmentTransferTimeout, за который должен быть передан файл вложения или импорта.
+func extendTransferDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(attachmentTransferTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
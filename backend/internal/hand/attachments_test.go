@@ -0,0 +1,108 @@
+package hand
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanFilename(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":               "report.pdf",
+		"  отчет 2024.docx  ":      "отчет 2024.docx",
+		"../../etc/passwd":         "passwd",
+		`C:\Users\alice\photo.png`: "photo.png",
+		"dir/":                     "dir",
+		"a\x00b\nc\x7f.txt":        "abc.txt",
+		"bad\xffname":              "badname",
+		"":                         "file",
+		".":                        "file",
+		"..":                       "file",
+		"/":                        "file",
+		"\x01\x02":                 "file",
+		strings.Repeat("я", 300):   strings.Repeat("я", maxFilenameLen),
+	}
+	for name, want := range tests {
+		if got := cleanFilename(name); got != want {
+			t.Errorf("cleanFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewStorageKey(t *testing.T) {
+	re := regexp.MustCompile(`^attachments/([0-9a-f]{2})/([0-9a-f]{32})$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		key, err := newStorageKey("attachments")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := re.FindStringSubmatch(key)
+		if m == nil || !strings.HasPrefix(m[2], m[1]) {
+			t.Fatalf("newStorageKey = %q, want attachments/<first two hex digits>/<32 hex digits>", key)
+		}
+		if seen[key] {
+			t.Fatalf("newStorageKey returned %q twice", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789"))
+	_, err := io.ReadAll(http.MaxBytesReader(httptest.NewRecorder(), r.Body, 5))
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"body over the limit", err, true},
+		{"wrapped", errors.Join(errors.New("multipart"), err), true},
+		{"other error", io.ErrUnexpectedEOF, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := tooLarge(tt.err); got != tt.want {
+			t.Errorf("%s: tooLarge(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExtendTransferDeadlines(t *testing.T) {
+	// Тело запроса передается дольше таймаута чтения сервера.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extendTransferDeadlines(w)
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(data)
+	}))
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("первая часть, "))
+		time.Sleep(300 * time.Millisecond)
+		pw.Write([]byte("вторая часть"))
+		pw.Close()
+	}()
+	resp, err := srv.Client().Post(srv.URL, "application/octet-stream", pr)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "первая часть, вторая часть" {
+		t.Errorf("got %d %q, want the whole body echoed", resp.StatusCode, body)
+	}
+}
@@ -3,53 +3,83 @@ package hand
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
-	"os"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
 	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/mailer"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Ключ для подписывания JWT токенов, загружается из переменных окружения.
-var jwtKey = []byte(os.Getenv("JWT_KEY"))
+// errInvalidEmail возвращается, если адрес электронной почты имеет неверный формат.
+var errInvalidEmail = errors.New("invalid email")
 
 // Claims определяет структуру полезной нагрузки JWT токена.
 type Claims struct {
-	Username             string `json:"username"` // Имя пользователя, для которого выдан токен.
+	Username             string `json:"username"`          // Имя пользователя, для которого выдан токен.
+	Purpose              string `json:"purpose,omitempty"` // Назначение служебного токена; у сессионных токенов пустое.
+	Impersonator         string `json:"imp,omitempty"`     // Администратор, вошедший от имени пользователя только для чтения.
 	jwt.RegisteredClaims        // Стандартные зарегистрированные поля JWT.
 }
 
+// registered возвращает стандартные поля токена для заполнения при подписи и проверки после разбора.
+func (c *Claims) registered() *jwt.RegisteredClaims {
+	return &c.RegisteredClaims
+}
+
 // UserHandler содержит логику для обработки запросов, связанных с пользователями.
 type UserHandler struct {
-	db     database.Database // Интерфейс для работы с базой данных.
-	logger *logger.Logger    // Логгер для записи сообщений и ошибок.
+	db      database.Database // Интерфейс для работы с базой данных.
+	auth    *Auth             // Выпуск и проверка JWT токенов.
+	mailer  mailer.Mailer     // Отправка писем (сброс пароля, подтверждение email).
+	queue   *jobs.Queue       // Очередь фоновых заданий, через которую отправляются письма.
+	baseURL string            // Публичный адрес сервиса для ссылок в письмах.
+	logger  *logger.Logger    // Логгер для записи сообщений и ошибок.
 }
 
-// NewUserHandler создает новый экземпляр UserHandler с заданными зависимостями.
-func NewUserHandler(db database.Database, logger *logger.Logger) *UserHandler {
-	return &UserHandler{
-		db:     db,
-		logger: logger,
+// NewUserHandler создает новый экземпляр UserHandler с заданными зависимостями
+// и регистрирует в очереди обработчики заданий отправки писем.
+func NewUserHandler(db database.Database, auth *Auth, mailer mailer.Mailer, queue *jobs.Queue, baseURL string, logger *logger.Logger) *UserHandler {
+	h := &UserHandler{
+		db:      db,
+		auth:    auth,
+		mailer:  mailer,
+		queue:   queue,
+		baseURL: baseURL,
+		logger:  logger,
 	}
+	jobs.Handle(queue, passwordResetTask, h.sendPasswordReset)
+	jobs.Handle(queue, verificationTask, h.sendVerification)
+	return h
 }
 
 // Register обрабатывает запросы на регистрацию нового пользователя.
 // Хэширует пароль и сохраняет данные пользователя в базе данных.
+// Если указан email, пользователю отправляется письмо для его подтверждения.
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Создание контекста с таймаутом для запроса к базе данных.
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Извлечение имени пользователя и пароля из формы запроса.
+	// Извлечение имени пользователя, пароля и необязательного email из формы запроса.
 	username := r.FormValue("username")
 	password := r.FormValue("password")
+	email, err := normalizeEmail(r.FormValue("email"))
+	if err != nil {
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return
+	}
 
 	// Хэширование пароля с использованием bcrypt перед сохранением в базе данных.
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	var hashedPassword []byte
+	hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		// Возвращение ошибки, если хэширование не удалось.
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
@@ -58,20 +88,30 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	// Вставка нового пользователя в базу данных и получение его ID.
 	var userID int
-	err = h.db.QueryRow(ctx, "INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id",
-		username, string(hashedPassword)).Scan(&userID)
+	err = h.db.QueryRow(ctx, "INSERT INTO users (username, password, email) VALUES ($1, $2, NULLIF($3, '')) RETURNING id",
+		username, string(hashedPassword), email).Scan(&userID)
 	if err != nil {
 		// Возвращение ошибки, если вставка в базу данных не удалась.
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
+	// Отправка письма для подтверждения email, если он был указан. Пользователь уже создан,
+	// поэтому при ошибке письмо можно запросить повторно.
+	if email != "" {
+		if err := h.enqueueVerification(ctx, userID, email); err != nil {
+			h.logger.Error("Failed to enqueue verification email", "user_id", userID, "error", err)
+		}
+	}
+
 	// Отправка успешного ответа клиенту.
 	w.Write([]byte("User registered successfully"))
 }
 
 // Login обрабатывает запросы на авторизацию пользователя.
 // Проверяет учетные данные и возвращает JWT токен в cookie при успешной авторизации.
+// Если у пользователя включена двухфакторная аутентификация, вместо сессии возвращается
+// кратковременный challenge-токен, который нужно обменять на сессию вместе с TOTP-кодом в LoginTwoFactor.
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Создание контекста с таймаутом для запроса к базе данных.
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -84,29 +124,68 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Получение хэшированного пароля и ID пользователя из базы данных.
 	var storedPassword string
 	var userID int
-	err := h.db.QueryRow(ctx, "SELECT id, password FROM users WHERE username=$1", username).Scan(&userID, &storedPassword)
+	var totpEnabled, disabled, resetRequired bool
+	err := h.db.QueryRow(ctx, `SELECT id, password, totp_enabled, disabled_at IS NOT NULL, password_reset_required
+        FROM users WHERE username=$1`, username).
+		Scan(&userID, &storedPassword, &totpEnabled, &disabled, &resetRequired)
 	if err == sql.ErrNoRows || bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password)) != nil {
 		// Возвращение ошибки авторизации, если пользователь не найден или пароль неверный.
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	// Состояние учетной записи сообщаем только тому, кто знает пароль. Проверка нужна до выдачи
+	// challenge-токена, чтобы заблокированный пользователь не вводил второй фактор напрасно.
+	if status, msg := loginError(disabled, resetRequired); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// При включенной двухфакторной аутентификации выдаем challenge-токен вместо сессии.
+	if totpEnabled {
+		h.issueTwoFactorChallenge(ctx, w, userID, username)
+		return
+	}
+
+	if status, msg := h.auth.issueSession(ctx, w, username); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Отправка успешного ответа клиенту с установкой статуса 200 OK.
+	w.WriteHeader(http.StatusOK)
+}
+
+// issueSession выпускает сессионный JWT токен для пользователя и устанавливает его в cookie.
+// Это единственный способ завершить вход, независимо от того, как пользователь был аутентифицирован,
+// поэтому здесь же проверяется, что вход в учетную запись разрешен.
+// Возвращает код и текст ответа с ошибкой или 0, если сессия выдана.
+func (a *Auth) issueSession(ctx context.Context, w http.ResponseWriter, username string) (int, string) {
+	var disabled, resetRequired bool
+	err := a.db.QueryRow(ctx, "SELECT disabled_at IS NOT NULL, password_reset_required FROM users WHERE username=$1",
+		username).Scan(&disabled, &resetRequired)
+	if err == sql.ErrNoRows {
+		return http.StatusUnauthorized, "Invalid credentials"
+	} else if err != nil {
+		return http.StatusInternalServerError, "Server error"
+	}
+	if status, msg := loginError(disabled, resetRequired); status != 0 {
+		return status, msg
+	}
+
 	// Установка времени истечения токена на 24 часа от текущего времени.
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	// Создание нового JWT токена с использованием алгоритма HMAC-SHA256.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := a.signToken(claims)
 	if err != nil {
-		// Возвращение ошибки генерации токена, если что-то пошло не так.
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
-		return
+		return http.StatusInternalServerError, "Error generating token"
 	}
 
 	// Установка JWT токена в cookie, который будет использоваться для аутентификации пользователя.
@@ -115,7 +194,31 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Value:   tokenString,
 		Expires: expirationTime,
 	})
+	return 0, ""
+}
 
-	// Отправка успешного ответа клиенту с установкой статуса 200 OK.
-	w.WriteHeader(http.StatusOK)
+// loginError возвращает код и текст ответа, если вход в учетную запись запрещен администратором,
+// или 0, если вход разрешен.
+func loginError(disabled, resetRequired bool) (int, string) {
+	if disabled {
+		return http.StatusForbidden, "Account is disabled"
+	}
+	if resetRequired {
+		return http.StatusForbidden, "Password reset required"
+	}
+	return 0, ""
+}
+
+// normalizeEmail проверяет адрес электронной почты и приводит его к нижнему регистру.
+// Пустая строка считается допустимой и означает отсутствие адреса.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
 }
@@ -0,0 +1,52 @@
+package hand
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"", "", nil},
+		{"   ", "", nil},
+		{"alice@example.com", "alice@example.com", nil},
+		{"  Alice@Example.COM ", "alice@example.com", nil},
+		{"alice+notes@mail.example.org", "alice+notes@mail.example.org", nil},
+		{"alice", "", errInvalidEmail},
+		{"alice@", "", errInvalidEmail},
+		{"@example.com", "", errInvalidEmail},
+		{"Alice <alice@example.com>", "", errInvalidEmail},
+		{"alice@example.com, bob@example.com", "", errInvalidEmail},
+		{"alice@example.com\r\nBcc: bob@example.com", "", errInvalidEmail},
+	}
+	for _, tt := range tests {
+		got, err := normalizeEmail(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("normalizeEmail(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLoginError(t *testing.T) {
+	tests := []struct {
+		disabled, resetRequired bool
+		status                  int
+		msg                     string
+	}{
+		{false, false, 0, ""},
+		{true, false, http.StatusForbidden, "Account is disabled"},
+		{false, true, http.StatusForbidden, "Password reset required"},
+		{true, true, http.StatusForbidden, "Account is disabled"},
+	}
+	for _, tt := range tests {
+		status, msg := loginError(tt.disabled, tt.resetRequired)
+		if status != tt.status || msg != tt.msg {
+			t.Errorf("loginError(%v, %v) = %d, %q; want %d, %q", tt.disabled, tt.resetRequired, status, msg, tt.status, tt.msg)
+		}
+	}
+}
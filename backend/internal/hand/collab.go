@@ -0,0 +1,170 @@
+package hand
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/collab"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/ws"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// collabMaxMessage - максимальный размер сообщения клиента совместного редактирования.
+	collabMaxMessage = 1 << 20
+	// collabPingInterval - период отправки ping, по ответам на который определяется обрыв соединения.
+	collabPingInterval = 30 * time.Second
+	// collabReadTimeout - время, после которого молчащий клиент считается отключенным.
+	collabReadTimeout = 2 * collabPingInterval
+)
+
+// CollabHandler обслуживает совместное редактирование заметок через WebSocket.
+type CollabHandler struct {
+	db       database.Database
+	authz    *authz.Authorizer
+	manager  *collab.Manager
+	upgrader ws.Upgrader
+	logger   *logger.Logger
+}
+
+// NewCollabHandler создает новый экземпляр CollabHandler. Подключения принимаются со страниц
+// того же хоста, что и запрос, или внешнего адреса сервиса baseURL.
+func NewCollabHandler(db database.Database, manager *collab.Manager, baseURL string, logger *logger.Logger) *CollabHandler {
+	var allowedHost string
+	if u, err := url.Parse(baseURL); err == nil {
+		allowedHost = u.Host
+	}
+	return &CollabHandler{
+		db:      db,
+		authz:   authz.New(db),
+		manager: manager,
+		upgrader: ws.Upgrader{
+			MaxMessageSize: collabMaxMessage,
+			ReadTimeout:    collabReadTimeout,
+			CheckOrigin: func(r *http.Request) bool {
+				if ws.SameOrigin(r) {
+					return true
+				}
+				u, err := url.Parse(r.Header.Get("Origin"))
+				return err == nil && allowedHost != "" && strings.EqualFold(u.Host, allowedHost)
+			},
+		},
+		logger: logger,
+	}
+}
+
+// Collab подключает пользователя к совместному редактированию заметки. Для подключения
+// достаточно доступа на чтение: такой участник видит изменения и курсоры других, но не может
+// менять текст. Менять текст нельзя и при входе от имени пользователя или с персональным токеном
+// без разрешения notes:write. Изменения участников объединяются на сервере и периодически
+// сохраняются в заметку, а перед каждым сохранением доступ участников проверяется заново.
+func (h *CollabHandler) Collab(w http.ResponseWriter, r *http.Request) {
+	noteID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note id", http.StatusBadRequest)
+		return
+	}
+	username := r.Header.Get("username")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	var userID int
+	if err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", username).Scan(&userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	access, err := h.authz.NoteAccess(ctx, userID, noteID)
+	if err == authz.ErrNotFound || (err == nil && access == authz.AccessNone) {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	cancel()
+
+	conn, err := h.upgrader.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	creds := RequestCredentials(r)
+	recheck := func(ctx context.Context) (bool, error) {
+		if err := creds.Check(ctx); err == ErrCredentialsRevoked {
+			return false, collab.ErrAccessDenied
+		} else if err != nil {
+			return false, err
+		}
+		access, err := h.authz.NoteAccess(ctx, userID, noteID)
+		if err == authz.ErrNotFound || (err == nil && access == authz.AccessNone) {
+			return false, collab.ErrAccessDenied
+		} else if err != nil {
+			return false, err
+		}
+		return access.CanWrite() && creds.CanWrite, nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	client, err := h.manager.Join(ctx, noteID, username, access.CanWrite() && creds.CanWrite, recheck)
+	cancel()
+	if err == collab.ErrNotFound {
+		conn.Close(ws.ClosePolicyViolation, "note not found")
+		return
+	} else if err != nil {
+		h.logger.Error("Failed to join collaborative session", "error", err)
+		conn.Close(ws.CloseInternalError, "")
+		return
+	}
+
+	go h.writeLoop(conn, client)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			client.Leave()
+			conn.Close(ws.CloseNormal, "")
+			return
+		}
+		client.Handle(data)
+	}
+}
+
+// writeLoop отправляет клиенту сообщения сеанса и ping. Когда сервер отключает участника,
+// оставшиеся в очереди сообщения (например, причина отключения) отправляются до закрытия соединения.
+func (h *CollabHandler) writeLoop(conn *ws.Conn, client *collab.Client) {
+	ping := time.NewTicker(collabPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case data := <-client.Send():
+			if err := conn.WriteMessage(ws.TextMessage, data); err != nil {
+				client.Leave()
+				conn.Close(ws.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteMessage(ws.PingMessage, nil); err != nil {
+				client.Leave()
+				conn.Close(ws.CloseGoingAway, "")
+				return
+			}
+		case <-client.Done():
+			for {
+				select {
+				case data := <-client.Send():
+					conn.WriteMessage(ws.TextMessage, data)
+				default:
+					conn.Close(ws.CloseGoingAway, "")
+					return
+				}
+			}
+		}
+	}
+}
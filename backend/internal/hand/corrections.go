@@ -0,0 +1,240 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultStatsLimit и maxStatsLimit - число самых частых исправлений в статистике по умолчанию и наибольшее.
+	defaultStatsLimit = 20
+	maxStatsLimit     = 100
+)
+
+// GetCorrections возвращает исправления орфографии, внесенные в заметку, от новых к старым.
+// Доступно всем, кто может читать заметку.
+func (h *NoteHandler) GetCorrections(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanRead) {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT id, version, position, word, replacement, code, created_at, reverted_at, reverted_version
+        FROM note_corrections WHERE note_id=$1 ORDER BY id DESC`, noteID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	corrections := []models.NoteCorrection{}
+	for rows.Next() {
+		var c models.NoteCorrection
+		if err := rows.Scan(&c.ID, &c.Version, &c.Position, &c.Word, &c.Replacement, &c.Code,
+			&c.CreatedAt, &c.RevertedAt, &c.RevertedVersion); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		corrections = append(corrections, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corrections)
+}
+
+// RevertCorrection отменяет исправление орфографии: исправленное слово в текущем тексте заметки
+// заменяется исходным. Если заметку меняли после исправления, слово ищется на прежней позиции,
+// а если там его нет - по всему тексту; когда найти его однозначно нельзя, отвечает 409.
+// Отмена - обычное изменение заметки: она создает новую версию. Доступно пользователям с правом изменения.
+func (h *NoteHandler) RevertCorrection(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	correctionID, err := strconv.Atoi(mux.Vars(r)["correctionID"])
+	if err != nil {
+		http.Error(w, "Invalid correction id", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanWrite) {
+		return
+	}
+
+	var c models.NoteCorrection
+	err = h.db.QueryRow(ctx, `SELECT id, version, position, word, replacement, code, created_at, reverted_at
+        FROM note_corrections WHERE id=$1 AND note_id=$2`, correctionID, noteID).
+		Scan(&c.ID, &c.Version, &c.Position, &c.Word, &c.Replacement, &c.Code, &c.CreatedAt, &c.RevertedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Correction not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if c.RevertedAt != nil {
+		http.Error(w, "Correction already reverted", http.StatusConflict)
+		return
+	}
+
+	var text string
+	var version int
+	err = h.db.QueryRow(ctx, "SELECT text, version FROM notes WHERE id=$1 AND deleted_at IS NULL", noteID).Scan(&text, &version)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	src, replacement := []rune(text), []rune(c.Replacement)
+	pos := findCorrection(src, replacement, c.Position)
+	if pos < 0 {
+		http.Error(w, "Corrected word not found in the current text", http.StatusConflict)
+		return
+	}
+	reverted := string(src[:pos]) + c.Word + string(src[pos+len(replacement):])
+
+	// Текст меняется только поверх прочитанной версии и только если исправление еще не отменено.
+	err = h.db.QueryRow(ctx, `WITH note AS (
+            UPDATE notes SET text=$3
+            WHERE id=$1 AND version=$2 AND deleted_at IS NULL
+                AND EXISTS (SELECT 1 FROM note_corrections WHERE id=$4 AND reverted_at IS NULL)
+            RETURNING version)
+        UPDATE note_corrections SET reverted_at=now(), reverted_version=(SELECT version FROM note)
+        WHERE id=$4 AND EXISTS (SELECT 1 FROM note)
+        RETURNING reverted_at, reverted_version`, noteID, version, reverted, c.ID).Scan(&c.RevertedAt, &c.RevertedVersion)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Note has been changed", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating note", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// findCorrection возвращает позицию исправленного слова word в тексте: pos, если слово стоит там,
+// иначе позицию единственного вхождения слова целиком; -1, если слова нет или вхождений несколько.
+func findCorrection(text, word []rune, pos int) int {
+	at := func(p int) bool {
+		return p >= 0 && p+len(word) <= len(text) && slices.Equal(text[p:p+len(word)], word) &&
+			(p == 0 || !isWordRune(text[p-1])) && (p+len(word) == len(text) || !isWordRune(text[p+len(word)]))
+	}
+	if len(word) == 0 {
+		return -1
+	}
+	if at(pos) {
+		return pos
+	}
+	found := -1
+	for p := 0; p+len(word) <= len(text); p++ {
+		if at(p) {
+			if found >= 0 {
+				return -1
+			}
+			found = p
+		}
+	}
+	return found
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '\''
+}
+
+// GetCorrectionStats возвращает статистику исправлений орфографии в заметках текущего пользователя:
+// общее число исправлений и отмен, число по кодам ошибок и самые частые исправления.
+// Параметр limit задает число самых частых исправлений (по умолчанию 20, не больше 100).
+func (h *NoteHandler) GetCorrectionStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	limit := defaultStatsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxStatsLimit)
+	}
+
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	stats := models.CorrectionStats{ByCode: map[int]int{}, Top: []models.CorrectionStat{}}
+	rows, err := h.db.Query(ctx, `SELECT c.code, count(*), count(c.reverted_at)
+        FROM note_corrections c JOIN notes n ON n.id = c.note_id
+        WHERE n.user_id=$1 GROUP BY c.code`, userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code, count, reverted int
+		if err := rows.Scan(&code, &count, &reverted); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		stats.ByCode[code] = count
+		stats.Total += count
+		stats.Reverted += reverted
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err = h.db.Query(ctx, `SELECT c.word, c.replacement, count(*), count(c.reverted_at)
+        FROM note_corrections c JOIN notes n ON n.id = c.note_id
+        WHERE n.user_id=$1
+        GROUP BY c.word, c.replacement
+        ORDER BY count(*) DESC, c.word
+        LIMIT $2`, userID, limit)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s models.CorrectionStat
+		if err := rows.Scan(&s.Word, &s.Replacement, &s.Count, &s.Reverted); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		stats.Top = append(stats.Top, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
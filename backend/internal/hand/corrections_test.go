@@ -0,0 +1,32 @@
+package hand
+
+import "testing"
+
+func TestFindCorrection(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		word string
+		pos  int
+		want int
+	}{
+		{"at the saved position", "мама мыла раму", "мыла", 5, 5},
+		{"text changed before the word", "наша мама мыла раму", "мыла", 5, 10},
+		{"at the start", "мыла раму", "мыла", 0, 0},
+		{"at the end", "мама мыла", "мыла", 0, 5},
+		{"only as part of a word", "мама вымыла раму", "мыла", 7, -1},
+		{"saved position is inside a word", "вымыла мыла", "мыла", 2, 7},
+		{"ambiguous", "мыла и мыла", "мыла", 3, -1},
+		{"ambiguous but the position matches", "мыла и мыла", "мыла", 7, 7},
+		{"hyphenated word", "из-за мыла", "за", 3, -1},
+		{"removed", "мама раму", "мыла", 5, -1},
+		{"position out of range", "мыла", "мыла", 10, 0},
+		{"negative position", "мыла", "мыла", -1, 0},
+		{"empty word", "мыла", "", 0, -1},
+	}
+	for _, tt := range tests {
+		if got := findCorrection([]rune(tt.text), []rune(tt.word), tt.pos); got != tt.want {
+			t.Errorf("%s: findCorrection(%q, %q, %d) = %d, want %d", tt.name, tt.text, tt.word, tt.pos, got, tt.want)
+		}
+	}
+}
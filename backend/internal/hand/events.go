@@ -0,0 +1,154 @@
+package hand
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/events"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+const (
+	// eventsHeartbeat - период отправки комментария, который не дает прокси закрыть простаивающее соединение.
+	// С тем же периодом повторно проверяются учетные данные клиента.
+	eventsHeartbeat = 25 * time.Second
+	// eventsRetry - задержка переподключения, которую браузер использует после обрыва соединения.
+	eventsRetry = 3 * time.Second
+)
+
+// EventHandler отдает поток событий изменений заметок пользователя (Server-Sent Events).
+type EventHandler struct {
+	db     database.Database
+	hub    *events.Hub
+	logger *logger.Logger
+}
+
+// NewEventHandler создает новый экземпляр EventHandler.
+func NewEventHandler(db database.Database, hub *events.Hub, logger *logger.Logger) *EventHandler {
+	return &EventHandler{
+		db:     db,
+		hub:    hub,
+		logger: logger,
+	}
+}
+
+// Events отдает поток событий created, updated и deleted для заметок, видимых текущему пользователю.
+// Идентификатор события передается в поле id, поэтому браузер при переподключении присылает
+// заголовок Last-Event-ID, и пропущенные события досылаются из журнала. Клиенты, которые не могут
+// передать заголовок, указывают параметр last_event_id. Если пропущенные события уже недоступны,
+// отправляется событие reset: клиенту нужно заново загрузить заметки. Поток закрывается, если учетная
+// запись заблокирована или сессия (персональный токен) отозвана после подключения.
+func (h *EventHandler) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	cancel()
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var since int64 = -1
+	if lastID != "" {
+		since, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Подписываемся до чтения журнала, чтобы не потерять события, появившиеся между ними.
+	sub := h.hub.Subscribe(userID)
+	defer sub.Close()
+
+	var replay []events.Event
+	reset := false
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	latest, err := h.hub.Latest(ctx)
+	if err == nil && since >= 0 {
+		replay, reset, err = h.hub.Since(ctx, userID, since, latest)
+	}
+	cancel()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Поток открыт, пока клиент не отключится, поэтому таймаут записи сервера к нему не применяется.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Отключаем буферизацию ответа в nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+
+	// Новый клиент и клиент, пропустивший слишком много, получают идентификатор последнего события,
+	// с которого будут продолжены переподключения.
+	if reset {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", latest)
+	} else if since < 0 {
+		fmt.Fprintf(w, "id: %d\nevent: ready\ndata: {}\n\n", latest)
+	}
+	sent := make(map[int64]bool, len(replay))
+	for _, ev := range replay {
+		writeEvent(w, ev)
+		sent[ev.ID] = true
+	}
+	flusher.Flush()
+
+	creds := RequestCredentials(r)
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Подписка закрыта (остановка сервера или медленный клиент): клиент переподключится.
+				return
+			}
+			if sent[ev.ID] {
+				continue
+			}
+			writeEvent(w, ev)
+			flusher.Flush()
+		case <-heartbeat.C:
+			if creds != nil {
+				ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+				err := creds.Check(ctx)
+				cancel()
+				if err == ErrCredentialsRevoked {
+					return
+				} else if err != nil {
+					h.logger.Error("Failed to recheck event stream credentials", "error", err)
+				}
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent записывает событие в формате text/event-stream.
+func writeEvent(w http.ResponseWriter, ev events.Event) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+}
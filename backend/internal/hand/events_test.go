@@ -0,0 +1,34 @@
+package hand
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/events"
+)
+
+func TestWriteEvent(t *testing.T) {
+	workspaceID := 3
+	created := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		ev   events.Event
+		want string
+	}{
+		{
+			events.Event{ID: 42, Type: events.TypeUpdated, NoteID: 7, CreatedAt: created},
+			"id: 42\nevent: updated\ndata: {\"id\":42,\"type\":\"updated\",\"note_id\":7,\"created_at\":\"2024-03-15T10:30:00Z\"}\n\n",
+		},
+		{
+			events.Event{ID: 43, Type: events.TypeCreated, NoteID: 8, WorkspaceID: &workspaceID, CreatedAt: created},
+			"id: 43\nevent: created\ndata: {\"id\":43,\"type\":\"created\",\"note_id\":8,\"workspace_id\":3,\"created_at\":\"2024-03-15T10:30:00Z\"}\n\n",
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeEvent(w, tt.ev)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("writeEvent:\n%s\nwant:\n%s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package hand
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/export"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// ExportHandler выгружает заметки пользователя для переноса в другие сервисы.
+type ExportHandler struct {
+	db     database.Database
+	store  blobstore.BlobStore
+	logger *logger.Logger
+}
+
+// NewExportHandler создает новый экземпляр ExportHandler. Содержимое вложений для архивов читается из store.
+func NewExportHandler(db database.Database, store blobstore.BlobStore, logger *logger.Logger) *ExportHandler {
+	return &ExportHandler{db: db, store: store, logger: logger}
+}
+
+// Export выгружает все заметки текущего пользователя вместе с временем создания и изменения,
+// номером версии и вложениями. Параметр format выбирает формат: json (по умолчанию, вложения
+// только описываются), markdown-zip (файлы Markdown и вложений) или html (HTML-страницы, вложения
+// и оглавление index.html). Выгрузка передается клиенту по мере чтения заметок из базы данных.
+// Если выгрузка прерывается ошибкой, соединение разрывается, чтобы клиент не принял неполный файл за целый.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatJSON
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	cancel()
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	out := &startedWriter{w: w}
+	writer, err := export.NewWriter(format, out, h.store, h.logger)
+	if err != nil {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	contentType, ext := export.ContentType(format)
+	filename := "notes-" + time.Now().UTC().Format("20060102") + ext
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Выгрузка может длиться долго, поэтому ограничена только временем жизни запроса,
+	// а не таймаутом записи сервера.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	err = export.Export(r.Context(), h.db, userID, writer)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		if r.Context().Err() == nil {
+			h.logger.Error("Failed to export notes", "error", err)
+		}
+		if !out.started {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Error exporting notes", http.StatusInternalServerError)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// startedWriter запоминает, начата ли запись ответа, чтобы до этого момента об ошибке
+// можно было сообщить кодом ответа.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
@@ -0,0 +1,81 @@
+package hand
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// Component - компонент сервиса, состояние и метрики которого публикуют /healthz и /metrics,
+// например клиент внешнего сервиса.
+type Component interface {
+	// Name возвращает имя компонента.
+	Name() string
+	// Health возвращает состояние компонента (ok или degraded) и сведения о нем.
+	Health() (status string, details map[string]any)
+	// WriteMetrics записывает метрики компонента в текстовом формате Prometheus.
+	WriteMetrics(w io.Writer)
+}
+
+// HealthHandler обрабатывает запросы проверки состояния сервиса и его метрик.
+type HealthHandler struct {
+	db         database.Database
+	components []Component
+	logger     *logger.Logger
+}
+
+// NewHealthHandler создает новый экземпляр HealthHandler с заданной базой данных, логгером
+// и компонентами, состояние которых входит в ответ.
+func NewHealthHandler(db database.Database, logger *logger.Logger, components ...Component) *HealthHandler {
+	return &HealthHandler{db: db, components: components, logger: logger}
+}
+
+// componentHealth - состояние компонента в ответе /healthz.
+type componentHealth struct {
+	Status  string         `json:"status"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Health возвращает состояние сервиса. Без базы данных сервис не работает, и ответ - 503;
+// неисправность остальных компонентов только снижает качество работы (degraded), и ответ - 200:
+// например, при недоступном сервисе проверки орфографии заметки сохраняются без исправлений.
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status, code := "ok", http.StatusOK
+	components := make(map[string]componentHealth, len(h.components)+1)
+	var one int
+	if err := h.db.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+		h.logger.Error("Health check: database unavailable", "error", err)
+		status, code = "unavailable", http.StatusServiceUnavailable
+		components["database"] = componentHealth{Status: "unavailable"}
+	} else {
+		components["database"] = componentHealth{Status: "ok"}
+	}
+	for _, c := range h.components {
+		cs, details := c.Health()
+		components[c.Name()] = componentHealth{Status: cs, Details: details}
+		if cs != "ok" && status == "ok" {
+			status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "components": components})
+}
+
+// Metrics возвращает метрики компонентов в текстовом формате Prometheus.
+func (h *HealthHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, c := range h.components {
+		c.WriteMetrics(w)
+	}
+}
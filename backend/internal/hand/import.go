@@ -0,0 +1,179 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/importer"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxImportSize - максимальный размер файла импорта.
+	maxImportSize = 512 << 20
+	// importMemory - часть файла импорта, которая при разборе запроса хранится в памяти; остальное пишется на диск.
+	importMemory = 8 << 20
+)
+
+// ImportHandler принимает файлы других сервисов для импорта заметок и сообщает о ходе импорта.
+type ImportHandler struct {
+	db       database.Database
+	store    blobstore.BlobStore
+	importer *importer.Importer
+	logger   *logger.Logger
+}
+
+// NewImportHandler создает новый экземпляр ImportHandler.
+func NewImportHandler(db database.Database, store blobstore.BlobStore, im *importer.Importer, logger *logger.Logger) *ImportHandler {
+	return &ImportHandler{db: db, store: store, importer: im, logger: logger}
+}
+
+// Import принимает файл импорта (поле file запроса multipart/form-data) и запускает его импорт в фоне.
+// Формат задается полем format (markdown-zip, enex или keep) или определяется по содержимому файла.
+// Орфография импортируемых заметок по умолчанию не проверяется; spellcheck=true включает проверку.
+// Возвращает 202 и задание импорта, ход которого можно узнать запросом GET /import/{id}.
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	cancel()
+
+	// Получение большого файла от медленного клиента дольше таймаутов сервера.
+	extendTransferDeadlines(w)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+multipartOverhead)
+	if err := r.ParseMultipartForm(importMemory); err != nil {
+		if tooLarge(err) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Expected multipart/form-data request", http.StatusBadRequest)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	spellcheck := r.FormValue("spellcheck") == "true"
+	format := r.FormValue("format")
+	if format == "" {
+		if format, err = importer.Detect(file, header.Size); err != nil {
+			http.Error(w, "Unrecognized import format", http.StatusBadRequest)
+			return
+		}
+	} else if !importer.ValidFormat(format) {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	key, err := newStorageKey("imports")
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Как и для вложений, ключ регистрируется как ненужный до загрузки и освобождается
+	// в том же запросе, которым создается задание.
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if _, err := h.db.Exec(ctx, "INSERT INTO orphaned_blobs (storage_key) VALUES ($1)", key); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	putCtx, cancelPut := context.WithTimeout(r.Context(), attachmentTransferTimeout)
+	defer cancelPut()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.Put(putCtx, key, file, header.Size, "application/octet-stream"); err != nil {
+		h.logger.Error("Failed to store import file", "error", err)
+		http.Error(w, "Error storing file", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	job := models.ImportJob{Format: format, Spellcheck: spellcheck, Status: "queued"}
+	err = h.db.QueryRow(ctx, `WITH claimed AS (DELETE FROM orphaned_blobs WHERE storage_key=$4 RETURNING storage_key)
+        INSERT INTO import_jobs (user_id, format, spellcheck, source_key)
+        SELECT $1, $2, $3, storage_key FROM claimed RETURNING id, created_at`,
+		userID, format, spellcheck, key).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		h.logger.Error("Failed to create import job", "error", err)
+		http.Error(w, "Error creating import job", http.StatusInternalServerError)
+		return
+	}
+	if err := h.importer.Enqueue(ctx, job.ID); err != nil {
+		h.logger.Error("Failed to enqueue import job", "job_id", job.ID, "error", err)
+		h.db.Exec(ctx, `WITH failed AS (UPDATE import_jobs SET status='failed', error='not started', source_key=NULL,
+                finished_at=now() WHERE id=$1)
+            INSERT INTO orphaned_blobs (storage_key) VALUES ($2) ON CONFLICT DO NOTHING`, job.ID, key)
+		http.Error(w, "Error creating import job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/import/"+strconv.Itoa(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetImportJob возвращает задание импорта текущего пользователя: состояние, прогресс и, после
+// завершения, отчет об импортированных и пропущенных элементах.
+func (h *ImportHandler) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	jobID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	var job models.ImportJob
+	var report []byte
+	var message sql.NullString
+	err = h.db.QueryRow(ctx, `SELECT j.id, j.format, j.spellcheck, j.status, j.total, j.processed, j.imported, j.skipped,
+            j.report, j.error, j.created_at, j.started_at, j.finished_at
+        FROM import_jobs j JOIN users u ON u.id = j.user_id WHERE j.id=$1 AND u.username=$2`,
+		jobID, r.Header.Get("username")).Scan(&job.ID, &job.Format, &job.Spellcheck, &job.Status, &job.Total,
+		&job.Processed, &job.Imported, &job.Skipped, &report, &message, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Import job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	job.Error = message.String
+	if report != nil {
+		job.Report = &models.ImportReport{}
+		if err := json.Unmarshal(report, job.Report); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,251 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxLinkTTL - максимальный срок действия публичной ссылки.
+const maxLinkTTL = 365 * 24 * time.Hour
+
+// sharedNotePage - минимальная HTML-страница публичной заметки.
+// Если ссылка защищена паролем и он не передан или неверен, вместо текста выводится форма ввода пароля.
+var sharedNotePage = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Note</title></head>
+<body>
+{{if .PasswordRequired}}<form method="post">
+{{if .WrongPassword}}<p>Wrong password</p>{{end}}
+<input type="password" name="password" autofocus>
+<button type="submit">Open</button>
+</form>{{else if .HTML}}{{.HTML}}{{else}}<pre style="white-space: pre-wrap">{{.Text}}</pre>{{end}}
+</body>
+</html>
+`))
+
+// sharedNoteView - данные страницы sharedNotePage.
+type sharedNoteView struct {
+	PasswordRequired bool
+	WrongPassword    bool
+	Text             string
+	// HTML - текст заметки в формате markdown, преобразованный в безопасный HTML.
+	HTML template.HTML
+}
+
+// CreateLink создает публичную ссылку на заметку для чтения без учетной записи.
+// Принимает необязательные срок действия в часах (expires_in_hours) и пароль (password).
+// Ссылка возвращается в ответе один раз. Доступно только владельцу заметки.
+func (h *NoteHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanManage) {
+		return
+	}
+
+	var expiresAt *time.Time
+	if v := r.FormValue("expires_in_hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 || time.Duration(hours)*time.Hour > maxLinkTTL {
+			http.Error(w, "Invalid expires_in_hours", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(time.Duration(hours) * time.Hour)
+		expiresAt = &t
+	}
+
+	var passwordHash *string
+	if password := r.FormValue("password"); password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			// bcrypt не принимает пароли длиннее 72 байт.
+			http.Error(w, "Invalid password", http.StatusBadRequest)
+			return
+		}
+		s := string(hashed)
+		passwordHash = &s
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	link := models.NoteLink{NoteID: noteID, HasPassword: passwordHash != nil, ExpiresAt: expiresAt}
+	err = h.db.QueryRow(ctx, `INSERT INTO note_links (note_id, token_hash, password_hash, expires_at)
+        VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		noteID, hashToken(token), passwordHash, expiresAt).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		http.Error(w, "Error creating link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.NoteLink
+		URL string `json:"url"`
+	}{link, strings.TrimRight(h.baseURL, "/") + "/s/" + token})
+}
+
+// GetLinks возвращает действующие (не отозванные) публичные ссылки на заметку без их токенов.
+// Доступно только владельцу заметки.
+func (h *NoteHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanManage) {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT id, note_id, password_hash IS NOT NULL, expires_at, view_count, created_at
+        FROM note_links WHERE note_id=$1 AND revoked_at IS NULL ORDER BY created_at`, noteID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	links := []models.NoteLink{}
+	for rows.Next() {
+		var l models.NoteLink
+		if err := rows.Scan(&l.ID, &l.NoteID, &l.HasPassword, &l.ExpiresAt, &l.ViewCount, &l.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		links = append(links, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeLink отзывает публичную ссылку на заметку. Доступно только владельцу заметки.
+func (h *NoteHandler) RevokeLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanManage) {
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `UPDATE note_links SET revoked_at=now()
+        WHERE id=$1 AND note_id=$2 AND revoked_at IS NULL`, mux.Vars(r)["linkID"], noteID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Link revoked successfully"))
+}
+
+// ViewLink отдает заметку по публичной ссылке без авторизации.
+// Ответ в формате JSON, либо минимальная HTML-страница, если ее запрашивает браузер (Accept: text/html)
+// или передан параметр format=html. Пароль ссылки передается в заголовке X-Share-Password
+// или в поле password формы (POST). Несуществующая, отозванная и просроченная ссылки, а также ссылка
+// на удаленную заметку неотличимы друг от друга.
+func (h *NoteHandler) ViewLink(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Токен находится в адресе страницы, поэтому она не должна кэшироваться, индексироваться
+	// и передаваться в заголовке Referer при переходах по ссылкам из заметки.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	html := r.URL.Query().Get("format") == "html" ||
+		(r.URL.Query().Get("format") == "" && strings.Contains(r.Header.Get("Accept"), "text/html"))
+	if html {
+		// Страница открывается напрямую в браузере, поэтому скрипты запрещены так же, как в GetNote.
+		w.Header().Set("Content-Security-Policy", renderedNoteCSP)
+	}
+
+	var linkID int
+	var passwordHash sql.NullString
+	var note models.Note
+	err := h.db.QueryRow(ctx, `SELECT l.id, l.password_hash, n.id, n.text, n.format
+        FROM note_links l JOIN notes n ON n.id = l.note_id
+        WHERE l.token_hash=$1 AND l.revoked_at IS NULL AND (l.expires_at IS NULL OR l.expires_at > now())
+        AND n.deleted_at IS NULL`,
+		hashToken(mux.Vars(r)["token"])).Scan(&linkID, &passwordHash, &note.ID, &note.Text, &note.Format)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if passwordHash.Valid {
+		password := r.Header.Get("X-Share-Password")
+		if password == "" && r.Method == http.MethodPost {
+			password = r.FormValue("password")
+		}
+		if password == "" || bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+			if html {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusUnauthorized)
+				sharedNotePage.Execute(w, sharedNoteView{PasswordRequired: true, WrongPassword: password != ""})
+				return
+			}
+			http.Error(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Просмотр засчитывается только после успешной проверки пароля.
+	if _, err := h.db.Exec(ctx, "UPDATE note_links SET view_count = view_count + 1 WHERE id=$1", linkID); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if html {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		view := sharedNoteView{Text: note.Text}
+		if note.Format == markdown.FormatMarkdown {
+			// Результат markdown.Render экранирован и не содержит небезопасных ссылок.
+			doc := markdown.Render(note.Text)
+			view.HTML = template.HTML(doc.TOC() + doc.HTML)
+		}
+		sharedNotePage.Execute(w, view)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ID     int    `json:"id"`
+		Text   string `json:"text"`
+		Format string `json:"format"`
+	}{note.ID, note.Text, note.Format})
+}
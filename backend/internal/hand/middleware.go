@@ -1,52 +1,349 @@
 package hand
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jwtkeys"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware возвращает middleware функцию, которая проверяет наличие и валидность JWT токена в cookie.
-// Если токен отсутствует или недействителен, пользователь получает ответ с ошибкой авторизации.
+// tokenLeeway - допустимое расхождение часов при проверке exp, nbf и iat,
+// так как токены могут проверять другие сервисы.
+const tokenLeeway = 30 * time.Second
+
+// tokenClaims - полезная нагрузка токенов, которые выпускает и проверяет Auth.
+type tokenClaims interface {
+	jwt.Claims
+	registered() *jwt.RegisteredClaims
+}
+
+// Auth выпускает и проверяет JWT токены сервиса.
+// Токены подписываются активным ключом набора и содержат его идентификатор в заголовке kid,
+// а проверяются любым ключом набора, поэтому смена ключа не завершает выданные сессии.
+type Auth struct {
+	db       database.Database
+	keys     *jwtkeys.KeySet
+	issuer   string
+	audience string
+}
+
+// NewAuth создает новый экземпляр Auth с заданным набором ключей.
+func NewAuth(db database.Database, keys *jwtkeys.KeySet, cfg config.JWTConfig) *Auth {
+	return &Auth{
+		db:       db,
+		keys:     keys,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+}
+
+// AuthMiddleware возвращает middleware функцию, которая проверяет наличие и валидность JWT токена в cookie
+// или в заголовке Authorization: Bearer. Если токен отсутствует или недействителен, пользователь получает ответ с ошибкой авторизации.
 // В противном случае, middleware устанавливает имя пользователя из токена в заголовки запроса и передает управление следующему обработчику.
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+//
+// Персональные токены доступа (API keys) принимаются только маршрутами, для которых указаны
+// необходимые разрешения scopes, и только если токен обладает всеми ними.
+// Сессии пользователя обладают всеми разрешениями.
+func (a *Auth) AuthMiddleware(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Извлечение JWT токена из cookie.
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			if errors.Is(err, http.ErrNoCookie) {
-				// Если cookie с токеном отсутствует, возвращаем ошибку авторизации.
+		// Персональный токен доступа передается в заголовке Authorization и узнается по префиксу.
+		bearer := bearerToken(r)
+		if strings.HasPrefix(bearer, apiTokenPrefix) {
+			if len(scopes) == 0 {
+				// Маршруты без разрешений (управление учетной записью) доступны только в сессии.
+				http.Error(w, "API tokens are not allowed here", http.StatusForbidden)
+				return
+			}
+			token, err := a.lookupAPIToken(r.Context(), bearer)
+			if err != nil {
+				log.Println("API token validation failed:", err)
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
-			// Если произошла ошибка при извлечении cookie, возвращаем ошибку запроса.
-			http.Error(w, "Bad request", http.StatusBadRequest)
+			if token.disabled {
+				http.Error(w, "Account is disabled", http.StatusForbidden)
+				return
+			}
+			for _, scope := range scopes {
+				if !hasScope(token.scopes, scope) {
+					http.Error(w, "Insufficient scope: "+scope+" is required", http.StatusForbidden)
+					return
+				}
+			}
+			r.Header.Set("username", token.username)
+			r.Header.Del("impersonator")
+			creds := &Credentials{auth: a, apiToken: bearer, CanWrite: hasScope(token.scopes, ScopeNotesWrite)}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), credentialsKey{}, creds)))
 			return
 		}
 
-		// Извлечение строки токена из cookie.
-		tokenStr := cookie.Value
+		// Извлечение JWT токена из заголовка Authorization или из cookie.
+		tokenStr := bearer
+		if tokenStr == "" {
+			cookie, err := r.Cookie("token")
+			if err != nil {
+				if errors.Is(err, http.ErrNoCookie) {
+					// Если cookie с токеном отсутствует, возвращаем ошибку авторизации.
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				// Если произошла ошибка при извлечении cookie, возвращаем ошибку запроса.
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			tokenStr = cookie.Value
+		}
 		claims := &Claims{}
 
 		// Парсинг токена и извлечение его полезной нагрузки.
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			// Проверка подписи токена с использованием секретного ключа.
-			return jwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		if err := a.parseToken(tokenStr, claims); err != nil {
 			// Если токен не удалось распарсить или он недействителен, выводим ошибку в лог и возвращаем ошибку авторизации.
 			log.Println("Token validation failed:", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		// Служебные токены (например, challenge-токен двухфакторной аутентификации) не являются сессией.
+		if claims.Purpose != "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Проверка состояния учетной записи: блокировки и отзыва сессий администратором.
+		if claims.Impersonator != "" {
+			// Вход от имени пользователя дает только чтение заметок и действует, пока выдавший его
+			// администратор остается активным администратором.
+			if !readOnly(scopes) {
+				http.Error(w, "Impersonation sessions are read-only", http.StatusForbidden)
+				return
+			}
+			if status, msg := a.checkAccount(r.Context(), claims.Impersonator, claims, true); status != 0 {
+				http.Error(w, msg, status)
+				return
+			}
+			r.Header.Set("impersonator", claims.Impersonator)
+		} else {
+			if status, msg := a.checkAccount(r.Context(), claims.Username, claims, false); status != 0 {
+				http.Error(w, msg, status)
+				return
+			}
+			r.Header.Del("impersonator")
+		}
+
 		// Установка имени пользователя из токена в заголовки запроса для дальнейшего использования в обработчике.
 		r.Header.Set("username", claims.Username)
 
 		// Передача управления следующему обработчику.
+		creds := &Credentials{auth: a, claims: claims, CanWrite: claims.Impersonator == ""}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), credentialsKey{}, creds)))
+	})
+}
+
+// AdminMiddleware пропускает только сессии администраторов. Персональные токены доступа
+// и сессии входа от имени пользователя административным API не принимаются.
+func (a *Auth) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return a.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		var isAdmin bool
+		err := a.db.QueryRow(r.Context(), "SELECT is_admin FROM users WHERE username=$1", r.Header.Get("username")).Scan(&isAdmin)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// checkAccount проверяет, что учетная запись username не заблокирована, а сессия claims выдана
+// после последнего отзыва сессий. Если admin - true, пользователь также должен быть администратором.
+// Возвращает код и текст ответа с ошибкой или 0, если сессия действительна.
+func (a *Auth) checkAccount(ctx context.Context, username string, claims *Claims, admin bool) (int, string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var disabled, isAdmin bool
+	var revokedAt *time.Time
+	err := a.db.QueryRow(ctx, "SELECT disabled_at IS NOT NULL, is_admin, sessions_revoked_at FROM users WHERE username=$1",
+		username).Scan(&disabled, &isAdmin, &revokedAt)
+	if err == sql.ErrNoRows {
+		return http.StatusUnauthorized, "Unauthorized"
+	} else if err != nil {
+		log.Println("Account lookup failed:", err)
+		return http.StatusInternalServerError, "Server error"
+	}
+	// iat хранится с точностью до секунды, поэтому сессия, выданная в ту же секунду, что и отзыв, тоже отзывается.
+	if revokedAt != nil && !claims.IssuedAt.Time.After(revokedAt.Truncate(time.Second)) {
+		return http.StatusUnauthorized, "Unauthorized"
+	}
+	if admin && (disabled || !isAdmin) {
+		return http.StatusUnauthorized, "Unauthorized"
+	}
+	if disabled {
+		return http.StatusForbidden, "Account is disabled"
+	}
+	return 0, ""
+}
+
+// ErrCredentialsRevoked возвращается Credentials.Check, если учетные данные запроса больше не действительны.
+var ErrCredentialsRevoked = errors.New("credentials revoked")
+
+// credentialsKey - ключ контекста запроса, под которым AuthMiddleware сохраняет Credentials.
+type credentialsKey struct{}
+
+// Credentials - учетные данные, с которыми AuthMiddleware принял запрос. Долгие соединения
+// (совместное редактирование, поток событий) проверяют их повторно, чтобы блокировка учетной записи,
+// отзыв сессий или персонального токена завершали и уже открытые соединения.
+type Credentials struct {
+	auth     *Auth
+	claims   *Claims
+	apiToken string
+	// CanWrite - учетные данные позволяют изменять заметки: это сессия пользователя, а не вход
+	// от имени пользователя, или персональный токен с разрешением notes:write.
+	CanWrite bool
+}
+
+// RequestCredentials возвращает учетные данные запроса, прошедшего AuthMiddleware, или nil.
+func RequestCredentials(r *http.Request) *Credentials {
+	creds, _ := r.Context().Value(credentialsKey{}).(*Credentials)
+	return creds
+}
+
+// Check повторно проверяет учетные данные: срок действия сессии, блокировку учетной записи,
+// отзыв сессий и персонального токена. Возвращает ErrCredentialsRevoked, если они больше
+// не действительны, и другую ошибку, если проверить их не удалось.
+func (c *Credentials) Check(ctx context.Context) error {
+	if c.apiToken != "" {
+		token, err := c.auth.lookupAPIToken(ctx, c.apiToken)
+		if err == sql.ErrNoRows || (err == nil && token.disabled) {
+			return ErrCredentialsRevoked
+		}
+		return err
+	}
+
+	if c.claims.ExpiresAt != nil && time.Now().After(c.claims.ExpiresAt.Time) {
+		return ErrCredentialsRevoked
+	}
+	username, admin := c.claims.Username, false
+	if c.claims.Impersonator != "" {
+		username, admin = c.claims.Impersonator, true
+	}
+	switch status, msg := c.auth.checkAccount(ctx, username, c.claims, admin); status {
+	case 0:
+		return nil
+	case http.StatusInternalServerError:
+		return errors.New(msg)
+	default:
+		return ErrCredentialsRevoked
+	}
+}
+
+// readOnly сообщает, требует ли маршрут только чтения заметок.
+func readOnly(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if scope != ScopeNotesRead {
+			return false
+		}
+	}
+	return true
+}
+
+// bearerToken извлекает токен из заголовка Authorization: Bearer.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// JWKS отдает открытые ключи подписи в формате JSON Web Key Set,
+// чтобы другие сервисы могли проверять токены без общего секрета.
+func (a *Auth) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := a.keys.JWKS()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
+}
+
+// signToken подписывает JWT токен активным ключом, дополняя полезную нагрузку
+// утверждениями iss, aud, iat, nbf и jti.
+func (a *Auth) signToken(claims tokenClaims) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := jwt.NewNumericDate(time.Now())
+	rc := claims.registered()
+	rc.Issuer = a.issuer
+	rc.Audience = jwt.ClaimStrings{a.audience}
+	rc.IssuedAt = now
+	rc.NotBefore = now
+	rc.ID = hex.EncodeToString(jti)
+
+	key := a.keys.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey())
+}
+
+// parseToken проверяет подпись и утверждения JWT токена и заполняет claims его полезной нагрузкой.
+// Ключ выбирается по kid, а алгоритм токена должен совпадать с алгоритмом этого ключа.
+func (a *Auth) parseToken(tokenStr string, claims tokenClaims) error {
+	_, err := jwt.ParseWithClaims(tokenStr, claims, a.verificationKey,
+		jwt.WithValidMethods(a.keys.Algorithms()),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Библиотека проверяет iat и nbf, только если они присутствуют, а наши токены обязаны их содержать.
+	rc := claims.registered()
+	if rc.IssuedAt == nil || rc.NotBefore == nil || rc.ID == "" {
+		return fmt.Errorf("%w: iat, nbf and jti are required", jwt.ErrTokenRequiredClaimMissing)
+	}
+	return nil
+}
+
+// verificationKey выбирает ключ для проверки подписи токена по заголовку kid.
+func (a *Auth) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := a.keys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	// Защита от подмены алгоритма: например, подписи HS256 открытым ключом RSA.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s does not match key %q", token.Method.Alg(), kid)
+	}
+	return key.VerifyKey(), nil
+}
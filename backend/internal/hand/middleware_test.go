@@ -0,0 +1,310 @@
+package hand
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey сохраняет закрытый ключ в каталог ключей подписи под идентификатором kid.
+func writeKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testKeys - каталог с ключом RSA "current" и выводимым из оборота ключом ECDSA "previous".
+type testKeys struct {
+	dir string
+	rsa *rsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeKey(t, dir, "current", rsaKey)
+	writeKey(t, dir, "previous", ecKey)
+	return &testKeys{dir: dir, rsa: rsaKey}
+}
+
+// auth возвращает Auth, подписывающий токены ключом active.
+func (k *testKeys) auth(t *testing.T, active, issuer, audience string) *Auth {
+	t.Helper()
+	cfg := config.JWTConfig{Issuer: issuer, Audience: audience, KeysDir: k.dir, ActiveKeyID: active}
+	keys, err := jwtkeys.Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuth(nil, keys, cfg)
+}
+
+// sessionClaims возвращает утверждения сессионного токена, истекающего через ttl.
+func sessionClaims(username string, ttl time.Duration) *Claims {
+	return &Claims{
+		Username:         username,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: username, ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl))},
+	}
+}
+
+func TestSignToken(t *testing.T) {
+	a := newTestKeys(t).auth(t, "current", "notes", "notes-api")
+	token, err := a.signToken(sessionClaims("alice", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "current" || parsed.Method.Alg() != "RS256" {
+		t.Errorf("header = %v, want kid current and RS256", parsed.Header)
+	}
+
+	claims := &Claims{}
+	if err := a.parseToken(token, claims); err != nil {
+		t.Fatalf("parseToken: %v", err)
+	}
+	if claims.Username != "alice" || claims.Issuer != "notes" || len(claims.Audience) != 1 || claims.Audience[0] != "notes-api" ||
+		claims.IssuedAt == nil || claims.NotBefore == nil || len(claims.ID) != 32 {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	other, err := a.signToken(sessionClaims("alice", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClaims := &Claims{}
+	if err := a.parseToken(other, otherClaims); err != nil || otherClaims.ID == claims.ID {
+		t.Errorf("two tokens have the same jti %q (%v)", claims.ID, err)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	keys := newTestKeys(t)
+	a := keys.auth(t, "current", "notes", "notes-api")
+	sign := func(a *Auth, c *Claims) string {
+		token, err := a.signToken(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// signRaw подписывает утверждения как есть, без дополнения полей signToken.
+	signRaw := func(method jwt.SigningMethod, kid string, key interface{}, c jwt.Claims) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	now := time.Now()
+	full := func(modify func(*jwt.RegisteredClaims)) *Claims {
+		c := &Claims{Username: "alice", RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "notes", Audience: jwt.ClaimStrings{"notes-api"}, ID: "jti",
+			IssuedAt: jwt.NewNumericDate(now), NotBefore: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}}
+		modify(&c.RegisteredClaims)
+		return c
+	}
+	publicPEM, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := sign(a, sessionClaims("alice", time.Hour))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", valid, true},
+		{"signed by the previous key", sign(keys.auth(t, "previous", "notes", "notes-api"), sessionClaims("alice", time.Hour)), true},
+		{"within leeway after expiry", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-tokenLeeway / 2))
+		})), true},
+		{"expired", sign(a, sessionClaims("alice", -time.Hour)), false},
+		{"without expiry", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil })), false},
+		{"without iat", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) { c.IssuedAt = nil })), false},
+		{"without nbf", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) { c.NotBefore = nil })), false},
+		{"without jti", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) { c.ID = "" })), false},
+		{"not yet valid", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+		})), false},
+		{"issued in the future", signRaw(jwt.SigningMethodRS256, "current", keys.rsa, full(func(c *jwt.RegisteredClaims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour))
+		})), false},
+		{"other issuer", sign(keys.auth(t, "current", "other", "notes-api"), sessionClaims("alice", time.Hour)), false},
+		{"other audience", sign(keys.auth(t, "current", "notes", "other-api"), sessionClaims("alice", time.Hour)), false},
+		{"unknown key", sign(newTestKeys(t).auth(t, "current", "notes", "notes-api"), sessionClaims("alice", time.Hour)), false},
+		{"key id of another key", signRaw(jwt.SigningMethodRS256, "previous", keys.rsa, full(func(*jwt.RegisteredClaims) {})), false},
+		{"HS256 signed with the public key", signRaw(jwt.SigningMethodHS256, "current", publicPEM, full(func(*jwt.RegisteredClaims) {})), false},
+		{"alg none", signRaw(jwt.SigningMethodNone, "current", jwt.UnsafeAllowNoneSignatureType, full(func(*jwt.RegisteredClaims) {})), false},
+		{"tampered payload", parts[0] + "." + strings.Split(sign(a, sessionClaims("bob", time.Hour)), ".")[1] + "." + parts[2], false},
+		{"garbage", "not-a-token", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.parseToken(tt.token, &Claims{})
+			if (err == nil) != tt.ok {
+				t.Errorf("parseToken: err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	a := newTestKeys(t).auth(t, "current", "notes", "notes-api")
+	token := func(c *Claims) string {
+		s, err := a.signToken(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	challenge := sessionClaims("alice", time.Minute)
+	challenge.Purpose = purposeTwoFactor
+	impersonation := sessionClaims("alice", time.Hour)
+	impersonation.Impersonator = "admin"
+
+	// Действительные сессии проверяются по базе данных (checkAccount), поэтому здесь
+	// проверяются только отказы, которые не доходят до нее; остальное покрывают тесты internal/app.
+	tests := []struct {
+		name   string
+		cookie string
+		bearer string
+		// header - заголовок username, подставленный клиентом; middleware не должен ему доверять.
+		header string
+		scopes []string
+		want   int
+	}{
+		{"no cookie", "", "", "bob", nil, http.StatusUnauthorized},
+		{"invalid token", "not-a-token", "", "", nil, http.StatusUnauthorized},
+		{"invalid bearer token", token(sessionClaims("alice", time.Hour)), "not-a-token", "", nil, http.StatusUnauthorized},
+		{"expired session", token(sessionClaims("alice", -time.Hour)), "", "", nil, http.StatusUnauthorized},
+		{"two-factor challenge", token(challenge), "", "", nil, http.StatusUnauthorized},
+		// Маршруты без разрешений (управление учетной записью) не принимают персональные токены.
+		{"API token", "", apiTokenPrefix + "secret", "", nil, http.StatusForbidden},
+		// Вход от имени пользователя дает только чтение заметок.
+		{"impersonation on an account route", token(impersonation), "", "", nil, http.StatusForbidden},
+		{"impersonation on a write route", token(impersonation), "", "", []string{ScopeNotesRead, ScopeNotesWrite}, http.StatusForbidden},
+		{"impersonation on a delete route", "", token(impersonation), "", []string{ScopeNotesDelete}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var username string
+			handler := a.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				username = r.Header.Get("username")
+			}, tt.scopes...)
+			r := httptest.NewRequest(http.MethodGet, "/notes", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.header != "" {
+				r.Header.Set("username", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want || username != "" {
+				t.Errorf("status %d, handler called as %q; want %d", w.Code, username, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{ScopeNotesRead}, true},
+		{[]string{ScopeNotesRead, ScopeNotesRead}, true},
+		{[]string{ScopeNotesRead, ScopeNotesWrite}, false},
+		{[]string{ScopeNotesWrite}, false},
+		{[]string{ScopeNotesDelete}, false},
+	}
+	for _, tt := range tests {
+		if got := readOnly(tt.scopes); got != tt.want {
+			t.Errorf("readOnly(%q) = %v, want %v", tt.scopes, got, tt.want)
+		}
+	}
+}
+
+func TestCredentialsExpired(t *testing.T) {
+	// Истекшая сессия отклоняется без обращения к базе данных.
+	creds := &Credentials{auth: &Auth{}, claims: sessionClaims("alice", -time.Minute), CanWrite: true}
+	if err := creds.Check(context.Background()); err != ErrCredentialsRevoked {
+		t.Errorf("Check = %v, want ErrCredentialsRevoked", err)
+	}
+}
+
+func TestRequestCredentials(t *testing.T) {
+	r := httptest.NewRequest("GET", "/notes/1/collab", nil)
+	if creds := RequestCredentials(r); creds != nil {
+		t.Errorf("RequestCredentials without AuthMiddleware = %+v, want nil", creds)
+	}
+	want := &Credentials{CanWrite: true}
+	r = r.WithContext(context.WithValue(r.Context(), credentialsKey{}, want))
+	if got := RequestCredentials(r); got != want {
+		t.Errorf("RequestCredentials = %p, want %p", got, want)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"":                   "",
+		"Bearer abc":         "abc",
+		"bearer abc":         "abc",
+		"BEARER  abc ":       "abc",
+		"Bearer ":            "",
+		"Basic YWxpY2U6cHc=": "",
+		"Bearerabc":          "",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if got := bearerToken(r); got != want {
+			t.Errorf("bearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
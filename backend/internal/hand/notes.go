@@ -2,38 +2,59 @@ package hand
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
 	"github.com/NickolaiP/notes_app/backend/internal/database"
 	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
 	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
-// NoteHandler обрабатывает запросы, связанные с заметками (создание, получение и удаление).
+// renderedNoteCSP - политика Content-Security-Policy для HTML, полученного из текста заметки:
+// скрипты и подключение ресурсов запрещены, кроме изображений и встроенных стилей.
+const renderedNoteCSP = "default-src 'none'; img-src http: https:; style-src 'unsafe-inline'"
+
+// NoteHandler обрабатывает запросы, связанные с заметками (получение, изменение и удаление).
+// Заметки создаются обработчиком speller.CreateNoteHandler, который проверяет орфографию текста.
+// Права на отдельные заметки определяются через authz.Authorizer: владелец или предоставленный доступ.
 type NoteHandler struct {
-	db     database.Database
-	logger *logger.Logger
+	db      database.Database
+	authz   *authz.Authorizer
+	baseURL string
+	logger  *logger.Logger
 }
 
 // NewNoteHandler создает новый экземпляр NoteHandler с заданной базой данных и логгером.
 // Аргументы:
 //
 //	db - интерфейс базы данных для выполнения запросов.
+//	baseURL - внешний адрес сервиса для публичных ссылок на заметки.
 //	logger - логгер для записи сообщений о событиях и ошибках.
 //
 // Возвращает:
 //
 //	*NoteHandler - новый экземпляр NoteHandler.
-func NewNoteHandler(db database.Database, logger *logger.Logger) *NoteHandler {
+func NewNoteHandler(db database.Database, baseURL string, logger *logger.Logger) *NoteHandler {
 	return &NoteHandler{
-		db:     db,
-		logger: logger,
+		db:      db,
+		authz:   authz.New(db),
+		baseURL: baseURL,
+		logger:  logger,
 	}
 }
 
 // GetNotes обрабатывает запрос на получение всех заметок для текущего пользователя.
+// Параметр scope выбирает личные заметки (own, по умолчанию), заметки, к которым пользователю
+// предоставлен доступ (shared), заметки рабочего пространства workspace_id (workspace)
+// или все доступные пользователю заметки (all).
 // Аргументы:
 //
 //	w - http.ResponseWriter для отправки ответа клиенту.
@@ -59,8 +80,43 @@ func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Запрашиваем все заметки пользователя из базы данных.
-	rows, err := h.db.Query(ctx, "SELECT id, text FROM notes WHERE user_id=$1", userID)
+	// Выбираем заметки в зависимости от области видимости.
+	var filter string
+	args := []interface{}{userID}
+	switch r.URL.Query().Get("scope") {
+	case "", "own":
+		filter = "n.workspace_id IS NULL AND n.user_id=$1"
+	case "shared":
+		filter = "s.user_id IS NOT NULL"
+	case "workspace":
+		workspaceID, err := strconv.Atoi(r.URL.Query().Get("workspace_id"))
+		if err != nil {
+			http.Error(w, "Invalid workspace_id", http.StatusBadRequest)
+			return
+		}
+		role, err := h.authz.WorkspaceRole(ctx, userID, workspaceID)
+		if err == authz.ErrNotFound || (err == nil && role == "") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		filter = "n.workspace_id=$2"
+		args = append(args, workspaceID)
+	case "all":
+		filter = "(n.workspace_id IS NULL AND n.user_id=$1) OR s.user_id IS NOT NULL OR m.user_id IS NOT NULL"
+	default:
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return
+	}
+
+	// Запрашиваем заметки пользователя из базы данных вместе с данными, от которых зависят права на них.
+	rows, err := h.db.Query(ctx, `SELECT n.id, n.text, n.format, n.tags, n.spellcheck_status, n.user_id, n.version, n.workspace_id, u.username, s.role, m.role
+        FROM notes n JOIN users u ON u.id = n.user_id
+        LEFT JOIN note_shares s ON s.note_id = n.id AND s.user_id = $1
+        LEFT JOIN workspace_members m ON m.workspace_id = n.workspace_id AND m.user_id = $1
+        WHERE n.deleted_at IS NULL AND (`+filter+`) ORDER BY n.id`, args...)
 	if err != nil {
 		// Если произошла ошибка при выполнении запроса, возвращаем ошибку 500.
 		http.Error(w, "Server error", http.StatusInternalServerError)
@@ -72,11 +128,20 @@ func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 	var notes []models.Note
 	for rows.Next() {
 		var note models.Note
-		if err := rows.Scan(&note.ID, &note.Text); err != nil {
+		var workspaceID sql.NullInt64
+		var shareRole, memberRole sql.NullString
+		if err := rows.Scan(&note.ID, &note.Text, &note.Format, pq.Array(&note.Tags), &note.SpellcheckStatus, &note.UserID, &note.Version, &workspaceID, &note.Owner, &shareRole, &memberRole); err != nil {
 			// Если произошла ошибка при чтении строки, возвращаем ошибку 500.
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
+		if workspaceID.Valid {
+			id := int(workspaceID.Int64)
+			note.WorkspaceID = &id
+		} else if note.UserID == userID {
+			note.Owner = ""
+		}
+		note.Access = authz.ResolveNoteAccess(userID, note.UserID, workspaceID.Valid, shareRole.String, memberRole.String).String()
 		notes = append(notes, note)
 	}
 
@@ -84,7 +149,9 @@ func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(notes)
 }
 
-// CreateNote обрабатывает запрос на создание новой заметки для текущего пользователя.
+// DeleteNote обрабатывает запрос на удаление заметки для текущего пользователя.
+// Удалить заметку может только ее владелец, а заметку рабочего пространства - его администраторы и владельцы.
+// Заметка помечается удаленной и остается в базе данных, чтобы синхронизируемые клиенты узнали об удалении.
 // Аргументы:
 //
 //	w - http.ResponseWriter для отправки ответа клиенту.
@@ -92,15 +159,15 @@ func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
 //
 // Возвращает:
 //
-//	Ответ с сообщением об успешном создании заметки или ошибкой.
-func (h *NoteHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
+//	Ответ с сообщением об успешном удалении заметки или ошибкой.
+func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 	// Устанавливаем тайм-аут для запроса к базе данных.
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Получаем имя пользователя и текст заметки из заголовков и формы запроса.
+	// Получаем имя пользователя из заголовка запроса и идентификатор заметки из параметров URL.
 	username := r.Header.Get("username")
-	text := r.FormValue("text")
+	noteID := r.URL.Query().Get("id")
 
 	// Запрашиваем идентификатор пользователя из базы данных.
 	var userID int
@@ -111,53 +178,176 @@ func (h *NoteHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Вставляем новую заметку в базу данных.
-	_, err = h.db.Exec(ctx, "INSERT INTO notes (user_id, text) VALUES ($1, $2)", userID, text)
+	// Проверяем, что пользователь является владельцем заметки.
+	id, err := strconv.Atoi(noteID)
+	if err != nil {
+		http.Error(w, "Invalid note id", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(ctx, w, userID, id, authz.Access.CanManage) {
+		return
+	}
+
+	// Помечаем заметку удаленной.
+	_, err = h.db.Exec(ctx, "UPDATE notes SET deleted_at=now() WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
 		// Если произошла ошибка при выполнении запроса, возвращаем ошибку 500.
-		http.Error(w, "Error creating note", http.StatusInternalServerError)
+		http.Error(w, "Error deleting note", http.StatusInternalServerError)
 		return
 	}
 
-	// Отправляем клиенту сообщение об успешном создании заметки.
-	w.Write([]byte("Note created successfully"))
+	// Отправляем клиенту сообщение об успешном удалении заметки.
+	w.Write([]byte("Note deleted successfully"))
 }
 
-// DeleteNote обрабатывает запрос на удаление заметки для текущего пользователя.
-// Аргументы:
-//
-//	w - http.ResponseWriter для отправки ответа клиенту.
-//	r - http.Request, содержащий запрос от клиента.
-//
-// Возвращает:
-//
-//	Ответ с сообщением об успешном удалении заметки или ошибкой.
-func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
-	// Устанавливаем тайм-аут для запроса к базе данных.
+// GetNote обрабатывает запрос на получение одной заметки по идентификатору.
+// Заметку может получить владелец и пользователи, которым к ней предоставлен доступ.
+// С параметром render=html вместо JSON возвращается текст заметки в виде HTML: заметки в формате
+// markdown преобразуются с оглавлением и якорями заголовков, HTML из текста не выполняется.
+func (h *NoteHandler) GetNote(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Получаем имя пользователя из заголовка запроса и идентификатор заметки из параметров URL.
-	username := r.Header.Get("username")
-	noteID := r.URL.Query().Get("id")
+	render := r.URL.Query().Get("render")
+	if render != "" && render != "html" {
+		http.Error(w, "Invalid render", http.StatusBadRequest)
+		return
+	}
 
-	// Запрашиваем идентификатор пользователя из базы данных.
-	var userID int
-	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", username).Scan(&userID)
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	access, ok := h.access(ctx, w, userID, noteID, authz.Access.CanRead)
+	if !ok {
+		return
+	}
+
+	var note models.Note
+	var workspaceID sql.NullInt64
+	err := h.db.QueryRow(ctx, `SELECT n.id, n.text, n.format, n.tags, n.spellcheck_status, n.user_id, n.version, n.workspace_id, u.username FROM notes n
+        JOIN users u ON u.id = n.user_id WHERE n.id=$1`, noteID).Scan(&note.ID, &note.Text, &note.Format, pq.Array(&note.Tags), &note.SpellcheckStatus, &note.UserID, &note.Version, &workspaceID, &note.Owner)
 	if err != nil {
-		// Если пользователь не найден, возвращаем ошибку 404.
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if workspaceID.Valid {
+		id := int(workspaceID.Int64)
+		note.WorkspaceID = &id
+	}
+	note.Access = access.String()
+
+	if render == "html" {
+		doc := markdown.RenderFormat(note.Format, note.Text)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// Фрагмент предназначен для вставки в страницу клиента; если его откроют напрямую, скрипты запрещены.
+		w.Header().Set("Content-Security-Policy", renderedNoteCSP)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write([]byte(doc.TOC() + doc.HTML))
 		return
 	}
 
-	// Удаляем заметку из базы данных, если она принадлежит указанному пользователю.
-	_, err = h.db.Exec(ctx, "DELETE FROM notes WHERE id=$1 AND user_id=$2", noteID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// UpdateNote обрабатывает запрос на изменение текста заметки.
+// Изменять заметку может владелец и пользователи с ролью editor.
+// Необязательный параметр format меняет формат текста (plain или markdown).
+// Если передана базовая версия (base_version), изменение применяется, только если заметка
+// с тех пор не менялась; иначе возвращается 409 Conflict.
+func (h *NoteHandler) UpdateNote(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanWrite) {
+		return
+	}
+
+	var baseVersion *int
+	if v := r.FormValue("base_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid base_version", http.StatusBadRequest)
+			return
+		}
+		baseVersion = &version
+	}
+
+	format := r.FormValue("format")
+	if format != "" && !markdown.ValidFormat(format) {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `UPDATE notes SET text=$1, format=COALESCE(NULLIF($4, ''), format)
+        WHERE id=$2 AND deleted_at IS NULL AND ($3::int IS NULL OR version=$3)`, r.FormValue("text"), noteID, baseVersion, format)
 	if err != nil {
-		// Если произошла ошибка при выполнении запроса, возвращаем ошибку 500.
-		http.Error(w, "Error deleting note", http.StatusInternalServerError)
+		http.Error(w, "Error updating note", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Note has been changed", http.StatusConflict)
 		return
 	}
 
-	// Отправляем клиенту сообщение об успешном удалении заметки.
-	w.Write([]byte("Note deleted successfully"))
+	w.Write([]byte("Note updated successfully"))
+}
+
+// noteRequest определяет текущего пользователя и идентификатор заметки из пути запроса.
+// В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func (h *NoteHandler) noteRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) (userID, noteID int, ok bool) {
+	return noteRequest(ctx, h.db, w, r)
+}
+
+// authorize проверяет, что уровень доступа пользователя к заметке удовлетворяет условию allowed.
+// В случае отказа отправляет ответ клиенту и возвращает false.
+func (h *NoteHandler) authorize(ctx context.Context, w http.ResponseWriter, userID, noteID int, allowed func(authz.Access) bool) bool {
+	_, ok := h.access(ctx, w, userID, noteID, allowed)
+	return ok
+}
+
+// access возвращает уровень доступа пользователя к заметке, если он удовлетворяет условию allowed.
+func (h *NoteHandler) access(ctx context.Context, w http.ResponseWriter, userID, noteID int, allowed func(authz.Access) bool) (authz.Access, bool) {
+	return noteAccess(ctx, h.authz, w, userID, noteID, allowed)
+}
+
+// noteRequest определяет текущего пользователя и идентификатор заметки из пути запроса.
+// В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func noteRequest(ctx context.Context, db database.Database, w http.ResponseWriter, r *http.Request) (userID, noteID int, ok bool) {
+	noteID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	err = db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return userID, noteID, true
+}
+
+// noteAccess возвращает уровень доступа пользователя к заметке, если он удовлетворяет условию allowed.
+// Если доступа к заметке нет совсем, отвечает 404, чтобы не раскрывать ее существование;
+// если доступ есть, но недостаточный, отвечает 403.
+func noteAccess(ctx context.Context, az *authz.Authorizer, w http.ResponseWriter, userID, noteID int, allowed func(authz.Access) bool) (authz.Access, bool) {
+	access, err := az.NoteAccess(ctx, userID, noteID)
+	if err == authz.ErrNotFound || (err == nil && access == authz.AccessNone) {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return access, false
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return access, false
+	}
+	if !allowed(access) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return access, false
+	}
+	return access, true
 }
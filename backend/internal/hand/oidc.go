@@ -0,0 +1,401 @@
+package hand
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// purposeOIDCState - назначение токена, хранящего параметры входа через провайдер в cookie.
+	purposeOIDCState = "oidc_state"
+	// oidcStateCookie - имя cookie с параметрами входа через провайдер.
+	oidcStateCookie = "oidc_state"
+	// oidcStateTTL - время, за которое пользователь должен завершить вход у провайдера.
+	oidcStateTTL = 10 * time.Minute
+)
+
+// usernameInvalidChars - символы, недопустимые в именах пользователей, создаваемых автоматически.
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// oidcStateClaims - полезная нагрузка cookie с параметрами входа через провайдер.
+// Cookie подписана тем же ключом, что и сессии, поэтому клиент не может ее подменить.
+type oidcStateClaims struct {
+	Claims
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// Identity описывает привязку пользователя к учетной записи внешнего провайдера.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCHandler обрабатывает вход через внешних провайдеров OpenID Connect.
+type OIDCHandler struct {
+	db        database.Database
+	auth      *Auth
+	providers map[string]*oidc.Provider
+	logger    *logger.Logger
+}
+
+// NewOIDCHandler создает новый экземпляр OIDCHandler с заданными провайдерами.
+func NewOIDCHandler(db database.Database, auth *Auth, providers map[string]*oidc.Provider, logger *logger.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		db:        db,
+		auth:      auth,
+		providers: providers,
+		logger:    logger,
+	}
+}
+
+// Login начинает вход через провайдер: сохраняет state, nonce и PKCE verifier в подписанной cookie
+// и перенаправляет пользователя на страницу входа провайдера.
+// С параметром link=1 вход привязывает учетную запись провайдера к текущему пользователю.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	providerName := r.URL.Query().Get("provider")
+	provider, ok := h.providers[providerName]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	// Для привязки учетной записи пользователь должен быть уже авторизован.
+	var linkUsername string
+	if r.URL.Query().Get("link") == "1" {
+		cookie, err := r.Cookie("token")
+		session := &Claims{}
+		if err != nil || h.auth.parseToken(cookie.Value, session) != nil || session.Purpose != "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		linkUsername = session.Username
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		h.logger.Error("OIDC discovery failed", "provider", providerName, "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	expires := time.Now().Add(oidcStateTTL)
+	stateToken, err := h.auth.signToken(&oidcStateClaims{
+		Claims: Claims{
+			Username: linkUsername,
+			Purpose:  purposeOIDCState,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(expires),
+			},
+		},
+		Provider: providerName,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+	})
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// SameSite=Lax позволяет cookie вернуться при перенаправлении от провайдера.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/auth/oidc",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback завершает вход через провайдер: проверяет state, обменивает код на ID токен,
+// находит, привязывает или создает пользователя и выдает ту же сессию, что и Login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	// Cookie с параметрами входа одноразовая, удаляем ее в любом случае.
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+	stored := &oidcStateClaims{}
+	if err != nil || h.auth.parseToken(cookie.Value, stored) != nil || stored.Purpose != purposeOIDCState {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(stored.State)) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+	if errCode := q.Get("error"); errCode != "" {
+		http.Error(w, "Login rejected by identity provider: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	provider, ok := h.providers[stored.Provider]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	claims, err := provider.Exchange(ctx, q.Get("code"), stored.Verifier, stored.Nonce)
+	if err != nil {
+		h.logger.Error("OIDC code exchange failed", "provider", stored.Provider, "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	username, err := h.resolveUser(ctx, stored.Provider, provider, claims, stored.Username)
+	if err != nil {
+		if err == errNoLinkedAccount {
+			http.Error(w, "No account is linked to this identity", http.StatusForbidden)
+			return
+		}
+		if err == errIdentityLinkedElsewhere {
+			http.Error(w, "This identity is linked to another account", http.StatusConflict)
+			return
+		}
+		h.logger.Error("OIDC user resolution failed", "provider", stored.Provider, "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Второй фактор в этом случае проверяет провайдер, поэтому сессия выдается сразу,
+	// если вход в учетную запись не запрещен администратором.
+	if status, msg := h.auth.issueSession(ctx, w, username); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"username": username})
+}
+
+// GetIdentities возвращает учетные записи провайдеров, привязанные к текущему пользователю.
+func (h *OIDCHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `SELECT i.provider, i.subject, COALESCE(i.email, ''), i.created_at
+        FROM user_identities i JOIN users u ON u.id = i.user_id
+        WHERE u.username=$1 ORDER BY i.created_at`, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		identities = append(identities, i)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// DeleteIdentity отвязывает учетную запись провайдера от текущего пользователя.
+func (h *OIDCHandler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := h.db.Exec(ctx, `DELETE FROM user_identities
+        WHERE provider=$1 AND user_id=(SELECT id FROM users WHERE username=$2)`,
+		mux.Vars(r)["provider"], r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Identity not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Identity unlinked successfully"))
+}
+
+// errNoLinkedAccount возвращается, если учетная запись провайдера не привязана и не может быть создана.
+var errNoLinkedAccount = errors.New("no linked account")
+
+// errIdentityLinkedElsewhere возвращается при попытке привязать учетную запись провайдера, уже привязанную к другому пользователю.
+var errIdentityLinkedElsewhere = errors.New("identity linked to another account")
+
+// resolveUser определяет локального пользователя для учетной записи провайдера. Порядок:
+// существующая привязка, явная привязка к текущему пользователю, привязка по подтвержденному email
+// (если разрешена) и создание нового пользователя (если разрешено).
+func (h *OIDCHandler) resolveUser(ctx context.Context, providerName string, provider *oidc.Provider, claims *oidc.IDClaims, linkUsername string) (string, error) {
+	cfg := provider.Config()
+
+	// Учетная запись провайдера уже привязана.
+	var username string
+	err := h.db.QueryRow(ctx, `SELECT u.username FROM user_identities i JOIN users u ON u.id = i.user_id
+        WHERE i.provider=$1 AND i.subject=$2`, providerName, claims.Subject).Scan(&username)
+	if err == nil {
+		if linkUsername != "" && linkUsername != username {
+			return "", errIdentityLinkedElsewhere
+		}
+		return username, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// Явная привязка к текущему пользователю.
+	var userID int
+	if linkUsername != "" {
+		if err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", linkUsername).Scan(&userID); err != nil {
+			return "", err
+		}
+		return linkUsername, h.link(ctx, userID, providerName, claims)
+	}
+
+	// Привязка к существующему пользователю по email, подтвержденному и провайдером, и у нас.
+	if cfg.LinkByEmail && claims.EmailVerified && claims.Email != "" {
+		err := h.db.QueryRow(ctx, "SELECT id, username FROM users WHERE lower(email)=lower($1) AND email_verified",
+			claims.Email).Scan(&userID, &username)
+		if err == nil {
+			return username, h.link(ctx, userID, providerName, claims)
+		} else if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+
+	if !cfg.AutoProvision {
+		return "", errNoLinkedAccount
+	}
+	return h.provision(ctx, providerName, claims)
+}
+
+// link сохраняет привязку учетной записи провайдера к пользователю.
+func (h *OIDCHandler) link(ctx context.Context, userID int, providerName string, claims *oidc.IDClaims) error {
+	_, err := h.db.Exec(ctx, `INSERT INTO user_identities (user_id, provider, subject, email)
+        VALUES ($1, $2, $3, NULLIF($4, ''))`, userID, providerName, claims.Subject, claims.Email)
+	return err
+}
+
+// provision создает нового пользователя для учетной записи провайдера (JIT provisioning).
+// Пароль пользователя случайный и неизвестен ему: входить он будет через провайдер
+// или установит пароль через восстановление по email.
+func (h *OIDCHandler) provision(ctx context.Context, providerName string, claims *oidc.IDClaims) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	// Email сохраняется, только если провайдер его подтвердил и он не занят другим пользователем.
+	email := ""
+	if claims.EmailVerified {
+		email, _ = normalizeEmail(claims.Email)
+	}
+	if email != "" {
+		var taken bool
+		if err := h.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE lower(email)=$1)", email).Scan(&taken); err != nil {
+			return "", err
+		}
+		if taken {
+			email = ""
+		}
+	}
+
+	base := provisionedUsername(claims)
+	for attempt := 0; attempt < 10; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := randomToken(3)
+			if err != nil {
+				return "", err
+			}
+			username = truncate(base, 40) + "-" + strings.ToLower(usernameInvalidChars.ReplaceAllString(suffix, ""))
+		}
+
+		var userID int
+		err = h.db.QueryRow(ctx, `INSERT INTO users (username, password, email, email_verified)
+            VALUES ($1, $2, NULLIF($3, ''), $3 <> '')
+            ON CONFLICT (username) DO NOTHING RETURNING id`,
+			username, string(hashedPassword), email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			// Имя занято, пробуем с другим суффиксом.
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if err := h.link(ctx, userID, providerName, claims); err != nil {
+			return "", err
+		}
+		h.logger.Info("Provisioned user from identity provider", "provider", providerName, "username", username)
+		return username, nil
+	}
+	return "", fmt.Errorf("could not find a free username for %q", base)
+}
+
+// provisionedUsername выбирает имя нового пользователя по утверждениям ID токена.
+func provisionedUsername(claims *oidc.IDClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" && claims.Email != "" {
+		candidate = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	candidate = strings.Trim(usernameInvalidChars.ReplaceAllString(candidate, "-"), "-.")
+	if candidate == "" {
+		candidate = "user"
+	}
+	return truncate(candidate, 50)
+}
+
+// truncate обрезает строку до n байт.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
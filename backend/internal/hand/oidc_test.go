@@ -0,0 +1,29 @@
+package hand
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/oidc"
+)
+
+func TestProvisionedUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims oidc.IDClaims
+		want   string
+	}{
+		{"preferred username", oidc.IDClaims{PreferredUsername: "alice", Email: "a.smith@example.com"}, "alice"},
+		{"email local part", oidc.IDClaims{Email: "a.smith@example.com"}, "a.smith"},
+		{"invalid characters", oidc.IDClaims{PreferredUsername: "Alice Smith/админ"}, "Alice-Smith"},
+		{"trimmed separators", oidc.IDClaims{PreferredUsername: "..alice--"}, "alice"},
+		{"only invalid characters", oidc.IDClaims{PreferredUsername: "Алиса"}, "user"},
+		{"no claims", oidc.IDClaims{}, "user"},
+		{"long", oidc.IDClaims{PreferredUsername: strings.Repeat("a", 80)}, strings.Repeat("a", 50)},
+	}
+	for _, tt := range tests {
+		if got := provisionedUsername(&tt.claims); got != tt.want {
+			t.Errorf("%s: provisionedUsername = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package hand
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/mailer"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Назначения одноразовых токенов пользователей и время их жизни.
+const (
+	tokenPasswordReset = "password_reset"
+	tokenEmailVerify   = "email_verify"
+
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+)
+
+// Задания отправки писем. Повторная попытка выпускает новый токен, а токены неудачных
+// попыток просто истекают, поэтому число попыток ограничено.
+var (
+	passwordResetTask = jobs.Task[passwordResetJob]{Kind: "email.password_reset", MaxAttempts: 5, Timeout: 30 * time.Second}
+	verificationTask  = jobs.Task[verificationJob]{Kind: "email.verification", MaxAttempts: 5, Timeout: 30 * time.Second}
+)
+
+// passwordResetJob - параметры задания отправки письма для сброса пароля.
+type passwordResetJob struct {
+	Email string `json:"email"`
+}
+
+// verificationJob - параметры задания отправки письма для подтверждения email.
+type verificationJob struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// Ответ на запрос восстановления пароля. Он одинаков независимо от того,
+// существует ли учетная запись, чтобы по нему нельзя было перебирать адреса.
+const forgotPasswordResponse = "If an account with this email exists, a password reset link has been sent"
+
+// ForgotPassword обрабатывает запрос на восстановление пароля по email.
+// Ответ не зависит от существования учетной записи, а поиск пользователя и отправка
+// письма выполняются в фоновом задании, чтобы время ответа также ничего не раскрывало.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	email, err := normalizeEmail(r.FormValue("email"))
+	if err != nil || email == "" {
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return
+	}
+
+	if err := EnqueuePasswordReset(ctx, h.queue, email); err != nil {
+		h.logger.Error("Failed to enqueue password reset email", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte(forgotPasswordResponse))
+}
+
+// EnqueuePasswordReset ставит в очередь отправку письма со ссылкой для сброса пароля
+// пользователю с адресом email. Если такого пользователя нет, письмо не отправляется.
+func EnqueuePasswordReset(ctx context.Context, queue *jobs.Queue, email string) error {
+	_, err := passwordResetTask.Enqueue(ctx, queue, passwordResetJob{Email: email})
+	return err
+}
+
+// ResetPassword обрабатывает запрос на установку нового пароля по токену из письма.
+// Токен одноразовый: после использования он и все остальные токены сброса пользователя становятся недействительными.
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	if password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	// Хэшируем новый пароль до использования токена, чтобы ошибка хэширования не «сжигала» токен.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := h.consumeUserToken(ctx, token, tokenPasswordReset)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Письмо со ссылкой дошло до пользователя, поэтому адрес можно считать подтвержденным.
+	// Новый пароль снимает запрет входа, установленный администратором, и отзывает все выданные сессии,
+	// в том числе сессии того, кто узнал старый пароль.
+	_, err = h.db.Exec(ctx, `UPDATE users SET password=$1, email_verified=TRUE, password_reset_required=FALSE,
+        sessions_revoked_at=now() WHERE id=$2`, string(hashedPassword), userID)
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	// Инвалидируем остальные неиспользованные токены сброса пароля.
+	if err := h.revokeUserTokens(ctx, userID, tokenPasswordReset); err != nil {
+		h.logger.Error("Failed to revoke password reset tokens", "user_id", userID, "error", err)
+	}
+
+	w.Write([]byte("Password reset successfully"))
+}
+
+// VerifyEmail подтверждает адрес электронной почты по токену из письма.
+// Принимает токен как из параметров URL (переход по ссылке), так и из формы.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, err := h.consumeUserToken(ctx, r.FormValue("token"), tokenEmailVerify)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec(ctx, "UPDATE users SET email_verified=TRUE WHERE id=$1 AND email IS NOT NULL", userID)
+	if err != nil {
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Email verified successfully"))
+}
+
+// SetEmail устанавливает или меняет email текущего пользователя.
+// Новый адрес считается неподтвержденным, на него отправляется письмо для подтверждения.
+func (h *UserHandler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := r.Header.Get("username")
+	email, err := normalizeEmail(r.FormValue("email"))
+	if err != nil || email == "" {
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	err = h.db.QueryRow(ctx, "UPDATE users SET email=$1, email_verified=FALSE WHERE username=$2 RETURNING id",
+		email, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		// Чаще всего ошибка означает, что адрес уже занят другим пользователем.
+		http.Error(w, "Error updating email", http.StatusConflict)
+		return
+	}
+
+	// Токены, выданные для прежнего адреса, больше не должны его подтверждать.
+	if err := h.revokeUserTokens(ctx, userID, tokenEmailVerify); err != nil {
+		h.logger.Error("Failed to revoke email verification tokens", "user_id", userID, "error", err)
+	}
+	if err := h.enqueueVerification(ctx, userID, email); err != nil {
+		h.logger.Error("Failed to enqueue verification email", "user_id", userID, "error", err)
+		http.Error(w, "Email updated, but verification could not be sent", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Email updated, verification sent"))
+}
+
+// ResendVerification повторно отправляет письмо для подтверждения email текущего пользователя.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := r.Header.Get("username")
+
+	var userID int
+	var email sql.NullString
+	var verified bool
+	err := h.db.QueryRow(ctx, "SELECT id, email, email_verified FROM users WHERE username=$1", username).
+		Scan(&userID, &email, &verified)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !email.Valid {
+		http.Error(w, "No email set", http.StatusBadRequest)
+		return
+	}
+	if verified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.enqueueVerification(ctx, userID, email.String); err != nil {
+		h.logger.Error("Failed to enqueue verification email", "user_id", userID, "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Verification sent"))
+}
+
+// enqueueVerification ставит в очередь отправку письма для подтверждения адреса email.
+// Пока предыдущее письмо пользователю не отправлено, новое задание не создается.
+func (h *UserHandler) enqueueVerification(ctx context.Context, userID int, email string) error {
+	_, err := verificationTask.Enqueue(ctx, h.queue, verificationJob{UserID: userID, Email: email},
+		jobs.Unique(strconv.Itoa(userID)+":"+email))
+	return err
+}
+
+// sendPasswordReset выпускает токен сброса пароля и отправляет его на email, если пользователь с таким адресом существует.
+// Выполняется в задании очереди.
+func (h *UserHandler) sendPasswordReset(ctx context.Context, job passwordResetJob) error {
+	var userID int
+	var username string
+	err := h.db.QueryRow(ctx, "SELECT id, username FROM users WHERE lower(email)=$1", job.Email).Scan(&userID, &username)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("look up user: %w", err)
+	}
+
+	token, err := h.issueUserToken(ctx, userID, tokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return fmt.Errorf("issue token: %w", err)
+	}
+
+	body := fmt.Sprintf("Hello, %s!\n\n"+
+		"Someone requested a password reset for your account. If it was you, send a POST request to\n"+
+		"%s/password/reset with the following token and your new password:\n\n%s\n\n"+
+		"The token is valid for %s. If you did not request a reset, ignore this email.\n",
+		username, h.baseURL, token, passwordResetTTL)
+	return h.mailer.Send(ctx, mailer.Message{To: job.Email, Subject: "Password reset", Body: body})
+}
+
+// sendVerification выпускает токен подтверждения email и отправляет ссылку на указанный адрес.
+// Выполняется в задании очереди. Если адрес пользователя с тех пор изменился или уже подтвержден,
+// письмо не отправляется.
+func (h *UserHandler) sendVerification(ctx context.Context, job verificationJob) error {
+	var current bool
+	err := h.db.QueryRow(ctx, "SELECT COALESCE(lower(email)=lower($2), FALSE) AND NOT email_verified FROM users WHERE id=$1",
+		job.UserID, job.Email).Scan(&current)
+	if err == sql.ErrNoRows || (err == nil && !current) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("look up user: %w", err)
+	}
+
+	token, err := h.issueUserToken(ctx, job.UserID, tokenEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return fmt.Errorf("issue token: %w", err)
+	}
+
+	link := h.baseURL + "/email/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Please confirm your email address by opening the link below:\n\n%s\n\n"+
+		"The link is valid for %s.\n", link, emailVerifyTTL)
+	return h.mailer.Send(ctx, mailer.Message{To: job.Email, Subject: "Confirm your email", Body: body})
+}
+
+// issueUserToken создает одноразовый токен с заданным назначением и временем жизни.
+// В базе данных сохраняется только хэш токена, сам токен возвращается для отправки пользователю.
+func (h *UserHandler) issueUserToken(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = h.db.Exec(ctx, "INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, purpose, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken атомарно помечает токен использованным и возвращает ID его владельца.
+// Если токен не найден, уже использован или истек, возвращается sql.ErrNoRows.
+func (h *UserHandler) consumeUserToken(ctx context.Context, token, purpose string) (int, error) {
+	if token == "" {
+		return 0, sql.ErrNoRows
+	}
+	var userID int
+	err := h.db.QueryRow(ctx, `UPDATE user_tokens SET used_at=now()
+        WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()
+        RETURNING user_id`, hashToken(token), purpose).Scan(&userID)
+	return userID, err
+}
+
+// revokeUserTokens помечает использованными все действующие токены пользователя с заданным назначением.
+func (h *UserHandler) revokeUserTokens(ctx context.Context, userID int, purpose string) error {
+	_, err := h.db.Exec(ctx, "UPDATE user_tokens SET used_at=now() WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL",
+		userID, purpose)
+	return err
+}
+
+// randomToken возвращает криптографически случайную строку из n байт в кодировке base64url.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken возвращает SHA-256 хэш токена в шестнадцатеричном виде.
+// Токены имеют высокую энтропию, поэтому медленный хэш вроде bcrypt для них не нужен.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
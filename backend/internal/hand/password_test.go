@@ -0,0 +1,42 @@
+package hand
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestRandomToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := randomToken(32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil || len(b) != 32 {
+			t.Fatalf("randomToken(32) = %q: %d bytes, %v", token, len(b), err)
+		}
+		if seen[token] {
+			t.Fatalf("randomToken returned %q twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	for _, tt := range tests {
+		if got := hashToken(tt.token); got != tt.want {
+			t.Errorf("hashToken(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+	if hashToken("token-a") == hashToken("token-b") {
+		t.Error("different tokens have the same hash")
+	}
+}
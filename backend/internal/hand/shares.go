@@ -0,0 +1,168 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GrantShare предоставляет другому пользователю доступ к заметке.
+// Принимает имя пользователя (username) и роль (role): viewer или editor.
+// Повторный вызов для того же пользователя меняет его роль. Доступно только владельцу заметки.
+func (h *NoteHandler) GrantShare(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanManage) {
+		return
+	}
+
+	role := r.FormValue("role")
+	if !authz.ValidShareRole(role) {
+		http.Error(w, "Role must be viewer or editor", http.StatusBadRequest)
+		return
+	}
+
+	var targetID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.FormValue("username")).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if targetID == userID {
+		http.Error(w, "Cannot share a note with its owner", http.StatusBadRequest)
+		return
+	}
+
+	share := models.NoteShare{NoteID: noteID, Username: r.FormValue("username"), Role: role}
+	err = h.db.QueryRow(ctx, `INSERT INTO note_shares (note_id, user_id, role) VALUES ($1, $2, $3)
+        ON CONFLICT (note_id, user_id) DO UPDATE SET role = EXCLUDED.role
+        RETURNING created_at`, noteID, targetID, role).Scan(&share.CreatedAt)
+	if err != nil {
+		http.Error(w, "Error sharing note", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+// GetShares возвращает список пользователей, которым предоставлен доступ к заметке.
+// Доступно всем, кто может читать заметку.
+func (h *NoteHandler) GetShares(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanRead) {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT s.note_id, u.username, s.role, s.created_at
+        FROM note_shares s JOIN users u ON u.id = s.user_id
+        WHERE s.note_id=$1 ORDER BY s.created_at`, noteID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	shares := []models.NoteShare{}
+	for rows.Next() {
+		var s models.NoteShare
+		if err := rows.Scan(&s.NoteID, &s.Username, &s.Role, &s.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		shares = append(shares, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// UpdateShare меняет роль пользователя, которому предоставлен доступ к заметке.
+// Доступно только владельцу заметки.
+func (h *NoteHandler) UpdateShare(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !h.authorize(ctx, w, userID, noteID, authz.Access.CanManage) {
+		return
+	}
+
+	role := r.FormValue("role")
+	if !authz.ValidShareRole(role) {
+		http.Error(w, "Role must be viewer or editor", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `UPDATE note_shares SET role=$1
+        WHERE note_id=$2 AND user_id=(SELECT id FROM users WHERE username=$3)`,
+		role, noteID, mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Share updated successfully"))
+}
+
+// RevokeShare отзывает доступ пользователя к заметке.
+// Отозвать доступ может владелец заметки, а пользователь - отказаться от предоставленного ему доступа.
+func (h *NoteHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, noteID, ok := h.noteRequest(ctx, w, r)
+	if !ok {
+		return
+	}
+	username := mux.Vars(r)["username"]
+	allowed := authz.Access.CanManage
+	if username == r.Header.Get("username") {
+		allowed = authz.Access.CanRead
+	}
+	if !h.authorize(ctx, w, userID, noteID, allowed) {
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `DELETE FROM note_shares
+        WHERE note_id=$1 AND user_id=(SELECT id FROM users WHERE username=$2)`, noteID, username)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Share revoked successfully"))
+}
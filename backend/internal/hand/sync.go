@@ -0,0 +1,332 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+)
+
+const (
+	// syncDefaultLimit и syncMaxLimit - размер страницы ленты изменений по умолчанию и максимальный.
+	syncDefaultLimit = 500
+	syncMaxLimit     = 1000
+	// syncMaxMutations - максимальное число изменений в одном запросе POST /sync.
+	syncMaxMutations = 500
+	// syncMaxBody - максимальный размер тела запроса POST /sync.
+	syncMaxBody = 5 << 20
+	// syncMaxClientRef - максимальная длина идентификатора заметки, присвоенного клиентом.
+	syncMaxClientRef = 64
+)
+
+// syncVisible - условие видимости заметки пользователю $1 в ленте изменений: личные заметки,
+// заметки, к которым предоставлен доступ, и заметки рабочих пространств, где он участник.
+// Запрос должен содержать соединения s (note_shares) и m (workspace_members) для пользователя $1.
+const syncVisible = "((n.workspace_id IS NULL AND n.user_id=$1) OR s.user_id IS NOT NULL OR m.user_id IS NOT NULL)"
+
+// syncResponse - ответ ленты изменений. Token передается в следующем запросе как since;
+// если More равен true, изменения получены не все, и запрос нужно повторить сразу.
+type syncResponse struct {
+	Changes []models.SyncChange `json:"changes"`
+	Token   string              `json:"token"`
+	More    bool                `json:"more"`
+}
+
+// GetSync возвращает изменения видимых пользователю заметок, в том числе удаления (tombstones),
+// произошедшие после токена синхронизации since. Потеря доступа к заметке тоже отдается как ее удаление. Без since возвращаются все заметки, кроме удаленных.
+// Токен - номер последнего изменения, которое гарантированно зафиксировано, поэтому лента
+// не пропускает изменения, сделанные параллельно с запросом. Размер страницы задается параметром limit.
+// Если токен старше окончательно удаленных из корзины заметок, возвращается 410 Gone.
+func (h *NoteHandler) GetSync(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid sync token", http.StatusBadRequest)
+			return
+		}
+	}
+	// Удаленные заметки старше срока хранения корзины удаляются окончательно, и по слишком старому
+	// токену клиент не узнал бы об их удалении: он должен синхронизироваться заново без since.
+	if since > 0 {
+		var horizon int64
+		if err := h.db.QueryRow(ctx, "SELECT change_seq FROM sync_horizon").Scan(&horizon); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if since < horizon {
+			http.Error(w, "Sync token expired, full sync required", http.StatusGone)
+			return
+		}
+	}
+	limit := syncDefaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > syncMaxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Токен вычисляется до чтения изменений: все изменения с номером не больше него уже зафиксированы.
+	var token int64
+	if err := h.db.QueryRow(ctx, "SELECT notes_sync_token()").Scan(&token); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Кроме изменений самих заметок лента содержит изменения доступа пользователя к ним (note_access_changes):
+	// заметка, которая стала видна, отдается целиком, а заметка, доступ к которой потерян, - как удаленная.
+	// Видимость проверяется на момент запроса, поэтому текст заметки не попадает к тому, кто потерял доступ.
+	rows, err := h.db.Query(ctx, `SELECT n.id, n.text, n.format, n.version, n.workspace_id, COALESCE(n.client_ref, ''),
+            n.deleted_at IS NOT NULL OR NOT `+syncVisible+`, n.updated_at, c.change_seq
+        FROM (
+            SELECT n.id, n.change_seq FROM notes n
+            LEFT JOIN note_shares s ON s.note_id = n.id AND s.user_id = $1
+            LEFT JOIN workspace_members m ON m.workspace_id = n.workspace_id AND m.user_id = $1
+            WHERE n.change_seq > $2 AND n.change_seq <= $3 AND `+syncVisible+`
+            AND (n.deleted_at IS NULL OR $2 > 0)
+            UNION ALL
+            SELECT a.note_id, a.change_seq FROM note_access_changes a
+            WHERE a.user_id = $1 AND a.change_seq > $2 AND a.change_seq <= $3 AND $2 > 0
+        ) c
+        JOIN notes n ON n.id = c.id
+        LEFT JOIN note_shares s ON s.note_id = n.id AND s.user_id = $1
+        LEFT JOIN workspace_members m ON m.workspace_id = n.workspace_id AND m.user_id = $1
+        ORDER BY c.change_seq LIMIT $4`, userID, since, token, limit+1)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp := syncResponse{Changes: []models.SyncChange{}, Token: strconv.FormatInt(token, 10)}
+	var lastSeq int64
+	for rows.Next() {
+		if len(resp.Changes) == limit {
+			// Страница заполнена: следующий запрос продолжит после последнего отданного изменения.
+			resp.More = true
+			resp.Token = strconv.FormatInt(lastSeq, 10)
+			break
+		}
+
+		var c models.SyncChange
+		var workspaceID sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.Text, &c.Format, &c.Version, &workspaceID, &c.ClientRef, &c.Deleted, &c.UpdatedAt, &lastSeq); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if workspaceID.Valid {
+			id := int(workspaceID.Int64)
+			c.WorkspaceID = &id
+		}
+		if c.Deleted {
+			c.Text, c.Format = "", ""
+		}
+		resp.Changes = append(resp.Changes, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// syncRequest - тело запроса POST /sync.
+type syncRequest struct {
+	Mutations []models.SyncMutation `json:"mutations"`
+}
+
+// syncResult - ответ POST /sync: результаты по каждому изменению в порядке их передачи и новый токен синхронизации.
+type syncResult struct {
+	Results []models.SyncResult `json:"results"`
+	Token   string              `json:"token"`
+}
+
+// PostSync применяет пакет изменений, сделанных клиентом офлайн. Изменения применяются по отдельности:
+// изменение поверх устаревшей версии заметки не применяется и возвращается как conflict вместе с текущим
+// состоянием заметки, остальные изменения пакета это не затрагивает. Заметки, созданные через синхронизацию,
+// не проходят проверку орфографии, чтобы текст на сервере совпадал с текстом на устройстве.
+func (h *NoteHandler) PostSync(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req syncRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, syncMaxBody)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Mutations) > syncMaxMutations {
+		http.Error(w, "Too many mutations", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := syncResult{Results: make([]models.SyncResult, 0, len(req.Mutations))}
+	for i, m := range req.Mutations {
+		res, err := h.applyMutation(ctx, userID, m)
+		if err != nil {
+			h.logger.Error("Failed to apply sync mutation", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		res.Index = i
+		resp.Results = append(resp.Results, res)
+	}
+
+	var token int64
+	if err := h.db.QueryRow(ctx, "SELECT notes_sync_token()").Scan(&token); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	resp.Token = strconv.FormatInt(token, 10)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// applyMutation применяет одно изменение клиента. Ошибка возвращается только при сбое базы данных;
+// отказ в применении описывается статусом результата.
+func (h *NoteHandler) applyMutation(ctx context.Context, userID int, m models.SyncMutation) (models.SyncResult, error) {
+	res := models.SyncResult{ID: m.ID, ClientRef: m.ClientRef}
+	if m.Format != "" && !markdown.ValidFormat(m.Format) {
+		res.Status, res.Error = "invalid", "unknown format"
+		return res, nil
+	}
+	switch m.Op {
+	case "create":
+		return h.syncCreate(ctx, userID, m)
+	case "update", "delete":
+	default:
+		res.Status, res.Error = "invalid", "unknown op"
+		return res, nil
+	}
+
+	access, err := h.authz.NoteAccess(ctx, userID, m.ID)
+	if err == authz.ErrNotFound || (err == nil && access == authz.AccessNone) {
+		res.Status = "not_found"
+		return res, nil
+	} else if err != nil {
+		return res, err
+	}
+
+	var query string
+	var args []interface{}
+	if m.Op == "update" {
+		if !access.CanWrite() {
+			res.Status = "forbidden"
+			return res, nil
+		}
+		query = `UPDATE notes SET text=$3, format=COALESCE(NULLIF($4, ''), format)
+            WHERE id=$1 AND version=$2 AND deleted_at IS NULL RETURNING version`
+		args = []interface{}{m.ID, m.BaseVersion, m.Text, m.Format}
+	} else {
+		if !access.CanManage() {
+			res.Status = "forbidden"
+			return res, nil
+		}
+		query = "UPDATE notes SET deleted_at=now() WHERE id=$1 AND version=$2 AND deleted_at IS NULL RETURNING version"
+		args = []interface{}{m.ID, m.BaseVersion}
+	}
+
+	err = h.db.QueryRow(ctx, query, args...).Scan(&res.Version)
+	if err == sql.ErrNoRows {
+		// Заметка изменилась после базовой версии клиента: возвращаем ее текущее состояние.
+		current, err := h.syncChange(ctx, m.ID)
+		if err != nil {
+			return res, err
+		}
+		res.Status = "conflict"
+		res.Version = current.Version
+		res.Current = current
+		return res, nil
+	} else if err != nil {
+		return res, err
+	}
+	res.Status = "applied"
+	return res, nil
+}
+
+// syncCreate создает заметку из изменения клиента. Повторная отправка с тем же client_ref
+// не создает новую заметку, а возвращает созданную ранее.
+func (h *NoteHandler) syncCreate(ctx context.Context, userID int, m models.SyncMutation) (models.SyncResult, error) {
+	res := models.SyncResult{ClientRef: m.ClientRef}
+	if len(m.ClientRef) > syncMaxClientRef {
+		res.Status, res.Error = "invalid", "client_ref is too long"
+		return res, nil
+	}
+	if m.WorkspaceID != nil {
+		role, err := h.authz.WorkspaceRole(ctx, userID, *m.WorkspaceID)
+		if err == authz.ErrNotFound || (err == nil && role == "") {
+			res.Status = "not_found"
+			return res, nil
+		} else if err != nil {
+			return res, err
+		}
+		if !authz.WorkspaceRoleAtLeast(role, authz.WorkspaceEditor) {
+			res.Status = "forbidden"
+			return res, nil
+		}
+	}
+
+	var clientRef *string
+	if m.ClientRef != "" {
+		clientRef = &m.ClientRef
+	}
+	format := m.Format
+	if format == "" {
+		format = markdown.FormatPlain
+	}
+	err := h.db.QueryRow(ctx, `INSERT INTO notes (user_id, workspace_id, text, format, client_ref) VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id, client_ref) DO NOTHING
+        RETURNING id, version`, userID, m.WorkspaceID, m.Text, format, clientRef).Scan(&res.ID, &res.Version)
+	if err == sql.ErrNoRows {
+		// Заметка с этим client_ref уже создана предыдущей отправкой.
+		err = h.db.QueryRow(ctx, "SELECT id, version FROM notes WHERE user_id=$1 AND client_ref=$2",
+			userID, m.ClientRef).Scan(&res.ID, &res.Version)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.Status = "applied"
+	return res, nil
+}
+
+// syncChange возвращает текущее состояние заметки для ответа о конфликте.
+func (h *NoteHandler) syncChange(ctx context.Context, noteID int) (*models.SyncChange, error) {
+	c := &models.SyncChange{}
+	var workspaceID sql.NullInt64
+	err := h.db.QueryRow(ctx, `SELECT id, text, format, version, workspace_id, COALESCE(client_ref, ''), deleted_at IS NOT NULL, updated_at
+        FROM notes WHERE id=$1`, noteID).Scan(&c.ID, &c.Text, &c.Format, &c.Version, &workspaceID, &c.ClientRef, &c.Deleted, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if workspaceID.Valid {
+		id := int(workspaceID.Int64)
+		c.WorkspaceID = &id
+	}
+	if c.Deleted {
+		c.Text, c.Format = "", ""
+	}
+	return c, nil
+}
@@ -0,0 +1,380 @@
+package hand
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// purposeTwoFactor - назначение challenge-токена, выдаваемого после проверки пароля.
+	purposeTwoFactor = "2fa"
+	// twoFactorChallengeTTL - время, за которое нужно ввести TOTP-код после ввода пароля.
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorMaxAttempts - число попыток ввести код по одному challenge-токену.
+	twoFactorMaxAttempts = 5
+	// twoFactorMaxFailures - число неверных кодов за twoFactorFailureWindow, после которого
+	// пользователю не выдаются новые challenge-токены до конца окна.
+	twoFactorMaxFailures   = 20
+	twoFactorFailureWindow = 15 * time.Minute
+	// totpIssuer - название сервиса, отображаемое в приложении-аутентификаторе.
+	totpIssuer = "NotesApp"
+	// totpSkew - допустимое расхождение часов в шагах по 30 секунд.
+	totpSkew = 1
+	// recoveryCodeCount - количество кодов восстановления, выдаваемых пользователю.
+	recoveryCodeCount = 10
+)
+
+// twoFactorState содержит данные двухфакторной аутентификации пользователя.
+type twoFactorState struct {
+	userID        int
+	password      string
+	enabled       bool
+	secret        sql.NullString
+	pendingSecret sql.NullString
+	lastStep      int64
+}
+
+// issueTwoFactorChallenge выдает challenge-токен для второго шага входа и сохраняет его jti:
+// по токену можно войти один раз и ввести не больше twoFactorMaxAttempts кодов. Если за последние
+// twoFactorFailureWindow введено слишком много неверных кодов, токен не выдается и возвращается 429.
+func (h *UserHandler) issueTwoFactorChallenge(ctx context.Context, w http.ResponseWriter, userID int, username string) {
+	var failures int
+	err := h.db.QueryRow(ctx, `SELECT COALESCE(sum(attempts), 0) FROM two_factor_challenges
+        WHERE user_id=$1 AND used_at IS NULL AND created_at > now() - make_interval(secs => $2)`,
+		userID, twoFactorFailureWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if failures >= twoFactorMaxFailures {
+		http.Error(w, "Too many failed two-factor attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	claims := &Claims{
+		Username: username,
+		Purpose:  purposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeTTL)),
+		},
+	}
+	challenge, err := h.auth.signToken(claims)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	// Вместе с новым challenge удаляются записи пользователя, которые уже не учитываются в окне неудач.
+	_, err = h.db.Exec(ctx, `WITH stale AS (
+            DELETE FROM two_factor_challenges
+            WHERE user_id=$2 AND created_at < now() - make_interval(secs => $4)
+        )
+        INSERT INTO two_factor_challenges (jti, user_id, expires_at) VALUES ($1, $2, $3)`,
+		claims.ID, userID, claims.ExpiresAt.Time, twoFactorFailureWindow.Seconds())
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+	})
+}
+
+// LoginTwoFactor завершает вход пользователя с включенной двухфакторной аутентификацией.
+// Принимает challenge-токен, выданный Login, и TOTP-код (code) или код восстановления (recovery_code).
+// Challenge-токен одноразовый, а после twoFactorMaxAttempts неверных кодов перестает приниматься.
+func (h *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Проверяем challenge-токен: он должен быть действительным и выданным именно для второго шага входа.
+	claims := &Claims{}
+	if err := h.auth.parseToken(r.FormValue("challenge_token"), claims); err != nil || claims.Purpose != purposeTwoFactor {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	// Попытка засчитывается до проверки кода, поэтому параллельные запросы не обходят ограничение.
+	var userID int
+	err := h.db.QueryRow(ctx, `UPDATE two_factor_challenges SET attempts = attempts + 1
+        WHERE jti=$1 AND used_at IS NULL AND expires_at > now() AND attempts < $2
+        RETURNING user_id`, claims.ID, twoFactorMaxAttempts).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	state, err := h.loadTwoFactor(ctx, claims.Username)
+	if err != nil || !state.enabled || state.userID != userID {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.verifySecondFactor(ctx, state, r.FormValue("code"), r.FormValue("recovery_code")) {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	// Отмечаем challenge использованным: вторая сессия по тому же токену не выдается.
+	res, err := h.db.Exec(ctx, "UPDATE two_factor_challenges SET used_at=now() WHERE jti=$1 AND used_at IS NULL", claims.ID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	// Учетную запись могли заблокировать, пока пользователь вводил код.
+	if status, msg := h.auth.issueSession(ctx, w, claims.Username); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// EnrollTwoFactor начинает подключение TOTP: генерирует новый секрет и возвращает otpauth URI.
+// Требует повторного ввода пароля. Если 2FA уже включена, дополнительно требуется действующий код,
+// а прежний секрет продолжает работать до подтверждения нового (сброс устройства).
+func (h *UserHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := r.Header.Get("username")
+	state, err := h.loadTwoFactor(ctx, username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.reauthenticate(ctx, state, r, state.enabled) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	_, err = h.db.Exec(ctx, "UPDATE users SET totp_pending_secret=$1 WHERE id=$2", secret, state.userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, username, secret),
+	})
+}
+
+// ConfirmTwoFactor завершает подключение TOTP: проверяет первый код от нового секрета,
+// включает двухфакторную аутентификацию и возвращает новые коды восстановления.
+func (h *UserHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	state, err := h.loadTwoFactor(ctx, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !state.pendingSecret.Valid {
+		http.Error(w, "Two-factor enrollment not started", http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Validate(state.pendingSecret.String, r.FormValue("code"), time.Now(), totpSkew)
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	// Новый секрет становится активным, использованный шаг запоминается для защиты от повтора.
+	_, err = h.db.Exec(ctx, `UPDATE users SET totp_secret=totp_pending_secret, totp_pending_secret=NULL,
+        totp_enabled=TRUE, totp_last_step=$1 WHERE id=$2`, step, state.userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := h.replaceRecoveryCodes(ctx, state.userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTwoFactor отключает двухфакторную аутентификацию.
+// Требует повторного ввода пароля и действующего TOTP-кода или кода восстановления.
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	state, err := h.loadTwoFactor(ctx, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !state.enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if !h.reauthenticate(ctx, state, r, true) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	_, err = h.db.Exec(ctx, `UPDATE users SET totp_enabled=FALSE, totp_secret=NULL, totp_pending_secret=NULL,
+        totp_last_step=0 WHERE id=$1`, state.userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", state.userID); err != nil {
+		h.logger.Error("Failed to delete recovery codes", "user_id", state.userID, "error", err)
+	}
+
+	w.Write([]byte("Two-factor authentication disabled"))
+}
+
+// RegenerateRecoveryCodes выпускает новый набор кодов восстановления взамен прежнего.
+// Требует повторного ввода пароля и действующего TOTP-кода или кода восстановления.
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	state, err := h.loadTwoFactor(ctx, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !state.enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if !h.reauthenticate(ctx, state, r, true) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := h.replaceRecoveryCodes(ctx, state.userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// loadTwoFactor загружает данные двухфакторной аутентификации пользователя по имени.
+func (h *UserHandler) loadTwoFactor(ctx context.Context, username string) (*twoFactorState, error) {
+	s := &twoFactorState{}
+	err := h.db.QueryRow(ctx, `SELECT id, password, totp_enabled, totp_secret, totp_pending_secret, totp_last_step
+        FROM users WHERE username=$1`, username).
+		Scan(&s.userID, &s.password, &s.enabled, &s.secret, &s.pendingSecret, &s.lastStep)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reauthenticate проверяет пароль из формы запроса и, если requireCode, второй фактор.
+// Используется для опасных операций, чтобы украденной сессии было недостаточно.
+func (h *UserHandler) reauthenticate(ctx context.Context, state *twoFactorState, r *http.Request, requireCode bool) bool {
+	if bcrypt.CompareHashAndPassword([]byte(state.password), []byte(r.FormValue("password"))) != nil {
+		return false
+	}
+	if !requireCode {
+		return true
+	}
+	return h.verifySecondFactor(ctx, state, r.FormValue("code"), r.FormValue("recovery_code"))
+}
+
+// verifySecondFactor проверяет TOTP-код или, если он не указан, код восстановления.
+// Каждый TOTP-код и код восстановления можно использовать только один раз.
+func (h *UserHandler) verifySecondFactor(ctx context.Context, state *twoFactorState, code, recoveryCode string) bool {
+	if code != "" {
+		if !state.secret.Valid {
+			return false
+		}
+		step, ok := totp.Validate(state.secret.String, code, time.Now(), totpSkew)
+		if !ok || step <= state.lastStep {
+			return false
+		}
+		// Атомарно запоминаем шаг, чтобы параллельный запрос с тем же кодом не прошел.
+		res, err := h.db.Exec(ctx, "UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1", step, state.userID)
+		if err != nil {
+			return false
+		}
+		n, err := res.RowsAffected()
+		return err == nil && n == 1
+	}
+
+	if recoveryCode != "" {
+		res, err := h.db.Exec(ctx, `UPDATE recovery_codes SET used_at=now()
+            WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, state.userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false
+		}
+		n, err := res.RowsAffected()
+		return err == nil && n == 1
+	}
+
+	return false
+}
+
+// replaceRecoveryCodes удаляет прежние коды восстановления пользователя и выпускает новые.
+// В базе данных хранятся только хэши кодов, сами коды показываются пользователю один раз.
+func (h *UserHandler) replaceRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	if _, err := h.db.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		// Код записывается в base32 в виде двух групп по 5 символов, чтобы его было удобно переписать.
+		enc := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		code := enc[:5] + "-" + enc[5:]
+		_, err := h.db.Exec(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode приводит код восстановления к каноническому виду: без дефисов, пробелов и в нижнем регистре.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,19 @@
+package hand
+
+import "testing"
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := map[string]string{
+		"abcd-efgh-ijkl":   "abcdefghijkl",
+		"ABCD-EFGH-IJKL":   "abcdefghijkl",
+		" abcd efgh ijkl ": "abcdefghijkl",
+		"abcdefghijkl":     "abcdefghijkl",
+		"ab-cd ef--gh":     "abcdefgh",
+		"":                 "",
+	}
+	for in, want := range tests {
+		if got := normalizeRecoveryCode(in); got != want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package hand
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// WorkspaceHandler обрабатывает запросы, связанные с рабочими пространствами команд:
+// создание пространств, управление участниками и приглашениями.
+// Права на заметки пространства проверяет NoteHandler через authz.Authorizer.
+type WorkspaceHandler struct {
+	db     database.Database
+	authz  *authz.Authorizer
+	logger *logger.Logger
+}
+
+// NewWorkspaceHandler создает новый экземпляр WorkspaceHandler с заданной базой данных и логгером.
+func NewWorkspaceHandler(db database.Database, logger *logger.Logger) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		db:     db,
+		authz:  authz.New(db),
+		logger: logger,
+	}
+}
+
+// CreateWorkspace создает рабочее пространство с названием name.
+// Создатель становится его владельцем.
+func (h *WorkspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := h.currentUser(ctx, w, r)
+	if !ok {
+		return
+	}
+	name, ok := workspaceName(w, r)
+	if !ok {
+		return
+	}
+
+	// Пространство и его владелец создаются одним запросом, чтобы не осталось пространства без участников.
+	ws := models.Workspace{Name: name, Role: authz.WorkspaceOwner}
+	err := h.db.QueryRow(ctx, `WITH ws AS (
+            INSERT INTO workspaces (name, created_by) VALUES ($1, $2) RETURNING id, created_at
+        )
+        INSERT INTO workspace_members (workspace_id, user_id, role)
+        SELECT id, $2, 'owner' FROM ws
+        RETURNING workspace_id, (SELECT created_at FROM ws)`, name, userID).Scan(&ws.ID, &ws.CreatedAt)
+	if err != nil {
+		http.Error(w, "Error creating workspace", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ws)
+}
+
+// GetWorkspaces возвращает рабочие пространства, участником которых является текущий пользователь, с его ролью.
+func (h *WorkspaceHandler) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `SELECT ws.id, ws.name, m.role, ws.created_at
+        FROM workspaces ws JOIN workspace_members m ON m.workspace_id = ws.id
+        JOIN users u ON u.id = m.user_id
+        WHERE u.username=$1 ORDER BY ws.id`, r.Header.Get("username"))
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	workspaces := []models.Workspace{}
+	for rows.Next() {
+		var ws models.Workspace
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Role, &ws.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// UpdateWorkspace переименовывает рабочее пространство. Доступно только его владельцам.
+func (h *WorkspaceHandler) UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, _, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceOwner)
+	if !ok {
+		return
+	}
+	name, ok := workspaceName(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(ctx, "UPDATE workspaces SET name=$1 WHERE id=$2", name, workspaceID); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Workspace updated successfully"))
+}
+
+// DeleteWorkspace удаляет рабочее пространство вместе с его заметками. Доступно только его владельцам.
+func (h *WorkspaceHandler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, _, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceOwner)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(ctx, "DELETE FROM workspaces WHERE id=$1", workspaceID); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Workspace deleted successfully"))
+}
+
+// GetMembers возвращает участников рабочего пространства. Доступно всем участникам.
+func (h *WorkspaceHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, _, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceViewer)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT u.username, m.role, m.created_at
+        FROM workspace_members m JOIN users u ON u.id = m.user_id
+        WHERE m.workspace_id=$1 ORDER BY m.created_at`, workspaceID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		var m models.WorkspaceMember
+		if err := rows.Scan(&m.Username, &m.Role, &m.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		members = append(members, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// UpdateMember меняет роль участника рабочего пространства.
+// Администраторы управляют редакторами и читателями, а назначать и снимать администраторов
+// и владельцев могут только владельцы. Последнего владельца понизить нельзя.
+func (h *WorkspaceHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, actorRole, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceAdmin)
+	if !ok {
+		return
+	}
+	role := r.FormValue("role")
+	if !authz.ValidWorkspaceRole(role) {
+		http.Error(w, "Role must be owner, admin, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	targetID, targetRole, ok := h.member(ctx, w, workspaceID, mux.Vars(r)["username"])
+	if !ok {
+		return
+	}
+	if !canManageRole(actorRole, targetRole) || !canManageRole(actorRole, role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `UPDATE workspace_members SET role=$1
+        WHERE workspace_id=$2 AND user_id=$3
+        AND (role <> 'owner' OR $1 = 'owner'
+            OR (SELECT count(*) FROM workspace_members WHERE workspace_id=$2 AND role='owner') > 1)`,
+		role, workspaceID, targetID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Workspace must have at least one owner", http.StatusConflict)
+		return
+	}
+
+	w.Write([]byte("Member updated successfully"))
+}
+
+// RemoveMember исключает участника из рабочего пространства или позволяет участнику покинуть его.
+// Действуют те же ограничения, что и при смене роли; последний владелец покинуть пространство не может.
+func (h *WorkspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	username := mux.Vars(r)["username"]
+	min := authz.WorkspaceAdmin
+	if username == r.Header.Get("username") {
+		min = authz.WorkspaceViewer
+	}
+	userID, workspaceID, actorRole, ok := h.workspaceRequest(ctx, w, r, min)
+	if !ok {
+		return
+	}
+
+	targetID, targetRole, ok := h.member(ctx, w, workspaceID, username)
+	if !ok {
+		return
+	}
+	if targetID != userID && !canManageRole(actorRole, targetRole) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	res, err := h.db.Exec(ctx, `DELETE FROM workspace_members
+        WHERE workspace_id=$1 AND user_id=$2
+        AND (role <> 'owner' OR (SELECT count(*) FROM workspace_members WHERE workspace_id=$1 AND role='owner') > 1)`,
+		workspaceID, targetID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Workspace must have at least one owner", http.StatusConflict)
+		return
+	}
+
+	w.Write([]byte("Member removed successfully"))
+}
+
+// CreateInvitation приглашает пользователя username в рабочее пространство с ролью role.
+// Повторное приглашение заменяет предыдущее. Доступно администраторам и владельцам,
+// причем приглашать администраторов и владельцев могут только владельцы.
+func (h *WorkspaceHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, workspaceID, actorRole, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceAdmin)
+	if !ok {
+		return
+	}
+	role := r.FormValue("role")
+	if !authz.ValidWorkspaceRole(role) {
+		http.Error(w, "Role must be owner, admin, editor or viewer", http.StatusBadRequest)
+		return
+	}
+	if !canManageRole(actorRole, role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	username := r.FormValue("username")
+	var inviteeID int
+	var member bool
+	err := h.db.QueryRow(ctx, `SELECT u.id, m.user_id IS NOT NULL FROM users u
+        LEFT JOIN workspace_members m ON m.user_id = u.id AND m.workspace_id = $2
+        WHERE u.username=$1`, username, workspaceID).Scan(&inviteeID, &member)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if member {
+		http.Error(w, "User is already a member", http.StatusConflict)
+		return
+	}
+
+	inv := models.WorkspaceInvitation{WorkspaceID: workspaceID, Username: username, Role: role, InvitedBy: r.Header.Get("username")}
+	err = h.db.QueryRow(ctx, `INSERT INTO workspace_invitations (workspace_id, user_id, role, invited_by)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (workspace_id, user_id) DO UPDATE
+        SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, created_at = now()
+        RETURNING id, created_at, (SELECT name FROM workspaces WHERE id=$1)`,
+		workspaceID, inviteeID, role, userID).Scan(&inv.ID, &inv.CreatedAt, &inv.Workspace)
+	if err != nil {
+		http.Error(w, "Error creating invitation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
+
+// GetInvitations возвращает ожидающие приглашения в рабочее пространство.
+// Доступно администраторам и владельцам.
+func (h *WorkspaceHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, _, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceAdmin)
+	if !ok {
+		return
+	}
+	h.writeInvitations(ctx, w, "i.workspace_id=$1", workspaceID)
+}
+
+// CancelInvitation отменяет приглашение в рабочее пространство.
+// Доступно администраторам и владельцам.
+func (h *WorkspaceHandler) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, workspaceID, _, ok := h.workspaceRequest(ctx, w, r, authz.WorkspaceAdmin)
+	if !ok {
+		return
+	}
+
+	res, err := h.db.Exec(ctx, "DELETE FROM workspace_invitations WHERE id=$1 AND workspace_id=$2",
+		mux.Vars(r)["invitationID"], workspaceID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Invitation cancelled successfully"))
+}
+
+// GetMyInvitations возвращает приглашения текущего пользователя в рабочие пространства.
+func (h *WorkspaceHandler) GetMyInvitations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := h.currentUser(ctx, w, r)
+	if !ok {
+		return
+	}
+	h.writeInvitations(ctx, w, "i.user_id=$1", userID)
+}
+
+// AcceptInvitation принимает приглашение: текущий пользователь становится участником пространства с указанной ролью.
+func (h *WorkspaceHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := h.currentUser(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	// Приглашение удаляется и превращается в участие одним запросом, поэтому принять его можно только один раз.
+	var ws models.Workspace
+	err := h.db.QueryRow(ctx, `WITH inv AS (
+            DELETE FROM workspace_invitations WHERE id=$1 AND user_id=$2
+            RETURNING workspace_id, user_id, role
+        )
+        INSERT INTO workspace_members (workspace_id, user_id, role)
+        SELECT workspace_id, user_id, role FROM inv
+        ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = workspace_members.role
+        RETURNING workspace_id, role,
+            (SELECT name FROM workspaces WHERE id = workspace_id),
+            (SELECT created_at FROM workspaces WHERE id = workspace_id)`,
+		mux.Vars(r)["invitationID"], userID).Scan(&ws.ID, &ws.Role, &ws.Name, &ws.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws)
+}
+
+// DeclineInvitation отклоняет приглашение текущего пользователя.
+func (h *WorkspaceHandler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, ok := h.currentUser(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.db.Exec(ctx, "DELETE FROM workspace_invitations WHERE id=$1 AND user_id=$2",
+		mux.Vars(r)["invitationID"], userID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Write([]byte("Invitation declined"))
+}
+
+// writeInvitations отправляет клиенту приглашения, отобранные условием filter с единственным аргументом arg.
+func (h *WorkspaceHandler) writeInvitations(ctx context.Context, w http.ResponseWriter, filter string, arg int) {
+	rows, err := h.db.Query(ctx, `SELECT i.id, i.workspace_id, ws.name, u.username, i.role, COALESCE(b.username, ''), i.created_at
+        FROM workspace_invitations i
+        JOIN workspaces ws ON ws.id = i.workspace_id
+        JOIN users u ON u.id = i.user_id
+        LEFT JOIN users b ON b.id = i.invited_by
+        WHERE `+filter+` ORDER BY i.created_at`, arg)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	invitations := []models.WorkspaceInvitation{}
+	for rows.Next() {
+		var inv models.WorkspaceInvitation
+		if err := rows.Scan(&inv.ID, &inv.WorkspaceID, &inv.Workspace, &inv.Username, &inv.Role, &inv.InvitedBy, &inv.CreatedAt); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		invitations = append(invitations, inv)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+// currentUser определяет идентификатор текущего пользователя.
+// В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func (h *WorkspaceHandler) currentUser(ctx context.Context, w http.ResponseWriter, r *http.Request) (int, bool) {
+	var userID int
+	err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE username=$1", r.Header.Get("username")).Scan(&userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, false
+	}
+	return userID, true
+}
+
+// workspaceRequest определяет текущего пользователя, рабочее пространство из пути запроса и роль пользователя в нем,
+// и проверяет, что роль не ниже min. Пользователь, не являющийся участником, получает 404,
+// чтобы не раскрывать существование пространства. В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func (h *WorkspaceHandler) workspaceRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, min string) (userID, workspaceID int, role string, ok bool) {
+	workspaceID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid workspace id", http.StatusBadRequest)
+		return 0, 0, "", false
+	}
+	if userID, ok = h.currentUser(ctx, w, r); !ok {
+		return 0, 0, "", false
+	}
+
+	role, err = h.authz.WorkspaceRole(ctx, userID, workspaceID)
+	if err == authz.ErrNotFound || (err == nil && role == "") {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return 0, 0, "", false
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, 0, "", false
+	}
+	if !authz.WorkspaceRoleAtLeast(role, min) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, 0, "", false
+	}
+	return userID, workspaceID, role, true
+}
+
+// member возвращает идентификатор и роль участника рабочего пространства по имени пользователя.
+// В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func (h *WorkspaceHandler) member(ctx context.Context, w http.ResponseWriter, workspaceID int, username string) (int, string, bool) {
+	var userID int
+	var role string
+	err := h.db.QueryRow(ctx, `SELECT m.user_id, m.role FROM workspace_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.workspace_id=$1 AND u.username=$2`, workspaceID, username).Scan(&userID, &role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return 0, "", false
+	} else if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+	return userID, role, true
+}
+
+// canManageRole сообщает, может ли участник с ролью actor назначать роль role или управлять участником с этой ролью.
+// Администраторы управляют только редакторами и читателями, владельцы - всеми.
+func canManageRole(actor, role string) bool {
+	if actor == authz.WorkspaceOwner {
+		return true
+	}
+	return actor == authz.WorkspaceAdmin && !authz.WorkspaceRoleAtLeast(role, authz.WorkspaceAdmin)
+}
+
+// workspaceName проверяет название рабочего пространства из формы запроса.
+// В случае ошибки отправляет ответ клиенту и возвращает ok=false.
+func workspaceName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		http.Error(w, "Name is required (up to 100 characters)", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,31 @@
+package hand
+
+import (
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/authz"
+)
+
+func TestCanManageRole(t *testing.T) {
+	tests := []struct {
+		actor, role string
+		want        bool
+	}{
+		{authz.WorkspaceOwner, authz.WorkspaceOwner, true},
+		{authz.WorkspaceOwner, authz.WorkspaceAdmin, true},
+		{authz.WorkspaceOwner, authz.WorkspaceViewer, true},
+		{authz.WorkspaceAdmin, authz.WorkspaceEditor, true},
+		{authz.WorkspaceAdmin, authz.WorkspaceViewer, true},
+		// Администратор не может назначать и изменять равных себе и владельца.
+		{authz.WorkspaceAdmin, authz.WorkspaceAdmin, false},
+		{authz.WorkspaceAdmin, authz.WorkspaceOwner, false},
+		{authz.WorkspaceEditor, authz.WorkspaceViewer, false},
+		{authz.WorkspaceViewer, authz.WorkspaceViewer, false},
+		{"", authz.WorkspaceViewer, false},
+	}
+	for _, tt := range tests {
+		if got := canManageRole(tt.actor, tt.role); got != tt.want {
+			t.Errorf("canManageRole(%q, %q) = %v, want %v", tt.actor, tt.role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+// enexSource - выгрузка Evernote в формате ENEX. Файл читается потоком: сначала считаются
+// заметки, затем они по одной разбираются и передаются на импорт. Содержимое заметок (ENML)
+// преобразуется в Markdown, метки Evernote сохраняются, вложения не импортируются.
+type enexSource struct {
+	r     io.ReaderAt
+	size  int64
+	count int
+}
+
+// enexNote - заметка в файле ENEX.
+type enexNote struct {
+	Title     string   `xml:"title"`
+	Content   string   `xml:"content"`
+	Created   string   `xml:"created"`
+	Updated   string   `xml:"updated"`
+	Tags      []string `xml:"tag"`
+	Resources []struct {
+		Mime string `xml:"mime"`
+	} `xml:"resource"`
+}
+
+// enexTime - формат времени в файлах ENEX.
+const enexTime = "20060102T150405Z"
+
+func newENEXSource(r io.ReaderAt, size int64) (*enexSource, error) {
+	s := &enexSource{r: r, size: size}
+	d := s.decoder()
+	depth := 0
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && t.Name.Local == "note" {
+				s.count++
+				if s.count > MaxItems {
+					return nil, ErrTooManyItems
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return s, nil
+}
+
+func (s *enexSource) decoder() *xml.Decoder {
+	d := xml.NewDecoder(io.NewSectionReader(s.r, 0, s.size))
+	d.Entity = xml.HTMLEntity
+	return d
+}
+
+func (s *enexSource) Count() int { return s.count }
+
+func (s *enexSource) Each(fn func(Item) error) error {
+	d := s.decoder()
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 && t.Name.Local == "note" {
+				var note enexNote
+				if err := d.DecodeElement(&note, &t); err != nil {
+					return err
+				}
+				if err := fn(enexItem(note)); err != nil {
+					return err
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// enexItem преобразует заметку Evernote в заметку в формате Markdown с заголовком.
+func enexItem(note enexNote) Item {
+	title := strings.TrimSpace(note.Title)
+	item := Item{Name: title, Format: markdown.FormatMarkdown}
+	if title == "" {
+		item.Name = "Untitled"
+	}
+	body, err := enmlToMarkdown(note.Content)
+	if err != nil {
+		item.Skip = "invalid note content"
+		return item
+	}
+	if body == "" && title == "" {
+		if len(note.Resources) > 0 {
+			item.Skip = "attachments are not imported"
+		} else {
+			item.Skip = "empty note"
+		}
+		return item
+	}
+	text := "# " + item.Name + "\n"
+	if body != "" {
+		text += "\n" + body
+	}
+	if len(text) > MaxNoteSize {
+		item.Skip = "note too large"
+		return item
+	}
+	item.Text = text
+	item.Tags = normalizeTags(note.Tags)
+	item.CreatedAt = parseENEXTime(note.Created)
+	item.UpdatedAt = parseENEXTime(note.Updated)
+	return item
+}
+
+func parseENEXTime(v string) *time.Time {
+	t, err := time.Parse(enexTime, strings.TrimSpace(v))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
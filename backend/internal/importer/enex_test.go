@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+func TestENMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		enml string
+		want string
+	}{
+		{"paragraphs", "<en-note><div>первый</div><div>второй</div></en-note>", "первый\nвторой"},
+		{"heading", "<en-note><h2>Заголовок</h2><p>текст</p></en-note>", "## Заголовок\n\nтекст"},
+		{"line breaks", "<en-note><div>a<br/>b</div><div><br/></div><div>c</div></en-note>", "a\nb\n\nc"},
+		{"emphasis", "<en-note><b>ж</b> <i>к</i> <s>з</s> <code>x</code></en-note>", "**ж** *к* ~~з~~ `x`"},
+		{"unordered list", "<en-note><ul><li>a</li><li>b<ul><li>c</li></ul></li></ul></en-note>", "- a\n- b\n  - c"},
+		{"ordered list", "<en-note><ol><li>a</li><li>b</li></ol></en-note>", "1. a\n2. b"},
+		{"todo", `<en-note><div><en-todo checked="true"/>готово</div><div><en-todo/>нет</div></en-note>`, "- [x] готово\n- [ ] нет"},
+		{"link", `<en-note><a href="https://example.com">сайт</a></en-note>`, "[сайт](https://example.com)"},
+		{"unsafe link", `<en-note><a href="javascript:alert(1)">сайт</a></en-note>`, "сайт"},
+		{"code block", "<en-note><pre>a  b\n  c</pre>текст</en-note>", "```\na  b\n  c\n```\n\nтекст"},
+		{"quote", "<en-note><blockquote><div>a</div><div>b</div></blockquote></en-note>", "> a\n> b"},
+		{"table", "<en-note><table><tr><td>a</td><td>b</td></tr></table></en-note>", "a | b |"},
+		{"entities", "<en-note><div>&laquo;a&nbsp;&amp;&nbsp;b&raquo;</div></en-note>", "«a & b»"},
+		{"unknown markup", "<en-note><span style=\"color:red\">текст</span><en-media hash=\"1\"/></en-note>", "текст"},
+		{"whitespace", "<en-note>\n  <div>\n    a\n  </div>\n</en-note>", "a"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enmlToMarkdown(tt.enml)
+			if err != nil {
+				t.Fatalf("enmlToMarkdown: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("enmlToMarkdown(%q) =\n%q\nwant\n%q", tt.enml, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := enmlToMarkdown(strings.Repeat("a", maxENMLSize+1)); !errors.Is(err, errENMLTooLarge) {
+		t.Errorf("enmlToMarkdown of a large note: err = %v, want errENMLTooLarge", err)
+	}
+}
+
+// enexNoteXML возвращает заметку ENEX; содержимое ENML помещается в CDATA, как в выгрузке Evernote.
+func enexNoteXML(title, content, extra string) string {
+	return "<note><title>" + title + "</title><content><![CDATA[" + content + "]]></content>" + extra + "</note>"
+}
+
+func TestENEXSource(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export4.dtd">
+<en-export export-date="20240301T000000Z" application="Evernote">
+` + enexNoteXML("Рецепт", `<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd"><en-note><div>мука &amp; вода</div></en-note>`,
+		"<created>20240102T030405Z</created><updated>20240203T040506Z</updated><tag>Кухня</tag><tag>кухня</tag>") + `
+` + enexNoteXML("", "<en-note><div>без заголовка</div></en-note>", "<created>вчера</created>") + `
+` + enexNoteXML("", "<en-note><en-media hash=\"1\" type=\"image/png\"/></en-note>", "<resource><mime>image/png</mime></resource>") + `
+` + enexNoteXML("  ", "<en-note></en-note>", "") + `
+` + enexNoteXML("Только заголовок", "", "") + `
+</en-export>`
+
+	got := items(t, FormatENEX, bytes.NewReader([]byte(enex)))
+	want := []Item{
+		{Name: "Рецепт", Text: "# Рецепт\n\nмука & вода", Format: markdown.FormatMarkdown, Tags: []string{"Кухня", "кухня"}, CreatedAt: &created, UpdatedAt: &updated},
+		{Name: "Untitled", Text: "# Untitled\n\nбез заголовка", Format: markdown.FormatMarkdown},
+		{Name: "Untitled", Format: markdown.FormatMarkdown, Skip: "attachments are not imported"},
+		{Name: "Untitled", Format: markdown.FormatMarkdown, Skip: "empty note"},
+		{Name: "Только заголовок", Text: "# Только заголовок\n", Format: markdown.FormatMarkdown},
+	}
+	compareItems(t, got, want)
+
+	if _, err := Open(FormatENEX, bytes.NewReader([]byte("<en-export><note a=>")), 20); err == nil {
+		t.Error("Open of a malformed ENEX file: want error")
+	}
+	// Незакрытые элементы обнаруживаются только при разборе заметок.
+	truncated := []byte("<en-export>" + enexNoteXML("a", "<en-note>a</en-note>", "") + "<note><title>b")
+	src, err := Open(FormatENEX, bytes.NewReader(truncated), int64(len(truncated)))
+	if err != nil {
+		t.Fatalf("Open of a truncated ENEX file: %v", err)
+	}
+	if err := src.Each(func(Item) error { return nil }); err == nil {
+		t.Error("Each over a truncated ENEX file: want error")
+	}
+}
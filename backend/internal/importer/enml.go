@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+// maxENMLSize - максимальный размер содержимого заметки Evernote до преобразования.
+// Разметка ENML занимает заметную часть текста, поэтому ограничение больше MaxNoteSize.
+const maxENMLSize = 4 * MaxNoteSize
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// enmlConverter преобразует разметку ENML (XHTML заметок Evernote) в Markdown.
+// Сохраняются заголовки, абзацы, списки, списки задач, выделение, ссылки, цитаты и код;
+// остальная разметка отбрасывается, а ее текст сохраняется.
+type enmlConverter struct {
+	b     strings.Builder
+	lists []listState
+	// links - адреса открытых ссылок; пустая строка - ссылка с небезопасным адресом, выводится только текст.
+	links []string
+	pre   int
+	quote int
+}
+
+type listState struct {
+	ordered bool
+	n       int
+}
+
+// enmlToMarkdown преобразует содержимое заметки Evernote в Markdown.
+func enmlToMarkdown(content string) (string, error) {
+	if len(content) > maxENMLSize {
+		return "", errENMLTooLarge
+	}
+	d := xml.NewDecoder(strings.NewReader(content))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	c := &enmlConverter{}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			c.start(t)
+		case xml.EndElement:
+			c.end(t.Name.Local)
+		case xml.CharData:
+			c.text(string(t))
+		}
+	}
+	out := blankLines.ReplaceAllString(c.b.String(), "\n\n")
+	return strings.TrimSpace(out), nil
+}
+
+var errENMLTooLarge = errors.New("importer: note content too large")
+
+func (c *enmlConverter) start(t xml.StartElement) {
+	switch name := t.Name.Local; name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.block()
+		c.write(strings.Repeat("#", int(name[1]-'0')) + " ")
+	case "p", "div", "table", "tr":
+		c.line()
+	case "br":
+		c.b.WriteString("\n")
+	case "hr":
+		c.block()
+		c.write("---\n")
+	case "ul", "ol":
+		c.line()
+		c.lists = append(c.lists, listState{ordered: name == "ol"})
+	case "li":
+		c.line()
+		if n := len(c.lists); n > 0 {
+			l := &c.lists[n-1]
+			l.n++
+			if l.ordered {
+				c.write(strings.Repeat("  ", n-1) + strconv.Itoa(l.n) + ". ")
+			} else {
+				c.write(strings.Repeat("  ", n-1) + "- ")
+			}
+		} else {
+			c.write("- ")
+		}
+	case "en-todo":
+		// Задачи Evernote стоят в начале абзаца, а в Markdown они элементы списка.
+		mark := "[ ] "
+		if attr(t, "checked") == "true" {
+			mark = "[x] "
+		}
+		if c.atLineStart() {
+			mark = "- " + mark
+		}
+		c.write(mark)
+	case "b", "strong":
+		c.write("**")
+	case "i", "em":
+		c.write("*")
+	case "s", "strike", "del":
+		c.write("~~")
+	case "code":
+		if c.pre == 0 {
+			c.write("`")
+		}
+	case "pre":
+		c.block()
+		c.write("```\n")
+		c.pre++
+	case "blockquote":
+		c.block()
+		c.quote++
+	case "a":
+		href, ok := markdown.SafeURL(attr(t, "href"))
+		if !ok {
+			href = ""
+		}
+		c.links = append(c.links, href)
+		if href != "" {
+			c.write("[")
+		}
+	case "td", "th":
+		c.write(" ")
+	}
+}
+
+func (c *enmlConverter) end(name string) {
+	switch name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.b.WriteString("\n\n")
+	case "p", "div", "tr":
+		c.line()
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		c.line()
+	case "b", "strong":
+		c.write("**")
+	case "i", "em":
+		c.write("*")
+	case "s", "strike", "del":
+		c.write("~~")
+	case "code":
+		if c.pre == 0 {
+			c.write("`")
+		}
+	case "pre":
+		if c.pre > 0 {
+			c.pre--
+			c.line()
+			c.write("```\n\n")
+		}
+	case "blockquote":
+		if c.quote > 0 {
+			c.quote--
+		}
+		c.b.WriteString("\n\n")
+	case "a":
+		if n := len(c.links); n > 0 {
+			if href := c.links[n-1]; href != "" {
+				c.write("](" + href + ")")
+			}
+			c.links = c.links[:n-1]
+		}
+	case "td", "th":
+		c.write(" |")
+	}
+}
+
+func (c *enmlConverter) text(s string) {
+	if c.pre > 0 {
+		c.write(s)
+		return
+	}
+	// Вне блоков кода переносы строк в разметке не значимы.
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' || r == '\t' }), " ")
+	if strings.TrimSpace(s) == "" && c.atLineStart() {
+		return
+	}
+	c.write(s)
+}
+
+// write выводит текст; в начале строки внутри цитаты сначала выводятся ее маркеры.
+func (c *enmlConverter) write(s string) {
+	if c.quote > 0 && c.atLineStart() {
+		c.b.WriteString(strings.Repeat("> ", c.quote))
+	}
+	c.b.WriteString(s)
+}
+
+func (c *enmlConverter) atLineStart() bool {
+	return c.b.Len() == 0 || strings.HasSuffix(c.b.String(), "\n")
+}
+
+// line начинает новую строку, если текущая не пуста.
+func (c *enmlConverter) line() {
+	if !c.atLineStart() {
+		c.b.WriteString("\n")
+	}
+}
+
+// block отделяет следующий блок пустой строкой.
+func (c *enmlConverter) block() {
+	if s := c.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		c.line()
+		c.b.WriteString("\n")
+	}
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
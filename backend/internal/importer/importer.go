@@ -0,0 +1,255 @@
+// Package importer переносит заметки из файлов других сервисов: архивов Markdown,
+// выгрузок Evernote (ENEX) и архивов Google Keep из Google Takeout.
+//
+// Импорт выполняется в фоне: загруженный файл сохраняется в BlobStore, создается задание
+// в таблице import_jobs, а Importer в очереди фоновых заданий разбирает файл и создает заметки,
+// обновляя прогресс задания.
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/blobstore"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+	"github.com/NickolaiP/notes_app/backend/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// progressInterval - как часто сохраняется прогресс задания.
+	progressInterval = time.Second
+	// spellTimeout - время на проверку орфографии одной заметки.
+	spellTimeout = 10 * time.Second
+	// maxReportItems - максимальное число импортированных и пропущенных элементов в отчете.
+	maxReportItems = 1000
+)
+
+// SpellFunc проверяет орфографию текста с настройками пользователя userID и возвращает исправленный текст.
+type SpellFunc func(ctx context.Context, userID int, text string) (string, error)
+
+// Importer выполняет задания импорта в очереди фоновых заданий.
+type Importer struct {
+	db     database.Database
+	store  blobstore.BlobStore
+	queue  *jobs.Queue
+	spell  SpellFunc
+	logger *logger.Logger
+}
+
+// importPayload - параметры задания очереди, выполняющего задание импорта.
+type importPayload struct {
+	JobID int `json:"job_id"`
+}
+
+// importTask - задание очереди, выполняющее задание импорта. Импорт большого архива может
+// занимать долгое время, а повтор после ошибки не запускает импорт заново (см. Run).
+var importTask = jobs.Task[importPayload]{Kind: "notes.import", MaxAttempts: 3, Timeout: time.Hour}
+
+// NewImporter создает новый экземпляр Importer и регистрирует обработчик его заданий в очереди.
+// Функция spell используется для заданий, в которых включена проверка орфографии.
+func NewImporter(db database.Database, store blobstore.BlobStore, queue *jobs.Queue, spell SpellFunc, logger *logger.Logger) *Importer {
+	im := &Importer{db: db, store: store, queue: queue, spell: spell, logger: logger}
+	jobs.Handle(queue, importTask, func(ctx context.Context, p importPayload) error {
+		return im.Run(ctx, p.JobID)
+	})
+	return im
+}
+
+// Enqueue ставит задание импорта jobID в очередь фоновых заданий.
+func (im *Importer) Enqueue(ctx context.Context, jobID int) error {
+	_, err := importTask.Enqueue(ctx, im.queue, importPayload{JobID: jobID}, jobs.Unique(strconv.Itoa(jobID)))
+	return err
+}
+
+// Run выполняет задание импорта: скачивает файл, создает заметки для его элементов и сохраняет отчет.
+// Завершенное задание не запускается повторно. Задание, выполнение которого прервала аварийная
+// остановка сервера, завершается с ошибкой: повторный запуск создал бы уже импортированные заметки еще раз.
+// Ошибка импорта сохраняется в задании и возвращается как jobs.Permanent.
+func (im *Importer) Run(ctx context.Context, jobID int) error {
+	var userID int
+	var format string
+	var spellcheck bool
+	var sourceKey sql.NullString
+	err := im.db.QueryRow(ctx, `UPDATE import_jobs SET status='running', started_at=now()
+        WHERE id=$1 AND status='queued' RETURNING user_id, format, spellcheck, source_key`, jobID).
+		Scan(&userID, &format, &spellcheck, &sourceKey)
+	if err == sql.ErrNoRows {
+		return im.failInterrupted(ctx, jobID)
+	} else if err != nil {
+		return err
+	}
+
+	job := &run{im: im, jobID: jobID, userID: userID, spellcheck: spellcheck}
+	runErr := job.importFile(ctx, format, sourceKey.String)
+	if sourceKey.Valid {
+		im.removeSource(sourceKey.String)
+	}
+
+	// Итог сохраняется и при отмене контекста, поэтому используется отдельный контекст.
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, _ := json.Marshal(job.report)
+	status, message := "done", ""
+	if runErr != nil {
+		status, message = "failed", runErr.Error()
+		if ctx.Err() != nil {
+			message = "interrupted by server shutdown"
+		}
+	}
+	_, err = im.db.Exec(saveCtx, `UPDATE import_jobs SET status=$2, error=NULLIF($3, ''), report=$4,
+        processed=$5, imported=$6, skipped=$7, source_key=NULL, finished_at=now() WHERE id=$1`,
+		jobID, status, message, report, job.processed, job.imported, job.skipped)
+	if err != nil {
+		return err
+	}
+	if runErr != nil {
+		return jobs.Permanent(runErr)
+	}
+	return nil
+}
+
+// failInterrupted завершает с ошибкой задание jobID, если оно осталось в состоянии running.
+func (im *Importer) failInterrupted(ctx context.Context, jobID int) error {
+	var sourceKey sql.NullString
+	err := im.db.QueryRow(ctx, `UPDATE import_jobs j SET status='failed', error='interrupted by server restart',
+            source_key=NULL, finished_at=now()
+        FROM (SELECT id, source_key FROM import_jobs WHERE id=$1 AND status='running' FOR UPDATE) old
+        WHERE j.id = old.id RETURNING old.source_key`, jobID).Scan(&sourceKey)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if sourceKey.Valid {
+		im.removeSource(sourceKey.String)
+	}
+	return nil
+}
+
+// removeSource удаляет загруженный файл задания. Если удалить его не удалось,
+// файл будет удален фоновой очисткой хранилища.
+func (im *Importer) removeSource(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := im.store.Delete(ctx, key); err != nil {
+		im.logger.Error("Failed to delete import source", "error", err)
+		im.db.Exec(ctx, "INSERT INTO orphaned_blobs (storage_key) VALUES ($1) ON CONFLICT DO NOTHING", key)
+	}
+}
+
+// run - состояние выполняемого задания.
+type run struct {
+	im         *Importer
+	jobID      int
+	userID     int
+	spellcheck bool
+
+	processed, imported, skipped int
+	report                       models.ImportReport
+	savedAt                      time.Time
+}
+
+// importFile скачивает файл задания во временный файл и импортирует его элементы.
+func (r *run) importFile(ctx context.Context, format, key string) error {
+	body, err := r.im.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Архивы ZIP читаются с произвольных позиций, поэтому файл сохраняется на диск.
+	tmp, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return err
+	}
+
+	src, err := Open(format, tmp, size)
+	if err != nil {
+		return err
+	}
+	if _, err := r.im.db.Exec(ctx, "UPDATE import_jobs SET total=$2 WHERE id=$1", r.jobID, src.Count()); err != nil {
+		return err
+	}
+	r.report = models.ImportReport{Imported: []models.ImportedItem{}, Skipped: []models.ImportSkipped{}}
+	return src.Each(func(item Item) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.importItem(ctx, item); err != nil {
+			return err
+		}
+		return r.saveProgress(ctx)
+	})
+}
+
+// importItem создает заметку из элемента или добавляет его в список пропущенных.
+func (r *run) importItem(ctx context.Context, item Item) error {
+	r.processed++
+	if item.Skip != "" {
+		r.skipped++
+		if len(r.report.Skipped) < maxReportItems {
+			r.report.Skipped = append(r.report.Skipped, models.ImportSkipped{Item: item.Name, Reason: item.Skip})
+		} else {
+			r.report.Truncated = true
+		}
+		return nil
+	}
+
+	text, status := item.Text, "skipped"
+	if r.spellcheck && r.im.spell != nil {
+		spellCtx, cancel := context.WithTimeout(ctx, spellTimeout)
+		// Импорт не прерывается из-за недоступности сервиса проверки: заметка сохраняется как есть.
+		if corrected, err := r.im.spell(spellCtx, r.userID, text); err == nil {
+			text, status = corrected, "done"
+		} else if ctx.Err() == nil {
+			status = "failed"
+			r.im.logger.Error("Spell check failed during import", "job_id", r.jobID, "error", err)
+		}
+		cancel()
+	}
+
+	tags := item.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	var noteID int
+	err := r.im.db.QueryRow(ctx, `INSERT INTO notes (user_id, text, format, tags, spellcheck_status, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, COALESCE($6, now()), COALESCE($7, $6, now())) RETURNING id`,
+		r.userID, text, item.Format, pq.Array(tags), status, item.CreatedAt, item.UpdatedAt).Scan(&noteID)
+	if err != nil {
+		return err
+	}
+	r.imported++
+	if len(r.report.Imported) < maxReportItems {
+		r.report.Imported = append(r.report.Imported, models.ImportedItem{Item: item.Name, NoteID: noteID})
+	} else {
+		r.report.Truncated = true
+	}
+	return nil
+}
+
+// saveProgress сохраняет прогресс задания не чаще progressInterval.
+func (r *run) saveProgress(ctx context.Context) error {
+	if time.Since(r.savedAt) < progressInterval {
+		return nil
+	}
+	r.savedAt = time.Now()
+	_, err := r.im.db.Exec(ctx, "UPDATE import_jobs SET processed=$2, imported=$3, skipped=$4 WHERE id=$1",
+		r.jobID, r.processed, r.imported, r.skipped)
+	return err
+}
@@ -0,0 +1,146 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+// keepSource - архив Google Takeout с заметками Google Keep. Каждая заметка хранится
+// в файле Takeout/Keep/<название>.json; HTML-копии и вложения не импортируются.
+// Заметки из корзины пропускаются, архивные получают метку "Archived", ярлыки становятся метками.
+type keepSource struct {
+	files []*zip.File
+}
+
+// keepNote - заметка Google Keep в формате Takeout.
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	IsTrashed               bool  `json:"isTrashed"`
+	IsArchived              bool  `json:"isArchived"`
+	IsPinned                bool  `json:"isPinned"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+	Attachments             []struct {
+		FilePath string `json:"filePath"`
+	} `json:"attachments"`
+}
+
+// isKeepNote сообщает, что файл архива - заметка Google Keep.
+func isKeepNote(name string) bool {
+	dir := path.Dir(name)
+	return (dir == "Keep" || strings.HasSuffix(dir, "/Keep")) && strings.EqualFold(path.Ext(name), ".json")
+}
+
+func newKeepSource(zr *zip.Reader) (*keepSource, error) {
+	var files []*zip.File
+	for _, f := range zr.File {
+		if !isKeepNote(f.Name) || hidden(f.Name) {
+			continue
+		}
+		files = append(files, f)
+		if len(files) > MaxItems {
+			return nil, ErrTooManyItems
+		}
+	}
+	return &keepSource{files: files}, nil
+}
+
+func (s *keepSource) Count() int { return len(s.files) }
+
+func (s *keepSource) Each(fn func(Item) error) error {
+	for _, f := range s.files {
+		if err := fn(keepItem(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepItem преобразует заметку Google Keep. Списки становятся списками задач Markdown.
+func keepItem(f *zip.File) Item {
+	item := Item{Name: f.Name}
+	data, skip := readZipFile(f)
+	if skip != "" {
+		item.Skip = skip
+		return item
+	}
+	var note keepNote
+	if err := json.Unmarshal([]byte(data), &note); err != nil {
+		item.Skip = "invalid Keep note"
+		return item
+	}
+	if note.Title != "" {
+		item.Name = note.Title
+	}
+	if note.IsTrashed {
+		item.Skip = "note is in trash"
+		return item
+	}
+
+	var b strings.Builder
+	item.Format = markdown.FormatPlain
+	if len(note.ListContent) > 0 {
+		item.Format = markdown.FormatMarkdown
+		if note.Title != "" {
+			b.WriteString("# " + note.Title + "\n\n")
+		}
+		for _, entry := range note.ListContent {
+			mark := "[ ]"
+			if entry.IsChecked {
+				mark = "[x]"
+			}
+			b.WriteString("- " + mark + " " + strings.ReplaceAll(entry.Text, "\n", " ") + "\n")
+		}
+	} else {
+		if note.Title != "" {
+			b.WriteString(note.Title + "\n\n")
+		}
+		b.WriteString(note.TextContent)
+	}
+	item.Text = strings.TrimRight(b.String(), "\n") + "\n"
+	if strings.TrimSpace(item.Text) == "" {
+		if len(note.Attachments) > 0 {
+			item.Skip = "attachments are not imported"
+		} else {
+			item.Skip = "empty note"
+		}
+		return item
+	}
+
+	var tags []string
+	for _, l := range note.Labels {
+		tags = append(tags, l.Name)
+	}
+	if note.IsArchived {
+		tags = append(tags, "Archived")
+	}
+	if note.IsPinned {
+		tags = append(tags, "Pinned")
+	}
+	item.Tags = normalizeTags(tags)
+	item.CreatedAt = usecTime(note.CreatedTimestampUsec)
+	item.UpdatedAt = usecTime(note.UserEditedTimestampUsec)
+	return item
+}
+
+// usecTime преобразует время в микросекундах Unix.
+func usecTime(usec int64) *time.Time {
+	if usec <= 0 {
+		return nil
+	}
+	t := time.UnixMicro(usec).UTC()
+	return &t
+}
@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+func TestIsKeepNote(t *testing.T) {
+	tests := map[string]bool{
+		"Takeout/Keep/note.json": true,
+		"Keep/note.JSON":         true,
+		"Takeout/Keep/note.html": false,
+		"Takeout/Keep/a/b.json":  false,
+		"Takeout/Drive/a.json":   false,
+		"note.json":              false,
+	}
+	for name, want := range tests {
+		if got := isKeepNote(name); got != want {
+			t.Errorf("isKeepNote(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestKeepSource(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	edited := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	r := makeZip(t,
+		zipFile{name: "Takeout/Keep/text.json", data: `{"title": "Покупки", "textContent": "хлеб\nмолоко\n",
+			"labels": [{"name": "Дом"}, {"name": " Дом "}], "isPinned": true,
+			"createdTimestampUsec": 1704164645000000, "userEditedTimestampUsec": 1706933106000000}`},
+		zipFile{name: "Takeout/Keep/list.json", data: `{"title": "Дела", "isArchived": true,
+			"listContent": [{"text": "позвонить", "isChecked": true}, {"text": "купить\nхлеб"}]}`},
+		zipFile{name: "Takeout/Keep/untitled.json", data: `{"textContent": "без заголовка"}`},
+		zipFile{name: "Takeout/Keep/trash.json", data: `{"title": "Удаленная", "textContent": "x", "isTrashed": true}`},
+		zipFile{name: "Takeout/Keep/photo.json", data: `{"attachments": [{"filePath": "photo.jpg"}]}`},
+		zipFile{name: "Takeout/Keep/empty.json", data: `{"title": ""}`},
+		zipFile{name: "Takeout/Keep/broken.json", data: `{"title": `},
+		zipFile{name: "Takeout/Keep/text.html", data: "<html></html>"},
+		zipFile{name: "Takeout/Keep/photo.jpg", data: "\xff\xd8"},
+	)
+	got := items(t, FormatKeep, r)
+	want := []Item{
+		{Name: "Покупки", Text: "Покупки\n\nхлеб\nмолоко\n", Format: markdown.FormatPlain, Tags: []string{"Дом", "Pinned"}, CreatedAt: &created, UpdatedAt: &edited},
+		{Name: "Дела", Text: "# Дела\n\n- [x] позвонить\n- [ ] купить хлеб\n", Format: markdown.FormatMarkdown, Tags: []string{"Archived"}},
+		{Name: "Takeout/Keep/untitled.json", Text: "без заголовка\n", Format: markdown.FormatPlain},
+		{Name: "Удаленная", Skip: "note is in trash"},
+		{Name: "Takeout/Keep/photo.json", Text: "\n", Format: markdown.FormatPlain, Skip: "attachments are not imported"},
+		{Name: "Takeout/Keep/empty.json", Text: "\n", Format: markdown.FormatPlain, Skip: "empty note"},
+		{Name: "Takeout/Keep/broken.json", Skip: "invalid Keep note"},
+	}
+	compareItems(t, got, want)
+}
@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"archive/zip"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+// markdownSource - архив файлов Markdown (.md, .markdown) и текстовых файлов (.txt).
+// Каталоги, в которых лежит файл, становятся метками заметки. Если у файла есть front matter
+// YAML (как в выгрузке markdown-zip), из него берутся метки, формат и время создания и изменения.
+type markdownSource struct {
+	files []*zip.File
+}
+
+func newMarkdownSource(zr *zip.Reader) (*markdownSource, error) {
+	var files []*zip.File
+	for _, f := range zr.File {
+		if hidden(f.Name) {
+			continue
+		}
+		files = append(files, f)
+		if len(files) > MaxItems {
+			return nil, ErrTooManyItems
+		}
+	}
+	return &markdownSource{files: files}, nil
+}
+
+func (s *markdownSource) Count() int { return len(s.files) }
+
+func (s *markdownSource) Each(fn func(Item) error) error {
+	for _, f := range s.files {
+		if err := fn(markdownItem(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownItem преобразует файл архива в заметку.
+func markdownItem(f *zip.File) Item {
+	item := Item{Name: f.Name}
+	switch strings.ToLower(path.Ext(f.Name)) {
+	case ".md", ".markdown":
+		item.Format = markdown.FormatMarkdown
+	case ".txt":
+		item.Format = markdown.FormatPlain
+	default:
+		item.Skip = "unsupported file type"
+		return item
+	}
+
+	text, skip := readZipFile(f)
+	if skip != "" {
+		item.Skip = skip
+		return item
+	}
+	meta, body, ok := frontMatter(text)
+	if ok {
+		text = body
+	}
+	if strings.TrimSpace(text) == "" {
+		item.Skip = "empty note"
+		return item
+	}
+
+	if tags, ok := meta["tags"]; ok {
+		item.Tags = normalizeTags(yamlList(tags))
+	} else if dir := path.Dir(f.Name); dir != "." {
+		item.Tags = normalizeTags(strings.Split(dir, "/"))
+	}
+	if format := yamlString(meta["format"]); markdown.ValidFormat(format) {
+		item.Format = format
+	}
+	item.CreatedAt = yamlTime(meta["created_at"])
+	item.UpdatedAt = yamlTime(meta["updated_at"])
+	// Архиваторы, не сохраняющие время изменения, записывают начало эпохи MS-DOS.
+	if item.UpdatedAt == nil && f.Modified.Year() > 1980 {
+		modified := f.Modified
+		item.UpdatedAt = &modified
+	}
+
+	// Заголовок заметки - ее первая строка. Если файл не начинается с заголовка и
+	// front matter его не задает, заголовком становится имя файла.
+	if _, hasTitle := meta["title"]; !hasTitle && !startsWithHeading(text) {
+		title := baseName(f.Name)
+		if item.Format == markdown.FormatMarkdown {
+			title = "# " + title
+		}
+		text = title + "\n\n" + text
+	}
+	item.Text = text
+	return item
+}
+
+// startsWithHeading сообщает, что первая непустая строка текста - заголовок Markdown.
+func startsWithHeading(text string) bool {
+	line := strings.TrimSpace(text)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.HasPrefix(line, "# ")
+}
+
+// frontMatter отделяет от текста front matter YAML, ограниченный строками "---", и разбирает
+// его простые поля: строки, числа, время и списки строк (в квадратных скобках или строками "- ").
+func frontMatter(text string) (map[string]string, string, bool) {
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return nil, text, false
+	}
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		return nil, text, false
+	}
+	meta := make(map[string]string)
+	var key string
+	for _, line := range strings.Split(rest[:end], "\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && k != "" && !strings.HasPrefix(k, " ") && !strings.HasPrefix(k, "-") {
+			key = strings.TrimSpace(k)
+			meta[key] = strings.TrimSpace(v)
+			continue
+		}
+		// Элемент списка в блочной записи относится к последнему ключу.
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && key != "" {
+			if !strings.Contains(item, ": ") {
+				meta[key] += "\n" + item
+			}
+		}
+	}
+	return meta, strings.TrimLeft(rest[end+len("\n---\n"):], "\n"), true
+}
+
+// yamlString возвращает строковое значение поля front matter без кавычек.
+func yamlString(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, `"`) {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+	return strings.Trim(v, `'"`)
+}
+
+// yamlList возвращает элементы списка из поля front matter.
+func yamlList(v string) []string {
+	v = strings.TrimSpace(v)
+	var parts []string
+	if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		parts = splitFlowList(v[1 : len(v)-1])
+	} else {
+		parts = strings.Split(v, "\n")
+	}
+	var list []string
+	for _, p := range parts {
+		if s := yamlString(p); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// splitFlowList разделяет элементы списка [a, "b, c"] по запятым вне кавычек.
+func splitFlowList(s string) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// yamlTime разбирает время в формате RFC 3339.
+func yamlTime(v string) *time.Time {
+	t, err := time.Parse(time.RFC3339, yamlString(v))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
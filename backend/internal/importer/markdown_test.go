@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/markdown"
+)
+
+func TestFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantMeta map[string]string
+		wantBody string
+		ok       bool
+	}{
+		{"none", "# Заголовок\n", nil, "# Заголовок\n", false},
+		{"unclosed", "---\ntags: [a]\ntext", nil, "---\ntags: [a]\ntext", false},
+		{
+			"fields", "---\ntitle: \"Заметка\"\nformat: markdown\ntags: [a, b]\n---\n\n# Текст\n",
+			map[string]string{"title": `"Заметка"`, "format": "markdown", "tags": "[a, b]"}, "# Текст\n", true,
+		},
+		{
+			"block list", "---\ntags:\n  - работа\n  - \"личное\"\n  - key: value\nformat: plain\n---\nтекст",
+			map[string]string{"tags": "\nработа\n\"личное\"", "format": "plain"}, "текст", true,
+		},
+		{"time with colons", "---\ncreated_at: 2024-01-02T03:04:05Z\n---\nx", map[string]string{"created_at": "2024-01-02T03:04:05Z"}, "x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, ok := frontMatter(tt.text)
+			if ok != tt.ok || body != tt.wantBody || !reflect.DeepEqual(meta, tt.wantMeta) {
+				t.Errorf("frontMatter = %q, %q, %v; want %q, %q, %v", meta, body, ok, tt.wantMeta, tt.wantBody, tt.ok)
+			}
+		})
+	}
+}
+
+func TestYAMLValues(t *testing.T) {
+	lists := []struct {
+		in   string
+		want []string
+	}{
+		{"[a, b]", []string{"a", "b"}},
+		{`["a, b", 'c', "d \"e\""]`, []string{"a, b", "c", `d "e"`}},
+		{"[]", nil},
+		{"\nработа\n\"личное\"", []string{"работа", "личное"}},
+		{"одна", []string{"одна"}},
+	}
+	for _, tt := range lists {
+		if got := yamlList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("yamlList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	strs := map[string]string{
+		`"a\tb"`: "a\tb",
+		`'a'`:    "a",
+		` a `:    "a",
+		`"a`:     "a",
+	}
+	for in, want := range strs {
+		if got := yamlString(in); got != want {
+			t.Errorf("yamlString(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := yamlTime(`"2024-01-02T03:04:05+03:00"`); got == nil || !got.Equal(time.Date(2024, 1, 2, 0, 4, 5, 0, time.UTC)) {
+		t.Errorf("yamlTime = %v, want 2024-01-02T00:04:05Z", got)
+	}
+	if got := yamlTime("вчера"); got != nil {
+		t.Errorf("yamlTime(вчера) = %v, want nil", got)
+	}
+}
+
+func TestMarkdownSource(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := makeZip(t,
+		zipFile{name: "Работа/Проект/план.md", data: "- пункт\n", modified: modified},
+		zipFile{name: "заметка.txt", data: "текст"},
+		zipFile{name: "с заголовком.md", data: "# Свой заголовок\nтекст"},
+		zipFile{name: "экспорт.md", data: "---\ntitle: \"Экспорт\"\nformat: plain\ntags: [a, b]\ncreated_at: 2023-01-02T03:04:05Z\n---\n\nЭкспорт\n\nтекст"},
+		zipFile{name: "пустая.md", data: "---\ntags: [a]\n---\n  \n"},
+		zipFile{name: "картинка.png", data: "\x89PNG"},
+		zipFile{name: "Работа/"},
+		zipFile{name: ".obsidian/config.md", data: "x"},
+	)
+	got := items(t, FormatMarkdownZip, r)
+	want := []Item{
+		{Name: "Работа/Проект/план.md", Text: "# план\n\n- пункт\n", Format: markdown.FormatMarkdown, Tags: []string{"Работа", "Проект"}, UpdatedAt: &modified},
+		{Name: "заметка.txt", Text: "заметка\n\nтекст", Format: markdown.FormatPlain},
+		{Name: "с заголовком.md", Text: "# Свой заголовок\nтекст", Format: markdown.FormatMarkdown},
+		{Name: "экспорт.md", Text: "Экспорт\n\nтекст", Format: markdown.FormatPlain, Tags: []string{"a", "b"}, CreatedAt: &created},
+		{Name: "пустая.md", Format: markdown.FormatMarkdown, Skip: "empty note"},
+		{Name: "картинка.png", Skip: "unsupported file type"},
+	}
+	compareItems(t, got, want)
+}
+
+// compareItems сравнивает элементы импорта, время - по значению.
+func compareItems(t *testing.T, got, want []Item) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d items, want %d:\n%+v", len(got), len(want), got)
+	}
+	sameTime := func(a, b *time.Time) bool {
+		return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if !sameTime(g.CreatedAt, w.CreatedAt) || !sameTime(g.UpdatedAt, w.UpdatedAt) {
+			t.Errorf("item %q: times = %v, %v; want %v, %v", w.Name, g.CreatedAt, g.UpdatedAt, w.CreatedAt, w.UpdatedAt)
+		}
+		g.CreatedAt, g.UpdatedAt, w.CreatedAt, w.UpdatedAt = nil, nil, nil, nil
+		if len(g.Tags) == 0 && len(w.Tags) == 0 {
+			g.Tags, w.Tags = nil, nil
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("item %d =\n%+v\nwant\n%+v", i, g, w)
+		}
+	}
+}
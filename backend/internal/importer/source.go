@@ -0,0 +1,175 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы файлов импорта.
+const (
+	// FormatMarkdownZip - ZIP-архив файлов Markdown и текстовых файлов; папки становятся метками.
+	FormatMarkdownZip = "markdown-zip"
+	// FormatENEX - выгрузка Evernote в формате ENEX; метки Evernote сохраняются.
+	FormatENEX = "enex"
+	// FormatKeep - архив Google Takeout с заметками Google Keep; ярлыки становятся метками.
+	FormatKeep = "keep"
+)
+
+const (
+	// MaxNoteSize - максимальный размер текста импортируемой заметки в байтах.
+	MaxNoteSize = 1 << 20
+	// MaxItems - максимальное число элементов в одном файле импорта.
+	MaxItems = 100000
+	// maxTags - максимальное число меток заметки.
+	maxTags = 50
+	// maxTagLen - максимальная длина метки в символах.
+	maxTagLen = 64
+)
+
+// ErrUnknownFormat возвращается, если формат файла не удалось определить или он не поддерживается.
+var ErrUnknownFormat = errors.New("importer: unknown format")
+
+// ErrTooManyItems возвращается, если в файле больше MaxItems элементов.
+var ErrTooManyItems = errors.New("importer: too many items")
+
+// Item - элемент файла импорта, из которого создается заметка.
+type Item struct {
+	// Name - имя элемента для отчета: путь в архиве или заголовок заметки.
+	Name   string
+	Text   string
+	Format string
+	Tags   []string
+	// CreatedAt и UpdatedAt - время создания и изменения в исходном сервисе, если оно известно.
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+	// Skip - причина, по которой элемент не импортируется. Пустая строка, если элемент импортируется.
+	Skip string
+}
+
+// Source - разобранный файл импорта.
+type Source interface {
+	// Count возвращает число элементов в файле.
+	Count() int
+	// Each вызывает fn для каждого элемента по порядку. Ошибка fn прерывает обход.
+	Each(fn func(Item) error) error
+}
+
+// Open разбирает файл импорта в формате format.
+func Open(format string, r io.ReaderAt, size int64) (Source, error) {
+	switch format {
+	case FormatMarkdownZip:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return newMarkdownSource(zr)
+	case FormatKeep:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return newKeepSource(zr)
+	case FormatENEX:
+		return newENEXSource(r, size)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Detect определяет формат файла импорта по его содержимому.
+func Detect(r io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, 512)
+	n, _ := r.ReadAt(head, 0)
+	head = bytes.TrimLeft(head[:n], "\ufeff \t\r\n")
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK")):
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return "", ErrUnknownFormat
+		}
+		for _, f := range zr.File {
+			if isKeepNote(f.Name) {
+				return FormatKeep, nil
+			}
+		}
+		return FormatMarkdownZip, nil
+	case bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("en-export")):
+		return FormatENEX, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// ValidFormat сообщает, является ли format поддерживаемым форматом импорта.
+func ValidFormat(format string) bool {
+	return format == FormatMarkdownZip || format == FormatENEX || format == FormatKeep
+}
+
+// readZipFile читает файл архива целиком, если он не больше MaxNoteSize.
+// Размер проверяется по прочитанным данным, а не по заголовку архива.
+func readZipFile(f *zip.File) (string, string) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", "unreadable file"
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxNoteSize+1))
+	if err != nil {
+		return "", "unreadable file"
+	}
+	if len(data) > MaxNoteSize {
+		return "", "file too large"
+	}
+	if !utf8.Valid(data) {
+		return "", "not UTF-8 text"
+	}
+	data = bytes.ReplaceAll(bytes.TrimPrefix(data, []byte("\ufeff")), []byte("\r\n"), []byte("\n"))
+	return string(data), ""
+}
+
+// hidden сообщает, что файл архива служебный и не должен упоминаться в отчете:
+// каталоги, скрытые файлы и метаданные архиваторов macOS.
+func hidden(name string) bool {
+	if strings.HasSuffix(name, "/") || strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTags удаляет пустые и повторяющиеся метки и ограничивает их длину и число.
+func normalizeTags(tags []string) []string {
+	out := []string{}
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.Join(strings.Fields(t), " ")
+		if utf8.RuneCountInString(t) > maxTagLen {
+			t = string([]rune(t)[:maxTagLen])
+		}
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+		if len(out) == maxTags {
+			break
+		}
+	}
+	return out
+}
+
+// baseName возвращает имя файла без каталога и расширения.
+func baseName(name string) string {
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipFile - файл тестового архива.
+type zipFile struct {
+	name     string
+	data     string
+	modified time.Time
+}
+
+// makeZip собирает ZIP-архив из файлов.
+func makeZip(t *testing.T, files ...zipFile) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: f.modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+// items открывает файл импорта и возвращает все его элементы.
+func items(t *testing.T, format string, r *bytes.Reader) []Item {
+	t.Helper()
+	src, err := Open(format, r, r.Size())
+	if err != nil {
+		t.Fatalf("Open(%s): %v", format, err)
+	}
+	var out []Item
+	if err := src.Each(func(item Item) error {
+		out = append(out, item)
+		return nil
+	}); err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	if len(out) != src.Count() {
+		t.Errorf("Count() = %d, Each returned %d items", src.Count(), len(out))
+	}
+	return out
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data *bytes.Reader
+		want string
+		err  error
+	}{
+		{"markdown zip", makeZip(t, zipFile{name: "a.md", data: "# a"}), FormatMarkdownZip, nil},
+		{"keep", makeZip(t, zipFile{name: "Takeout/Keep/a.json", data: "{}"}, zipFile{name: "Takeout/Keep/a.html"}), FormatKeep, nil},
+		{"enex", bytes.NewReader([]byte("\ufeff<?xml version=\"1.0\"?>\n<!DOCTYPE en-export><en-export></en-export>")), FormatENEX, nil},
+		{"other xml", bytes.NewReader([]byte("<?xml version=\"1.0\"?><rss></rss>")), "", ErrUnknownFormat},
+		{"broken zip", bytes.NewReader([]byte("PK\x03\x04broken")), "", ErrUnknownFormat},
+		{"text", bytes.NewReader([]byte("просто текст")), "", ErrUnknownFormat},
+		{"empty", bytes.NewReader(nil), "", ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.data, tt.data.Size())
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("Detect = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	if _, err := Open("csv", bytes.NewReader(nil), 0); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Open(csv): err = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	long := strings.Repeat("я", maxTagLen+10)
+	many := make([]string, maxTags+5)
+	for i := range many {
+		many[i] = strings.Repeat("a", i+1)
+	}
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"nil", nil, []string{}},
+		{"spaces", []string{"  работа  ", "личное\tи\nважное"}, []string{"работа", "личное и важное"}},
+		{"empty and duplicates", []string{"", "a", " ", "a", "b"}, []string{"a", "b"}},
+		{"long tag", []string{long}, []string{strings.Repeat("я", maxTagLen)}},
+		{"too many", many, many[:maxTags]},
+	}
+	for _, tt := range tests {
+		if got := normalizeTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: normalizeTags = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHidden(t *testing.T) {
+	tests := map[string]bool{
+		"notes/a.md":           false,
+		"a.txt":                false,
+		"notes/":               true,
+		".DS_Store":            true,
+		"notes/.obsidian/x.md": true,
+		"__MACOSX/notes/a.md":  true,
+	}
+	for name, want := range tests {
+		if got := hidden(name); got != want {
+			t.Errorf("hidden(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestReadZipFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     string
+		wantSkip string
+	}{
+		{"text", "строка", "строка", ""},
+		{"bom and crlf", "\ufeffa\r\nb\r\n", "a\nb\n", ""},
+		{"binary", "\xff\xfe\x00", "", "not UTF-8 text"},
+		{"too large", strings.Repeat("a", MaxNoteSize+1), "", "file too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := makeZip(t, zipFile{name: "a.txt", data: tt.data})
+			zr, err := zip.NewReader(r, r.Size())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, skip := readZipFile(zr.File[0])
+			if got != tt.want || skip != tt.wantSkip {
+				t.Errorf("readZipFile = %q, %q; want %q, %q", got, skip, tt.want, tt.wantSkip)
+			}
+		})
+	}
+}
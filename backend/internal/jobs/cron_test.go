@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2024, 3, 15, 10, 30, 20, 0, time.UTC) // пятница
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"* * * * *", []string{"2024-03-15 10:31", "2024-03-15 10:32"}},
+		{"*/15 * * * *", []string{"2024-03-15 10:45", "2024-03-15 11:00", "2024-03-15 11:15"}},
+		{"0 3 * * *", []string{"2024-03-16 03:00", "2024-03-17 03:00"}},
+		{"5,35 9-11 * * *", []string{"2024-03-15 10:35", "2024-03-15 11:05", "2024-03-15 11:35", "2024-03-16 09:05"}},
+		{"10-40/15 * * * *", []string{"2024-03-15 10:40", "2024-03-15 11:10", "2024-03-15 11:25"}},
+		{"30 12 1 * *", []string{"2024-04-01 12:30", "2024-05-01 12:30"}},
+		{"0 0 29 2 *", []string{"2028-02-29 00:00"}},
+		{"0 0 31 * *", []string{"2024-03-31 00:00", "2024-05-31 00:00"}},
+		// Воскресенье - и 0, и 7.
+		{"0 8 * * 0", []string{"2024-03-17 08:00", "2024-03-24 08:00"}},
+		{"0 8 * * 7", []string{"2024-03-17 08:00", "2024-03-24 08:00"}},
+		{"0 8 * * 1-5", []string{"2024-03-18 08:00", "2024-03-19 08:00"}},
+		// Если ограничены и день месяца, и день недели, подходит любой из них.
+		{"0 0 20 * 1", []string{"2024-03-18 00:00", "2024-03-20 00:00", "2024-03-25 00:00"}},
+		{"0 0 * 6 *", []string{"2024-06-01 00:00", "2024-06-02 00:00"}},
+		{"@hourly", []string{"2024-03-15 11:00", "2024-03-15 12:00"}},
+		{"@daily", []string{"2024-03-16 00:00", "2024-03-17 00:00"}},
+		{"@weekly", []string{"2024-03-17 00:00", "2024-03-24 00:00"}},
+		{"@monthly", []string{"2024-04-01 00:00", "2024-05-01 00:00"}},
+		{"@every 10m", []string{"2024-03-15 10:40", "2024-03-15 10:50"}},
+		{"@every 6h", []string{"2024-03-15 12:00", "2024-03-15 18:00"}},
+		{" 0  3 * * * ", []string{"2024-03-16 03:00"}},
+		// Никогда не срабатывает.
+		{"0 0 30 2 *", []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("parseCron: %v", err)
+			}
+			next := from
+			for _, want := range tt.want {
+				next = s.Next(next)
+				got := ""
+				if !next.IsZero() {
+					got = next.Format("2006-01-02 15:04")
+				}
+				if got != want {
+					t.Fatalf("Next = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronTimeZone(t *testing.T) {
+	s, err := parseCron("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Расписание задано в UTC независимо от зоны переданного времени: 05:00 MSK - это 02:00 UTC.
+	from := time.Date(2024, 3, 15, 5, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	if got, want := s.Next(from), time.Date(2024, 3, 15, 3, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+		"@yearly",
+		"@every",
+		"@every 10",
+		"@every 500ms",
+		"@every -1m",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q): want error", spec)
+		}
+	}
+}
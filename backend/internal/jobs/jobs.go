@@ -0,0 +1,150 @@
+// Package jobs - очередь фоновых заданий в PostgreSQL.
+//
+// Задания хранятся в таблице jobs и переживают перезапуск сервера. Обработчики забирают их
+// запросом SELECT ... FOR UPDATE SKIP LOCKED, поэтому задания можно выполнять на нескольких
+// экземплярах сервиса одновременно. Неудачное задание повторяется с экспоненциальной задержкой,
+// а после исчерпания попыток переводится в состояние dead и остается в таблице для разбора.
+// Периодические задания задаются расписанием cron (см. Schedule).
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Состояния задания.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+const (
+	// DefaultMaxAttempts - число попыток выполнения задания, если оно не задано в Task.
+	DefaultMaxAttempts = 10
+	// DefaultTimeout - время на одну попытку выполнения, если оно не задано в Task.
+	DefaultTimeout = 5 * time.Minute
+)
+
+// Task описывает тип задания с полезной нагрузкой P. Нагрузка сохраняется в JSON,
+// поэтому P должен сериализоваться в JSON без потерь.
+type Task[P any] struct {
+	// Kind - имя типа задания, по нему задание связывается с обработчиком.
+	Kind string
+	// MaxAttempts - число попыток выполнения, после которого задание переводится в dead.
+	MaxAttempts int
+	// Timeout - время на одну попытку выполнения.
+	Timeout time.Duration
+}
+
+// Option настраивает постановку задания в очередь.
+type Option func(*enqueueOptions)
+
+type enqueueOptions struct {
+	runAt     *time.Time
+	uniqueKey string
+}
+
+// RunAt откладывает выполнение задания до момента t.
+func RunAt(t time.Time) Option {
+	return func(o *enqueueOptions) { o.runAt = &t }
+}
+
+// Delay откладывает выполнение задания на d.
+func Delay(d time.Duration) Option {
+	return RunAt(time.Now().Add(d))
+}
+
+// Unique запрещает ставить в очередь задание того же типа с тем же ключом, пока предыдущее
+// ожидает выполнения или выполняется. Повторная постановка в этом случае ничего не делает.
+func Unique(key string) Option {
+	return func(o *enqueueOptions) { o.uniqueKey = key }
+}
+
+// Enqueue ставит задание в очередь и возвращает его ID. Если задание с тем же ключом Unique
+// уже в очереди, возвращается 0 и nil.
+func (t Task[P]) Enqueue(ctx context.Context, q *Queue, payload P, opts ...Option) (int64, error) {
+	var o enqueueOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = q.db.QueryRow(ctx, `INSERT INTO jobs (kind, payload, run_at, max_attempts, unique_key)
+        VALUES ($1, $2, COALESCE($3, now()), $4, NULLIF($5, ''))
+        ON CONFLICT (kind, unique_key) WHERE status IN ('queued', 'running') DO NOTHING
+        RETURNING id`, t.Kind, data, o.runAt, t.maxAttempts(), o.uniqueKey).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	q.notify()
+	return id, nil
+}
+
+func (t Task[P]) maxAttempts() int {
+	if t.MaxAttempts > 0 {
+		return t.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (t Task[P]) timeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Handle регистрирует обработчик заданий типа t. Обработчики регистрируются до вызова Queue.Start;
+// повторная регистрация того же типа - ошибка программы.
+// Ошибка обработчика приводит к повтору задания, ошибка, обернутая в Permanent, - сразу к переводу в dead.
+func Handle[P any](q *Queue, t Task[P], fn func(ctx context.Context, payload P) error) {
+	q.register(t.Kind, &handler{
+		timeout: t.timeout(),
+		run: func(ctx context.Context, data []byte) error {
+			var payload P
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return Permanent(fmt.Errorf("decode payload: %w", err))
+			}
+			return fn(ctx, payload)
+		},
+	})
+}
+
+type attemptKey struct{}
+
+// Attempt возвращает номер выполняемой попытки задания (начиная с 1) и число попыток.
+// Обработчик может узнать, что попытка последняя, и сохранить итог неудачи.
+func Attempt(ctx context.Context) (attempt, maxAttempts int) {
+	if a, ok := ctx.Value(attemptKey{}).([2]int); ok {
+		return a[0], a[1]
+	}
+	return 1, 1
+}
+
+// permanentError - ошибка, после которой задание не повторяется.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку обработчика как неустранимую повтором: задание сразу переводится в dead.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent сообщает, что ошибка помечена Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,401 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// leaseDuration - на сколько задание закрепляется за обработчиком. Пока задание выполняется,
+	// закрепление продлевается; если экземпляр сервиса упал, по истечении срока задание повторяется.
+	leaseDuration = time.Minute
+	// leaseRenewal - период продления закрепления: за срок закрепления успевают пройти несколько
+	// попыток продления, поэтому одна неудачная попытка не отдает задание другому обработчику.
+	leaseRenewal = leaseDuration / 3
+	// maintenanceInterval - период запуска заданий по расписанию и возврата заданий упавших обработчиков.
+	maintenanceInterval = 15 * time.Second
+	// pruneInterval - период удаления старых завершенных заданий.
+	pruneInterval = time.Hour
+	// doneRetention и deadRetention - сколько хранятся выполненные и невыполнимые задания.
+	doneRetention = 7 * 24 * time.Hour
+	deadRetention = 30 * 24 * time.Hour
+	// backoffBase и backoffMax - задержка перед первым повтором и максимальная задержка.
+	backoffBase = 10 * time.Second
+	backoffMax  = time.Hour
+)
+
+// Queue - очередь заданий и пул обработчиков, выполняющих их на этом экземпляре сервиса.
+type Queue struct {
+	db       database.Database
+	cfg      config.JobsConfig
+	logger   *logger.Logger
+	workerID string
+
+	handlers  map[string]*handler
+	kinds     []string
+	schedules []*schedule
+
+	wake       chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+
+	// leaseRenewal и extendLease - период и способ продления закрепления выполняемого задания.
+	leaseRenewal time.Duration
+	extendLease  func(ctx context.Context, id int64) error
+}
+
+// handler - зарегистрированный обработчик типа заданий.
+type handler struct {
+	timeout time.Duration
+	run     func(ctx context.Context, payload []byte) error
+}
+
+// job - задание, взятое обработчиком.
+type job struct {
+	id          int64
+	kind        string
+	payload     []byte
+	attempts    int
+	maxAttempts int
+}
+
+// NewQueue создает новый экземпляр Queue. Задания можно ставить в очередь сразу,
+// а выполняться они начинают после регистрации обработчиков и вызова Start.
+func NewQueue(db database.Database, cfg config.JobsConfig, logger *logger.Logger) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	q := &Queue{
+		db:           db,
+		cfg:          cfg,
+		logger:       logger,
+		workerID:     newWorkerID(),
+		handlers:     make(map[string]*handler),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		jobCtx:       jobCtx,
+		cancelJobs:   cancelJobs,
+		leaseRenewal: leaseRenewal,
+	}
+	q.extendLease = q.renewLease
+	return q
+}
+
+func (q *Queue) register(kind string, h *handler) {
+	if _, ok := q.handlers[kind]; ok {
+		panic("jobs: handler for " + kind + " already registered")
+	}
+	q.handlers[kind] = h
+	q.kinds = append(q.kinds, kind)
+}
+
+// Start сохраняет расписания периодических заданий и запускает обработчики.
+func (q *Queue) Start(ctx context.Context) error {
+	for _, s := range q.schedules {
+		_, err := q.db.Exec(ctx, `INSERT INTO job_schedules (name, spec) VALUES ($1, $2)
+            ON CONFLICT (name) DO UPDATE SET spec = EXCLUDED.spec`, s.name, s.spec)
+		if err != nil {
+			return err
+		}
+	}
+	q.wg.Add(q.cfg.Workers + 1)
+	for i := 0; i < q.cfg.Workers; i++ {
+		go q.work()
+	}
+	go q.maintain()
+	q.logger.Info("Job workers started", "workers", q.cfg.Workers, "kinds", q.kinds)
+	return nil
+}
+
+// Shutdown прекращает брать новые задания и ждет завершения выполняемых. Если контекст
+// истекает раньше, выполняемые задания прерываются и возвращаются в очередь без учета попытки.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stop) })
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancelJobs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// notify будит один из простаивающих обработчиков.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) stopping() bool {
+	select {
+	case <-q.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// work - цикл обработчика: берет задания, пока они есть, и ждет новых.
+func (q *Queue) work() {
+	defer q.wg.Done()
+	timer := time.NewTimer(q.cfg.PollInterval)
+	defer timer.Stop()
+	for !q.stopping() {
+		ran, err := q.runNext()
+		if err != nil {
+			q.logger.Error("Failed to fetch job", "error", err)
+		}
+		if ran {
+			continue
+		}
+		timer.Reset(q.cfg.PollInterval)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// runNext берет и выполняет одно готовое задание. Возвращает false, если готовых заданий нет.
+func (q *Queue) runNext() (bool, error) {
+	if len(q.kinds) == 0 {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var j job
+	err := q.db.QueryRow(ctx, `UPDATE jobs SET status='running', attempts=attempts+1, locked_by=$2,
+            locked_until=now() + make_interval(secs => $3)
+        WHERE id = (SELECT id FROM jobs WHERE status='queued' AND run_at <= now() AND kind = ANY($1)
+            ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED)
+        RETURNING id, kind, payload, attempts, max_attempts`,
+		pq.Array(q.kinds), q.workerID, leaseDuration.Seconds()).
+		Scan(&j.id, &j.kind, &j.payload, &j.attempts, &j.maxAttempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	// В очереди могут быть еще задания: будим следующий обработчик.
+	q.notify()
+	q.execute(j)
+	return true, nil
+}
+
+// execute выполняет задание и сохраняет результат.
+func (q *Queue) execute(j job) {
+	started := time.Now()
+	err := q.run(j)
+	if err != nil {
+		q.logger.Error("Job failed", "job_id", j.id, "kind", j.kind, "attempt", j.attempts, "error", err)
+	} else {
+		q.logger.Info("Job done", "job_id", j.id, "kind", j.kind, "duration", time.Since(started).String())
+	}
+	if err := q.finish(j, err); err != nil {
+		q.logger.Error("Failed to save job result", "job_id", j.id, "error", err)
+	}
+}
+
+// run выполняет задание обработчиком его типа с ограничением времени, продлевая закрепление задания.
+func (q *Queue) run(j job) error {
+	h := q.handlers[j.kind]
+	ctx, cancel := context.WithTimeout(q.jobCtx, h.timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, attemptKey{}, [2]int{j.attempts, j.maxAttempts})
+
+	done := make(chan struct{})
+	defer close(done)
+	go q.heartbeat(j.id, done)
+	return safeRun(ctx, h, j.payload)
+}
+
+// safeRun вызывает обработчик, превращая панику в ошибку.
+func safeRun(ctx context.Context, h *handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.run(ctx, payload)
+}
+
+// heartbeat продлевает закрепление задания каждые leaseRenewal, пока оно выполняется.
+// Неудачное продление не прерывает задание: следующая попытка может успеть до истечения срока.
+func (q *Queue) heartbeat(id int64, done <-chan struct{}) {
+	ticker := time.NewTicker(q.leaseRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := q.extendLease(ctx, id)
+			cancel()
+			if err != nil {
+				q.logger.Error("Failed to extend job lease", "job_id", id, "error", err)
+			}
+		}
+	}
+}
+
+// renewLease продлевает закрепление задания за этим экземпляром сервиса на leaseDuration.
+func (q *Queue) renewLease(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, `UPDATE jobs SET locked_until=now() + make_interval(secs => $3)
+        WHERE id=$1 AND locked_by=$2`, id, q.workerID, leaseDuration.Seconds())
+	return err
+}
+
+// result - итог попытки выполнения задания.
+type result struct {
+	// status - новое состояние задания: StatusDone, StatusQueued или StatusDead.
+	status string
+	// retryIn - через сколько повторить задание, вернувшееся в очередь.
+	retryIn time.Duration
+	// refund - попытка не засчитывается.
+	refund bool
+	// lastError - ошибка попытки; для выполненного задания пустая.
+	lastError string
+}
+
+// outcome определяет, что делать с заданием j после попытки, завершившейся ошибкой runErr.
+// Задание, прерванное остановкой сервера (interrupted), возвращается в очередь без учета попытки.
+// Неудачное задание повторяется с задержкой backoff, а после исчерпания попыток или ошибки,
+// помеченной Permanent, переводится в dead.
+func outcome(j job, runErr error, interrupted bool) result {
+	switch {
+	case runErr == nil:
+		return result{status: StatusDone}
+	case interrupted:
+		return result{status: StatusQueued, refund: true, lastError: "interrupted by server shutdown"}
+	case IsPermanent(runErr) || j.attempts >= j.maxAttempts:
+		return result{status: StatusDead, lastError: runErr.Error()}
+	default:
+		return result{status: StatusQueued, retryIn: backoff(j.attempts), lastError: runErr.Error()}
+	}
+}
+
+// finish сохраняет результат выполнения задания (см. outcome).
+func (q *Queue) finish(j job, runErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r := outcome(j, runErr, q.jobCtx.Err() != nil)
+	_, err := q.db.Exec(ctx, `UPDATE jobs SET status=$3, attempts = attempts - CASE WHEN $4 THEN 1 ELSE 0 END,
+            run_at = CASE WHEN $3 = 'queued' THEN now() + make_interval(secs => $5) ELSE run_at END,
+            finished_at = CASE WHEN $3 = 'queued' THEN NULL ELSE now() END,
+            last_error = COALESCE(NULLIF($6, ''), last_error), locked_by=NULL, locked_until=NULL
+        WHERE id=$1 AND locked_by=$2`, j.id, q.workerID, r.status, r.refund, r.retryIn.Seconds(), r.lastError)
+	if err == nil && r.status == StatusDead {
+		q.logger.Error("Job moved to dead letter", "job_id", j.id, "kind", j.kind, "attempts", j.attempts)
+	}
+	return err
+}
+
+// backoff возвращает задержку перед повтором после attempt неудачных попыток:
+// задержка удваивается с каждой попыткой, к ней добавляется случайная часть до 20%,
+// чтобы одновременно упавшие задания не повторялись одновременно.
+func backoff(attempt int) time.Duration {
+	d := backoffMax
+	if attempt < 20 {
+		d = min(backoffBase<<(attempt-1), backoffMax)
+	}
+	return d + time.Duration(mrand.Int64N(int64(d)/5+1))
+}
+
+// maintain периодически запускает задания по расписанию, возвращает в очередь задания
+// упавших экземпляров сервиса и удаляет старые завершенные задания.
+func (q *Queue) maintain() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+	var prunedAt time.Time
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := q.reap(ctx); err != nil {
+			q.logger.Error("Failed to requeue abandoned jobs", "error", err)
+		}
+		if err := q.runSchedules(ctx); err != nil {
+			q.logger.Error("Failed to enqueue scheduled jobs", "error", err)
+		}
+		if time.Since(prunedAt) >= pruneInterval {
+			prunedAt = time.Now()
+			if err := q.prune(ctx); err != nil {
+				q.logger.Error("Failed to prune finished jobs", "error", err)
+			}
+		}
+		cancel()
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap возвращает в очередь задания, закрепление которых истекло: выполнявший их экземпляр
+// сервиса остановился аварийно. Если попытки исчерпаны, задание переводится в dead.
+func (q *Queue) reap(ctx context.Context) error {
+	res, err := q.db.Exec(ctx, `UPDATE jobs SET
+            status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'queued' END,
+            finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+            run_at=now(), last_error='worker lost', locked_by=NULL, locked_until=NULL
+        WHERE status='running' AND locked_until < now()`)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		q.logger.Info("Requeued abandoned jobs", "count", n)
+		q.notify()
+	}
+	return nil
+}
+
+// prune удаляет выполненные задания старше doneRetention и невыполнимые старше deadRetention.
+func (q *Queue) prune(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, `DELETE FROM jobs
+        WHERE (status='done' AND finished_at < now() - make_interval(secs => $1))
+        OR (status='dead' AND finished_at < now() - make_interval(secs => $2))`,
+		doneRetention.Seconds(), deadRetention.Seconds())
+	return err
+}
+
+// newWorkerID возвращает идентификатор экземпляра сервиса, которым помечаются взятые им задания.
+func newWorkerID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
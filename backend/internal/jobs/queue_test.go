@@ -0,0 +1,300 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// newTestQueue возвращает очередь без базы данных: задания выполняются напрямую через run,
+// а продления закрепления записываются в leases.
+func newTestQueue(t *testing.T) (*Queue, *leaseLog) {
+	t.Helper()
+	q := NewQueue(nil, config.JobsConfig{}, logger.InitLogger(io.Discard))
+	t.Cleanup(q.cancelJobs)
+	leases := &leaseLog{}
+	q.leaseRenewal = 5 * time.Millisecond
+	q.extendLease = leases.extend
+	return q, leases
+}
+
+// leaseLog запоминает продления закрепления заданий.
+type leaseLog struct {
+	mu  sync.Mutex
+	ids []int64
+	err error
+}
+
+func (l *leaseLog) extend(_ context.Context, id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids = append(l.ids, id)
+	return l.err
+}
+
+func (l *leaseLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.ids)
+}
+
+type testPayload struct {
+	Text string `json:"text"`
+}
+
+func TestOutcome(t *testing.T) {
+	failure := errors.New("temporary failure")
+	tests := []struct {
+		name        string
+		attempts    int
+		err         error
+		interrupted bool
+		want        result
+	}{
+		{"success", 1, nil, false, result{status: StatusDone}},
+		{"success during shutdown", 3, nil, true, result{status: StatusDone}},
+		{"first failure", 1, failure, false, result{status: StatusQueued, retryIn: backoffBase, lastError: "temporary failure"}},
+		{"later failure", 4, failure, false, result{status: StatusQueued, retryIn: 8 * backoffBase, lastError: "temporary failure"}},
+		{"last attempt", 5, failure, false, result{status: StatusDead, lastError: "temporary failure"}},
+		{"attempts exceeded", 6, failure, false, result{status: StatusDead, lastError: "temporary failure"}},
+		{"permanent", 1, Permanent(failure), false, result{status: StatusDead, lastError: "temporary failure"}},
+		{"wrapped permanent", 1, fmt.Errorf("save: %w", Permanent(failure)), false, result{status: StatusDead, lastError: "save: temporary failure"}},
+		{"interrupted", 2, context.Canceled, true, result{status: StatusQueued, refund: true, lastError: "interrupted by server shutdown"}},
+		{"interrupted last attempt", 5, failure, true, result{status: StatusQueued, refund: true, lastError: "interrupted by server shutdown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := outcome(job{id: 1, attempts: tt.attempts, maxAttempts: 5}, tt.err, tt.interrupted)
+			// Задержка повтора содержит случайную часть до 20%.
+			if got.retryIn < tt.want.retryIn || got.retryIn > tt.want.retryIn+tt.want.retryIn/5 {
+				t.Errorf("retryIn = %v, want %v + up to 20%%", got.retryIn, tt.want.retryIn)
+			}
+			got.retryIn = tt.want.retryIn
+			if got != tt.want {
+				t.Errorf("outcome = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{19, time.Hour},
+		{20, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := backoff(tt.attempt); got < tt.want || got > tt.want+tt.want/5 {
+				t.Fatalf("backoff(%d) = %v, want %v + up to 20%%", tt.attempt, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	q, leases := newTestQueue(t)
+	task := Task[testPayload]{Kind: "test", MaxAttempts: 5, Timeout: time.Second}
+	var gotPayload testPayload
+	var gotAttempt, gotMax int
+	var deadline time.Duration
+	Handle(q, task, func(ctx context.Context, p testPayload) error {
+		gotPayload = p
+		gotAttempt, gotMax = Attempt(ctx)
+		if d, ok := ctx.Deadline(); ok {
+			deadline = time.Until(d)
+		}
+		return nil
+	})
+
+	if err := q.run(job{id: 7, kind: "test", payload: []byte(`{"text":"заметка"}`), attempts: 2, maxAttempts: 5}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if gotPayload.Text != "заметка" || gotAttempt != 2 || gotMax != 5 {
+		t.Errorf("handler got %+v, attempt %d of %d", gotPayload, gotAttempt, gotMax)
+	}
+	if deadline <= 0 || deadline > time.Second {
+		t.Errorf("handler deadline in %v, want at most the task timeout", deadline)
+	}
+	if leases.count() != 0 {
+		t.Errorf("lease extended %d times for a quick job", leases.count())
+	}
+
+	// Нагрузку, которую нельзя разобрать, повторять бесполезно.
+	if err := q.run(job{id: 8, kind: "test", payload: []byte(`{"text":1}`), attempts: 1, maxAttempts: 5}); !IsPermanent(err) {
+		t.Errorf("run with an invalid payload: err = %v, want a permanent error", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	q, _ := newTestQueue(t)
+	failure := errors.New("failure")
+	Handle(q, Task[testPayload]{Kind: "fail"}, func(context.Context, testPayload) error { return failure })
+	Handle(q, Task[testPayload]{Kind: "panic"}, func(context.Context, testPayload) error { panic("boom") })
+	Handle(q, Task[testPayload]{Kind: "slow", Timeout: 20 * time.Millisecond}, func(ctx context.Context, _ testPayload) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{"fail", "failure"},
+		{"panic", "panic: boom"},
+		{"slow", context.DeadlineExceeded.Error()},
+	}
+	for _, tt := range tests {
+		err := q.run(job{id: 1, kind: tt.kind, payload: []byte("{}"), attempts: 1, maxAttempts: 3})
+		if err == nil || err.Error() != tt.want || IsPermanent(err) {
+			t.Errorf("run(%s): err = %v, want %q", tt.kind, err, tt.want)
+		}
+	}
+}
+
+func TestRunExtendsLease(t *testing.T) {
+	q, leases := newTestQueue(t)
+	// Ошибка продления не прерывает задание.
+	leases.err = errors.New("database is unavailable")
+	release := make(chan struct{})
+	Handle(q, Task[testPayload]{Kind: "long"}, func(ctx context.Context, _ testPayload) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- q.run(job{id: 42, kind: "long", payload: []byte("{}"), attempts: 1, maxAttempts: 1}) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for leases.count() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lease extended %d times, want at least 3", leases.count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// После завершения задания закрепление больше не продлевается.
+	n := leases.count()
+	time.Sleep(5 * q.leaseRenewal)
+	if got := leases.count(); got != n {
+		t.Errorf("lease extended %d more times after the job finished", got-n)
+	}
+	leases.mu.Lock()
+	defer leases.mu.Unlock()
+	for _, id := range leases.ids {
+		if id != 42 {
+			t.Fatalf("extended lease of job %d, want 42", id)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		// jobTime - сколько выполняется задание; timeout - сколько Shutdown ждет его завершения.
+		jobTime, timeout time.Duration
+		wantErr          error
+		want             result
+	}{
+		{"drained", 10 * time.Millisecond, 5 * time.Second, nil, result{status: StatusDone}},
+		{"interrupted", time.Hour, 20 * time.Millisecond, context.DeadlineExceeded,
+			result{status: StatusQueued, refund: true, lastError: "interrupted by server shutdown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newTestQueue(t)
+			started := make(chan struct{})
+			Handle(q, Task[testPayload]{Kind: "job", Timeout: 2 * time.Hour}, func(ctx context.Context, _ testPayload) error {
+				close(started)
+				select {
+				case <-time.After(tt.jobTime):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+
+			// Задание выполняется так же, как в work, но без обращения к базе данных.
+			j := job{id: 1, kind: "job", payload: []byte("{}"), attempts: 3, maxAttempts: 3}
+			var got result
+			q.wg.Add(1)
+			go func() {
+				defer q.wg.Done()
+				got = outcome(j, q.run(j), q.jobCtx.Err() != nil)
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := q.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Shutdown: err = %v, want %v", err, tt.wantErr)
+			}
+			if !q.stopping() {
+				t.Error("queue is not stopping after Shutdown")
+			}
+			if got != tt.want {
+				t.Errorf("outcome = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleTwice(t *testing.T) {
+	q, _ := newTestQueue(t)
+	task := Task[testPayload]{Kind: "twice"}
+	Handle(q, task, func(context.Context, testPayload) error { return nil })
+	defer func() {
+		if recover() == nil {
+			t.Error("second Handle for the same kind did not panic")
+		}
+	}()
+	Handle(q, task, func(context.Context, testPayload) error { return nil })
+}
+
+func TestTaskDefaults(t *testing.T) {
+	tests := []struct {
+		task        Task[testPayload]
+		maxAttempts int
+		timeout     time.Duration
+	}{
+		{Task[testPayload]{Kind: "a"}, DefaultMaxAttempts, DefaultTimeout},
+		{Task[testPayload]{Kind: "b", MaxAttempts: 3, Timeout: time.Minute}, 3, time.Minute},
+		{Task[testPayload]{Kind: "c", MaxAttempts: -1, Timeout: -time.Second}, DefaultMaxAttempts, DefaultTimeout},
+	}
+	for _, tt := range tests {
+		if got := tt.task.maxAttempts(); got != tt.maxAttempts {
+			t.Errorf("%s: maxAttempts = %d, want %d", tt.task.Kind, got, tt.maxAttempts)
+		}
+		if got := tt.task.timeout(); got != tt.timeout {
+			t.Errorf("%s: timeout = %v, want %v", tt.task.Kind, got, tt.timeout)
+		}
+	}
+}
+
+func TestAttemptWithoutJob(t *testing.T) {
+	if attempt, max := Attempt(context.Background()); attempt != 1 || max != 1 {
+		t.Errorf("Attempt outside a job = %d, %d; want 1, 1", attempt, max)
+	}
+}
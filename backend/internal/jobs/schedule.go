@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxCatchUp - сколько пропущенных моментов запуска просматривается, чтобы найти последний.
+// После простоя сервиса пропущенные запуски не повторяются: задание выполняется один раз.
+const maxCatchUp = 100000
+
+// schedule - периодическое задание.
+type schedule struct {
+	name        string
+	spec        string
+	cron        cronSchedule
+	kind        string
+	payload     []byte
+	maxAttempts int
+}
+
+// Schedule регистрирует периодическое задание name: по расписанию spec (см. parseCron) в очередь
+// ставится задание типа t с нагрузкой payload. Момент последнего запуска хранится в таблице
+// job_schedules, поэтому при нескольких экземплярах сервиса задание ставится в очередь один раз.
+// Пока предыдущее задание расписания не выполнено, следующее не ставится.
+// Расписания регистрируются до вызова Queue.Start.
+func Schedule[P any](q *Queue, name, spec string, t Task[P], payload P) error {
+	cron, err := parseCron(spec)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.schedules = append(q.schedules, &schedule{
+		name: name, spec: spec, cron: cron, kind: t.Kind, payload: data, maxAttempts: t.maxAttempts(),
+	})
+	return nil
+}
+
+// runSchedules ставит в очередь задания расписаний, момент запуска которых наступил.
+func (q *Queue) runSchedules(ctx context.Context) error {
+	if len(q.schedules) == 0 {
+		return nil
+	}
+	names := make([]string, len(q.schedules))
+	for i, s := range q.schedules {
+		names[i] = s.name
+	}
+	rows, err := q.db.Query(ctx, "SELECT name, last_run_at FROM job_schedules WHERE name = ANY($1)", pq.Array(names))
+	if err != nil {
+		return err
+	}
+	lastRun := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var t time.Time
+		if err := rows.Scan(&name, &t); err != nil {
+			rows.Close()
+			return err
+		}
+		lastRun[name] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range q.schedules {
+		last, ok := lastRun[s.name]
+		if !ok {
+			continue
+		}
+		due := s.cron.Next(last)
+		if due.IsZero() || due.After(now) {
+			continue
+		}
+		for i := 0; i < maxCatchUp; i++ {
+			next := s.cron.Next(due)
+			if next.IsZero() || next.After(now) {
+				break
+			}
+			due = next
+		}
+
+		// Момент запуска фиксируется условным обновлением: если другой экземпляр уже поставил
+		// задание за этот момент, строка не обновится и задание не будет создано.
+		res, err := q.db.Exec(ctx, `WITH claimed AS (
+                UPDATE job_schedules SET last_run_at=$2 WHERE name=$1 AND last_run_at < $2 RETURNING name)
+            INSERT INTO jobs (kind, payload, max_attempts, unique_key)
+            SELECT $3, $4, $5, 'schedule:' || name FROM claimed
+            ON CONFLICT (kind, unique_key) WHERE status IN ('queued', 'running') DO NOTHING`,
+			s.name, due, s.kind, s.payload, s.maxAttempts)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			q.notify()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func TestPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK := Key{Kty: "RSA", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())}
+	ecJWK := Key{Kty: "EC", Crv: "P-384", X: b64(ecKey.X.Bytes()), Y: b64(ecKey.Y.Bytes())}
+	edJWK := Key{Kty: "OKP", Crv: "Ed25519", X: b64(edPub)}
+
+	pub, err := rsaJWK.PublicKey()
+	if err != nil || !rsaKey.PublicKey.Equal(pub) {
+		t.Errorf("RSA: PublicKey = %v, %v", pub, err)
+	}
+	pub, err = ecJWK.PublicKey()
+	if err != nil || !ecKey.PublicKey.Equal(pub) {
+		t.Errorf("EC: PublicKey = %v, %v", pub, err)
+	}
+	pub, err = edJWK.PublicKey()
+	if err != nil || !edPub.Equal(pub) {
+		t.Errorf("OKP: PublicKey = %v, %v", pub, err)
+	}
+
+	modify := func(k Key, f func(*Key)) Key {
+		f(&k)
+		return k
+	}
+	invalid := map[string]Key{
+		"unknown key type":       {Kty: "oct"},
+		"empty modulus":          modify(rsaJWK, func(k *Key) { k.N = "" }),
+		"invalid base64":         modify(rsaJWK, func(k *Key) { k.N = "not base64!" }),
+		"exponent 1":             modify(rsaJWK, func(k *Key) { k.E = b64([]byte{1}) }),
+		"huge exponent":          modify(rsaJWK, func(k *Key) { k.E = b64(append([]byte{1}, make([]byte, 8)...)) }),
+		"unknown curve":          modify(ecJWK, func(k *Key) { k.Crv = "secp256k1" }),
+		"curve mismatch":         modify(ecJWK, func(k *Key) { k.Crv = "P-256" }),
+		"point not on curve":     modify(ecJWK, func(k *Key) { k.Y = b64([]byte{1}) }),
+		"missing y":              modify(ecJWK, func(k *Key) { k.Y = "" }),
+		"OKP with other curve":   modify(edJWK, func(k *Key) { k.Crv = "X25519" }),
+		"short Ed25519 key":      modify(edJWK, func(k *Key) { k.X = b64(edPub[:16]) }),
+		"Ed25519 invalid base64": modify(edJWK, func(k *Key) { k.X = "***" }),
+	}
+	for name, k := range invalid {
+		if pub, err := k.PublicKey(); err == nil {
+			t.Errorf("%s: PublicKey = %v, want error", name, pub)
+		}
+	}
+}
+
+// publicKey - открытые ключи стандартной библиотеки, которые умеют сравниваться.
+type publicKey interface {
+	Equal(x crypto.PublicKey) bool
+}
+
+func TestFromPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]publicKey{"RS256": &rsaKey.PublicKey, "EdDSA": edPub}
+	for alg, curve := range map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()} {
+		ecKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[alg] = &ecKey.PublicKey
+	}
+
+	for alg, pub := range keys {
+		k, err := FromPublicKey("kid", alg, pub)
+		if err != nil {
+			t.Fatalf("FromPublicKey(%T): %v", pub, err)
+		}
+		if k.Kid != "kid" || k.Alg != alg || k.Use != "sig" {
+			t.Errorf("FromPublicKey(%T) = %+v", pub, k)
+		}
+		if k.Kty == "EC" {
+			// Координаты имеют фиксированную длину независимо от ведущих нулей.
+			size := (pub.(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+			if n := base64.RawURLEncoding.DecodedLen(len(k.X)); n != size || len(k.Y) != len(k.X) {
+				t.Errorf("%s coordinates are %d and %d characters, want %d bytes", k.Crv, len(k.X), len(k.Y), size)
+			}
+		}
+		got, err := k.PublicKey()
+		if err != nil || !pub.Equal(got) {
+			t.Errorf("round trip of %+v: %v, %v", k, got, err)
+		}
+	}
+
+	if _, err := FromPublicKey("kid", "HS256", []byte("secret")); err == nil {
+		t.Error("FromPublicKey with a symmetric key: want error")
+	}
+}
+
+func TestFind(t *testing.T) {
+	set := &Set{Keys: []Key{{Kid: "a", Kty: "RSA"}, {Kid: "b", Kty: "EC"}}}
+	if k, ok := set.Find("b"); !ok || k.Kty != "EC" {
+		t.Errorf("Find(b) = %+v, %v", k, ok)
+	}
+	if k, ok := set.Find("c"); ok {
+		t.Errorf("Find(c) = %+v, want not found", k)
+	}
+	if _, ok := (&Set{}).Find(""); ok {
+		t.Error("Find in an empty set found a key")
+	}
+}
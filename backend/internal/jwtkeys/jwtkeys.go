@@ -0,0 +1,212 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID - идентификатор симметричного ключа из JWT_KEY, который используется,
+// если асимметричные ключи не настроены.
+const legacyKeyID = "hs256"
+
+// Key - ключ подписи JWT токенов.
+// У ключей, оставленных только для проверки (выведенных из оборота), signKey равен nil.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign сообщает, можно ли подписывать этим ключом.
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// SignKey возвращает ключ в виде, который ожидает jwt.Token.SignedString.
+func (k *Key) SignKey() interface{} {
+	return k.signKey
+}
+
+// VerifyKey возвращает ключ в виде, который ожидает функция выбора ключа jwt.Keyfunc.
+func (k *Key) VerifyKey() interface{} {
+	return k.verifyKey
+}
+
+// KeySet - набор ключей подписи: один активный ключ, которым подписываются новые токены,
+// и ключи, которыми токены только проверяются. Ключи различаются по идентификатору kid
+// в заголовке токена, поэтому смена активного ключа не делает выданные токены недействительными.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// Load загружает ключи подписи согласно конфигурации.
+// Если задан KeysDir, из него загружаются все файлы *.pem: закрытые ключи (RSA, ECDSA, Ed25519)
+// и открытые ключи выведенных из оборота ключей. Идентификатор ключа - имя файла без расширения.
+// Иначе используется симметричный ключ HMACKey с алгоритмом HS256.
+func Load(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.KeysDir == "" {
+		if cfg.HMACKey == "" {
+			return nil, errors.New("jwtkeys: neither JWT_KEYS_DIR nor JWT_KEY is set")
+		}
+		key := &Key{ID: legacyKeyID, Method: jwt.SigningMethodHS256, signKey: []byte(cfg.HMACKey), verifyKey: []byte(cfg.HMACKey)}
+		return &KeySet{active: key, keys: map[string]*Key{key.ID: key}}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: make(map[string]*Key)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("jwtkeys: %s: %w", path, err)
+		}
+		set.keys[kid] = key
+	}
+
+	active, ok := set.keys[cfg.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwtkeys: active key %q not found in %s", cfg.ActiveKeyID, cfg.KeysDir)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("jwtkeys: active key %q has no private key", cfg.ActiveKeyID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// Active возвращает ключ, которым подписываются новые токены.
+func (s *KeySet) Active() *Key {
+	return s.active
+}
+
+// Lookup возвращает ключ по идентификатору.
+func (s *KeySet) Lookup(kid string) (*Key, bool) {
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Algorithms возвращает алгоритмы всех ключей набора.
+// Токены с другими алгоритмами (в том числе "none") отклоняются до проверки подписи.
+func (s *KeySet) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range s.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWKS возвращает открытые ключи набора для публикации другим сервисам.
+// Симметричные ключи не публикуются.
+func (s *KeySet) JWKS() (jwk.Set, error) {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, id := range ids {
+		key := s.keys[id]
+		if _, symmetric := key.verifyKey.([]byte); symmetric {
+			continue
+		}
+		k, err := jwk.FromPublicKey(key.ID, key.Method.Alg(), key.verifyKey)
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, k)
+	}
+	return set, nil
+}
+
+// parseKey разбирает PEM-файл с закрытым или открытым ключом и определяет алгоритм подписи по типу ключа.
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Для закрытого ключа открытая часть вычисляется из него.
+	if private != nil {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", private)
+		}
+		public = signer.Public()
+	}
+
+	key := &Key{ID: kid, signKey: private, verifyKey: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			key.Method = jwt.SigningMethodES256
+		case 384:
+			key.Method = jwt.SigningMethodES384
+		case 521:
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	return key, nil
+}
@@ -0,0 +1,238 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// privatePEM кодирует закрытый ключ в PKCS#8.
+func privatePEM(t *testing.T, key crypto.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// publicPEM кодирует открытый ключ в PKIX.
+func publicPEM(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func mustRSA(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustEC(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey := mustRSA(t, 2048)
+	ecKey := mustEC(t, elliptic.P256())
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384, ec521 := mustEC(t, elliptic.P384()), mustEC(t, elliptic.P521())
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		method  jwt.SigningMethod
+		canSign bool
+		wantErr bool
+	}{
+		{"rsa pkcs8", privatePEM(t, rsaKey), jwt.SigningMethodRS256, true, false},
+		{"rsa pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), jwt.SigningMethodRS256, true, false},
+		{"rsa public", publicPEM(t, &rsaKey.PublicKey), jwt.SigningMethodRS256, false, false},
+		{"ec p256", privatePEM(t, ecKey), jwt.SigningMethodES256, true, false},
+		{"ec sec1", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), jwt.SigningMethodES256, true, false},
+		{"ec p384", privatePEM(t, ec384), jwt.SigningMethodES384, true, false},
+		{"ec p521 public", publicPEM(t, &ec521.PublicKey), jwt.SigningMethodES512, false, false},
+		{"ed25519", privatePEM(t, edKey), jwt.SigningMethodEdDSA, true, false},
+		{"short rsa", privatePEM(t, mustRSA(t, 1024)), nil, false, true},
+		{"unsupported curve", privatePEM(t, mustEC(t, elliptic.P224())), nil, false, true},
+		{"unsupported block", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), nil, false, true},
+		{"broken der", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}}), nil, false, true},
+		{"not pem", []byte("secret"), nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseKey("k1", tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseKey: want error, got %s key", key.Method.Alg())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKey: %v", err)
+			}
+			if key.ID != "k1" || key.Method != tt.method || key.CanSign() != tt.canSign {
+				t.Errorf("parseKey = {%s %s canSign=%v}, want {k1 %s canSign=%v}",
+					key.ID, key.Method.Alg(), key.CanSign(), tt.method.Alg(), tt.canSign)
+			}
+			if key.VerifyKey() == nil {
+				t.Error("VerifyKey() = nil")
+			}
+		})
+	}
+}
+
+func TestLoadHMAC(t *testing.T) {
+	set, err := Load(config.JWTConfig{HMACKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := set.Active()
+	if active.ID != legacyKeyID || active.Method != jwt.SigningMethodHS256 || !active.CanSign() {
+		t.Errorf("Active() = {%s %s}, want {%s HS256}", active.ID, active.Method.Alg(), legacyKeyID)
+	}
+	if got := set.Algorithms(); !reflect.DeepEqual(got, []string{"HS256"}) {
+		t.Errorf("Algorithms() = %v, want [HS256]", got)
+	}
+	jwks, err := set.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 0 {
+		t.Errorf("JWKS() publishes %d symmetric keys, want none", len(jwks.Keys))
+	}
+
+	if _, err := Load(config.JWTConfig{}); err == nil {
+		t.Error("Load without keys: want error")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	oldKey := mustRSA(t, 2048)
+	newKey := mustEC(t, elliptic.P256())
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"2024-old.pem": publicPEM(t, &oldKey.PublicKey),
+		"2025-new.pem": privatePEM(t, newKey),
+		"readme.txt":   []byte("не ключ"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set, err := Load(config.JWTConfig{KeysDir: dir, ActiveKeyID: "2025-new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Active().ID != "2025-new" {
+		t.Errorf("Active().ID = %q, want 2025-new", set.Active().ID)
+	}
+	if old, ok := set.Lookup("2024-old"); !ok || old.CanSign() {
+		t.Errorf("Lookup(2024-old) = %v, %v; want verify-only key", old, ok)
+	}
+	if _, ok := set.Lookup("readme"); ok {
+		t.Error("Lookup(readme) found a key from a non-PEM file")
+	}
+	if got := set.Algorithms(); !reflect.DeepEqual(got, []string{"ES256", "RS256"}) {
+		t.Errorf("Algorithms() = %v, want [ES256 RS256]", got)
+	}
+
+	// Токен, подписанный активным ключом, проверяется ключом из набора по kid.
+	token := jwt.NewWithClaims(set.Active().Method, jwt.MapClaims{"sub": "1"})
+	token.Header["kid"] = set.Active().ID
+	signed, err := token.SignedString(set.Active().SignKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(signed, func(tok *jwt.Token) (interface{}, error) {
+		kid, _ := tok.Header["kid"].(string)
+		key, ok := set.Lookup(kid)
+		if !ok {
+			t.Fatalf("Lookup(%q) failed", kid)
+		}
+		return key.VerifyKey(), nil
+	}, jwt.WithValidMethods(set.Algorithms()))
+	if err != nil {
+		t.Errorf("parse token signed with active key: %v", err)
+	}
+
+	jwks, err := set.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "2024-old" || jwks.Keys[1].Kid != "2025-new" {
+		t.Fatalf("JWKS() = %+v, want keys 2024-old and 2025-new", jwks.Keys)
+	}
+	for _, k := range jwks.Keys {
+		pub, err := k.PublicKey()
+		if err != nil {
+			t.Fatalf("JWKS key %s: %v", k.Kid, err)
+		}
+		key, _ := set.Lookup(k.Kid)
+		if eq, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !eq.Equal(key.VerifyKey()) {
+			t.Errorf("JWKS key %s does not match the loaded key", k.Kid)
+		}
+	}
+}
+
+func TestLoadDirErrors(t *testing.T) {
+	rsaKey := mustRSA(t, 2048)
+	tests := []struct {
+		name   string
+		files  map[string][]byte
+		active string
+	}{
+		{"missing active key", map[string][]byte{"a.pem": privatePEM(t, rsaKey)}, "b"},
+		{"active key without private part", map[string][]byte{"a.pem": publicPEM(t, &rsaKey.PublicKey)}, "a"},
+		{"broken key file", map[string][]byte{"a.pem": privatePEM(t, rsaKey), "b.pem": []byte("broken")}, "a"},
+		{"empty dir", nil, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := Load(config.JWTConfig{KeysDir: dir, ActiveKeyID: tt.active}); err == nil {
+				t.Error("Load: want error")
+			}
+		})
+	}
+}
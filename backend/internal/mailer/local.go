@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// LogMailer не отправляет письма, а записывает их в лог.
+// Используется по умолчанию при локальной разработке.
+type LogMailer struct {
+	from   string
+	logger *logger.Logger
+}
+
+// NewLogMailer создает новый экземпляр LogMailer.
+func NewLogMailer(from string, logger *logger.Logger) *LogMailer {
+	return &LogMailer{from: from, logger: logger}
+}
+
+// Send записывает письмо в лог.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.Info("Email", "from", m.from, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer сохраняет каждое письмо в отдельный .eml файл в заданном каталоге.
+// Позволяет проверять содержимое писем в тестах без почтового сервера.
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer создает новый экземпляр FileMailer.
+func NewFileMailer(from, dir string) *FileMailer {
+	return &FileMailer{from: from, dir: dir}
+}
+
+// Send сохраняет письмо в файл.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	// Имя файла начинается с метки времени, чтобы письма сортировались по порядку отправки.
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), randomID())
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// Message описывает текстовое письмо, отправляемое пользователю.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer определяет интерфейс для отправки писем.
+// Реализации: SMTPMailer для реальной отправки, LogMailer и FileMailer
+// для разработки и тестов без доступа к почтовому серверу.
+type Mailer interface {
+	// Send отправляет письмо. Контекст ограничивает время отправки.
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создает Mailer в соответствии с драйвером, указанным в конфигурации.
+func New(cfg config.MailerConfig, logger *logger.Logger) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.Dir), nil
+	case "log", "":
+		return NewLogMailer(cfg.From, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Driver)
+	}
+}
+
+// buildMessage формирует письмо в формате RFC 5322 с телом в кодировке quoted-printable.
+func buildMessage(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Заголовки письма. Тема кодируется, так как может содержать кириллицу.
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@notes_app>\r\n", randomID())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	// Тело письма.
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// randomID возвращает случайный идентификатор для заголовка Message-ID и имен файлов.
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
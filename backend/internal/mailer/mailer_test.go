@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+// parseMessage разбирает письмо и декодирует его тему и тело.
+func parseMessage(t *testing.T, data []byte) (*mail.Message, string, string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decode subject: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return m, subject, string(body)
+}
+
+func TestBuildMessage(t *testing.T) {
+	body := "Здравствуйте!\n\nДля сброса пароля перейдите по ссылке: https://notes.example.com/reset?token=" +
+		strings.Repeat("ab", 40) + "\n"
+	msg := Message{To: "alice@example.com", Subject: "Сброс пароля", Body: body}
+	data, err := buildMessage("noreply@example.com", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, subject, gotBody := parseMessage(t, data)
+	headers := map[string]string{
+		"From":                      "noreply@example.com",
+		"To":                        "alice@example.com",
+		"Mime-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for name, want := range headers {
+		if got := m.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if subject != msg.Subject {
+		t.Errorf("Subject = %q, want %q", subject, msg.Subject)
+	}
+	if _, err := m.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := m.Header.Get("Message-Id"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@notes_app>") {
+		t.Errorf("Message-ID = %q", id)
+	}
+	// Переводы строк в теле письма заменяются на CRLF.
+	if want := strings.ReplaceAll(body, "\n", "\r\n"); gotBody != want {
+		t.Errorf("body = %q, want %q", gotBody, want)
+	}
+	// Строки тела не длиннее 76 символов (RFC 2045), иначе длинные ссылки ломаются почтовыми серверами.
+	_, encoded, _ := strings.Cut(string(data), "\r\n\r\n")
+	for _, line := range strings.Split(encoded, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("line of %d characters: %q", len(line), line)
+		}
+	}
+
+	other, err := buildMessage("noreply@example.com", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2, _, _ := parseMessage(t, other); m2.Header.Get("Message-Id") == m.Header.Get("Message-Id") {
+		t.Error("two messages have the same Message-ID")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer("noreply@example.com", dir)
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to, Subject: "Тема", Body: "Текст"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d files in the mail directory, want 2", len(entries))
+	}
+	// Файлы сортируются в порядке отправки.
+	for i, to := range []string{"alice@example.com", "bob@example.com"} {
+		if !strings.HasSuffix(entries[i].Name(), ".eml") {
+			t.Errorf("file name %q, want .eml", entries[i].Name())
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entries[i].Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, subject, body := parseMessage(t, data)
+		if msg.Header.Get("To") != to || subject != "Тема" || body != "Текст" {
+			t.Errorf("file %d: to %q, subject %q, body %q", i, msg.Header.Get("To"), subject, body)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	log := logger.InitLogger(io.Discard)
+	tests := []struct {
+		driver string
+		want   Mailer
+	}{
+		{"", &LogMailer{}},
+		{"log", &LogMailer{}},
+		{"file", &FileMailer{}},
+		{"smtp", &SMTPMailer{}},
+	}
+	for _, tt := range tests {
+		m, err := New(config.MailerConfig{Driver: tt.driver, Dir: t.TempDir()}, log)
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.driver, err)
+			continue
+		}
+		if got, want := fmt.Sprintf("%T", m), fmt.Sprintf("%T", tt.want); got != want {
+			t.Errorf("New(%q) = %s, want %s", tt.driver, got, want)
+		}
+	}
+	if _, err := New(config.MailerConfig{Driver: "sendmail"}, log); err == nil {
+		t.Error("New with an unknown driver: want error")
+	}
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+)
+
+// SMTPMailer отправляет письма через SMTP-сервер.
+// Если сервер поддерживает STARTTLS, соединение шифруется.
+type SMTPMailer struct {
+	cfg config.MailerConfig
+}
+
+// NewSMTPMailer создает новый экземпляр SMTPMailer с заданными настройками.
+func NewSMTPMailer(cfg config.MailerConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send отправляет письмо через SMTP-сервер.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+
+	// Устанавливаем соединение с учетом контекста, чтобы не зависнуть на недоступном сервере.
+	addr := net.JoinHostPort(m.cfg.SMTPHost, m.cfg.SMTPPort)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// Включаем шифрование, если сервер его поддерживает.
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.SMTPHost}); err != nil {
+			return err
+		}
+	}
+
+	// Аутентифицируемся, если заданы учетные данные.
+	if m.cfg.SMTPUser != "" {
+		auth := smtp.PlainAuth("", m.cfg.SMTPUser, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	// Передаем конверт и содержимое письма.
+	if err := c.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,511 @@
+package markdown
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// spanLimit - максимальное расстояние в байтах от открывающего до закрывающего разделителя
+	// выделения, кода или ссылки. Ограничивает время разбора текста с большим числом незакрытых разделителей.
+	spanLimit = 4096
+	// maxInlineDepth - максимальная вложенность выделения и ссылок.
+	maxInlineDepth = 16
+)
+
+// linkRel - атрибут rel ссылок из заметок: поисковые системы не учитывают ссылки пользователей,
+// а открытая страница не получает доступ к окну и адресу заметки.
+const linkRel = "nofollow noopener noreferrer"
+
+// renderInline выводит строчную разметку текста. Если plain равен true, выводится только текст без HTML,
+// например для оглавления.
+func renderInline(out *strings.Builder, s string, plain bool) {
+	p := &inlineParser{out: out, plain: plain}
+	p.render(s)
+}
+
+// inlineParser выводит строчную разметку.
+type inlineParser struct {
+	out    *strings.Builder
+	plain  bool
+	depth  int
+	inLink bool
+	idx    *spanIndex
+}
+
+func (p *inlineParser) render(s string) {
+	saved := p.idx
+	p.idx = newSpanIndex(s)
+	defer func() { p.idx = saved }()
+	for i := 0; i < len(s); {
+		if n := p.special(s, i); n > 0 {
+			i += n
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if string(c) == hardBreak {
+			p.html("<br>\n")
+			if p.plain {
+				p.out.WriteString(" ")
+			}
+		} else {
+			p.text(s[i : i+size])
+		}
+		i += size
+	}
+}
+
+// special пытается разобрать конструкцию разметки в позиции i и возвращает число разобранных байт
+// или 0, если в этой позиции обычный текст.
+func (p *inlineParser) special(s string, i int) int {
+	switch s[i] {
+	case '\\':
+		if i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			p.text(s[i+1 : i+2])
+			return 2
+		}
+	case '`':
+		return p.codeSpan(s, i)
+	case '!':
+		if i+1 < len(s) && s[i+1] == '[' && !p.inLink {
+			if n := p.link(s, i+1, true); n > 0 {
+				return n + 1
+			}
+		}
+	case '[':
+		if !p.inLink {
+			return p.link(s, i, false)
+		}
+	case '<':
+		return p.autolink(s, i)
+	case '*', '_', '~':
+		return p.emphasis(s, i)
+	case 'h', 'w', 'H', 'W':
+		if !p.inLink && (i == 0 || !isWordChar(lastRune(s[:i]))) {
+			return p.bareURL(s, i)
+		}
+	}
+	return 0
+}
+
+// codeSpan выводит код в строке, заключенный в одинаковое число обратных кавычек.
+// Незакрытая последовательность кавычек выводится как текст.
+func (p *inlineParser) codeSpan(s string, i int) int {
+	n := runLength(s, i, '`')
+	end := min(len(s), i+n+spanLimit)
+	for j := i + n; j < end; {
+		k := strings.IndexByte(s[j:end], '`')
+		if k < 0 {
+			break
+		}
+		j += k
+		m := runLength(s, j, '`')
+		if m == n {
+			code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+			code = strings.ReplaceAll(code, hardBreak, " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			p.html("<code>")
+			p.text(code)
+			p.html("</code>")
+			return j + n - i
+		}
+		j += m
+	}
+	p.text(s[i : i+n])
+	return n
+}
+
+// link выводит ссылку [текст](адрес "заголовок") или изображение ![описание](адрес).
+// Ссылка с небезопасным адресом выводится как текст.
+func (p *inlineParser) link(s string, i int, image bool) int {
+	closeText := p.matchBracket(i)
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return 0
+	}
+	dest, title, end, ok := parseDestination(s, closeText+2)
+	if !ok {
+		return 0
+	}
+	text := s[i+1 : closeText]
+
+	if image {
+		src, ok := SafeImageURL(dest)
+		if !ok || p.plain {
+			renderInline(p.out, text, true)
+			return end - i
+		}
+		var alt strings.Builder
+		renderInline(&alt, text, true)
+		p.out.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt.String()) + `"`)
+		if title != "" {
+			p.out.WriteString(` title="` + html.EscapeString(title) + `"`)
+		}
+		p.out.WriteString(` loading="lazy" referrerpolicy="no-referrer">`)
+		return end - i
+	}
+
+	href, safe := SafeURL(dest)
+	if safe {
+		p.html(`<a href="` + html.EscapeString(href) + `"`)
+		if title != "" {
+			p.html(` title="` + html.EscapeString(title) + `"`)
+		}
+		p.html(` rel="` + linkRel + `">`)
+	}
+	p.nested(text, true)
+	if safe {
+		p.html("</a>")
+	}
+	return end - i
+}
+
+// autolink выводит ссылку в угловых скобках: <https://example.com> или <user@example.com>.
+func (p *inlineParser) autolink(s string, i int) int {
+	end := strings.IndexByte(s[i+1:min(len(s), i+1+spanLimit)], '>')
+	if end <= 0 {
+		return 0
+	}
+	target := s[i+1 : i+1+end]
+	if strings.ContainsAny(target, " <\n"+hardBreak) {
+		return 0
+	}
+	href := target
+	if !strings.Contains(target, ":") && strings.Contains(target, "@") {
+		href = "mailto:" + target
+	}
+	href, ok := SafeURL(href)
+	if !ok || !strings.Contains(href, ":") {
+		return 0
+	}
+	p.anchor(href, target)
+	return end + 2
+}
+
+// bareURL выводит ссылкой адрес без разметки, начинающийся с http://, https:// или www.
+func (p *inlineParser) bareURL(s string, i int) int {
+	rest := s[i:]
+	lower := strings.ToLower(rest[:min(len(rest), 8)])
+	prefix := ""
+	switch {
+	case strings.HasPrefix(lower, "https://"):
+	case strings.HasPrefix(lower, "http://"):
+	case strings.HasPrefix(lower, "www."):
+		prefix = "http://"
+	default:
+		return 0
+	}
+	n := urlLength(rest)
+	if n == 0 || strings.HasSuffix(strings.ToLower(rest[:n]), "://") {
+		return 0
+	}
+	href, ok := SafeURL(prefix + rest[:n])
+	if !ok {
+		return 0
+	}
+	p.anchor(href, rest[:n])
+	return n
+}
+
+// emphasis выводит выделение: *курсив*, **полужирный**, ***оба*** (так же с _) и ~~зачеркнутый~~ текст.
+// Разделитель без пары выводится как текст.
+func (p *inlineParser) emphasis(s string, i int) int {
+	d := s[i]
+	n := runLength(s, i, d)
+	if p.depth >= maxInlineDepth {
+		p.text(s[i : i+n])
+		return n
+	}
+
+	var tries []int
+	switch {
+	case d == '~':
+		if n == 2 {
+			tries = []int{2}
+		}
+	case n >= 3:
+		tries = []int{3, 2, 1}
+	case n == 2:
+		tries = []int{2, 1}
+	default:
+		tries = []int{1}
+	}
+
+	for _, k := range tries {
+		if !canOpen(s, i, k, d) {
+			continue
+		}
+		j := p.findCloser(i+k, k, d)
+		if j < 0 {
+			continue
+		}
+		var open, close string
+		switch {
+		case d == '~':
+			open, close = "<del>", "</del>"
+		case k == 3:
+			open, close = "<strong><em>", "</em></strong>"
+		case k == 2:
+			open, close = "<strong>", "</strong>"
+		default:
+			open, close = "<em>", "</em>"
+		}
+		// Лишние разделители перед выделением выводятся как текст.
+		p.text(s[i : i+n-k])
+		p.html(open)
+		p.nested(s[i+n:j], p.inLink)
+		p.html(close)
+		return j + k - i
+	}
+	p.text(s[i : i+n])
+	return n
+}
+
+// canOpen сообщает, может ли последовательность из k разделителей d, заканчивающаяся в позиции i+n, открыть выделение:
+// за ней идет не пробел, а подчеркивание не стоит внутри слова.
+func canOpen(s string, i, k int, d byte) bool {
+	n := runLength(s, i, d)
+	after := i + n
+	if after >= len(s) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(s[after:])
+	if unicode.IsSpace(next) {
+		return false
+	}
+	if d == '_' && i > 0 && isWordChar(lastRune(s[:i])) {
+		return false
+	}
+	return k <= n
+}
+
+// findCloser ищет закрывающую последовательность ровно из k разделителей d после позиции from,
+// перед которой нет пробела. Возвращает ее позицию или -1.
+func (p *inlineParser) findCloser(from, k int, d byte) int {
+	// Открывающая последовательность могла быть длиннее k: содержимое начинается после нее целиком.
+	for from < len(p.idx.s) && p.idx.s[from] == d {
+		from++
+	}
+	list := p.idx.closers[[2]byte{d, byte(k)}]
+	if n := sort.SearchInts(list, from); n < len(list) && list[n] < from+spanLimit {
+		return list[n]
+	}
+	return -1
+}
+
+// nested выводит вложенную разметку (текст ссылки или выделения).
+func (p *inlineParser) nested(s string, inLink bool) {
+	saved := p.inLink
+	p.depth++
+	p.inLink = inLink
+	p.render(s)
+	p.inLink = saved
+	p.depth--
+}
+
+// anchor выводит ссылку с адресом href и текстом text.
+func (p *inlineParser) anchor(href, text string) {
+	p.html(`<a href="` + html.EscapeString(href) + `" rel="` + linkRel + `">`)
+	p.text(text)
+	p.html("</a>")
+}
+
+// text выводит текст, экранируя его, если выводится HTML.
+func (p *inlineParser) text(s string) {
+	if p.plain {
+		p.out.WriteString(s)
+		return
+	}
+	p.out.WriteString(html.EscapeString(s))
+}
+
+// html выводит разметку; в режиме plain она пропускается.
+func (p *inlineParser) html(s string) {
+	if !p.plain {
+		p.out.WriteString(s)
+	}
+}
+
+// spanIndex - позиции закрывающих разделителей текста, найденные за один проход. Без него текст
+// с большим числом незакрытых разделителей разбирался бы за квадратичное время.
+type spanIndex struct {
+	s string
+	// closers - позиции последовательностей ровно из k разделителей d, которые могут закрыть выделение.
+	closers map[[2]byte][]int
+	// brackets - позиции закрывающих скобок для открывающих "[".
+	brackets map[int]int
+}
+
+// newSpanIndex находит закрывающие разделители в тексте s.
+func newSpanIndex(s string) *spanIndex {
+	idx := &spanIndex{s: s, closers: make(map[[2]byte][]int), brackets: make(map[int]int)}
+	var open []int
+	for j := 0; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '\\':
+			j++
+		case '`':
+			// Скобки внутри кода не учитываются.
+			n := runLength(s, j, '`')
+			if k := findRun(s[j+n:min(len(s), j+n+spanLimit)], n, '`'); k >= 0 {
+				j += n + k + n - 1
+			} else {
+				j += n - 1
+			}
+		case '[':
+			open = append(open, j)
+		case ']':
+			if len(open) > 0 {
+				idx.brackets[open[len(open)-1]] = j
+				open = open[:len(open)-1]
+			}
+		case '*', '_', '~':
+			m := runLength(s, j, c)
+			if m <= 3 && j > 0 && !unicode.IsSpace(lastRune(s[:j])) &&
+				(c != '_' || j+m >= len(s) || !isWordChar(firstRune(s[j+m:]))) {
+				key := [2]byte{c, byte(m)}
+				idx.closers[key] = append(idx.closers[key], j)
+			}
+			j += m - 1
+		}
+	}
+	return idx
+}
+
+// matchBracket возвращает позицию квадратной скобки, закрывающей скобку в позиции i, или -1.
+// Экранированные скобки и скобки внутри кода не учитываются.
+func (p *inlineParser) matchBracket(i int) int {
+	if j, ok := p.idx.brackets[i]; ok && j-i < spanLimit {
+		return j
+	}
+	return -1
+}
+
+// parseDestination разбирает адрес ссылки и необязательный заголовок после "(" до закрывающей ")".
+// Возвращает позицию после ")".
+func parseDestination(s string, i int) (dest, title string, end int, ok bool) {
+	i = skipSpaces(s, i)
+	if i < len(s) && s[i] == '<' {
+		k := strings.IndexAny(s[i+1:], ">\n")
+		if k < 0 || s[i+1+k] != '>' {
+			return "", "", 0, false
+		}
+		dest = s[i+1 : i+1+k]
+		i += k + 2
+	} else {
+		start := i
+		depth := 0
+	loop:
+		for ; i < len(s) && i-start < spanLimit; i++ {
+			switch c := s[i]; {
+			case c == '\\':
+				i++
+			case c == '(':
+				depth++
+			case c == ')':
+				if depth == 0 {
+					break loop
+				}
+				depth--
+			case c == ' ' || c == '\n' || c < 0x20:
+				break loop
+			}
+		}
+		dest = unescape(s[start:min(i, len(s))])
+	}
+
+	i = skipSpaces(s, i)
+	if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+		q := s[i]
+		k := strings.IndexByte(s[i+1:], q)
+		if k < 0 {
+			return "", "", 0, false
+		}
+		title = unescape(s[i+1 : i+1+k])
+		i = skipSpaces(s, i+k+2)
+	}
+	if i >= len(s) || s[i] != ')' {
+		return "", "", 0, false
+	}
+	return dest, title, i + 1, true
+}
+
+// urlLength возвращает длину адреса в начале строки: до пробела или "<", без завершающих знаков препинания
+// и закрывающей скобки без пары.
+func urlLength(s string) int {
+	n := 0
+	for n < len(s) {
+		c, size := utf8.DecodeRuneInString(s[n:])
+		if unicode.IsSpace(c) || c == '<' || c == '"' || c == '`' {
+			break
+		}
+		n += size
+	}
+	for n > 0 {
+		c := s[n-1]
+		switch {
+		case strings.IndexByte(".,:;!?'*_~", c) >= 0:
+			n--
+			continue
+		case c == ')' && strings.Count(s[:n], "(") < strings.Count(s[:n], ")"):
+			n--
+			continue
+		}
+		break
+	}
+	return n
+}
+
+// runLength возвращает число одинаковых символов c подряд начиная с позиции i.
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// skipSpaces пропускает пробелы и переносы строк.
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// unescape убирает обратную косую черту перед знаками препинания.
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func lastRune(s string) rune {
+	c, _ := utf8.DecodeLastRuneInString(s)
+	return c
+}
+
+func firstRune(s string) rune {
+	c, _ := utf8.DecodeRuneInString(s)
+	return c
+}
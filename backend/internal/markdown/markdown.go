@@ -0,0 +1,546 @@
+// Package markdown преобразует текст заметок в формате Markdown в безопасный HTML.
+//
+// Поддерживается основная часть CommonMark: заголовки, абзацы, списки, цитаты, блоки кода,
+// горизонтальные линии, выделение, ссылки, изображения и код в строке, а также зачеркивание
+// и ссылки без разметки из GitHub Flavored Markdown. HTML в тексте не поддерживается и экранируется,
+// ссылки допускаются только со схемами из SafeURL, поэтому результат можно вставлять в страницу как есть.
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Форматы текста заметок.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// ValidFormat сообщает, является ли format допустимым форматом текста заметки.
+func ValidFormat(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown
+}
+
+// RenderFormat преобразует текст заметки в HTML в соответствии с ее форматом.
+func RenderFormat(format, src string) *Document {
+	if format == FormatMarkdown {
+		return Render(src)
+	}
+	return RenderPlain(src)
+}
+
+// maxDepth - максимальная вложенность цитат и списков. Более глубокая вложенность выводится как текст.
+const maxDepth = 16
+
+// hardBreak заменяет конец строки с принудительным переносом (два пробела или обратная косая черта в конце).
+// Это символ разделителя строк Unicode, поэтому он и в исходном тексте выводится как перенос.
+const hardBreak = "\u2028"
+
+// Heading - заголовок документа для оглавления.
+type Heading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+}
+
+// Document - результат преобразования: HTML и заголовки документа.
+type Document struct {
+	HTML     string
+	Headings []Heading
+}
+
+// TOC возвращает оглавление документа: вложенные по уровням заголовков списки ссылок на якоря.
+// Если заголовков нет, возвращает пустую строку.
+func (d *Document) TOC() string {
+	if len(d.Headings) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="toc">`)
+	var levels []int
+	for _, h := range d.Headings {
+		for len(levels) > 0 && levels[len(levels)-1] > h.Level {
+			b.WriteString("</li></ul>")
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) > 0 && levels[len(levels)-1] == h.Level {
+			b.WriteString("</li>")
+		} else {
+			b.WriteString("<ul>")
+			levels = append(levels, h.Level)
+		}
+		b.WriteString(`<li><a href="#` + html.EscapeString(h.Anchor) + `">` + html.EscapeString(h.Text) + "</a>")
+	}
+	for range levels {
+		b.WriteString("</li></ul>")
+	}
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// Render преобразует текст в формате Markdown в HTML. Заголовки получают якоря (атрибут id),
+// уникальные в пределах документа.
+func Render(src string) *Document {
+	r := &renderer{slugs: make(map[string]bool)}
+	r.blocks(splitLines(src), 0, false)
+	return &Document{HTML: r.buf.String(), Headings: r.headings}
+}
+
+// RenderPlain преобразует обычный текст в HTML: абзацы разделяются пустыми строками,
+// переносы строк сохраняются.
+func RenderPlain(src string) *Document {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n\n") {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(strings.Trim(para, "\n")), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return &Document{HTML: b.String()}
+}
+
+// renderer накапливает HTML и заголовки документа.
+type renderer struct {
+	buf      strings.Builder
+	headings []Heading
+	slugs    map[string]bool
+}
+
+// blocks выводит последовательность блоков. В плотных списках (tight) абзацы выводятся без <p>.
+func (r *renderer) blocks(lines []string, depth int, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+		if f, ok := openFence(line); ok {
+			i = r.codeBlock(lines, i, f)
+			continue
+		}
+		if level, text, ok := atxHeading(line); ok {
+			r.heading(level, text)
+			i++
+			continue
+		}
+		if isThematicBreak(line) {
+			r.buf.WriteString("<hr>\n")
+			i++
+			continue
+		}
+		if depth < maxDepth {
+			if _, ok := quoteLine(line); ok {
+				var inner []string
+				for i < len(lines) {
+					content, ok := quoteLine(lines[i])
+					if !ok {
+						break
+					}
+					inner = append(inner, content)
+					i++
+				}
+				r.buf.WriteString("<blockquote>\n")
+				r.blocks(inner, depth+1, false)
+				r.buf.WriteString("</blockquote>\n")
+				continue
+			}
+			if m, ok := listMarker(line); ok {
+				i = r.list(lines, i, m, depth)
+				continue
+			}
+		}
+
+		start := i
+		for i < len(lines) && !isBlank(lines[i]) && (i == start || !startsBlock(lines[i])) {
+			i++
+		}
+		r.paragraph(lines[start:i], tight)
+	}
+}
+
+// paragraph выводит абзац из строк lines.
+func (r *renderer) paragraph(lines []string, tight bool) {
+	var text strings.Builder
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		last := i == len(lines)-1
+		switch {
+		case last:
+			text.WriteString(strings.TrimRight(line, " "))
+		case strings.HasSuffix(line, "  "):
+			text.WriteString(strings.TrimRight(line, " ") + hardBreak)
+		case strings.HasSuffix(line, "\\"):
+			text.WriteString(line[:len(line)-1] + hardBreak)
+		default:
+			text.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+	}
+	if !tight {
+		r.buf.WriteString("<p>")
+	}
+	renderInline(&r.buf, text.String(), false)
+	if !tight {
+		r.buf.WriteString("</p>\n")
+	}
+}
+
+// heading выводит заголовок с якорем и запоминает его для оглавления.
+func (r *renderer) heading(level int, text string) {
+	var plain strings.Builder
+	renderInline(&plain, text, true)
+	anchor := r.anchor(plain.String())
+	r.headings = append(r.headings, Heading{Level: level, Text: plain.String(), Anchor: anchor})
+
+	tag := "h" + strconv.Itoa(level)
+	r.buf.WriteString("<" + tag + ` id="` + html.EscapeString(anchor) + `">`)
+	renderInline(&r.buf, text, false)
+	r.buf.WriteString("</" + tag + ">\n")
+}
+
+// anchor возвращает уникальный в документе якорь для заголовка: слова в нижнем регистре через дефис,
+// при повторе с номером (-1, -2, ...).
+func (r *renderer) anchor(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '_':
+			dash = true
+		}
+	}
+	slug := b.String()
+	if slug == "" {
+		slug = "section"
+	}
+
+	anchor := slug
+	for n := 1; r.slugs[anchor]; n++ {
+		anchor = slug + "-" + strconv.Itoa(n)
+	}
+	r.slugs[anchor] = true
+	return anchor
+}
+
+// fence - открывающая строка блока кода.
+type fence struct {
+	char   byte
+	n      int
+	indent int
+	lang   string
+}
+
+// openFence распознает начало блока кода: три и более ` или ~ с отступом не больше трех пробелов.
+func openFence(line string) (fence, bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return fence{}, false
+	}
+	rest := line[indent:]
+	if len(rest) < 3 || (rest[0] != '`' && rest[0] != '~') {
+		return fence{}, false
+	}
+	f := fence{char: rest[0], indent: indent}
+	for f.n < len(rest) && rest[f.n] == f.char {
+		f.n++
+	}
+	if f.n < 3 {
+		return fence{}, false
+	}
+	info := strings.TrimSpace(rest[f.n:])
+	if f.char == '`' && strings.Contains(info, "`") {
+		return fence{}, false
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		f.lang = strings.Map(func(c rune) rune {
+			if c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_+#.-", c)) {
+				return c
+			}
+			return -1
+		}, fields[0])
+	}
+	return f, true
+}
+
+// closesFence сообщает, закрывает ли строка блок кода f.
+func closesFence(line string, f fence) bool {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return false
+	}
+	rest := strings.TrimRight(line[indent:], " ")
+	if len(rest) < f.n {
+		return false
+	}
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != f.char {
+			return false
+		}
+	}
+	return true
+}
+
+// codeBlock выводит блок кода, начинающийся со строки start, и возвращает индекс следующей после него строки.
+// Незакрытый блок продолжается до конца документа.
+func (r *renderer) codeBlock(lines []string, start int, f fence) int {
+	if f.lang != "" {
+		r.buf.WriteString(`<pre><code class="language-` + html.EscapeString(f.lang) + `">`)
+	} else {
+		r.buf.WriteString("<pre><code>")
+	}
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if closesFence(lines[i], f) {
+			i++
+			break
+		}
+		line := lines[i]
+		line = line[min(f.indent, leadingSpaces(line)):]
+		r.buf.WriteString(html.EscapeString(line) + "\n")
+	}
+	r.buf.WriteString("</code></pre>\n")
+	return i
+}
+
+// atxHeading распознает заголовок вида "## Текст".
+func atxHeading(line string) (level int, text string, ok bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return 0, "", false
+	}
+	rest := line[indent:]
+	for level < len(rest) && rest[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(rest) && rest[level] != ' ') {
+		return 0, "", false
+	}
+	text = strings.TrimSpace(rest[level:])
+	// Закрывающие символы # отбрасываются, если отделены пробелом.
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return level, text, true
+}
+
+// isThematicBreak распознает горизонтальную линию: три и более -, * или _, возможно через пробелы.
+func isThematicBreak(line string) bool {
+	s := strings.TrimSpace(line)
+	if len(s) < 3 || leadingSpaces(line) > 3 || (s[0] != '-' && s[0] != '*' && s[0] != '_') {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case s[0]:
+			n++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return n >= 3
+}
+
+// quoteLine распознает строку цитаты и возвращает ее содержимое без символа >.
+func quoteLine(line string) (string, bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 || indent >= len(line) || line[indent] != '>' {
+		return "", false
+	}
+	content := line[indent+1:]
+	return strings.TrimPrefix(content, " "), true
+}
+
+// marker - маркер элемента списка.
+type marker struct {
+	ordered bool
+	bullet  byte
+	start   int
+	// indent - отступ содержимого элемента; строки продолжения должны иметь не меньший отступ.
+	indent int
+}
+
+// listMarker распознает начало элемента списка: "- ", "* ", "+ " или "1. ", "1) ".
+func listMarker(line string) (marker, bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 || indent >= len(line) {
+		return marker{}, false
+	}
+	rest := line[indent:]
+	var m marker
+	width := 0
+	switch c := rest[0]; {
+	case c == '-' || c == '*' || c == '+':
+		m.bullet = c
+		width = 1
+	case c >= '0' && c <= '9':
+		for width < len(rest) && width < 9 && rest[width] >= '0' && rest[width] <= '9' {
+			width++
+		}
+		if width >= len(rest) || (rest[width] != '.' && rest[width] != ')') {
+			return marker{}, false
+		}
+		m.ordered = true
+		m.bullet = rest[width]
+		m.start, _ = strconv.Atoi(rest[:width])
+		width++
+	default:
+		return marker{}, false
+	}
+	if width < len(rest) && rest[width] != ' ' {
+		return marker{}, false
+	}
+	spaces := leadingSpaces(rest[width:])
+	if spaces == 0 || spaces > 4 {
+		spaces = 1
+	}
+	m.indent = indent + width + spaces
+	return m, true
+}
+
+// list выводит список, начинающийся со строки start, и возвращает индекс следующей после него строки.
+// Список, элементы которого разделены пустыми строками, выводится с абзацами в элементах.
+func (r *renderer) list(lines []string, start int, first marker, depth int) int {
+	var items [][]string
+	loose := false
+	i := start
+	for i < len(lines) {
+		m, ok := listMarker(lines[i])
+		if !ok || isThematicBreak(lines[i]) || m.ordered != first.ordered || m.bullet != first.bullet {
+			break
+		}
+		item := []string{cut(lines[i], m.indent)}
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if isBlank(line) {
+				j := i
+				for j < len(lines) && isBlank(lines[j]) {
+					j++
+				}
+				if j < len(lines) && leadingSpaces(lines[j]) >= m.indent {
+					for ; i < j; i++ {
+						item = append(item, "")
+					}
+					loose = true
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) >= m.indent {
+				item = append(item, line[m.indent:])
+			} else if !startsBlock(line) && !isBlank(item[len(item)-1]) {
+				// Продолжение абзаца без отступа.
+				item = append(item, strings.TrimLeft(line, " "))
+			} else {
+				break
+			}
+			i++
+		}
+		items = append(items, item)
+
+		// Пустые строки между элементами делают список свободным.
+		j := i
+		for j < len(lines) && isBlank(lines[j]) {
+			j++
+		}
+		if j > i && j < len(lines) {
+			if m, ok := listMarker(lines[j]); ok && m.ordered == first.ordered && m.bullet == first.bullet {
+				loose = true
+				i = j
+			}
+		}
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	if first.ordered && first.start != 1 {
+		r.buf.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+	} else {
+		r.buf.WriteString("<" + tag + ">\n")
+	}
+	for _, item := range items {
+		r.buf.WriteString("<li>")
+		r.blocks(item, depth+1, !loose)
+		r.buf.WriteString("</li>\n")
+	}
+	r.buf.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// startsBlock сообщает, начинает ли строка новый блок, прерывающий абзац.
+func startsBlock(line string) bool {
+	if _, ok := openFence(line); ok {
+		return true
+	}
+	if _, _, ok := atxHeading(line); ok {
+		return true
+	}
+	if _, ok := quoteLine(line); ok {
+		return true
+	}
+	if _, ok := listMarker(line); ok {
+		return true
+	}
+	return isThematicBreak(line)
+}
+
+// splitLines разбивает текст на строки и заменяет табуляцию в начале строк четырьмя пробелами.
+func splitLines(src string) []string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+			continue
+		}
+		n := 0
+		for n < len(line) && (line[n] == ' ' || line[n] == '\t') {
+			n++
+		}
+		width := 0
+		for _, c := range line[:n] {
+			if c == '\t' {
+				width += 4 - width%4
+			} else {
+				width++
+			}
+		}
+		lines[i] = strings.Repeat(" ", width) + line[n:]
+	}
+	return lines
+}
+
+// leadingSpaces возвращает число пробелов в начале строки.
+func leadingSpaces(s string) int {
+	n := 0
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// cut отрезает от строки первые n байт, если она не короче.
+func cut(s string, n int) string {
+	if n >= len(s) {
+		return ""
+	}
+	return s[n:]
+}
+
+// isBlank сообщает, что строка пустая или состоит из пробелов.
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
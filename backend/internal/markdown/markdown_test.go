@@ -0,0 +1,245 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"https://example.com/a?b=c#d", "https://example.com/a?b=c#d", true},
+		{"  http://example.com  ", "http://example.com", true},
+		{"HTTPS://EXAMPLE.COM", "HTTPS://EXAMPLE.COM", true},
+		{"mailto:user@example.com", "mailto:user@example.com", true},
+		{"/notes/1", "/notes/1", true},
+		{"notes/1?x=a:b", "notes/1?x=a:b", true},
+		{"#section", "#section", true},
+		{"javascript:alert(1)", "", false},
+		{"JavaScript:alert(1)", "", false},
+		{"java\tscript:alert(1)", "", false},
+		{"java\nscript:alert(1)", "", false},
+		{" \x01javascript:alert(1)", "", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", "", false},
+		{"vbscript:msgbox", "", false},
+		{"file:///etc/passwd", "", false},
+		{"", "", false},
+		{"   ", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := SafeURL(tt.raw)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("SafeURL(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSafeImageURL(t *testing.T) {
+	tests := []struct {
+		raw string
+		ok  bool
+	}{
+		{"https://example.com/a.png", true},
+		{"/attachments/1", true},
+		{"mailto:user@example.com", false},
+		{"data:image/png;base64,AAAA", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		if _, ok := SafeImageURL(tt.raw); ok != tt.ok {
+			t.Errorf("SafeImageURL(%q) ok = %v, want %v", tt.raw, ok, tt.ok)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "один\nдва\n\nтри", "<p>один\nдва</p>\n<p>три</p>\n"},
+		{"heading", "# Заголовок #", `<h1 id="заголовок">Заголовок</h1>` + "\n"},
+		{"duplicate headings", "## A\n## A", `<h2 id="a">A</h2>` + "\n" + `<h2 id="a-1">A</h2>` + "\n"},
+		{"emphasis", "*a* **b** ***c*** ~~d~~", "<p><em>a</em> <strong>b</strong> <strong><em>c</em></strong> <del>d</del></p>\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"code span", "`a <b>`", "<p><code>a &lt;b&gt;</code></p>\n"},
+		{"code block", "```go\nif a < b {}\n```", `<pre><code class="language-go">if a &lt; b {}` + "\n</code></pre>\n"},
+		{"unclosed code block", "```\ncode", "<pre><code>code\n</code></pre>\n"},
+		{"thematic break", "* * *", "<hr>\n"},
+		{"quote", "> цитата", "<blockquote>\n<p>цитата</p>\n</blockquote>\n"},
+		{"tight list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li><p>a</p>\n</li>\n<li><p>b</p>\n</li>\n</ul>\n"},
+		{"ordered list", "3. a\n4. b", `<ol start="3">` + "\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"hard break", "a  \nb", "<p>a<br>\nb</p>\n"},
+		{"link", `[текст](https://example.com "t")`,
+			`<p><a href="https://example.com" title="t" rel="nofollow noopener noreferrer">текст</a></p>` + "\n"},
+		{"autolink", "<https://example.com>",
+			`<p><a href="https://example.com" rel="nofollow noopener noreferrer">https://example.com</a></p>` + "\n"},
+		{"email autolink", "<user@example.com>",
+			`<p><a href="mailto:user@example.com" rel="nofollow noopener noreferrer">user@example.com</a></p>` + "\n"},
+		{"bare url", "см. www.example.com.",
+			`<p>см. <a href="http://www.example.com" rel="nofollow noopener noreferrer">www.example.com</a>.</p>` + "\n"},
+		{"image", "![кот](/a.png)", `<p><img src="/a.png" alt="кот" loading="lazy" referrerpolicy="no-referrer"></p>` + "\n"},
+		{"escaped", `\*не выделение\*`, "<p>*не выделение*</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src).HTML; got != tt.want {
+				t.Errorf("Render(%q) =\n%q\nwant\n%q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderSanitizes проверяет, что из текста заметки нельзя получить активное содержимое:
+// все теги и атрибуты результата должны быть из тех, что выводит Render, а адреса - безопасными.
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// want - фрагмент, который должен быть в результате.
+		want string
+	}{
+		{"html", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"html attribute", `<img src=x onerror="alert(1)">`, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>"},
+		{"uppercase scheme", "[x](JAVASCRIPT:alert(1))", "<p>x</p>"},
+		{"obfuscated link", "[x](<java\tscript:alert(1)>)", "<p>x</p>"},
+		{"tab in link", "[x](JaVa\tScRiPt:alert(1))", ""},
+		{"escaped scheme", `[x](javascript\:alert(1))`, "<p>x</p>"},
+		{"data image", "![x](data:image/svg+xml;base64,AAAA)", "<p>x</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "&lt;javascript:alert(1)&gt;"},
+		{"quote in href", `[x](https://example.com/"onmouseover="alert(1))`, `href="https://example.com/&#34;onmouseover=&#34;alert(1)"`},
+		{"quote in title", `[x](/a "t" onclick="b")`, ""},
+		{"quote in alt", `![" onerror="alert(1)](/a.png)`, `alt="&#34; onerror=&#34;alert(1)"`},
+		{"code language", "```\"><script>\nx\n```", `<pre><code class="language-script">`},
+		{"heading anchor", `# "><script>`, `id="script"`},
+		{"nested", "**[*x*](javascript:alert(1))**", "<strong><em>x</em></strong>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src).HTML
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Render(%q) = %q, want it to contain %q", tt.src, got, tt.want)
+			}
+			checkSafeHTML(t, got)
+		})
+	}
+}
+
+var (
+	// tagPattern - тег с атрибутами в двойных кавычках. Текст экранируется, поэтому каждый
+	// символ "<" в результате начинает тег.
+	tagPattern  = regexp.MustCompile(`^<(/?)([a-z0-9]+)((?:\s+[a-z-]+="[^"<>]*")*)>`)
+	attrPattern = regexp.MustCompile(`([a-z-]+)="([^"]*)"`)
+	safeTags    = map[string]bool{
+		"p": true, "br": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"em": true, "strong": true, "del": true, "code": true, "pre": true, "blockquote": true,
+		"ul": true, "ol": true, "li": true, "hr": true, "a": true, "img": true,
+	}
+	safeAttrs = map[string]bool{
+		"href": true, "src": true, "title": true, "alt": true, "rel": true, "id": true,
+		"class": true, "start": true, "loading": true, "referrerpolicy": true,
+	}
+)
+
+// checkSafeHTML проверяет, что HTML состоит только из разрешенных тегов и атрибутов.
+func checkSafeHTML(t *testing.T, out string) {
+	t.Helper()
+	for i := strings.IndexByte(out, '<'); i >= 0; i = strings.IndexByte(out, '<') {
+		out = out[i:]
+		m := tagPattern.FindStringSubmatch(out)
+		if m == nil {
+			t.Fatalf("malformed tag at %q", out[:min(len(out), 40)])
+		}
+		if !safeTags[m[2]] {
+			t.Errorf("unexpected tag %q", m[0])
+		}
+		for _, a := range attrPattern.FindAllStringSubmatch(m[3], -1) {
+			if !safeAttrs[a[1]] {
+				t.Errorf("unexpected attribute in %q", m[0])
+			}
+			if a[1] == "href" || a[1] == "src" {
+				if _, ok := SafeURL(html.UnescapeString(a[2])); !ok {
+					t.Errorf("unsafe URL in %q", m[0])
+				}
+			}
+		}
+		out = out[len(m[0]):]
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	got := RenderPlain("<b>a</b>\r\nb\r\n\r\n\r\nc").HTML
+	want := "<p>&lt;b&gt;a&lt;/b&gt;<br>\nb</p>\n<p>c</p>\n"
+	if got != want {
+		t.Errorf("RenderPlain = %q, want %q", got, want)
+	}
+}
+
+func TestTOC(t *testing.T) {
+	doc := Render("# A\n## B\n## C\n# D")
+	want := `<nav class="toc"><ul><li><a href="#a">A</a><ul><li><a href="#b">B</a></li><li><a href="#c">C</a></li></ul></li>` +
+		`<li><a href="#d">D</a></li></ul></nav>` + "\n"
+	if got := doc.TOC(); got != want {
+		t.Errorf("TOC() =\n%q\nwant\n%q", got, want)
+	}
+	if got := Render("текст").TOC(); got != "" {
+		t.Errorf("TOC() without headings = %q, want empty", got)
+	}
+}
+
+// TestRenderPathological проверяет, что текст с большим числом незакрытых разделителей
+// и глубокой вложенностью разбирается быстро.
+func TestRenderPathological(t *testing.T) {
+	inputs := map[string]string{
+		"emphasis":  strings.Repeat("*a ", 50000),
+		"brackets":  strings.Repeat("[", 50000),
+		"backticks": strings.Repeat("`a", 50000),
+		"links":     strings.Repeat("[a](", 50000),
+		"quotes":    strings.Repeat(">", 50000),
+		"lists":     strings.Repeat("- ", 50000),
+	}
+	for name, src := range inputs {
+		start := time.Now()
+		Render(src)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: Render took %v", name, d)
+		}
+	}
+}
+
+func TestProtected(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"plain text", "обычный текст без адресов", nil},
+		{"code span", "слово `код` слово", []string{"`код`"}},
+		{"code block", "текст\n```\nкод\n```\nтекст", []string{"```\nкод\n```"}},
+		{"link destination", "[текст](https://example.com/путь)", []string{"https://example.com/путь"}},
+		{"bare url", "см. https://example.com/a, и далее", []string{"https://example.com/a"}},
+		{"email", "пишите на user@example.com", []string{"user@example.com"}},
+		{"autolink", "<https://example.com>", []string{"https://example.com"}},
+		{"path", "файл ./docs/readme.md здесь", []string{"./docs/readme.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range Protected(tt.src) {
+				got = append(got, tt.src[r.Start:r.End])
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Protected(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package markdown
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Range - фрагмент текста в байтах: [Start, End).
+type Range struct {
+	Start, End int
+}
+
+// Protected возвращает фрагменты текста, которые нельзя изменять при проверке орфографии:
+// блоки кода, код в строке, адреса ссылок и изображений, адреса без разметки и адреса почты.
+// Фрагменты отсортированы и не пересекаются. Текст не обязан быть в формате Markdown:
+// в обычных заметках код и адреса распознаются так же.
+func Protected(src string) []Range {
+	var ranges []Range
+	var open *fence
+	openAt := 0
+	for pos := 0; pos < len(src); {
+		end := strings.IndexByte(src[pos:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += pos
+		}
+		// Блоки кода внутри элементов списка имеют отступ, поэтому он здесь не ограничивается.
+		line := strings.TrimLeft(src[pos:end], " \t")
+
+		switch {
+		case open != nil:
+			if closesFence(line, *open) {
+				ranges = append(ranges, Range{openAt, end})
+				open = nil
+			}
+		default:
+			if f, ok := openFence(line); ok {
+				open, openAt = &f, pos
+			} else {
+				ranges = append(ranges, protectedInline(src, pos, end)...)
+			}
+		}
+		pos = end + 1
+	}
+	if open != nil {
+		ranges = append(ranges, Range{openAt, len(src)})
+	}
+	return merge(ranges)
+}
+
+// protectedInline возвращает защищенные фрагменты строки src[start:end].
+func protectedInline(src string, start, end int) []Range {
+	var ranges []Range
+	for i := start; i < end; {
+		switch c := src[i]; {
+		case c == '\\':
+			i += 2
+			continue
+		case c == '`':
+			n := runLength(src[:end], i, '`')
+			if k := findRun(src[i+n:min(end, i+n+spanLimit)], n, '`'); k >= 0 {
+				ranges = append(ranges, Range{i, i + n + k + n})
+				i += n + k + n
+			} else {
+				i += n
+			}
+			continue
+		case c == ']' && i+1 < end && src[i+1] == '(':
+			// Адрес ссылки или изображения до закрывающей скобки.
+			if k := strings.IndexByte(src[i+2:min(end, i+2+spanLimit)], ')'); k >= 0 {
+				ranges = append(ranges, Range{i + 2, i + 2 + k})
+				i += k + 3
+				continue
+			}
+		case c == '<':
+			if k := strings.IndexByte(src[i+1:min(end, i+1+spanLimit)], '>'); k > 0 {
+				if t := src[i+1 : i+1+k]; !strings.Contains(t, " ") && strings.ContainsAny(t, ":@") {
+					ranges = append(ranges, Range{i + 1, i + 1 + k})
+					i += k + 2
+					continue
+				}
+			}
+		}
+
+		// Слово целиком: адрес, адрес почты или путь.
+		r, size := utf8.DecodeRuneInString(src[i:end])
+		if unicode.IsSpace(r) || (i > start && !unicode.IsSpace(lastRune(src[start:i]))) {
+			i += size
+			continue
+		}
+		word := i
+		for word < end {
+			r, size := utf8.DecodeRuneInString(src[word:end])
+			if unicode.IsSpace(r) {
+				break
+			}
+			word += size
+		}
+		// Текст ссылки [текст](адрес) проверяется, защищается только ее адрес.
+		if n := urlLength(src[i:word]); n > 0 && !strings.Contains(src[i:word], "](") && looksLikeAddress(src[i:i+n]) {
+			ranges = append(ranges, Range{i, i + n})
+			i += n
+			continue
+		}
+		i += size
+	}
+	return ranges
+}
+
+// looksLikeAddress сообщает, что слово - адрес сайта, адрес почты или путь к файлу.
+func looksLikeAddress(word string) bool {
+	lower := strings.ToLower(strings.TrimLeft(word, "(\"'«"))
+	switch {
+	case strings.Contains(lower, "://"), strings.HasPrefix(lower, "www."), strings.HasPrefix(lower, "mailto:"):
+		return true
+	case strings.Contains(lower, "@") && strings.Contains(lower[strings.Index(lower, "@"):], "."):
+		return true
+	case strings.HasPrefix(lower, "/") || strings.HasPrefix(lower, "./") || strings.HasPrefix(lower, "~/"):
+		return strings.Count(lower, "/") > 1 || strings.Contains(lower, ".")
+	}
+	return false
+}
+
+// findRun возвращает позицию последовательности ровно из n символов c в s или -1.
+func findRun(s string, n int, c byte) int {
+	for j := 0; j < len(s); {
+		k := strings.IndexByte(s[j:], c)
+		if k < 0 {
+			return -1
+		}
+		j += k
+		m := runLength(s, j, c)
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// merge сортирует фрагменты и объединяет пересекающиеся.
+func merge(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	var out []Range
+	for _, r := range ranges {
+		if r.End <= r.Start {
+			continue
+		}
+		if n := len(out); n > 0 && r.Start <= out[n-1].End {
+			out[n-1].End = max(out[n-1].End, r.End)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package markdown
+
+import (
+	"strings"
+)
+
+// linkSchemes и imageSchemes - схемы, допустимые в адресах ссылок и изображений.
+var (
+	linkSchemes  = []string{"http", "https", "mailto"}
+	imageSchemes = []string{"http", "https"}
+)
+
+// SafeURL проверяет адрес ссылки и возвращает его без пробелов по краям. Допускаются адреса
+// со схемами http, https и mailto и относительные адреса; javascript:, data: и другие схемы
+// отклоняются. Схема определяется так же, как в браузере: без учета регистра и управляющих символов.
+func SafeURL(raw string) (string, bool) {
+	return safeURL(raw, linkSchemes)
+}
+
+// SafeImageURL проверяет адрес изображения: допускаются схемы http и https и относительные адреса.
+func SafeImageURL(raw string) (string, bool) {
+	return safeURL(raw, imageSchemes)
+}
+
+func safeURL(raw string, schemes []string) (string, bool) {
+	u := strings.TrimSpace(raw)
+	if u == "" {
+		return "", false
+	}
+	// Браузер игнорирует табуляцию и переносы строк внутри адреса, поэтому "java\tscript:" - тоже схема.
+	cleaned := strings.Map(func(c rune) rune {
+		if c < 0x20 || c == 0x7f {
+			return -1
+		}
+		return c
+	}, u)
+	colon := strings.IndexByte(cleaned, ':')
+	if colon < 0 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		// Относительный адрес.
+		return cleaned, true
+	}
+	scheme := strings.ToLower(cleaned[:colon])
+	for _, s := range schemes {
+		if scheme == s {
+			return cleaned, true
+		}
+	}
+	return "", false
+}
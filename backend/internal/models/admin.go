@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// AdminUser - учетная запись пользователя, как ее видит администратор.
+type AdminUser struct {
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	IsAdmin       bool      `json:"is_admin"`
+	CreatedAt     time.Time `json:"created_at"`
+	// DisabledAt и DisabledReason заполнены, если учетная запись заблокирована.
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	// SessionsRevokedAt - сессии, выданные раньше, не принимаются.
+	SessionsRevokedAt     *time.Time `json:"sessions_revoked_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"`
+
+	// Notes и DeletedNotes - число заметок, созданных пользователем, и его заметок в корзине.
+	Notes        int `json:"notes"`
+	DeletedNotes int `json:"deleted_notes"`
+	// NotesBytes - суммарный размер текста заметок, AttachmentBytes - вложений, загруженных пользователем.
+	NotesBytes      int64 `json:"notes_bytes"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	// APITokens - число действующих персональных токенов доступа.
+	APITokens int `json:"api_tokens"`
+}
+
+// AdminAction - запись журнала действий администраторов.
+type AdminAction struct {
+	ID int `json:"id"`
+	// Actor - администратор или, для действий из notesctl, пользователь операционной системы.
+	Actor     string    `json:"actor"`
+	Username  string    `json:"username"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// APIToken описывает персональный токен доступа пользователя для скриптов и интеграций.
+// Сам токен не хранится, Prefix позволяет узнать токен в списке.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Attachment описывает файл, прикрепленный к заметке. Содержимое файла хранится в BlobStore.
+type Attachment struct {
+	ID          int       `json:"id"`
+	NoteID      int       `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	UploadedBy  string    `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
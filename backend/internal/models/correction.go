@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// NoteCorrection - исправление орфографии, внесенное в заметку при проверке.
+type NoteCorrection struct {
+	ID int `json:"id"`
+	// Version - версия заметки, созданная исправлением.
+	Version int `json:"version"`
+	// Position - позиция исправленного слова в символах текста этой версии.
+	Position    int    `json:"position"`
+	Word        string `json:"word"`
+	Replacement string `json:"replacement"`
+	// Code - код ошибки Яндекс.Спеллер API.
+	Code      int       `json:"code"`
+	CreatedAt time.Time `json:"created_at"`
+	// RevertedAt и RevertedVersion заполнены, если пользователь отменил исправление.
+	RevertedAt      *time.Time `json:"reverted_at,omitempty"`
+	RevertedVersion *int       `json:"reverted_version,omitempty"`
+}
+
+// CorrectionStat - сколько раз слово было исправлено на замену и сколько из этих исправлений отменено.
+type CorrectionStat struct {
+	Word        string `json:"word"`
+	Replacement string `json:"replacement"`
+	Count       int    `json:"count"`
+	Reverted    int    `json:"reverted"`
+}
+
+// CorrectionStats - статистика исправлений орфографии в заметках пользователя.
+type CorrectionStats struct {
+	Total    int `json:"total"`
+	Reverted int `json:"reverted"`
+	// ByCode - число исправлений по кодам ошибок Яндекс.Спеллер API.
+	ByCode map[int]int `json:"by_code"`
+	// Top - самые частые исправления.
+	Top []CorrectionStat `json:"top"`
+}
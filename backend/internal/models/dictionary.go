@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DictionaryWord - слово словаря пользователя, которое проверка орфографии не исправляет.
+type DictionaryWord struct {
+	Word      string    `json:"word"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DictionaryImport - итог импорта списка слов в словарь пользователя.
+type DictionaryImport struct {
+	// Added - число добавленных слов.
+	Added int `json:"added"`
+	// Skipped - число пропущенных слов: некорректных, уже бывших в словаре и не поместившихся в него.
+	// Пустые строки и комментарии не учитываются.
+	Skipped int `json:"skipped"`
+}
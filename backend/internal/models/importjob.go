@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ImportJob описывает задание импорта заметок из файла другого сервиса.
+type ImportJob struct {
+	ID         int    `json:"id"`
+	Format     string `json:"format"`
+	Spellcheck bool   `json:"spellcheck"`
+	// Status - состояние задания: queued, running, done или failed.
+	Status string `json:"status"`
+	// Total - число найденных в файле элементов, Processed - число уже обработанных.
+	Total     int           `json:"total"`
+	Processed int           `json:"processed"`
+	Imported  int           `json:"imported"`
+	Skipped   int           `json:"skipped"`
+	Report    *ImportReport `json:"report,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	StartedAt *time.Time    `json:"started_at,omitempty"`
+	// FinishedAt задан для завершенных заданий.
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportReport - итог импорта: созданные заметки и пропущенные элементы с причинами.
+type ImportReport struct {
+	Imported []ImportedItem  `json:"imported"`
+	Skipped  []ImportSkipped `json:"skipped"`
+	// Truncated сообщает, что в отчет вошли не все элементы; их общее число есть в задании.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ImportedItem - элемент файла импорта и созданная из него заметка.
+type ImportedItem struct {
+	Item   string `json:"item"`
+	NoteID int    `json:"note_id"`
+}
+
+// ImportSkipped - элемент файла импорта, для которого не создана заметка.
+type ImportSkipped struct {
+	Item   string `json:"item"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// NoteLink описывает публичную ссылку на заметку для чтения без учетной записи.
+// Сам токен ссылки не хранится и возвращается только при ее создании.
+type NoteLink struct {
+	ID          int        `json:"id"`
+	NoteID      int        `json:"note_id"`
+	HasPassword bool       `json:"has_password"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ViewCount   int        `json:"view_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
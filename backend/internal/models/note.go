@@ -4,4 +4,17 @@ type Note struct {
 	ID     int    `json:"id"`
 	Text   string `json:"text"`
 	UserID int    `json:"user_id"`
+	// Format - формат текста: plain или markdown.
+	Format string `json:"format"`
+	// Tags - метки заметки, например папки и ярлыки импортированных заметок.
+	Tags []string `json:"tags"`
+	// SpellcheckStatus - состояние проверки орфографии текста: pending, done, failed или skipped.
+	SpellcheckStatus string `json:"spellcheck_status"`
+	// Version увеличивается при каждом изменении заметки.
+	Version int `json:"version"`
+	// WorkspaceID задан для заметок рабочего пространства.
+	WorkspaceID *int `json:"workspace_id,omitempty"`
+	// Owner - автор заметки, если это не личная заметка пользователя; Access - уровень доступа к ней.
+	Owner  string `json:"owner,omitempty"`
+	Access string `json:"access,omitempty"`
 }
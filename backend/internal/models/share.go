@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// NoteShare описывает доступ к заметке, предоставленный владельцем другому пользователю.
+type NoteShare struct {
+	NoteID    int       `json:"note_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// SyncChange описывает состояние заметки в ленте изменений для синхронизации.
+// У удаленной заметки (tombstone) Deleted равен true, а текст не передается.
+type SyncChange struct {
+	ID          int       `json:"id"`
+	Text        string    `json:"text,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	Version     int       `json:"version"`
+	WorkspaceID *int      `json:"workspace_id,omitempty"`
+	ClientRef   string    `json:"client_ref,omitempty"`
+	Deleted     bool      `json:"deleted"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SyncMutation описывает изменение, сделанное клиентом офлайн.
+// Op принимает значения create, update и delete. Для update и delete BaseVersion - версия
+// заметки, которую изменял клиент; для create ClientRef делает повторную отправку безопасной.
+// Format (plain или markdown) необязателен: при создании по умолчанию plain, при изменении формат сохраняется.
+type SyncMutation struct {
+	Op          string `json:"op"`
+	ID          int    `json:"id,omitempty"`
+	ClientRef   string `json:"client_ref,omitempty"`
+	BaseVersion int    `json:"base_version,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Format      string `json:"format,omitempty"`
+	WorkspaceID *int   `json:"workspace_id,omitempty"`
+}
+
+// SyncResult описывает результат применения одного изменения клиента.
+// Status принимает значения applied, conflict, not_found (заметка не существует, удалена или недоступна),
+// forbidden и invalid. При конфликте Current содержит текущее состояние заметки на сервере.
+type SyncResult struct {
+	Index     int         `json:"index"`
+	Status    string      `json:"status"`
+	ID        int         `json:"id,omitempty"`
+	ClientRef string      `json:"client_ref,omitempty"`
+	Version   int         `json:"version,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Current   *SyncChange `json:"current,omitempty"`
+}
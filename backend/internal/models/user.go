@@ -1,7 +1,9 @@
 package models
 
 type User struct {
-	ID       int
-	Username string
-	Password string
+	ID            int
+	Username      string
+	Password      string
+	Email         string
+	EmailVerified bool
 }
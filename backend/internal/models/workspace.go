@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Workspace описывает рабочее пространство команды с общими заметками.
+// Role - роль текущего пользователя в пространстве.
+type Workspace struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkspaceMember описывает участника рабочего пространства и его роль.
+type WorkspaceMember struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkspaceInvitation описывает приглашение пользователя в рабочее пространство.
+type WorkspaceInvitation struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	Workspace   string    `json:"workspace"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	InvitedBy   string    `json:"invited_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,287 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Ограничения на ответы провайдера, чтобы недоступный или некорректный провайдер не блокировал вход.
+const (
+	httpTimeout     = 10 * time.Second
+	maxResponseSize = 1 << 20
+	// jwksMinRefresh - минимальный интервал между повторными загрузками JWKS при неизвестном kid.
+	jwksMinRefresh = time.Minute
+)
+
+// Алгоритмы подписи ID токенов, которые принимаются от провайдера.
+var validMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// ErrNonceMismatch возвращается, если nonce в ID токене не совпадает с ожидаемым.
+var ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+
+// Provider реализует поток authorization code + PKCE для одного провайдера OpenID Connect.
+// Метаданные провайдера и его ключи загружаются при первом использовании и кэшируются.
+type Provider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        *jwk.Set
+	keysFetched time.Time
+}
+
+// metadata содержит используемые поля документа /.well-known/openid-configuration.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDClaims содержит проверенные утверждения ID токена.
+type IDClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// NewProvider создает провайдер с заданной конфигурацией.
+func NewProvider(cfg config.OIDCProviderConfig) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// NewProviders создает провайдеры из конфигурации и возвращает их по именам.
+func NewProviders(cfgs []config.OIDCProviderConfig) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfgs))
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = NewProvider(cfg)
+	}
+	return providers
+}
+
+// Config возвращает конфигурацию провайдера.
+func (p *Provider) Config() config.OIDCProviderConfig {
+	return p.cfg
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера, на которую перенаправляется пользователь.
+// state защищает от CSRF, nonce связывает ID токен с этим запросом, challenge - PKCE challenge (S256).
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на токены и возвращает проверенные утверждения ID токена.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("oidc: token response has no id_token (error %q)", tokens.Error)
+	}
+
+	return p.verifyIDToken(ctx, md, tokens.IDToken, nonce)
+}
+
+// verifyIDToken проверяет подпись, издателя, получателя, срок действия и nonce ID токена.
+func (p *Provider) verifyIDToken(ctx context.Context, md *metadata, raw, nonce string) (*IDClaims, error) {
+	claims := &IDClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, md, kid)
+	},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc: id_token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
+
+// publicKey возвращает открытый ключ провайдера по kid.
+// При неизвестном kid набор ключей перезагружается: так поддерживается ротация ключей провайдера.
+func (p *Provider) publicKey(ctx context.Context, md *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		if key, ok := findKey(p.keys, kid); ok {
+			return key.PublicKey()
+		}
+		if time.Since(p.keysFetched) < jwksMinRefresh {
+			return nil, fmt.Errorf("oidc: unknown key id %q", kid)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", md.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	set := &jwk.Set{}
+	if err := p.doJSON(req, set); err != nil {
+		return nil, err
+	}
+	p.keys = set
+	p.keysFetched = time.Now()
+
+	key, ok := findKey(set, kid)
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown key id %q", kid)
+	}
+	return key.PublicKey()
+}
+
+// findKey ищет ключ по kid. Если kid не указан, а ключ в наборе один, используется он.
+func findKey(set *jwk.Set, kid string) (jwk.Key, bool) {
+	if kid == "" && len(set.Keys) == 1 {
+		return set.Keys[0], true
+	}
+	return set.Find(kid)
+}
+
+// discover загружает и кэширует метаданные провайдера.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	md := &metadata{}
+	if err := p.doJSON(req, md); err != nil {
+		return nil, err
+	}
+
+	// Издатель в метаданных обязан совпадать с настроенным (OpenID Connect Discovery, раздел 4.3).
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch: configured %q, provider reports %q", p.cfg.Issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("oidc: incomplete provider metadata")
+	}
+	p.metadata = md
+	return md, nil
+}
+
+// doJSON выполняет запрос и декодирует JSON-ответ, ограничивая его размер.
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s %s: unexpected status %d", req.Method, req.URL, resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// NewVerifier создает случайный PKCE code verifier (RFC 7636).
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// Challenge вычисляет PKCE code challenge методом S256.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString возвращает случайную строку для параметров state и nonce.
+func RandomString() (string, error) {
+	return randomString(24)
+}
+
+// randomString возвращает n случайных байт в кодировке base64url.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+	"github.com/NickolaiP/notes_app/backend/internal/oidc/oidctest"
+)
+
+const testRedirectURL = "http://notes.test/auth/oidc/callback"
+
+// authorize проходит вход у провайдера и возвращает параметры, с которыми он перенаправил пользователя обратно.
+func authorize(t *testing.T, p *Provider, state, nonce, verifier string) url.Values {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", authURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, testRedirectURL)
+	}
+	return location.Query()
+}
+
+func TestProviderFlow(t *testing.T) {
+	idp := oidctest.NewServer("notes", "secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{
+		Subject:           "user-1",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "alice",
+		Name:              "Alice",
+	})
+
+	p := NewProvider(config.OIDCProviderConfig{
+		Name:         "corp",
+		Issuer:       idp.Issuer(),
+		ClientID:     "notes",
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := authorize(t, p, "state-1", "nonce-1", verifier)
+	if q.Get("state") != "state-1" || q.Get("code") == "" {
+		t.Fatalf("callback parameters = %v, want state-1 and a code", q)
+	}
+	claims, err := p.Exchange(context.Background(), q.Get("code"), verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" || !claims.EmailVerified ||
+		claims.PreferredUsername != "alice" || claims.Name != "Alice" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Код одноразовый.
+	if _, err := p.Exchange(context.Background(), q.Get("code"), verifier, "nonce-1"); err == nil {
+		t.Error("Exchange with a used code: want error")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		wantErr  error
+	}{
+		{"wrong verifier", "other-verifier", "nonce-2", nil},
+		{"wrong nonce", verifier, "other-nonce", ErrNonceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := authorize(t, p, "state-2", "nonce-2", verifier)
+			_, err := p.Exchange(context.Background(), q.Get("code"), tt.verifier, tt.nonce)
+			if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderConfigErrors(t *testing.T) {
+	idp := oidctest.NewServer("notes", "secret")
+	defer idp.Close()
+
+	tests := []struct {
+		name string
+		cfg  config.OIDCProviderConfig
+		// authErr - ошибка ожидается уже при построении адреса входа.
+		authErr bool
+	}{
+		{"issuer mismatch", config.OIDCProviderConfig{Issuer: idp.Issuer() + "/", ClientID: "notes", ClientSecret: "secret", RedirectURL: testRedirectURL}, true},
+		{"unreachable provider", config.OIDCProviderConfig{Issuer: "http://127.0.0.1:1", ClientID: "notes", ClientSecret: "secret", RedirectURL: testRedirectURL}, true},
+		{"wrong client secret", config.OIDCProviderConfig{Issuer: idp.Issuer(), ClientID: "notes", ClientSecret: "wrong", RedirectURL: testRedirectURL}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(tt.cfg)
+			verifier, err := NewVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authErr {
+				if _, err := p.AuthCodeURL(context.Background(), "s", "n", Challenge(verifier)); err == nil {
+					t.Error("AuthCodeURL: want error")
+				}
+				return
+			}
+			q := authorize(t, p, "s", "n", verifier)
+			if _, err := p.Exchange(context.Background(), q.Get("code"), verifier, "n"); err == nil {
+				t.Error("Exchange: want error")
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// Пример из RFC 7636, приложение B.
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge = %s", got)
+	}
+	a, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Верификатор по RFC 7636 - от 43 до 128 символов.
+	if a == b || len(a) < 43 || len(a) > 128 {
+		t.Errorf("NewVerifier = %q, %q", a, b)
+	}
+}
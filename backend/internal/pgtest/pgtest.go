@@ -0,0 +1,243 @@
+// Package pgtest запускает временный сервер PostgreSQL для интеграционных тестов.
+// Сервер создается из локально установленных initdb и postgres во временном каталоге,
+// слушает только 127.0.0.1 и удаляется вместе с данными при остановке. Сеть не нужна.
+//
+// Каталог с программами задается переменной PGTEST_BIN; если она не задана, программы ищутся
+// в PATH и в стандартных каталогах установки PostgreSQL.
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/config"
+
+	_ "github.com/lib/pq"
+)
+
+// ErrUnavailable означает, что временный сервер запустить нельзя: программы PostgreSQL
+// не найдены или процесс работает от имени root, от которого postgres не запускается.
+var ErrUnavailable = errors.New("pgtest: PostgreSQL is unavailable")
+
+// startTimeout - сколько ждать, пока запущенный сервер начнет принимать подключения.
+const startTimeout = 30 * time.Second
+
+// Server - запущенный временный сервер PostgreSQL.
+type Server struct {
+	// Host и Port - адрес, на котором сервер принимает подключения.
+	Host string
+	Port string
+	// User - суперпользователь сервера; пароль не нужен.
+	User string
+
+	dir  string
+	cmd  *exec.Cmd
+	done chan error
+	// databases - счетчик для имен баз данных, созданных NewDatabase.
+	databases atomic.Int64
+}
+
+// Start создает кластер во временном каталоге и запускает на нем сервер.
+// Если программы PostgreSQL недоступны, возвращает ошибку, оборачивающую ErrUnavailable.
+// Сервер нужно остановить вызовом Stop.
+func Start() (*Server, error) {
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("%w: postgres cannot be run as root", ErrUnavailable)
+	}
+	initdb, err := findProgram("initdb")
+	if err != nil {
+		return nil, err
+	}
+	postgres, err := findProgram("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest-")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Host: "127.0.0.1", User: "postgres", dir: dir, done: make(chan error, 1)}
+	data := filepath.Join(dir, "data")
+	logFile, err := os.Create(filepath.Join(dir, "postgres.log"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	defer logFile.Close()
+
+	out, err := exec.Command(initdb, "-D", data, "-U", s.User, "-A", "trust", "-E", "UTF8", "--no-locale", "-N").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pgtest: initdb: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.Port = strconv.Itoa(port)
+
+	// Надежность записи тестовым данным не нужна, поэтому ее отключаем ради скорости.
+	s.cmd = exec.Command(postgres, "-D", data, "-p", s.Port, "-k", dir,
+		"-c", "listen_addresses="+s.Host,
+		"-c", "fsync=off", "-c", "synchronous_commit=off", "-c", "full_page_writes=off")
+	s.cmd.Stdout = logFile
+	s.cmd.Stderr = logFile
+	if err := s.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pgtest: start postgres: %w", err)
+	}
+	go func() { s.done <- s.cmd.Wait() }()
+
+	if err := s.waitReady(); err != nil {
+		log, _ := os.ReadFile(logFile.Name())
+		s.Stop()
+		return nil, fmt.Errorf("%w\n%s", err, log)
+	}
+	return s, nil
+}
+
+// Config возвращает настройки подключения к базе данных dbname.
+func (s *Server) Config(dbname string) config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Host:    s.Host,
+		Port:    s.Port,
+		User:    s.User,
+		DBName:  dbname,
+		SSLMode: "disable",
+	}
+}
+
+// NewDatabase создает пустую базу данных для теста и удаляет ее по его завершении.
+func (s *Server) NewDatabase(t testing.TB) config.DatabaseConfig {
+	t.Helper()
+	name := "test_" + strconv.FormatInt(s.databases.Add(1), 10)
+
+	db, err := s.open("postgres")
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("pgtest: create database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db, err := s.open("postgres")
+		if err != nil {
+			t.Errorf("pgtest: %v", err)
+			return
+		}
+		defer db.Close()
+		// Соединения, оставшиеся у теста (например, LISTEN), закрываются принудительно.
+		if _, err := db.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Errorf("pgtest: drop database: %v", err)
+		}
+	})
+	return s.Config(name)
+}
+
+// Stop останавливает сервер и удаляет его данные.
+func (s *Server) Stop() {
+	if s.cmd != nil && s.cmd.Process != nil {
+		// SIGINT - быстрая остановка: сервер прерывает транзакции и отключает клиентов.
+		s.cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-s.done:
+		case <-time.After(10 * time.Second):
+			s.cmd.Process.Kill()
+			<-s.done
+		}
+	}
+	os.RemoveAll(s.dir)
+}
+
+func (s *Server) open(dbname string) (*sql.DB, error) {
+	cfg := s.Config(dbname)
+	return sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.DBName, cfg.SSLMode))
+}
+
+// waitReady ждет, пока сервер начнет принимать подключения.
+func (s *Server) waitReady() error {
+	db, err := s.open("postgres")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(startTimeout)
+	for {
+		select {
+		case err := <-s.done:
+			s.done <- err
+			return fmt.Errorf("pgtest: postgres exited: %v", err)
+		default:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pgtest: postgres is not ready: %w", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// findProgram ищет программу PostgreSQL в PGTEST_BIN, в PATH и в стандартных каталогах установки.
+func findProgram(name string) (string, error) {
+	if dir := os.Getenv("PGTEST_BIN"); dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("%w: %s not found in PGTEST_BIN", ErrUnavailable, name)
+		}
+		return path, nil
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	var candidates []string
+	for _, pattern := range []string{
+		"/usr/lib/postgresql/*/bin",
+		"/usr/pgsql-*/bin",
+		"/usr/local/pgsql/bin",
+		"/opt/homebrew/opt/postgresql*/bin",
+		"/usr/local/opt/postgresql*/bin",
+	} {
+		dirs, _ := filepath.Glob(pattern)
+		candidates = append(candidates, dirs...)
+	}
+	// Glob возвращает каталоги по алфавиту, поэтому перебираем с конца, чтобы взять более новую версию.
+	for i := len(candidates) - 1; i >= 0; i-- {
+		path := filepath.Join(candidates[i], name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s not found", ErrUnavailable, name)
+}
+
+// freePort возвращает свободный TCP-порт на 127.0.0.1.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,385 @@
+// Package spellertest предоставляет локальный заменитель Яндекс.Спеллер API для тестов и разработки.
+// Заменитель реализует методы checkText и checkTexts JSON-интерфейса: ошибки в тексте находятся
+// по правилам (слово и варианты исправления) и, если задан словарь, по отсутствию слова в нем.
+// Для проверки устойчивости клиента можно добавить задержку ответа, ошибки сервера и ответы
+// с некорректным JSON.
+package spellertest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Коды ошибок Яндекс.Спеллер API.
+const (
+	CodeUnknownWord    = 1
+	CodeRepeatWord     = 2
+	CodeCapitalization = 3
+)
+
+// Флаги параметра options, которые учитывает заменитель.
+const (
+	optionIgnoreDigits         = 2
+	optionIgnoreURLs           = 4
+	optionFindRepeatWords      = 8
+	optionIgnoreCapitalization = 512
+)
+
+// MaxTextLen - наибольшая суммарная длина текстов в одном запросе, как у Яндекс.Спеллера.
+// Более длинный запрос отклоняется с кодом 413.
+const MaxTextLen = 10000
+
+// Rule - правило проверки: слово Word считается ошибкой с вариантами исправления Suggestions.
+// Слово сравнивается без учета регистра, кроме правил с кодом CodeCapitalization.
+type Rule struct {
+	Word        string
+	Suggestions []string
+	Code        int
+}
+
+// Faults - неисправности, которые заменитель добавляет к ответам.
+type Faults struct {
+	// Latency - задержка каждого ответа.
+	Latency time.Duration
+	// ErrorRate - доля запросов (от 0 до 1), на которые отвечается кодом ErrorStatus (по умолчанию 503).
+	ErrorRate   float64
+	ErrorStatus int
+	// MalformedRate - доля запросов, на которые отвечается некорректным JSON.
+	MalformedRate float64
+}
+
+// SpellError - ошибка в ответе API. Pos и Len задаются в символах текста.
+type SpellError struct {
+	Code int      `json:"code"`
+	Pos  int      `json:"pos"`
+	Row  int      `json:"row"`
+	Col  int      `json:"col"`
+	Len  int      `json:"len"`
+	Word string   `json:"word"`
+	S    []string `json:"s"`
+}
+
+// Speller - обработчик HTTP-запросов, реализующий Яндекс.Спеллер API. Адрес метода может
+// содержать любой префикс: .../checkText и .../checkTexts.
+type Speller struct {
+	rules map[string]Rule
+	known map[string]bool
+
+	mu            sync.Mutex
+	faults        Faults
+	failNext      int
+	failStatus    int
+	malformedNext int
+	requests      int
+}
+
+// New создает заменитель с правилами rules. Если словарь dictionary не пуст, слова,
+// которых нет ни в нем, ни в правилах, считаются неизвестными (код 1, без вариантов исправления).
+func New(rules []Rule, dictionary []string) *Speller {
+	s := &Speller{rules: make(map[string]Rule), known: make(map[string]bool)}
+	for _, r := range rules {
+		if r.Code == 0 {
+			r.Code = CodeUnknownWord
+		}
+		key := r.Word
+		if r.Code != CodeCapitalization {
+			key = strings.ToLower(key)
+		}
+		s.rules[key] = r
+	}
+	for _, w := range dictionary {
+		s.known[strings.ToLower(w)] = true
+	}
+	return s
+}
+
+// SetFaults задает неисправности для следующих запросов.
+func (s *Speller) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+// FailNext отвечает на следующие n запросов кодом status.
+func (s *Speller) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext, s.failStatus = n, status
+}
+
+// MalformedNext отвечает на следующие n запросов некорректным JSON.
+func (s *Speller) MalformedNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.malformedNext = n
+}
+
+// Requests возвращает число полученных запросов.
+func (s *Speller) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// fault выбирает неисправность для очередного запроса: код ошибки или некорректный ответ.
+func (s *Speller) fault() (latency time.Duration, status int, malformed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	latency = s.faults.Latency
+	switch {
+	case s.failNext > 0:
+		s.failNext--
+		return latency, s.failStatus, false
+	case s.malformedNext > 0:
+		s.malformedNext--
+		return latency, 0, true
+	case s.faults.ErrorRate > 0 && rand.Float64() < s.faults.ErrorRate:
+		status = s.faults.ErrorStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		return latency, status, false
+	}
+	return latency, 0, s.faults.MalformedRate > 0 && rand.Float64() < s.faults.MalformedRate
+}
+
+// ServeHTTP обрабатывает запрос к методу checkText или checkTexts.
+func (s *Speller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	latency, status, malformed := s.fault()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	batch := strings.HasSuffix(r.URL.Path, "/checkTexts")
+	if !batch && !strings.HasSuffix(r.URL.Path, "/checkText") {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	texts := r.Form["text"]
+	total := 0
+	for _, t := range texts {
+		total += len([]rune(t))
+	}
+	if total > MaxTextLen {
+		http.Error(w, "Text is too long", http.StatusRequestEntityTooLarge)
+		return
+	}
+	options, _ := strconv.Atoi(r.Form.Get("options"))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if malformed {
+		w.Write([]byte(`[{"code":1,"pos":`))
+		return
+	}
+	if !batch {
+		text := ""
+		if len(texts) > 0 {
+			text = texts[0]
+		}
+		json.NewEncoder(w).Encode(s.Check(text, options))
+		return
+	}
+	results := make([][]SpellError, len(texts))
+	for i, t := range texts {
+		results[i] = s.Check(t, options)
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+// Check возвращает ошибки в тексте с учетом флагов options API.
+func (s *Speller) Check(text string, options int) []SpellError {
+	errs := []SpellError{}
+	prev := ""
+	for _, t := range tokenize([]rune(text)) {
+		if options&optionIgnoreURLs != 0 && t.url {
+			prev = ""
+			continue
+		}
+		for _, wd := range t.words {
+			word := string(wd.text)
+			lower := strings.ToLower(word)
+			e := SpellError{Pos: wd.pos, Row: wd.row, Col: wd.col, Len: len(wd.text), Word: word, S: []string{}}
+			switch {
+			case options&optionIgnoreDigits != 0 && strings.IndexFunc(word, unicode.IsDigit) >= 0:
+			case options&optionFindRepeatWords != 0 && lower == prev:
+				e.Code = CodeRepeatWord
+			default:
+				if r, ok := s.rules[word]; ok && r.Code == CodeCapitalization {
+					if options&optionIgnoreCapitalization == 0 {
+						e.Code, e.S = r.Code, r.Suggestions
+					}
+				} else if r, ok := s.rules[lower]; ok && r.Code != CodeCapitalization {
+					e.Code, e.S = r.Code, matchCase(word, r.Suggestions)
+				} else if len(s.known) > 0 && !s.known[lower] && strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+					e.Code = CodeUnknownWord
+				}
+			}
+			if e.Code != 0 {
+				errs = append(errs, e)
+			}
+			prev = lower
+		}
+	}
+	return errs
+}
+
+// matchCase начинает варианты исправления с заглавной буквы, если с нее начинается слово.
+func matchCase(word string, suggestions []string) []string {
+	if first := []rune(word); len(first) == 0 || !unicode.IsUpper(first[0]) {
+		return suggestions
+	}
+	out := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		r := []rune(s)
+		if len(r) > 0 {
+			r[0] = unicode.ToUpper(r[0])
+		}
+		out[i] = string(r)
+	}
+	return out
+}
+
+// word - слово текста с позицией в символах, номером строки и столбца (с нуля).
+type word struct {
+	text          []rune
+	pos, row, col int
+}
+
+// token - фрагмент текста между пробелами и его слова.
+type token struct {
+	url   bool
+	words []word
+}
+
+// tokenize делит текст на фрагменты между пробелами, а фрагменты - на слова: последовательности
+// букв и цифр, в том числе соединенные дефисом или апострофом.
+func tokenize(text []rune) []token {
+	var tokens []token
+	row, lineStart := 0, 0
+	for i := 0; i < len(text); {
+		if unicode.IsSpace(text[i]) {
+			if text[i] == '\n' {
+				row, lineStart = row+1, i+1
+			}
+			i++
+			continue
+		}
+		start := i
+		for i < len(text) && !unicode.IsSpace(text[i]) {
+			i++
+		}
+		field := text[start:i]
+		t := token{url: isURL(string(field))}
+		for j := 0; j < len(field); {
+			if !isWordRune(field[j]) {
+				j++
+				continue
+			}
+			ws := j
+			for j < len(field) && (isWordRune(field[j]) ||
+				(field[j] == '-' || field[j] == '\'') && j+1 < len(field) && isWordRune(field[j+1])) {
+				j++
+			}
+			pos := start + ws
+			t.words = append(t.words, word{text: field[ws:j], pos: pos, row: row, col: pos - lineStart})
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func isURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "www.")
+}
+
+// LoadRules читает правила по одному в строке в формате
+//
+//	слово -> вариант1, вариант2 [код]
+//
+// Варианты и код необязательны (код по умолчанию 1). Пустые строки и строки, начинающиеся с #, пропускаются.
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		w, rest, ok := strings.Cut(line, "->")
+		w = strings.TrimSpace(w)
+		if !ok || w == "" {
+			return nil, fmt.Errorf("line %d: expected \"word -> suggestions\"", n)
+		}
+		rule := Rule{Word: w, Suggestions: []string{}}
+		rest = strings.TrimSpace(rest)
+		if i := strings.LastIndex(rest, "["); i >= 0 && strings.HasSuffix(rest, "]") {
+			code, err := strconv.Atoi(strings.TrimSpace(rest[i+1 : len(rest)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid code: %w", n, err)
+			}
+			rule.Code, rest = code, strings.TrimSpace(rest[:i])
+		}
+		for _, s := range strings.Split(rest, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				rule.Suggestions = append(rule.Suggestions, s)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// LoadDictionary читает словарь: по одному слову в строке. Пустые строки и строки,
+// начинающиеся с #, пропускаются.
+func LoadDictionary(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// Server - заменитель Яндекс.Спеллер API поверх httptest.Server. Адрес сервера (URL) передается
+// клиенту как базовый адрес API.
+type Server struct {
+	*httptest.Server
+	*Speller
+}
+
+// NewServer запускает заменитель с правилами rules и словарем dictionary (см. New).
+// Сервер нужно остановить вызовом Close.
+func NewServer(rules []Rule, dictionary []string) *Server {
+	s := New(rules, dictionary)
+	return &Server{Server: httptest.NewServer(s), Speller: s}
+}
@@ -0,0 +1,179 @@
+package spellertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var testRules = []Rule{
+	{Word: "превет", Suggestions: []string{"привет"}},
+	{Word: "москва", Suggestions: []string{"Москва"}, Code: CodeCapitalization},
+}
+
+// describe возвращает ошибки в виде "слово@pos:row:col/len=code[варианты]" для сравнения в тестах.
+func describe(errs []SpellError) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = fmt.Sprintf("%s@%d:%d:%d/%d=%d%v", e.Word, e.Pos, e.Row, e.Col, e.Len, e.Code, e.S)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestCheck(t *testing.T) {
+	s := New(testRules, nil)
+	tests := []struct {
+		name    string
+		text    string
+		options int
+		want    string
+	}{
+		{"rule", "Мы из москва, превет!", 0, "москва@6:0:6/6=3[Москва] превет@14:0:14/6=1[привет]"},
+		{"suggestion case follows the word", "Превет всем", 0, "Превет@0:0:0/6=1[Привет]"},
+		{"capitalization rule is case-sensitive", "Москва", 0, ""},
+		{"ignore capitalization", "москва превет", optionIgnoreCapitalization, "превет@7:0:7/6=1[привет]"},
+		{"rows and columns", "строка\n  превет", 0, "превет@9:1:2/6=1[привет]"},
+		{"repeat words", "мы мы Мы пошли", optionFindRepeatWords, "мы@3:0:3/2=2[] Мы@6:0:6/2=2[]"},
+		{"repeat words are not checked by default", "мы мы", 0, ""},
+		{"ignore URLs", "https://превет.рф превет", optionIgnoreURLs, "превет@18:0:18/6=1[привет]"},
+		{"URL words are checked by default", "www.превет.рф", 0, "превет@4:0:4/6=1[привет]"},
+		{"hyphenated word", "из-за превет-то", 0, ""},
+		{"empty", "", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := describe(s.Check(tt.text, tt.options)); got != tt.want {
+			t.Errorf("%s: Check(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDictionary(t *testing.T) {
+	s := New(testRules, []string{"мы", "Пошли", "домой"})
+	tests := []struct {
+		text    string
+		options int
+		want    string
+	}{
+		{"Мы пошли домой", 0, ""},
+		{"мы пашли домой", 0, "пашли@3:0:3/5=1[]"},
+		{"мы превет", 0, "превет@3:0:3/6=1[привет]"},
+		{"мы 2024 года", 0, "года@8:0:8/4=1[]"},
+		{"мы k8s", 0, "k8s@3:0:3/3=1[]"},
+		{"мы k8s", optionIgnoreDigits, ""},
+	}
+	for _, tt := range tests {
+		if got := describe(s.Check(tt.text, tt.options)); got != tt.want {
+			t.Errorf("Check(%q, %d) = %q, want %q", tt.text, tt.options, got, tt.want)
+		}
+	}
+}
+
+// post отправляет форму методу method заменителя и возвращает код и тело ответа.
+func post(t *testing.T, srv *Server, method string, form url.Values) (int, string) {
+	t.Helper()
+	resp, err := http.PostForm(srv.URL+"/services/spellservice.json/"+method, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(testRules, nil)
+	defer srv.Close()
+
+	status, body := post(t, srv, "checkText", url.Values{"text": {"превет"}})
+	var single []SpellError
+	if err := json.Unmarshal([]byte(body), &single); status != http.StatusOK || err != nil || describe(single) != "превет@0:0:0/6=1[привет]" {
+		t.Errorf("checkText: %d %s (%v)", status, body, err)
+	}
+
+	status, body = post(t, srv, "checkTexts", url.Values{"text": {"всё хорошо", "москва превет"}, "options": {"512"}})
+	var batch [][]SpellError
+	if err := json.Unmarshal([]byte(body), &batch); status != http.StatusOK || err != nil || len(batch) != 2 ||
+		len(batch[0]) != 0 || describe(batch[1]) != "превет@7:0:7/6=1[привет]" {
+		t.Errorf("checkTexts: %d %s (%v)", status, body, err)
+	}
+
+	if status, _ := post(t, srv, "checkWords", nil); status != http.StatusNotFound {
+		t.Errorf("unknown method: status %d, want 404", status)
+	}
+	long := url.Values{"text": {strings.Repeat("я", MaxTextLen/2), strings.Repeat("я", MaxTextLen/2+1)}}
+	if status, _ := post(t, srv, "checkTexts", long); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("long request: status %d, want 413", status)
+	}
+	if got := srv.Requests(); got != 4 {
+		t.Errorf("Requests = %d, want 4", got)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	srv := NewServer(testRules, nil)
+	defer srv.Close()
+	form := url.Values{"text": {"превет"}}
+
+	srv.FailNext(2, http.StatusTooManyRequests)
+	srv.MalformedNext(1)
+	for i, want := range []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK, http.StatusOK} {
+		status, body := post(t, srv, "checkText", form)
+		if status != want {
+			t.Fatalf("request %d: status %d, want %d", i, status, want)
+		}
+		// После ошибок отвечается некорректным JSON, затем снова правильно.
+		if valid := json.Valid([]byte(body)); status == http.StatusOK && valid != (i == 3) {
+			t.Errorf("request %d: body %q, valid JSON %v", i, body, valid)
+		}
+	}
+
+	srv.SetFaults(Faults{ErrorRate: 1})
+	if status, _ := post(t, srv, "checkText", form); status != http.StatusServiceUnavailable {
+		t.Errorf("ErrorRate 1: status %d, want 503", status)
+	}
+	srv.SetFaults(Faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway})
+	if status, _ := post(t, srv, "checkText", form); status != http.StatusBadGateway {
+		t.Errorf("ErrorStatus 502: status %d", status)
+	}
+	srv.SetFaults(Faults{MalformedRate: 1})
+	if status, body := post(t, srv, "checkText", form); status != http.StatusOK || json.Valid([]byte(body)) {
+		t.Errorf("MalformedRate 1: %d %q", status, body)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`
+# правила
+превет -> привет, приветик
+москва -> Москва [3]
+  кот->
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(rules)
+	want := "[{превет [привет приветик] 0} {москва [Москва] 3} {кот [] 0}]"
+	if got != want {
+		t.Errorf("LoadRules = %s, want %s", got, want)
+	}
+
+	for _, input := range []string{"превет", " -> привет", "москва -> Москва [x]"} {
+		if _, err := LoadRules(strings.NewReader(input)); err == nil {
+			t.Errorf("LoadRules(%q): want error", input)
+		}
+	}
+}
+
+func TestLoadDictionary(t *testing.T) {
+	words, err := LoadDictionary(strings.NewReader("# словарь\nмы\n\n  пошли  \n#домой\n"))
+	if err != nil || fmt.Sprint(words) != "[мы пошли]" {
+		t.Errorf("LoadDictionary = %v, %v", words, err)
+	}
+}
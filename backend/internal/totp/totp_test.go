@@ -0,0 +1,133 @@
+package totp
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// rfcSecret - секрет "12345678901234567890" из тестовых векторов RFC 6238 в кодировке base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// Тестовые векторы RFC 6238 (SHA1), последние шесть цифр.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with invalid secret: want error")
+	}
+	// Секрет принимается в нижнем регистре, как его часто вводят вручную.
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0)))
+	if err != nil || lower != "287082" {
+		t.Errorf("Code with lowercase secret = %q, %v; want 287082", lower, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		ok       bool
+	}{
+		{"current", code(step), 1, step, true},
+		{"surrounding spaces", " " + code(step) + " ", 1, step, true},
+		{"previous step", code(step - 1), 1, step - 1, true},
+		{"next step", code(step + 1), 1, step + 1, true},
+		{"outside skew", code(step - 2), 1, 0, false},
+		{"no skew", code(step - 1), 0, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", code(step)[:5], 1, 0, false},
+		{"too long", code(step) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.ok || got != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v; want %d, %v", tt.code, got, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", "123456", now, 1); ok {
+		t.Error("Validate with invalid secret: want false")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("GenerateSecret returned the same secret twice: %s", a)
+	}
+	if key, err := encoding.DecodeString(a); err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v; want 20 bytes", a, len(key), err)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("Code with generated secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("NotesApp", "alice smith", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parse %q: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/NotesApp:alice smith" {
+		t.Errorf("URI = %q, want otpauth://totp/NotesApp:alice%%20smith", uri)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "NotesApp",
+		"algorithm": "SHA1",
+		"digits":    strconv.Itoa(Digits),
+		"period":    "30",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("URI parameter %s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
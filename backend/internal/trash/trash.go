@@ -0,0 +1,80 @@
+// Package trash окончательно удаляет заметки, которые пролежали в корзине дольше срока хранения.
+//
+// Удаленная заметка остается в таблице notes с отметкой deleted_at, чтобы клиенты синхронизации
+// узнали об удалении. По истечении срока хранения она удаляется вместе с вложениями, доступами и
+// ссылками, а файлы вложений удаляет очистка хранилища (см. blobstore.Sweeper).
+package trash
+
+import (
+	"context"
+	"time"
+
+	"github.com/NickolaiP/notes_app/backend/internal/database"
+	"github.com/NickolaiP/notes_app/backend/internal/jobs"
+	"github.com/NickolaiP/notes_app/backend/internal/logger"
+)
+
+const (
+	// PurgeSchedule - расписание очистки корзины.
+	PurgeSchedule = "@hourly"
+	// purgeBatch - число заметок, удаляемых одним запросом.
+	purgeBatch = 500
+)
+
+// purgeTask - задание очистки корзины.
+var purgeTask = jobs.Task[struct{}]{Kind: "notes.purge_trash", MaxAttempts: 3}
+
+// Purger удаляет из корзины заметки старше срока хранения.
+type Purger struct {
+	db        database.Database
+	retention time.Duration
+	logger    *logger.Logger
+}
+
+// NewPurger создает новый экземпляр Purger.
+func NewPurger(db database.Database, retention time.Duration, logger *logger.Logger) *Purger {
+	return &Purger{db: db, retention: retention, logger: logger}
+}
+
+// Schedule регистрирует очистку корзины как периодическое задание очереди q.
+func (p *Purger) Schedule(q *jobs.Queue) error {
+	jobs.Handle(q, purgeTask, func(ctx context.Context, _ struct{}) error {
+		n, err := p.Purge(ctx)
+		if n > 0 {
+			p.logger.Info("Purged notes from trash", "count", n)
+		}
+		return err
+	})
+	return jobs.Schedule(q, "purge-trash", PurgeSchedule, purgeTask, struct{}{})
+}
+
+// Purge окончательно удаляет заметки, удаленные раньше срока хранения, и возвращает их число.
+// Вместе с заметками сдвигается граница ленты синхронизации: клиенты с более старым токеном
+// должны синхронизироваться заново.
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		var n int
+		err := p.db.QueryRow(ctx, `WITH purged AS (
+                DELETE FROM notes WHERE id IN (
+                    SELECT id FROM notes WHERE deleted_at < now() - make_interval(secs => $1) ORDER BY id LIMIT $2)
+                RETURNING change_seq),
+            horizon AS (
+                UPDATE sync_horizon SET change_seq = GREATEST(change_seq, (SELECT max(change_seq) FROM purged))
+                WHERE EXISTS (SELECT 1 FROM purged))
+            SELECT count(*) FROM purged`, p.retention.Seconds(), purgeBatch).Scan(&n)
+		if err != nil {
+			return purged, err
+		}
+		purged += n
+		if n < purgeBatch {
+			break
+		}
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	// Изменения доступа старше границы ленты больше не нужны: токен, который их не получил, устарел.
+	_, err := p.db.Exec(ctx, "DELETE FROM note_access_changes WHERE change_seq < (SELECT change_seq FROM sync_horizon)")
+	return purged, err
+}
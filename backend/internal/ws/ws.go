@@ -0,0 +1,327 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Типы сообщений и управляющих кадров (RFC 6455, раздел 5.2).
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Коды закрытия соединения (RFC 6455, раздел 7.4.1).
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseInvalidData     = 1007
+	ClosePolicyViolation = 1008
+	CloseTooBig          = 1009
+	CloseInternalError   = 1011
+)
+
+// acceptGUID - строка, которая добавляется к ключу клиента при вычислении Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// writeTimeout - максимальное время записи одного кадра.
+const writeTimeout = 10 * time.Second
+
+var (
+	// ErrClosed возвращается при чтении из соединения, которое закрыто клиентом или сервером.
+	ErrClosed = errors.New("ws: connection closed")
+	// ErrTooBig возвращается, если сообщение клиента превышает допустимый размер.
+	ErrTooBig = errors.New("ws: message too big")
+)
+
+// Upgrader переводит HTTP-запрос в соединение WebSocket.
+type Upgrader struct {
+	// MaxMessageSize - максимальный размер сообщения клиента в байтах.
+	MaxMessageSize int64
+	// ReadTimeout - максимальное время ожидания следующего кадра от клиента, включая pong.
+	// Если сервер периодически отправляет ping, живое соединение не простаивает дольше периода ping.
+	ReadTimeout time.Duration
+	// CheckOrigin проверяет заголовок Origin. Браузер отправляет cookie при подключении с любого сайта,
+	// поэтому без проверки чужая страница могла бы работать от имени пользователя.
+	// Если не задан, разрешены запросы без Origin и с Origin, совпадающим с Host.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Upgrade выполняет рукопожатие WebSocket и возвращает соединение.
+// В случае ошибки клиенту уже отправлен ответ.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("ws: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("ws: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("ws: invalid key")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil, errors.New("ws: origin not allowed")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("ws: response does not support hijacking")
+	}
+	netConn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Сервер мог установить дедлайны для обычных запросов, соединение WebSocket управляет ими само.
+	netConn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := netConn.Write([]byte(resp)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: netConn, br: brw.Reader, maxSize: u.MaxMessageSize, readTimeout: u.ReadTimeout}, nil
+}
+
+// SameOrigin разрешает запросы без заголовка Origin (не из браузера) и запросы,
+// у которых хост в Origin совпадает с Host запроса.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Conn - серверная сторона соединения WebSocket.
+// Чтение должно выполняться из одной горутины, запись безопасна из нескольких.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	maxSize     int64
+	readTimeout time.Duration
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// ReadMessage читает следующее сообщение, собирая его из фрагментов.
+// На ping отвечает pong, на запрос закрытия - подтверждением и возвращает ErrClosed.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	var msg []byte
+	msgType := 0
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code, "")
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "ws: new message inside fragmented message")
+			}
+			msgType = opcode
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "ws: unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("ws: unknown opcode %d", opcode))
+		}
+
+		if c.maxSize > 0 && int64(len(msg)+len(payload)) > c.maxSize {
+			c.fail(CloseTooBig, "")
+			return 0, nil, ErrTooBig
+		}
+		msg = append(msg, payload...)
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidData, "ws: invalid UTF-8 in text message")
+			}
+			return msgType, msg, nil
+		}
+	}
+}
+
+// readFrame читает один кадр и снимает с него маску.
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "ws: reserved bits set")
+	}
+	// Все кадры клиента должны быть замаскированы (RFC 6455, раздел 5.1).
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "ws: unmasked client frame")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "ws: invalid frame length")
+		}
+	}
+	if opcode >= CloseMessage && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "ws: invalid control frame")
+	}
+	if c.maxSize > 0 && length > c.maxSize {
+		c.fail(CloseTooBig, "")
+		return false, 0, nil, ErrTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage отправляет сообщение одним кадром. Сообщения сервера не маскируются.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// writeFrame записывает кадр; вызывается под блокировкой wmu.
+func (c *Conn) writeFrame(opcode int, data []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | byte(opcode)
+	switch n := len(data); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close отправляет клиенту кадр закрытия с кодом и причиной и закрывает соединение.
+// Повторные вызовы ничего не делают.
+func (c *Conn) Close(code int, reason string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+	c.writeFrame(CloseMessage, payload)
+	return c.conn.Close()
+}
+
+// fail закрывает соединение из-за нарушения протокола и возвращает ошибку с описанием.
+func (c *Conn) fail(code int, msg string) error {
+	c.Close(code, "")
+	if msg == "" {
+		return ErrClosed
+	}
+	return errors.New(msg)
+}
+
+// headerContains сообщает, содержит ли заголовок токен (без учета регистра) в списке через запятую.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
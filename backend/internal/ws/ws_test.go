@@ -0,0 +1,387 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeConn - соединение, которое читает заранее записанные кадры клиента и запоминает ответы сервера.
+type fakeConn struct {
+	net.Conn
+	r      io.Reader
+	out    bytes.Buffer
+	closed bool
+}
+
+func (c *fakeConn) Read(p []byte) (int, error)       { return c.r.Read(p) }
+func (c *fakeConn) Write(p []byte) (int, error)      { return c.out.Write(p) }
+func (c *fakeConn) Close() error                     { c.closed = true; return nil }
+func (c *fakeConn) SetDeadline(time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+// newTestConn возвращает соединение, из которого читаются кадры frames.
+func newTestConn(maxSize int64, frames ...[]byte) (*Conn, *fakeConn) {
+	fc := &fakeConn{r: bytes.NewReader(bytes.Join(frames, nil))}
+	return &Conn{conn: fc, br: bufio.NewReader(fc), maxSize: maxSize}, fc
+}
+
+// clientFrame собирает кадр клиента с маской.
+func clientFrame(fin bool, opcode int, payload []byte) []byte {
+	return rawFrame(fin, opcode, payload, []byte{0x12, 0x34, 0x56, 0x78})
+}
+
+// rawFrame собирает кадр; если mask равна nil, кадр не маскируется.
+func rawFrame(fin bool, opcode int, payload, mask []byte) []byte {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	var maskBit byte
+	if mask != nil {
+		maskBit = 0x80
+	}
+	frame := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(n))
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// serverFrame - кадр, отправленный сервером.
+type serverFrame struct {
+	opcode  int
+	payload []byte
+}
+
+// readServerFrames разбирает кадры сервера; они не должны быть замаскированы.
+func readServerFrames(t *testing.T, data []byte) []serverFrame {
+	t.Helper()
+	var frames []serverFrame
+	for len(data) > 0 {
+		if len(data) < 2 || data[0]&0x80 == 0 || data[1]&0x80 != 0 {
+			t.Fatalf("invalid server frame % x", data)
+		}
+		opcode := int(data[0] & 0x0f)
+		length, rest := int(data[1]&0x7f), data[2:]
+		switch length {
+		case 126:
+			length, rest = int(binary.BigEndian.Uint16(rest)), rest[2:]
+		case 127:
+			length, rest = int(binary.BigEndian.Uint64(rest)), rest[8:]
+		}
+		frames = append(frames, serverFrame{opcode, rest[:length]})
+		data = rest[length:]
+	}
+	return frames
+}
+
+// closeCode возвращает код из кадра закрытия.
+func closeCode(f serverFrame) int {
+	if f.opcode != CloseMessage || len(f.payload) < 2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(f.payload))
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 300)
+	huge := bytes.Repeat([]byte("y"), 70000)
+	tests := []struct {
+		name     string
+		frames   [][]byte
+		wantType int
+		want     []byte
+		// replies - типы кадров, которые сервер отправил в ответ.
+		replies []int
+	}{
+		{"text", [][]byte{clientFrame(true, TextMessage, []byte("привет"))}, TextMessage, []byte("привет"), nil},
+		{"binary", [][]byte{clientFrame(true, BinaryMessage, []byte{0, 1, 0xff})}, BinaryMessage, []byte{0, 1, 0xff}, nil},
+		{"empty", [][]byte{clientFrame(true, TextMessage, nil)}, TextMessage, []byte{}, nil},
+		{"16-bit length", [][]byte{clientFrame(true, BinaryMessage, long)}, BinaryMessage, long, nil},
+		{"64-bit length", [][]byte{clientFrame(true, BinaryMessage, huge)}, BinaryMessage, huge, nil},
+		{"fragmented", [][]byte{
+			clientFrame(false, TextMessage, []byte("пр")),
+			clientFrame(false, continuationFrame, []byte("ив")),
+			clientFrame(true, continuationFrame, []byte("ет")),
+		}, TextMessage, []byte("привет"), nil},
+		{"ping inside fragmented message", [][]byte{
+			clientFrame(false, TextMessage, []byte("a")),
+			clientFrame(true, PingMessage, []byte("p")),
+			clientFrame(true, PongMessage, nil),
+			clientFrame(true, continuationFrame, []byte("b")),
+		}, TextMessage, []byte("ab"), []int{PongMessage}},
+		{"UTF-8 split between fragments", [][]byte{
+			clientFrame(false, TextMessage, []byte("я")[:1]),
+			clientFrame(true, continuationFrame, []byte("я")[1:]),
+		}, TextMessage, []byte("я"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fc := newTestConn(0, tt.frames...)
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if typ != tt.wantType || !bytes.Equal(data, tt.want) {
+				t.Errorf("ReadMessage = %d, %q; want %d, %q", typ, data, tt.wantType, tt.want)
+			}
+			var replies []int
+			for _, f := range readServerFrames(t, fc.out.Bytes()) {
+				replies = append(replies, f.opcode)
+			}
+			if len(replies) != len(tt.replies) || len(replies) > 0 && replies[0] != tt.replies[0] {
+				t.Errorf("server replied with frames %v, want %v", replies, tt.replies)
+			}
+			if fc.closed {
+				t.Error("connection closed")
+			}
+		})
+	}
+}
+
+func TestReadMessagePong(t *testing.T) {
+	c, fc := newTestConn(0, clientFrame(true, PingMessage, []byte("данные")), clientFrame(true, TextMessage, []byte("a")))
+	if _, _, err := c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	frames := readServerFrames(t, fc.out.Bytes())
+	if len(frames) != 1 || frames[0].opcode != PongMessage || string(frames[0].payload) != "данные" {
+		t.Errorf("reply = %+v, want pong with the ping payload", frames)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	reserved := clientFrame(true, TextMessage, []byte("a"))
+	reserved[0] |= 0x40
+	negative := binary.BigEndian.AppendUint64([]byte{0x82, 0x80 | 127}, 1<<63)
+
+	tests := []struct {
+		name    string
+		maxSize int64
+		frames  [][]byte
+		// wantErr - ожидаемая ошибка; если nil, проверяется только код закрытия.
+		wantErr error
+		// wantCode - код в кадре закрытия, 0 - сервер не закрывает соединение.
+		wantCode int
+	}{
+		{"unmasked frame", 0, [][]byte{rawFrame(true, TextMessage, []byte("a"), nil)}, nil, CloseProtocolError},
+		{"reserved bits", 0, [][]byte{reserved}, nil, CloseProtocolError},
+		{"negative length", 0, [][]byte{negative}, nil, CloseProtocolError},
+		{"unknown opcode", 0, [][]byte{clientFrame(true, 3, nil)}, nil, CloseProtocolError},
+		{"unexpected continuation", 0, [][]byte{clientFrame(true, continuationFrame, []byte("a"))}, nil, CloseProtocolError},
+		{"new message inside fragmented", 0, [][]byte{
+			clientFrame(false, TextMessage, []byte("a")),
+			clientFrame(true, TextMessage, []byte("b")),
+		}, nil, CloseProtocolError},
+		{"long control frame", 0, [][]byte{clientFrame(true, PingMessage, bytes.Repeat([]byte("p"), 126))}, nil, CloseProtocolError},
+		{"fragmented control frame", 0, [][]byte{clientFrame(false, PingMessage, []byte("p"))}, nil, CloseProtocolError},
+		{"invalid UTF-8", 0, [][]byte{clientFrame(true, TextMessage, []byte{0xff, 0xfe})}, nil, CloseInvalidData},
+		{"frame too big", 4, [][]byte{clientFrame(true, BinaryMessage, []byte("12345"))}, ErrTooBig, CloseTooBig},
+		{"message too big", 4, [][]byte{
+			clientFrame(false, BinaryMessage, []byte("123")),
+			clientFrame(true, continuationFrame, []byte("45")),
+		}, ErrTooBig, CloseTooBig},
+		{"close", 0, [][]byte{clientFrame(true, CloseMessage, binary.BigEndian.AppendUint16(nil, CloseGoingAway))}, ErrClosed, CloseGoingAway},
+		{"close without code", 0, [][]byte{clientFrame(true, CloseMessage, nil)}, ErrClosed, CloseNormal},
+		{"truncated frame", 0, [][]byte{clientFrame(true, TextMessage, []byte("abc"))[:5]}, io.ErrUnexpectedEOF, 0},
+		{"no frames", 0, nil, io.EOF, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fc := newTestConn(tt.maxSize, tt.frames...)
+			_, _, err := c.ReadMessage()
+			if err == nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadMessage: err = %v, want %v", err, tt.wantErr)
+			}
+			frames := readServerFrames(t, fc.out.Bytes())
+			if tt.wantCode == 0 {
+				if len(frames) != 0 || fc.closed {
+					t.Errorf("server sent %+v and closed = %v, want nothing", frames, fc.closed)
+				}
+				return
+			}
+			if len(frames) != 1 || closeCode(frames[0]) != tt.wantCode {
+				t.Errorf("server sent %+v, want a close frame with code %d", frames, tt.wantCode)
+			}
+			if !fc.closed {
+				t.Error("connection not closed")
+			}
+			if err := c.WriteMessage(TextMessage, []byte("a")); !errors.Is(err, ErrClosed) {
+				t.Errorf("WriteMessage after close: err = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	for _, n := range []int{0, 1, 125, 126, 0xffff, 0x10000} {
+		c, fc := newTestConn(0)
+		data := bytes.Repeat([]byte("z"), n)
+		if err := c.WriteMessage(BinaryMessage, data); err != nil {
+			t.Fatalf("WriteMessage(%d bytes): %v", n, err)
+		}
+		frames := readServerFrames(t, fc.out.Bytes())
+		if len(frames) != 1 || frames[0].opcode != BinaryMessage || !bytes.Equal(frames[0].payload, data) {
+			t.Errorf("WriteMessage(%d bytes) wrote an unexpected frame", n)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, fc := newTestConn(0)
+	reason := strings.Repeat("r", 200)
+	if err := c.Close(ClosePolicyViolation, reason); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(CloseNormal, ""); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	frames := readServerFrames(t, fc.out.Bytes())
+	if len(frames) != 1 || closeCode(frames[0]) != ClosePolicyViolation {
+		t.Fatalf("frames = %+v, want one close frame", frames)
+	}
+	// Управляющий кадр не длиннее 125 байт: причина обрезается.
+	if got := string(frames[0].payload[2:]); got != reason[:123] {
+		t.Errorf("close reason has %d bytes, want 123", len(got))
+	}
+	if !fc.closed {
+		t.Error("connection not closed")
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		host   string
+		want   bool
+	}{
+		{"", "notes.example.com", true},
+		{"https://notes.example.com", "notes.example.com", true},
+		{"https://NOTES.example.com", "notes.example.com", true},
+		{"http://localhost:3000", "localhost:3000", true},
+		{"http://localhost:3000", "localhost:8080", false},
+		{"https://evil.example.com", "notes.example.com", false},
+		{"null", "notes.example.com", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := SameOrigin(r); got != tt.want {
+			t.Errorf("SameOrigin(origin %q, host %q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+		}
+	}
+}
+
+// handshake отправляет запрос на подключение WebSocket и возвращает соединение и ответ сервера.
+func handshake(t *testing.T, srv *httptest.Server, header http.Header) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	req.Header = header
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestUpgrade(t *testing.T) {
+	u := &Upgrader{MaxMessageSize: 1024, ReadTimeout: 5 * time.Second}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := u.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close(CloseNormal, "")
+		typ, data, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.WriteMessage(typ, data)
+	}))
+	defer srv.Close()
+
+	valid := func() http.Header {
+		return http.Header{
+			"Connection":            {"keep-alive, Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			// Пример из RFC 6455, раздел 1.3.
+			"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(http.Header)
+		want   int
+	}{
+		{"no upgrade header", func(h http.Header) { h.Del("Upgrade") }, http.StatusUpgradeRequired},
+		{"no connection header", func(h http.Header) { h.Set("Connection", "keep-alive") }, http.StatusUpgradeRequired},
+		{"old version", func(h http.Header) { h.Set("Sec-Websocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"invalid key", func(h http.Header) { h.Set("Sec-Websocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+		{"foreign origin", func(h http.Header) { h.Set("Origin", "https://evil.example.com") }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := valid()
+			tt.modify(h)
+			_, _, resp := handshake(t, srv, h)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	conn, br, resp := handshake(t, srv, valid())
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-Websocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+	if _, err := conn.Write(clientFrame(true, TextMessage, []byte("эхо"))); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := readServerFrames(t, data)
+	if len(frames) != 2 || frames[0].opcode != TextMessage || string(frames[0].payload) != "эхо" || closeCode(frames[1]) != CloseNormal {
+		t.Errorf("server frames = %+v, want the echo and a close frame", frames)
+	}
+}